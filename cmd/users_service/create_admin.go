@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/roles"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+const createAdminCommand = "create-admin"
+
+// adminPasswordEnv переменная окружения с паролем администратора.
+// Если не задана, пароль читается из первой строки stdin, что б он не попадал в историю shell и список процессов
+const adminPasswordEnv = "ADMIN_PASSWORD"
+
+// runCreateAdmin выполняет подкоманду create-admin и возвращает код выхода
+//
+// Пример: echo "$PASSWORD" | users_service create-admin --email admin@example.com
+//
+// С --org администратор создаётся в организации с этим названием, организация создаётся, если её ещё нет:
+// echo "$PASSWORD" | users_service create-admin --email admin@acme.example --org Acme
+func runCreateAdmin(args []string, stdin io.Reader, userRepository users_db.UserRepository, organizationRepository organizations_db.OrganizationRepository, auditRepository audit_db.AuditRepository, logger *slog.Logger) int {
+	flags := flag.NewFlagSet(createAdminCommand, flag.ContinueOnError)
+	email := flags.String("email", "", "email администратора (обязательно)")
+	firstName := flags.String("first-name", "Admin", "имя администратора")
+	lastName := flags.String("last-name", "Admin", "фамилия администратора")
+	phone := flags.String("phone", "70000000000", "телефон администратора")
+	organization := flags.String("org", "", "название организации администратора, создаётся, если её нет (по умолчанию - организация по умолчанию)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "create-admin: --email is required")
+		flags.Usage()
+		return 2
+	}
+
+	password, err := readAdminPassword(stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "create-admin:", err)
+		return 1
+	}
+
+	// Без --org администратор создаётся системным вызовом в организации по умолчанию
+	ctx, cancel := context.WithTimeout(tenant.WithSystem(context.Background()), 30*time.Second)
+	defer cancel()
+
+	if *organization != "" {
+		organizationId, err := roles.EnsureOrganization(logger, organizationRepository, auditRepository, ctx, *organization)
+		if err != nil {
+			if errors.Is(err, roles.ErrInvalidOrganization) {
+				fmt.Fprintln(os.Stderr, "create-admin: invalid --org:", err)
+				return 2
+			}
+			fmt.Fprintln(os.Stderr, "create-admin: failed to create organization:", err)
+			return 1
+		}
+		// Поиск и создание администратора ограничиваются этой организацией
+		ctx = tenant.WithID(ctx, organizationId)
+	}
+
+	id, changed, err := roles.EnsureAdmin(logger, userRepository, auditRepository, ctx, create_user.UserCreate{
+		FirstName: *firstName,
+		LastName:  *lastName,
+		Email:     *email,
+		Password:  password,
+		Phone:     *phone,
+	})
+	if err != nil {
+		if errors.Is(err, roles.ErrInvalidAdmin) {
+			fmt.Fprintln(os.Stderr, "create-admin: invalid admin data (the password must meet the password policy):", err)
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, "create-admin:", err)
+		return 1
+	}
+	if changed {
+		fmt.Printf("admin %s is ready (id %d)\n", *email, id)
+	} else {
+		fmt.Printf("admin %s already exists (id %d), nothing changed\n", *email, id)
+	}
+	return 0
+}
+
+func readAdminPassword(stdin io.Reader) (string, error) {
+	if password, ok := os.LookupEnv(adminPasswordEnv); ok {
+		return password, nil
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password is empty: pass it on stdin or in %s", adminPasswordEnv)
+	}
+	return password, nil
+}
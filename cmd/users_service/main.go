@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"github.com/ShlykovPavel/booker_microservice/internal/config"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/login_guard"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/passwords"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/change_booking_status"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/create_booking"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/delete_booking"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/get_booking_by_booking_entity"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/get_booking_by_id"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/get_booking_by_time"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/get_booking_status_history"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/get_my_booking"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/update_booking"
 	create_bookingEntity_handler "github.com/ShlykovPavel/booker_microservice/internal/server/booking_entities_handlers/create"
@@ -22,18 +33,79 @@ import (
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking_type_handlers/get_booking_types_list_handler"
 	get_bookingType_by_id_handler "github.com/ShlykovPavel/booker_microservice/internal/server/booking_type_handlers/get_by_id"
 	"github.com/ShlykovPavel/booker_microservice/internal/server/booking_type_handlers/update_booking_type"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/delegations/create_delegation"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/delegations/delete_delegation"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/delegations/list_delegations"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/booking_groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/create_group"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/delete_group"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/get_group"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/group_members"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/list_groups"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/login_attempts"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/token_denylist"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/admin/impersonate"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/api_keys/create_api_key"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/api_keys/list_api_keys"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/api_keys/revoke_api_key"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/forgot_password"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/jwks"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/logout"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/oidc_login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/refresh_token"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/reset_password"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/verify_email"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/organizations/create_organization"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/create_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/delete_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/get_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/list_scim_users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/patch_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/replace_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/activate_user"
 	users "github.com/ShlykovPavel/booker_microservice/user_service/server/users/create"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/deactivate_user"
 	users_delete "github.com/ShlykovPavel/booker_microservice/user_service/server/users/delete"
 	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/get_user"
 	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/get_user/get_user_list"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/change_password"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/confirm_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/disable_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/enroll_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/get_me"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/list_sessions"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/resend_verification"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/terminate_session"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/update_me"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/purge_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/roles"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/terminate_sessions"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/unlock_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/update_role"
 	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/update_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/identities_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/password_reset_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"log"
 	"log/slog"
 	"net/http"
@@ -46,12 +118,26 @@ const (
 	envProd  = "prod"
 )
 
+const (
+	denylistStoragePostgres = "postgres"
+	denylistStorageMemory   = "memory"
+)
+
+const (
+	loginAttemptStoragePostgres = "postgres"
+	loginAttemptStorageMemory   = "memory"
+)
+
+const (
+	mailerSMTP = "smtp"
+	mailerLog  = "log"
+)
+
 func main() {
 	cfg, err := config.LoadConfig(".env")
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(cfg)
 	logger := setupLogger(cfg.Env)
 	logger.Info("Starting application")
 	logger.Debug("Debug messages enabled")
@@ -69,6 +155,53 @@ func main() {
 	bookerTypeRepository := booking_type_db.NewBookingTypeRepository(poll, logger)
 	bookerEntityRepository := booking_entity_db.NewBookingEntityRepository(poll, logger)
 	bookingRepository := booking_db.NewBookingRepository(poll, logger)
+	refreshTokenRepository := refresh_tokens_db.NewRefreshTokenRepository(poll, logger)
+	permissionRepository := permissions_db.NewPermissionRepository(poll, logger)
+	passwordResetRepository := password_reset_db.NewPasswordResetRepository(poll, logger)
+	emailVerificationRepository := email_verification_db.NewEmailVerificationRepository(poll, logger)
+	auditRepository := audit_db.NewAuditRepository(poll, logger)
+	mfaRepository := mfa_db.NewMFARepository(poll, logger)
+	apiKeyRepository := api_keys_db.NewAPIKeyRepository(poll, logger)
+	sessionRepository := sessions_db.NewSessionRepository(poll, logger)
+	identityRepository := identities_db.NewIdentityRepository(poll, logger)
+	groupRepository := groups_db.NewGroupRepository(poll, logger)
+	delegationRepository := delegations_db.NewDelegationRepository(poll, logger)
+	organizationRepository := organizations_db.NewOrganizationRepository(poll, logger)
+	tokenDenylist := setupTokenDenylist(cfg.TokenDenylistStorage, poll, logger)
+	mail := setupMailer(cfg, logger)
+	loginGuard := login_guard.NewGuard(setupLoginAttemptStore(cfg.LoginAttemptStorage, poll, logger), login_guard.Settings{
+		MaxAccountFailures: cfg.LoginMaxFailures,
+		MaxIPFailures:      cfg.LoginMaxIPFailures,
+		BaseLockout:        cfg.LoginBaseLockout,
+		MaxLockout:         cfg.LoginMaxLockout,
+		FailureWindow:      cfg.LoginFailureWindow,
+	}, logger)
+
+	setupPasswords(cfg, logger)
+
+	// Подкоманда create-admin создаёт первого администратора и завершает процесс, сервер не запускается
+	if len(os.Args) > 1 && os.Args[1] == createAdminCommand {
+		os.Exit(runCreateAdmin(os.Args[2:], os.Stdin, userRepository, organizationRepository, auditRepository, logger))
+	}
+
+	// Ключи подписи JWT. JWT_KEYS задаётся как kid:путь_к_pem,kid2:путь_к_pem2.
+	// Токены HS256 при активном асимметричном ключе принимаются только с JWT_LEGACY_HMAC=true
+	keySet, err := jwt_tokens.LoadKeySet(cfg.JWTKeys, cfg.JWTActiveKeyID, cfg.JWTSecretKey, cfg.JWTLegacyHMAC)
+	if err != nil {
+		logger.Error("failed to load jwt keys", "error", err.Error())
+		os.Exit(1)
+	}
+	tokenSettings := jwt_tokens.TokenSettings{
+		Keys:            keySet,
+		AccessTokenTTL:  cfg.JWTDuration,
+		RefreshTokenTTL: cfg.RefreshTokenDuration,
+	}
+	mfaSettings := totp.Settings{
+		Issuer:        cfg.MFAIssuer,
+		RequiredRoles: cfg.MFARequiredRoles,
+		ChallengeTTL:  cfg.MFAChallengeTTL,
+		MaxAttempts:   cfg.MFAMaxAttempts,
+	}
 
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
@@ -76,34 +209,98 @@ func main() {
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
 
-	router.Post("/register", users.CreateUser(logger, userRepository, cfg.ServerTimeout))
-	router.Get("/users/{id}", get_user.GetUserById(logger, userRepository, cfg.ServerTimeout))
-	router.Get("/users", get_user_list.GetUserList(logger, userRepository, cfg.ServerTimeout))
-	router.Put("/users/{id}", update_user.UpdateUserHandler(logger, userRepository, cfg.ServerTimeout))
-	router.Delete("/users/{id}", users_delete.DeleteUserHandler(logger, userRepository, cfg.ServerTimeout))
-
-	router.Post("/bookingType", create_bookingType.CreateBookingTypeHandler(logger, bookerTypeRepository, cfg.ServerTimeout))
-	router.Get("/bookingType/{id}", get_bookingType_by_id_handler.GetBookingTypeByIdHandler(logger, bookerTypeRepository, cfg.ServerTimeout))
-	router.Get("/bookingType", get_booking_types_list_handler.GetBookingTypesListHandler(logger, bookerTypeRepository, cfg.ServerTimeout))
-	router.Put("/bookingType/{id}", update_booking_type.UpdateBookingTypeHandler(logger, bookerTypeRepository, cfg.ServerTimeout))
-	router.Delete("/bookingType/{id}", delete_booking_type.DeleteBookingTypeHandler(logger, bookerTypeRepository, cfg.ServerTimeout))
-
-	router.Post("/bookingEntity", create_bookingEntity_handler.CreateBookingEntityHandler(logger, bookerTypeRepository, bookerEntityRepository, cfg.ServerTimeout))
-	router.Get("/bookingEntity/{id}", get_bookingEntity_by_id_handler.GetBookingEntityByIdHandler(logger, bookerEntityRepository, cfg.ServerTimeout))
-	router.Get("/bookingEntity", get_booking_entities_list_handler.GetBookingEntitiesListHandler(logger, bookerEntityRepository, cfg.ServerTimeout))
-	router.Put("/bookingEntity/{id}", update_booking_entity.UpdateBookingEntityHandler(logger, bookerTypeRepository, bookerEntityRepository, cfg.ServerTimeout))
-	router.Delete("/bookingEntity/{id}", delete_booking_entity.DeleteBookingEntityHandler(logger, bookerEntityRepository, cfg.ServerTimeout))
-
-	router.Group(func(r chi.Router) {
-		r.Use(middlewares.AuthMiddleware(cfg.JWTSecretKey, logger))
-		r.Post("/booking", create_booking.CreateBookingHandler(logger, bookingRepository, cfg.ServerTimeout))
-		r.Get("/bookings/my", get_my_booking.GetMyBookingsHandler(logger, bookingRepository, cfg.ServerTimeout))
-	})
-	router.Get("/bookings", get_booking_by_time.GetBookingByTimeHandler(logger, bookingRepository, cfg.ServerTimeout))
-	router.Get("/bookingEntity/{id}/bookings", get_booking_by_booking_entity.GetMyBookingsHandler(logger, bookingRepository, cfg.ServerTimeout))
-	router.Get("/booking/{id}", get_booking_by_id.GetBookingByIdHandler(logger, bookingRepository, cfg.ServerTimeout))
-	router.Put("/booking/{id}", update_booking.UpdateBookingHandler(logger, bookingRepository, cfg.ServerTimeout))
-	router.Delete("/booking/{id}", delete_booking.DeleteBookingHandler(logger, bookingRepository, cfg.ServerTimeout))
+	routes := []route{
+		{Method: http.MethodPost, Pattern: "/register", Handler: users.CreateUser(logger, userRepository, emailVerificationRepository, mail, cfg.EmailVerificationTTL, cfg.EmailVerificationURL, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodGet, Pattern: "/verify-email", Handler: verify_email.VerifyEmailHandler(logger, emailVerificationRepository, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodPost, Pattern: "/login", Handler: login.LoginHandler(logger, userRepository, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, loginGuard, tokenSettings, mfaSettings, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodPost, Pattern: "/login/2fa", Handler: login_mfa.LoginMFAHandler(logger, userRepository, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, loginGuard, tokenSettings, mfaSettings, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodGet, Pattern: "/.well-known/jwks.json", Handler: jwks.JWKSHandler(logger, keySet), Public: true},
+		{Method: http.MethodPost, Pattern: "/token/refresh", Handler: refresh_token.RefreshTokenHandler(logger, userRepository, refreshTokenRepository, sessionRepository, permissionRepository, tokenSettings, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodPost, Pattern: "/password/forgot", Handler: forgot_password.ForgotPasswordHandler(logger, userRepository, passwordResetRepository, mail, cfg.PasswordResetTTL, cfg.PasswordResetURL, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodPost, Pattern: "/password/reset", Handler: reset_password.ResetPasswordHandler(logger, userRepository, passwordResetRepository, refreshTokenRepository, cfg.ServerTimeout), Public: true},
+		{Method: http.MethodPost, Pattern: "/logout", Handler: logout.LogoutHandler(logger, tokenDenylist, refreshTokenRepository, cfg.ServerTimeout)},
+
+		{Method: http.MethodGet, Pattern: "/users/me", Handler: get_me.GetMeHandler(logger, userRepository, cfg.ServerTimeout)},
+		{Method: http.MethodPatch, Pattern: "/users/me", Handler: update_me.UpdateMeHandler(logger, userRepository, cfg.ServerTimeout)},
+		{Method: http.MethodPost, Pattern: "/users/me/password", Handler: change_password.ChangePasswordHandler(logger, userRepository, refreshTokenRepository, cfg.ServerTimeout), NoImpersonation: true},
+		{Method: http.MethodPost, Pattern: "/users/me/verify-email/resend", Handler: resend_verification.ResendVerificationHandler(logger, userRepository, emailVerificationRepository, mail, cfg.EmailVerificationTTL, cfg.EmailVerificationURL, cfg.EmailResendInterval, cfg.ServerTimeout), NoImpersonation: true},
+		{Method: http.MethodPost, Pattern: "/users/me/2fa/enroll", Handler: enroll_mfa.EnrollMFAHandler(logger, userRepository, mfaRepository, mfaSettings, cfg.ServerTimeout), NoImpersonation: true},
+		{Method: http.MethodPost, Pattern: "/users/me/2fa/confirm", Handler: confirm_mfa.ConfirmMFAHandler(logger, mfaRepository, cfg.ServerTimeout), NoImpersonation: true},
+		{Method: http.MethodDelete, Pattern: "/users/me/2fa", Handler: disable_mfa.DisableMFAHandler(logger, userRepository, mfaRepository, mfaSettings, cfg.ServerTimeout), NoImpersonation: true},
+		{Method: http.MethodGet, Pattern: "/users/me/sessions", Handler: list_sessions.ListSessionsHandler(logger, sessionRepository, cfg.ServerTimeout)},
+		{Method: http.MethodDelete, Pattern: "/users/me/sessions/{id}", Handler: terminate_session.TerminateSessionHandler(logger, sessionRepository, refreshTokenRepository, cfg.ServerTimeout), NoImpersonation: true},
+		{Method: http.MethodGet, Pattern: "/users/{id}", Handler: get_user.GetUserById(logger, userRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserRead},
+		{Method: http.MethodGet, Pattern: "/users", Handler: get_user_list.GetUserList(logger, userRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserRead},
+		{Method: http.MethodPut, Pattern: "/users/{id}", Handler: update_user.UpdateUserHandler(logger, userRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+		{Method: http.MethodDelete, Pattern: "/users/{id}", Handler: users_delete.DeleteUserHandler(logger, userRepository, refreshTokenRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+		{Method: http.MethodDelete, Pattern: "/users/{id}/purge", Handler: purge_user.PurgeUserHandler(logger, userRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+		{Method: http.MethodPost, Pattern: "/users/{id}/deactivate", Handler: deactivate_user.DeactivateUserHandler(logger, userRepository, refreshTokenRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+		{Method: http.MethodPost, Pattern: "/users/{id}/activate", Handler: activate_user.ActivateUserHandler(logger, userRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+		{Method: http.MethodPut, Pattern: "/users/{id}/role", Handler: update_role.UpdateRoleHandler(logger, userRepository, permissionRepository, auditRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage, NoImpersonation: true},
+		{Method: http.MethodPost, Pattern: "/users/{id}/admin", Handler: roles.SetAdminRoleHandler(logger, userRepository, permissionRepository, auditRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage, NoImpersonation: true},
+		{Method: http.MethodDelete, Pattern: "/users/{id}/sessions", Handler: terminate_sessions.TerminateUserSessionsHandler(logger, userRepository, refreshTokenRepository, auditRepository, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+		{Method: http.MethodPost, Pattern: "/users/{id}/unlock", Handler: unlock_user.UnlockUserHandler(logger, userRepository, loginGuard, cfg.ServerTimeout), Permission: authorization.PermissionUserManage},
+
+		{Method: http.MethodPost, Pattern: "/admin/impersonate/{userId}", Handler: impersonate.ImpersonateHandler(logger, userRepository, permissionRepository, auditRepository, tokenSettings, cfg.ImpersonationTTL, cfg.ServerTimeout), Permission: authorization.PermissionUserImpersonate, NoImpersonation: true},
+		{Method: http.MethodPost, Pattern: "/organizations", Handler: create_organization.CreateOrganizationHandler(logger, organizationRepository, auditRepository, cfg.ServerTimeout), Permission: authorization.PermissionOrganizationManage, NoImpersonation: true},
+
+		{Method: http.MethodPost, Pattern: "/api-keys", Handler: create_api_key.CreateAPIKeyHandler(logger, apiKeyRepository, userRepository, permissionRepository, auditRepository, cfg.ServerTimeout), Permission: authorization.PermissionAPIKeyManage, NoImpersonation: true},
+		{Method: http.MethodGet, Pattern: "/api-keys", Handler: list_api_keys.ListAPIKeysHandler(logger, apiKeyRepository, cfg.ServerTimeout), Permission: authorization.PermissionAPIKeyManage},
+		{Method: http.MethodDelete, Pattern: "/api-keys/{id}", Handler: revoke_api_key.RevokeAPIKeyHandler(logger, apiKeyRepository, auditRepository, cfg.ServerTimeout), Permission: authorization.PermissionAPIKeyManage, NoImpersonation: true},
+
+		{Method: http.MethodPost, Pattern: "/groups", Handler: create_group.CreateGroupHandler(logger, groupRepository, cfg.ServerTimeout), Permission: authorization.PermissionGroupManage},
+		{Method: http.MethodGet, Pattern: "/groups", Handler: list_groups.ListGroupsHandler(logger, groupRepository, cfg.ServerTimeout), Permission: authorization.PermissionGroupManage},
+		{Method: http.MethodGet, Pattern: "/groups/{id}", Handler: get_group.GetGroupHandler(logger, groupRepository, cfg.ServerTimeout), Permission: authorization.PermissionGroupManage},
+		{Method: http.MethodDelete, Pattern: "/groups/{id}", Handler: delete_group.DeleteGroupHandler(logger, groupRepository, cfg.ServerTimeout), Permission: authorization.PermissionGroupManage},
+		{Method: http.MethodPut, Pattern: "/groups/{id}/members/{userId}", Handler: group_members.AddMemberHandler(logger, groupRepository, cfg.ServerTimeout), Permission: authorization.PermissionGroupManage},
+		{Method: http.MethodDelete, Pattern: "/groups/{id}/members/{userId}", Handler: group_members.RemoveMemberHandler(logger, groupRepository, cfg.ServerTimeout), Permission: authorization.PermissionGroupManage},
+
+		{Method: http.MethodPost, Pattern: "/bookingType", Handler: create_bookingType.CreateBookingTypeHandler(logger, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeWrite},
+		{Method: http.MethodGet, Pattern: "/bookingType/{id}", Handler: get_bookingType_by_id_handler.GetBookingTypeByIdHandler(logger, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeRead},
+		{Method: http.MethodGet, Pattern: "/bookingType", Handler: get_booking_types_list_handler.GetBookingTypesListHandler(logger, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeRead},
+		{Method: http.MethodPut, Pattern: "/bookingType/{id}", Handler: update_booking_type.UpdateBookingTypeHandler(logger, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeWrite},
+		{Method: http.MethodDelete, Pattern: "/bookingType/{id}", Handler: delete_booking_type.DeleteBookingTypeHandler(logger, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeWrite},
+		{Method: http.MethodGet, Pattern: "/bookingType/{id}/groups", Handler: booking_groups.GetBookingTypeGroupsHandler(logger, groupRepository, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeWrite},
+		{Method: http.MethodPut, Pattern: "/bookingType/{id}/groups", Handler: booking_groups.SetBookingTypeGroupsHandler(logger, groupRepository, bookerTypeRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingTypeWrite},
+
+		{Method: http.MethodPost, Pattern: "/bookingEntity", Handler: create_bookingEntity_handler.CreateBookingEntityHandler(logger, bookerTypeRepository, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityWrite},
+		{Method: http.MethodGet, Pattern: "/bookingEntity/{id}", Handler: get_bookingEntity_by_id_handler.GetBookingEntityByIdHandler(logger, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityRead},
+		{Method: http.MethodGet, Pattern: "/bookingEntity", Handler: get_booking_entities_list_handler.GetBookingEntitiesListHandler(logger, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityRead},
+		{Method: http.MethodPut, Pattern: "/bookingEntity/{id}", Handler: update_booking_entity.UpdateBookingEntityHandler(logger, bookerTypeRepository, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityWrite},
+		{Method: http.MethodDelete, Pattern: "/bookingEntity/{id}", Handler: delete_booking_entity.DeleteBookingEntityHandler(logger, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityWrite},
+		{Method: http.MethodGet, Pattern: "/bookingEntity/{id}/groups", Handler: booking_groups.GetBookingEntityGroupsHandler(logger, groupRepository, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityWrite},
+		{Method: http.MethodPut, Pattern: "/bookingEntity/{id}/groups", Handler: booking_groups.SetBookingEntityGroupsHandler(logger, groupRepository, bookerEntityRepository, cfg.ServerTimeout), Permission: authorization.PermissionEntityWrite},
+
+		{Method: http.MethodPost, Pattern: "/booking", Handler: create_booking.CreateBookingHandler(logger, bookingRepository, bookerEntityRepository, delegationRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodGet, Pattern: "/bookings/my", Handler: get_my_booking.GetMyBookingsHandler(logger, bookingRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingRead, VerifiedEmail: true},
+		{Method: http.MethodGet, Pattern: "/bookings", Handler: get_booking_by_time.GetBookingByTimeHandler(logger, bookingRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingRead, VerifiedEmail: true},
+		{Method: http.MethodGet, Pattern: "/bookingEntity/{id}/bookings", Handler: get_booking_by_booking_entity.GetMyBookingsHandler(logger, bookingRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingRead, VerifiedEmail: true},
+		{Method: http.MethodGet, Pattern: "/booking/{id}", Handler: get_booking_by_id.GetBookingByIdHandler(logger, bookingRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingRead, VerifiedEmail: true},
+		{Method: http.MethodPut, Pattern: "/booking/{id}", Handler: update_booking.UpdateBookingHandler(logger, bookingRepository, bookerEntityRepository, delegationRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodDelete, Pattern: "/booking/{id}", Handler: delete_booking.DeleteBookingHandler(logger, bookingRepository, delegationRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodPost, Pattern: "/booking/{id}/confirm", Handler: change_booking_status.ChangeBookingStatusHandler(logger, bookingRepository, delegationRepository, booking_service.StatusConfirmed, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodPost, Pattern: "/booking/{id}/check-in", Handler: change_booking_status.ChangeBookingStatusHandler(logger, bookingRepository, delegationRepository, booking_service.StatusCheckedIn, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodPost, Pattern: "/booking/{id}/complete", Handler: change_booking_status.ChangeBookingStatusHandler(logger, bookingRepository, delegationRepository, booking_service.StatusCompleted, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodPost, Pattern: "/booking/{id}/cancel", Handler: change_booking_status.ChangeBookingStatusHandler(logger, bookingRepository, delegationRepository, booking_service.StatusCancelled, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodPost, Pattern: "/booking/{id}/no-show", Handler: change_booking_status.ChangeBookingStatusHandler(logger, bookingRepository, delegationRepository, booking_service.StatusNoShow, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true},
+		{Method: http.MethodGet, Pattern: "/booking/{id}/history", Handler: get_booking_status_history.GetBookingStatusHistoryHandler(logger, bookingRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingRead, VerifiedEmail: true},
+
+		{Method: http.MethodGet, Pattern: "/delegations", Handler: list_delegations.ListDelegationsHandler(logger, delegationRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingRead, VerifiedEmail: true},
+		{Method: http.MethodPost, Pattern: "/delegations", Handler: create_delegation.CreateDelegationHandler(logger, delegationRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true, NoImpersonation: true},
+		{Method: http.MethodDelete, Pattern: "/delegations/{userId}", Handler: delete_delegation.DeleteDelegationHandler(logger, delegationRepository, cfg.ServerTimeout), Permission: authorization.PermissionBookingCreate, VerifiedEmail: true, NoImpersonation: true},
+	}
+	// Вход через SSO включается, если задан OIDC_ISSUER
+	if oidcProvider, cookieSettings := setupOIDC(cfg, logger); oidcProvider != nil {
+		routes = append(routes,
+			route{Method: http.MethodGet, Pattern: "/login/oidc", Handler: oidc_login.StartHandler(logger, oidcProvider, cookieSettings, cfg.ServerTimeout), Public: true},
+			route{Method: http.MethodGet, Pattern: "/login/oidc/callback", Handler: oidc_login.CallbackHandler(logger, oidcProvider, userRepository, identityRepository, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, auditRepository, cookieSettings, tokenSettings, mfaSettings, cfg.ServerTimeout), Public: true},
+		)
+	}
+	// Защищённые маршруты принимают и токен доступа, и API ключ в заголовке X-API-Key
+	authMiddleware := middlewares.APIKeyMiddleware(apiKeyRepository, logger, middlewares.AuthMiddleware(keySet, tokenDenylist, sessionRepository, logger))
+	impersonationAudit := middlewares.ImpersonationAudit(auditRepository, logger)
+	registerRoutes(router, routes, authMiddleware, impersonationAudit, cfg.RequireVerifiedEmail, logger)
+	registerSCIMRoutes(router, cfg, userRepository, refreshTokenRepository, logger)
 
 	logger.Info("Starting HTTP server", slog.String("adress", cfg.Address))
 	// Run server
@@ -121,6 +318,82 @@ func main() {
 	logger.Info("Stopped HTTP server")
 }
 
+// route Описание маршрута для таблицы маршрутов
+//
+// Public - маршрут доступен без токена. Иначе маршрут требует AuthMiddleware и,
+// если задан Permission, наличие этого разрешения у пользователя.
+// VerifiedEmail - маршрут требует подтверждённый email, если включено Config.RequireVerifiedEmail.
+// NoImpersonation - маршрут недоступен с токеном имперсонации (POST /admin/impersonate/{userId})
+type route struct {
+	Method          string
+	Pattern         string
+	Handler         http.HandlerFunc
+	Public          bool
+	Permission      string
+	VerifiedEmail   bool
+	NoImpersonation bool
+}
+
+// registerRoutes регистрирует маршруты из таблицы, навешивая на защищённые маршруты проверку токена и разрешений
+//
+// Изменяющие запросы под имперсонацией записываются в журнал аудита через impersonationAudit,
+// в том числе отклонённые проверками разрешений. Публичные маршруты выполняются как системные вызовы
+// (middlewares.SystemTenantMiddleware), защищённые ограничиваются организацией пользователя из токена
+func registerRoutes(router chi.Router, routes []route, authMiddleware func(http.Handler) http.Handler, impersonationAudit func(http.Handler) http.Handler, requireVerifiedEmail bool, logger *slog.Logger) {
+	for _, rt := range routes {
+		if rt.Public {
+			router.Method(rt.Method, rt.Pattern, middlewares.SystemTenantMiddleware(rt.Handler))
+			continue
+		}
+		handler := http.Handler(rt.Handler)
+		if rt.VerifiedEmail && requireVerifiedEmail {
+			handler = middlewares.RequireVerifiedEmail(logger)(handler)
+		}
+		if rt.Permission != "" {
+			handler = middlewares.RequirePermission(logger, rt.Permission)(handler)
+		}
+		if rt.NoImpersonation {
+			handler = middlewares.BlockImpersonation(logger)(handler)
+		}
+		router.Method(rt.Method, rt.Pattern, authMiddleware(impersonationAudit(handler)))
+	}
+}
+
+// registerSCIMRoutes регистрирует SCIM 2.0 ресурс пользователей, если задан SCIM_TOKEN
+//
+// Маршруты защищены только выделенным токеном SCIM, без AuthMiddleware, и ограничены организацией SCIM_TENANT_ID
+func registerSCIMRoutes(router chi.Router, cfg *config.Config, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, logger *slog.Logger) {
+	if cfg.SCIMToken == "" {
+		return
+	}
+	policy := users_db.BookingPolicy(cfg.SCIMBookingPolicy)
+	if policy != users_db.BookingPolicyCancel && policy != users_db.BookingPolicyKeep {
+		logger.Error("SCIM_BOOKING_POLICY must be cancel or keep", "policy", cfg.SCIMBookingPolicy)
+		os.Exit(1)
+	}
+	if len(cfg.SCIMToken) < 32 {
+		logger.Warn("SCIM_TOKEN is shorter than 32 characters")
+	}
+	if cfg.SCIMTenantID <= 0 {
+		logger.Error("SCIM_TENANT_ID must be a positive organization id", "tenant_id", cfg.SCIMTenantID)
+		os.Exit(1)
+	}
+	scimAuth := middlewares.SCIMTokenMiddleware(cfg.SCIMToken, logger)
+	scimTenant := middlewares.TenantMiddleware(cfg.SCIMTenantID)
+
+	routes := []route{
+		{Method: http.MethodPost, Pattern: scim.UsersPath, Handler: create_scim_user.CreateSCIMUserHandler(logger, userRepository, cfg.ServerTimeout)},
+		{Method: http.MethodGet, Pattern: scim.UsersPath, Handler: list_scim_users.ListSCIMUsersHandler(logger, userRepository, cfg.ServerTimeout)},
+		{Method: http.MethodGet, Pattern: scim.UsersPath + "/{id}", Handler: get_scim_user.GetSCIMUserHandler(logger, userRepository, cfg.ServerTimeout)},
+		{Method: http.MethodPut, Pattern: scim.UsersPath + "/{id}", Handler: replace_scim_user.ReplaceSCIMUserHandler(logger, userRepository, refreshTokenRepository, policy, cfg.ServerTimeout)},
+		{Method: http.MethodPatch, Pattern: scim.UsersPath + "/{id}", Handler: patch_scim_user.PatchSCIMUserHandler(logger, userRepository, refreshTokenRepository, policy, cfg.ServerTimeout)},
+		{Method: http.MethodDelete, Pattern: scim.UsersPath + "/{id}", Handler: delete_scim_user.DeleteSCIMUserHandler(logger, userRepository, refreshTokenRepository, policy, cfg.ServerTimeout)},
+	}
+	for _, rt := range routes {
+		router.Method(rt.Method, rt.Pattern, scimAuth(scimTenant(rt.Handler)))
+	}
+}
+
 func setupLogger(env string) *slog.Logger {
 	var logger *slog.Logger
 	switch env {
@@ -136,3 +409,120 @@ func setupLogger(env string) *slog.Logger {
 	}
 	return logger
 }
+
+func setupTokenDenylist(storage string, poll *pgxpool.Pool, logger *slog.Logger) token_denylist.TokenDenylist {
+	switch storage {
+	case denylistStorageMemory:
+		logger.Warn("Using in-memory token denylist, revoked tokens are not shared between replicas")
+		return token_denylist.NewInMemoryDenylist()
+	case denylistStoragePostgres:
+		return token_denylist.NewPostgresDenylist(poll, logger)
+	default:
+		logger.Error("unknown token denylist storage", "storage", storage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+func setupLoginAttemptStore(storage string, poll *pgxpool.Pool, logger *slog.Logger) login_attempts.AttemptStore {
+	switch storage {
+	case loginAttemptStorageMemory:
+		logger.Warn("Using in-memory login attempt store, failed logins are not shared between replicas")
+		return login_attempts.NewInMemoryStore()
+	case loginAttemptStoragePostgres:
+		return login_attempts.NewPostgresStore(poll, logger)
+	default:
+		logger.Error("unknown login attempt storage", "storage", storage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// setupPasswords настраивает алгоритм хеширования паролей и политику паролей
+//
+// Хеши, созданные с другими параметрами, продолжают проверяться и перехешируются при входе пользователя
+func setupPasswords(cfg *config.Config, logger *slog.Logger) {
+	hasher, err := passwords.NewHasher(passwords.Params{
+		Algorithm:         cfg.PasswordHashAlgorithm,
+		Argon2Memory:      cfg.Argon2Memory,
+		Argon2Iterations:  cfg.Argon2Iterations,
+		Argon2Parallelism: cfg.Argon2Parallelism,
+		BcryptCost:        cfg.BcryptCost,
+	})
+	if err != nil {
+		logger.Error("invalid password hash settings", "error", err.Error())
+		os.Exit(1)
+	}
+	passwords.SetDefault(hasher)
+
+	var banned []string
+	if cfg.PasswordBannedFile != "" {
+		banned, err = validation.LoadBannedPasswords(cfg.PasswordBannedFile)
+		if err != nil {
+			logger.Error("failed to load banned passwords", "error", err.Error())
+			os.Exit(1)
+		}
+	}
+	// bcrypt не принимает пароли длиннее 72 байт
+	maxBytes := 0
+	if cfg.PasswordHashAlgorithm == passwords.AlgorithmBcrypt {
+		maxBytes = 72
+	}
+	validation.SetPasswordPolicy(validation.NewPasswordPolicy(cfg.PasswordMinLength, cfg.PasswordMaxLength, maxBytes, banned))
+}
+
+// setupOIDC создаёт клиент провайдера OpenID Connect. Возвращает nil, если вход через SSO не настроен
+//
+// Без OIDC_STATE_SECRET ключ подписи cookie генерируется при запуске, тогда вход, начатый на другой реплике
+// или до перезапуска, завершить нельзя
+func setupOIDC(cfg *config.Config, logger *slog.Logger) (*oidc.Provider, oidc_login.CookieSettings) {
+	if cfg.OIDCIssuer == "" {
+		return nil, oidc_login.CookieSettings{}
+	}
+	if cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "" {
+		logger.Error("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+		os.Exit(1)
+	}
+	roleMapping, err := oidc.ParseRoleMapping(cfg.OIDCRoleMapping)
+	if err != nil {
+		logger.Error("invalid oidc role mapping", "error", err.Error())
+		os.Exit(1)
+	}
+	stateKey := []byte(cfg.OIDCStateSecret)
+	if len(stateKey) == 0 {
+		logger.Warn("OIDC_STATE_SECRET is not set, using random key, sso logins are not shared between replicas")
+		secret, err := secure_tokens.Generate()
+		if err != nil {
+			logger.Error("failed to generate oidc state key", "error", err.Error())
+			os.Exit(1)
+		}
+		stateKey = []byte(secret)
+	}
+	provider := oidc.NewProvider(oidc.Settings{
+		Issuer:        cfg.OIDCIssuer,
+		ClientID:      cfg.OIDCClientID,
+		ClientSecret:  cfg.OIDCClientSecret,
+		RedirectURL:   cfg.OIDCRedirectURL,
+		Scopes:        cfg.OIDCScopes,
+		GroupsClaim:   cfg.OIDCGroupsClaim,
+		RoleMapping:   roleMapping,
+		DefaultRole:   cfg.OIDCDefaultRole,
+		StateTTL:      cfg.OIDCStateTTL,
+		AutoProvision: cfg.OIDCAutoProvision,
+	}, nil)
+	return provider, oidc_login.CookieSettings{Key: stateKey, Secure: cfg.OIDCCookieSecure}
+}
+
+func setupMailer(cfg *config.Config, logger *slog.Logger) mailer.Mailer {
+	switch cfg.Mailer {
+	case mailerSMTP:
+		return mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom, logger)
+	case mailerLog:
+		logger.Warn("Using log mailer, emails are written to the log and not sent")
+		return mailer.NewLogMailer(logger)
+	default:
+		logger.Error("unknown mailer", "mailer", cfg.Mailer)
+		os.Exit(1)
+	}
+	return nil
+}
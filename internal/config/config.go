@@ -8,16 +8,67 @@ import (
 
 // Config представляет конфигурацию приложения
 type Config struct {
-	Env           string        `yaml:"ENV" env:"ENV" env-default:"production"`
-	Address       string        `yaml:"address" env:"ADDRESS" env-default:"localhost:8080"`
-	DbHost        string        `yaml:"db_host" env:"DB_HOST" env-required:"true" `
-	DbPort        string        `yaml:"db_port" env:"DB_PORT" env-required:"true"`
-	DbName        string        `yaml:"db_name" env:"DB_NAME" env-required:"true"`
-	DbUser        string        `yaml:"db_user" env:"DB_USER" env-required:"true"`
-	DbPassword    string        `yaml:"db_password" env:"DB_PASSWORD" env-required:"true"`
-	JWTSecretKey  string        `yaml:"jwt_secret_key" env:"JWT_SECRET_KEY" env-required:"true"`
-	JWTDuration   time.Duration `yaml:"jwt_duration"  env:"JWT_DURATION" env-default:"5m"`
-	ServerTimeout time.Duration `yaml:"server_timeout" env:"SERVER_TIMEOUT" env-default:"10s"`
+	Env                   string            `yaml:"ENV" env:"ENV" env-default:"production"`
+	Address               string            `yaml:"address" env:"ADDRESS" env-default:"localhost:8080"`
+	DbHost                string            `yaml:"db_host" env:"DB_HOST" env-required:"true" `
+	DbPort                string            `yaml:"db_port" env:"DB_PORT" env-required:"true"`
+	DbName                string            `yaml:"db_name" env:"DB_NAME" env-required:"true"`
+	DbUser                string            `yaml:"db_user" env:"DB_USER" env-required:"true"`
+	DbPassword            string            `yaml:"db_password" env:"DB_PASSWORD" env-required:"true"`
+	JWTSecretKey          string            `yaml:"jwt_secret_key" env:"JWT_SECRET_KEY"`
+	JWTKeys               map[string]string `yaml:"jwt_keys" env:"JWT_KEYS"`
+	JWTActiveKeyID        string            `yaml:"jwt_active_key_id" env:"JWT_ACTIVE_KEY_ID"`
+	JWTLegacyHMAC         bool              `yaml:"jwt_legacy_hmac" env:"JWT_LEGACY_HMAC" env-default:"false"`
+	JWTDuration           time.Duration     `yaml:"jwt_duration"  env:"JWT_DURATION" env-default:"5m"`
+	RefreshTokenDuration  time.Duration     `yaml:"refresh_token_duration" env:"REFRESH_TOKEN_DURATION" env-default:"720h"`
+	ServerTimeout         time.Duration     `yaml:"server_timeout" env:"SERVER_TIMEOUT" env-default:"10s"`
+	TokenDenylistStorage  string            `yaml:"token_denylist_storage" env:"TOKEN_DENYLIST_STORAGE" env-default:"postgres"`
+	LoginAttemptStorage   string            `yaml:"login_attempt_storage" env:"LOGIN_ATTEMPT_STORAGE" env-default:"postgres"`
+	LoginMaxFailures      int               `yaml:"login_max_failures" env:"LOGIN_MAX_FAILURES" env-default:"5"`
+	LoginMaxIPFailures    int               `yaml:"login_max_ip_failures" env:"LOGIN_MAX_IP_FAILURES" env-default:"50"`
+	LoginFailureWindow    time.Duration     `yaml:"login_failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"15m"`
+	LoginBaseLockout      time.Duration     `yaml:"login_base_lockout" env:"LOGIN_BASE_LOCKOUT" env-default:"1m"`
+	LoginMaxLockout       time.Duration     `yaml:"login_max_lockout" env:"LOGIN_MAX_LOCKOUT" env-default:"1h"`
+	PasswordResetTTL      time.Duration     `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" env-default:"1h"`
+	PasswordResetURL      string            `yaml:"password_reset_url" env:"PASSWORD_RESET_URL" env-default:"http://localhost:8080/password/reset?token="`
+	EmailVerificationTTL  time.Duration     `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL" env-default:"24h"`
+	EmailVerificationURL  string            `yaml:"email_verification_url" env:"EMAIL_VERIFICATION_URL" env-default:"http://localhost:8080/verify-email?token="`
+	EmailResendInterval   time.Duration     `yaml:"email_verification_resend_interval" env:"EMAIL_VERIFICATION_RESEND_INTERVAL" env-default:"1m"`
+	RequireVerifiedEmail  bool              `yaml:"require_verified_email" env:"REQUIRE_VERIFIED_EMAIL" env-default:"false"`
+	PasswordHashAlgorithm string            `yaml:"password_hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"argon2id"`
+	Argon2Memory          uint32            `yaml:"argon2_memory" env:"ARGON2_MEMORY" env-default:"65536"`
+	Argon2Iterations      uint32            `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS" env-default:"3"`
+	Argon2Parallelism     uint8             `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM" env-default:"2"`
+	BcryptCost            int               `yaml:"bcrypt_cost" env:"BCRYPT_COST" env-default:"10"`
+	PasswordMinLength     int               `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	PasswordMaxLength     int               `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH" env-default:"128"`
+	PasswordBannedFile    string            `yaml:"password_banned_file" env:"PASSWORD_BANNED_FILE"`
+	Mailer                string            `yaml:"mailer" env:"MAILER" env-default:"log"`
+	SMTPHost              string            `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort              string            `yaml:"smtp_port" env:"SMTP_PORT" env-default:"587"`
+	SMTPUsername          string            `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword          string            `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	MailFrom              string            `yaml:"mail_from" env:"MAIL_FROM" env-default:"noreply@booker.local"`
+	MFAIssuer             string            `yaml:"mfa_issuer" env:"MFA_ISSUER" env-default:"Booker"`
+	MFARequiredRoles      []string          `yaml:"mfa_required_roles" env:"MFA_REQUIRED_ROLES" env-separator:","`
+	MFAChallengeTTL       time.Duration     `yaml:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL" env-default:"5m"`
+	MFAMaxAttempts        int               `yaml:"mfa_max_attempts" env:"MFA_MAX_ATTEMPTS" env-default:"5"`
+	OIDCIssuer            string            `yaml:"oidc_issuer" env:"OIDC_ISSUER"`
+	OIDCClientID          string            `yaml:"oidc_client_id" env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret      string            `yaml:"oidc_client_secret" env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL       string            `yaml:"oidc_redirect_url" env:"OIDC_REDIRECT_URL" env-default:"http://localhost:8080/login/oidc/callback"`
+	OIDCScopes            []string          `yaml:"oidc_scopes" env:"OIDC_SCOPES" env-separator:"," env-default:"openid,email,profile"`
+	OIDCGroupsClaim       string            `yaml:"oidc_groups_claim" env:"OIDC_GROUPS_CLAIM" env-default:"groups"`
+	OIDCRoleMapping       []string          `yaml:"oidc_role_mapping" env:"OIDC_ROLE_MAPPING" env-separator:","`
+	OIDCDefaultRole       string            `yaml:"oidc_default_role" env:"OIDC_DEFAULT_ROLE" env-default:"user"`
+	OIDCAutoProvision     bool              `yaml:"oidc_auto_provision" env:"OIDC_AUTO_PROVISION" env-default:"true"`
+	OIDCStateTTL          time.Duration     `yaml:"oidc_state_ttl" env:"OIDC_STATE_TTL" env-default:"10m"`
+	OIDCStateSecret       string            `yaml:"oidc_state_secret" env:"OIDC_STATE_SECRET"`
+	OIDCCookieSecure      bool              `yaml:"oidc_cookie_secure" env:"OIDC_COOKIE_SECURE" env-default:"true"`
+	ImpersonationTTL      time.Duration     `yaml:"impersonation_ttl" env:"IMPERSONATION_TTL" env-default:"15m"`
+	SCIMToken             string            `yaml:"scim_token" env:"SCIM_TOKEN"`
+	SCIMBookingPolicy     string            `yaml:"scim_booking_policy" env:"SCIM_BOOKING_POLICY" env-default:"cancel"`
+	SCIMTenantID          int64             `yaml:"scim_tenant_id" env:"SCIM_TENANT_ID" env-default:"1"`
 }
 
 // LoadConfig загружает конфигурацию из файла и переменных окружения
@@ -6,8 +6,8 @@ import (
 )
 
 // Authorization проверяет предоставленный токен и получает аргументы тела токена
-func Authorization(tokenString string, secretKey string) (jwt.MapClaims, error) {
-	jwtClaims, err := jwt_tokens.VerifyToken(tokenString, secretKey)
+func Authorization(tokenString string, keys *jwt_tokens.KeySet) (jwt.MapClaims, error) {
+	jwtClaims, err := jwt_tokens.VerifyToken(tokenString, keys)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,34 @@
+package authorization
+
+// Разрешения. Соответствие ролей и разрешений хранится в таблице role_permissions
+const (
+	PermissionBookingCreate      = "booking:create"      // Создание и изменение своих бронирований
+	PermissionBookingRead        = "booking:read"        // Просмотр бронирований
+	PermissionBookingManageAny   = "booking:manage_any"  // Изменение и отмена чужих бронирований
+	PermissionEntityRead         = "entity:read"         // Просмотр объектов бронирования
+	PermissionEntityWrite        = "entity:write"        // Создание, изменение и удаление объектов бронирования
+	PermissionBookingTypeRead    = "booking_type:read"   // Просмотр типов бронирования
+	PermissionBookingTypeWrite   = "booking_type:write"  // Создание, изменение и удаление типов бронирования
+	PermissionUserRead           = "user:read"           // Просмотр пользователей
+	PermissionUserManage         = "user:manage"         // Изменение и удаление пользователей
+	PermissionAPIKeyManage       = "api_key:manage"      // Выпуск и отзыв API ключей
+	PermissionUserImpersonate    = "user:impersonate"    // Вход от имени другого пользователя
+	PermissionGroupManage        = "group:manage"        // Управление группами пользователей и их участниками
+	PermissionOrganizationManage = "organization:manage" // Создание организаций, только в организации по умолчанию
+)
+
+// APIKeyScopes разрешения, которые можно выдать API ключу
+//
+// api_key:manage и user:impersonate сюда не входят, что б API ключом нельзя было выпустить новый ключ
+// или получить токен другого пользователя
+var APIKeyScopes = []string{
+	PermissionBookingCreate,
+	PermissionBookingRead,
+	PermissionBookingManageAny,
+	PermissionEntityRead,
+	PermissionEntityWrite,
+	PermissionBookingTypeRead,
+	PermissionBookingTypeWrite,
+	PermissionUserRead,
+	PermissionUserManage,
+}
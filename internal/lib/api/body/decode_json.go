@@ -2,7 +2,7 @@ package body
 
 import (
 	"errors"
-	"github.com/go-playground/validator"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
 	"log/slog"
 	"net/http"
 
@@ -21,7 +21,7 @@ func DecodeAndValidateJson(r *http.Request, v interface{}) error {
 	}
 
 	// Валидируем структуру
-	if err := validator.New().Struct(v); err != nil {
+	if err := validation.Struct(v); err != nil {
 		return err // Возвращаем ошибку валидации напрямую
 	}
 
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"log/slog"
+	"net/http"
+)
+
+// APIKeyHeader заголовок, в котором сервисы передают API ключ
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyMiddleware аутентифицирует запросы по API ключу из заголовка X-API-Key
+//
+// Если заголовка нет, обработка передаётся fallback (обычно AuthMiddleware), поэтому один и тот же маршрут
+// доступен и пользователю с токеном, и сервису с ключом. Principal собирается так же, как в AuthMiddleware:
+// пользователь - владелец ключа, а разрешения - scopes ключа, а не разрешения роли.
+// При недействительном ключе возвращает статус код 401
+func APIKeyMiddleware(apiKeys api_keys_db.APIKeyRepository, log *slog.Logger, fallback func(next http.Handler) http.Handler) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/api_key.go/APIKeyMiddleware"
+	log = log.With(slog.String("op", op))
+
+	return func(next http.Handler) http.Handler {
+		fallbackHandler := fallback(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := r.Header.Get(APIKeyHeader)
+			if apiKey == "" {
+				fallbackHandler.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := apiKeys.Authenticate(r.Context(), secure_tokens.Hash(apiKey))
+			if errors.Is(err, api_keys_db.ErrAPIKeyInvalid) {
+				renderUnauthorized(w, r, log, "API key is invalid")
+				return
+			}
+			if err != nil {
+				log.Error("Failed to authenticate api key", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
+				return
+			}
+			if err = apiKeys.TouchLastUsed(r.Context(), key.ID); err != nil {
+				log.Warn("Failed to update api key last used time", "error", err, "api_key_id", key.ID)
+			}
+
+			principal := auth.Principal{
+				UserID:        key.UserID,
+				Role:          key.UserRole,
+				Permissions:   key.Scopes,
+				EmailVerified: key.UserEmailVerified,
+				TenantID:      key.UserTenantID,
+				APIKeyID:      key.ID,
+			}
+			log.Debug("API key is valid", slog.Int64("api_key_id", key.ID), slog.Int64("user_id", key.UserID))
+
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+)
+
+// BlockImpersonation отклоняет запросы с токеном имперсонации (claim act)
+//
+// Используется для действий, которые администратор не должен выполнять от имени пользователя:
+// смена пароля, управление 2FA, сессиями, ролями и API ключами.
+// Должен использоваться после AuthMiddleware. Возвращает статус код 403
+func BlockImpersonation(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/impersonation.go/BlockImpersonation"
+	log = log.With(slog.String("op", op))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				log.Error("Failed to retrieve principal from context")
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
+				return
+			}
+			if principal.Impersonated() {
+				log.Warn("Action is not allowed under impersonation", "user_id", principal.UserID, "actor_id", principal.ActorID, "path", r.URL.Path)
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Forbidden: action is not allowed during impersonation"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ImpersonationAudit записывает в журнал аудита каждый изменяющий запрос (POST, PUT, PATCH, DELETE),
+// выполненный с токеном имперсонации
+//
+// В записи ActorID - администратор, TargetID - пользователь, от имени которого выполнен запрос,
+// в Details - метод, путь и статус ответа. Запись делается после ответа хендлера, в том числе неуспешного.
+// Ошибка записи в журнал только логируется. Должен использоваться после AuthMiddleware
+func ImpersonationAudit(auditRepository audit_db.AuditRepository, log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/impersonation.go/ImpersonationAudit"
+	log = log.With(slog.String("op", op))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok || !principal.Impersonated() || !isMutation(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			// Запрос уже обработан, поэтому запись не должна прерываться из-за отмены контекста запроса
+			err := auditRepository.Record(context.WithoutCancel(r.Context()), audit_db.Entry{
+				ActorID:    principal.ActorID,
+				Action:     audit_db.ActionImpersonatedRequest,
+				TargetType: audit_db.TargetUser,
+				TargetID:   principal.UserID,
+				Details:    map[string]any{"method": r.Method, "path": r.URL.Path, "status": status},
+			})
+			if err != nil {
+				log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionImpersonatedRequest)
+			}
+		})
+	}
+}
+
+func isMutation(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -1,12 +1,14 @@
 package middlewares
 
 import (
-	"context"
 	"fmt"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/token_denylist"
 	"github.com/go-chi/render"
-	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -16,8 +18,10 @@ import (
 //
 // # При успехе передаёт обработку следующему хендлеру
 //
+// Токены без jti и токены, jti которых есть в denylist (после /logout), отклоняются.
+// Токены с claim sid отклоняются, если сессия завершена (DELETE /users/me/sessions/{id}, выход на всех устройствах).
 // При ошибке возвращает статус код 401 и ошибку
-func AuthMiddleware(secretKey string, log *slog.Logger) func(next http.Handler) http.Handler {
+func AuthMiddleware(keys *jwt_tokens.KeySet, denylist token_denylist.TokenDenylist, sessions sessions_db.SessionChecker, log *slog.Logger) func(next http.Handler) http.Handler {
 	const op = "internal/lib/api/middlewares/middlewares.go/AuthMiddleware"
 	log = log.With(slog.String("op", op))
 	return func(next http.Handler) http.Handler {
@@ -35,15 +39,46 @@ func AuthMiddleware(secretKey string, log *slog.Logger) func(next http.Handler)
 
 			tokenString := strings.TrimPrefix(authHeader, bearerPrefix)
 
-			claims, err := authorization.Authorization(tokenString, secretKey)
+			claims, err := authorization.Authorization(tokenString, keys)
 			if err != nil {
 				renderUnauthorized(w, r, log, fmt.Sprintf("Authorization token is invalid: %v", err))
 				return
 			}
-			log.Debug("Authorization token is valid", slog.Any("claims", claims))
-			ctx := context.WithValue(r.Context(), "tokenClaims", claims)
+			jti, ok := claims["jti"].(string)
+			if !ok || jti == "" {
+				renderUnauthorized(w, r, log, "Authorization token has no jti")
+				return
+			}
+			denied, err := denylist.IsDenied(r.Context(), jti)
+			if err != nil {
+				log.Error("Failed to check token in denylist", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
+				return
+			}
+			if denied {
+				renderUnauthorized(w, r, log, "Authorization token is revoked")
+				return
+			}
+			principal, err := auth.FromClaims(claims)
+			if err != nil {
+				renderUnauthorized(w, r, log, fmt.Sprintf("Authorization token is invalid: %v", err))
+				return
+			}
+			if principal.SessionID != 0 {
+				active, err := sessions.IsSessionActive(r.Context(), principal.SessionID)
+				if err != nil {
+					log.Error("Failed to check token session", "error", err)
+					resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
+					return
+				}
+				if !active {
+					renderUnauthorized(w, r, log, "Session is terminated")
+					return
+				}
+			}
+			log.Debug("Authorization token is valid", slog.Int64("user_id", principal.UserID), slog.String("role", principal.Role))
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
 
 		})
 
@@ -56,37 +91,56 @@ func renderUnauthorized(w http.ResponseWriter, r *http.Request, log *slog.Logger
 	render.JSON(w, r, resp.Error(msg))
 }
 
-func AuthAdminMiddleware(secretKey string, log *slog.Logger) func(next http.Handler) http.Handler {
-	const op = "internal/lib/api/middlewares/middlewares.go/AuthAdminMiddleware"
+// RequirePermission проверяет, что у пользователя есть все перечисленные разрешения
+//
+// Разрешения берутся из Principal (claim permissions токена, который записывается при выдаче токена по роли пользователя).
+// Должен использоваться после AuthMiddleware. При отсутствии разрешения возвращает статус код 403
+func RequirePermission(log *slog.Logger, permissions ...string) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/middlewares.go/RequirePermission"
 	log = log.With(slog.String("op", op))
 
 	return func(next http.Handler) http.Handler {
-		// Используем AuthMiddleware для проверки авторизации
-		return AuthMiddleware(secretKey, log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Извлекаем claims из контекста
-			claims, ok := r.Context().Value("tokenClaims").(jwt.MapClaims)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
 			if !ok {
-				log.Error("Failed to retrieve claims from context")
-				render.Status(r, http.StatusInternalServerError)
-				render.JSON(w, r, resp.Error("Internal server error"))
+				log.Error("Failed to retrieve principal from context")
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
 				return
 			}
 
-			value, ok := claims["user_role"].(string)
+			for _, permission := range permissions {
+				if !principal.HasPermission(permission) {
+					log.Debug("User has no permission", "permission", permission, "user_id", principal.UserID)
+					resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(fmt.Sprintf("Forbidden: missing permission %s", permission)))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerifiedEmail отклоняет запросы пользователей с неподтверждённым email (claim email_verified)
+//
+// Должен использоваться после AuthMiddleware. Возвращает статус код 403
+func RequireVerifiedEmail(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/middlewares.go/RequireVerifiedEmail"
+	log = log.With(slog.String("op", op))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
 			if !ok {
-				log.Error("Failed to retrieve user role from context", "user_role", claims["user_role"])
-				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Forbidden"))
+				log.Error("Failed to retrieve principal from context")
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
 				return
 			}
-			// Проверяем, является ли пользователь администратором
-			if value == "admin" {
-				log.Debug("User is authorized and has admin privileges")
-				next.ServeHTTP(w, r)
-			} else {
-				log.Debug("User is NOT authorized and has admin privileges")
-				resp.RenderResponse(w, r, http.StatusForbidden,
-					resp.Error("Forbidden"))
+			if !principal.EmailVerified {
+				log.Debug("User email is not verified", "user_id", principal.UserID)
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Forbidden: email is not verified"))
+				return
 			}
-		}))
+			next.ServeHTTP(w, r)
+		})
 	}
 }
@@ -0,0 +1,164 @@
+package middlewares_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/token_denylist"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) CreateAPIKey(ctx context.Context, key api_keys_db.APIKeyCreate) (int64, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]api_keys_db.APIKeyInfo, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]api_keys_db.APIKeyInfo), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) Authenticate(ctx context.Context, secretHash string) (api_keys_db.APIKeyPrincipal, error) {
+	args := m.Called(ctx, secretHash)
+	return args.Get(0).(api_keys_db.APIKeyPrincipal), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) TouchLastUsed(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	const validKey = "bk_valid-key"
+	const revokedKey = "bk_revoked-key"
+	userToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", Permissions: []string{"booking:read"}}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		apiKey            string
+		authHeader        string
+		setupMock         func(*MockAPIKeyRepository)
+		expectedStatus    int
+		expectedBody      string
+		expectedPrincipal auth.Principal
+	}{
+		{
+			name:   "valid api key",
+			apiKey: validKey,
+			setupMock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("Authenticate", mock.Anything, secure_tokens.Hash(validKey)).Return(api_keys_db.APIKeyPrincipal{
+					ID: 3, Scopes: []string{"entity:read"}, UserID: 7, UserRole: "admin", UserEmailVerified: true, UserTenantID: 2,
+				}, nil).Once()
+				mockRepo.On("TouchLastUsed", mock.Anything, int64(3)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			// Разрешения берутся из scopes ключа, а не из роли владельца
+			expectedPrincipal: auth.Principal{UserID: 7, Role: "admin", Permissions: []string{"entity:read"}, EmailVerified: true, TenantID: 2, APIKeyID: 3},
+		},
+		{
+			name:   "last used update error does not fail request",
+			apiKey: validKey,
+			setupMock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("Authenticate", mock.Anything, secure_tokens.Hash(validKey)).Return(api_keys_db.APIKeyPrincipal{
+					ID: 3, Scopes: []string{"entity:read"}, UserID: 7, UserRole: "admin",
+				}, nil).Once()
+				mockRepo.On("TouchLastUsed", mock.Anything, int64(3)).Return(errors.New("db is down")).Once()
+			},
+			expectedStatus:    http.StatusOK,
+			expectedPrincipal: auth.Principal{UserID: 7, Role: "admin", Permissions: []string{"entity:read"}, APIKeyID: 3},
+		},
+		{
+			name:   "revoked or expired api key",
+			apiKey: revokedKey,
+			setupMock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("Authenticate", mock.Anything, secure_tokens.Hash(revokedKey)).Return(api_keys_db.APIKeyPrincipal{}, api_keys_db.ErrAPIKeyInvalid).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"API key is invalid"}`,
+		},
+		{
+			name:   "repository error",
+			apiKey: validKey,
+			setupMock: func(mockRepo *MockAPIKeyRepository) {
+				mockRepo.On("Authenticate", mock.Anything, secure_tokens.Hash(validKey)).Return(api_keys_db.APIKeyPrincipal{}, errors.New("db is down")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"Internal server error"}`,
+		},
+		{
+			name:       "without api key falls back to token",
+			authHeader: "Bearer " + userToken,
+			setupMock: func(mockRepo *MockAPIKeyRepository) {
+				// Нет вызова мока, запрос проверяет AuthMiddleware
+			},
+			expectedStatus:    http.StatusOK,
+			expectedPrincipal: auth.Principal{UserID: 42, Role: "user", Permissions: []string{"booking:read"}},
+		},
+		{
+			name: "without api key and token",
+			setupMock: func(mockRepo *MockAPIKeyRepository) {
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Authorization header is missing"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockAPIKeyRepository)
+			test.setupMock(mockRepo)
+
+			var principal auth.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = auth.FromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := middlewares.APIKeyMiddleware(mockRepo, slog.Default(),
+				middlewares.AuthMiddleware(testKeys, token_denylist.NewInMemoryDenylist(), testSessions, slog.Default()))(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/bookingEntity", nil)
+			if test.apiKey != "" {
+				req.Header.Set(middlewares.APIKeyHeader, test.apiKey)
+			}
+			if test.authHeader != "" {
+				req.Header.Set("Authorization", test.authHeader)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedBody != "" {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+			if test.expectedStatus == http.StatusOK {
+				require.Equal(t, test.expectedPrincipal.UserID, principal.UserID)
+				require.Equal(t, test.expectedPrincipal.Role, principal.Role)
+				require.Equal(t, test.expectedPrincipal.Permissions, principal.Permissions)
+				require.Equal(t, test.expectedPrincipal.EmailVerified, principal.EmailVerified)
+				require.Equal(t, test.expectedPrincipal.APIKeyID, principal.APIKeyID)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package middlewares_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// auditStub запоминает записанные в журнал аудита записи
+type auditStub struct {
+	entries []audit_db.Entry
+}
+
+func (a *auditStub) Record(ctx context.Context, entry audit_db.Entry) error {
+	a.entries = append(a.entries, entry)
+	return nil
+}
+
+var impersonatedPrincipal = auth.Principal{UserID: 42, Role: "user", ActorID: 1}
+
+func TestBlockImpersonation(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      auth.Principal
+		expectedStatus int
+	}{
+		{name: "regular token", principal: auth.Principal{UserID: 42, Role: "user"}, expectedStatus: http.StatusOK},
+		{name: "impersonation token", principal: impersonatedPrincipal, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := middlewares.BlockImpersonation(slog.Default())(next)
+
+			req := httptest.NewRequest(http.MethodPut, "/users/me/password", nil)
+			req = req.WithContext(auth.NewContext(req.Context(), test.principal))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+		})
+	}
+}
+
+func TestImpersonationAudit(t *testing.T) {
+	tests := []struct {
+		name            string
+		principal       auth.Principal
+		method          string
+		handlerStatus   int
+		expectedEntries int
+	}{
+		{name: "impersonated mutation", principal: impersonatedPrincipal, method: http.MethodPost, handlerStatus: http.StatusCreated, expectedEntries: 1},
+		{name: "impersonated failed mutation", principal: impersonatedPrincipal, method: http.MethodDelete, handlerStatus: http.StatusNotFound, expectedEntries: 1},
+		{name: "impersonated read", principal: impersonatedPrincipal, method: http.MethodGet, handlerStatus: http.StatusOK, expectedEntries: 0},
+		{name: "regular mutation", principal: auth.Principal{UserID: 42, Role: "user"}, method: http.MethodPost, handlerStatus: http.StatusCreated, expectedEntries: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			audit := &auditStub{}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.handlerStatus)
+			})
+			handler := middlewares.ImpersonationAudit(audit, slog.Default())(next)
+
+			req := httptest.NewRequest(test.method, "/bookings", nil)
+			req = req.WithContext(auth.NewContext(req.Context(), test.principal))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.handlerStatus, w.Code, "unexpected HTTP status")
+			require.Len(t, audit.entries, test.expectedEntries)
+			if test.expectedEntries == 0 {
+				return
+			}
+			entry := audit.entries[0]
+			require.Equal(t, audit_db.ActionImpersonatedRequest, entry.Action)
+			require.Equal(t, int64(1), entry.ActorID)
+			require.Equal(t, int64(42), entry.TargetID)
+			require.Equal(t, test.method, entry.Details["method"])
+			require.Equal(t, "/bookings", entry.Details["path"])
+			require.Equal(t, test.handlerStatus, entry.Details["status"])
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package middlewares_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/token_denylist"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testKeys = jwt_tokens.NewHMACKeySet("test-secret-key")
+
+// sessionsStub сессии для проверки claim sid: id -> сессия активна
+type sessionsStub map[int64]bool
+
+func (s sessionsStub) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	return s[sessionId], nil
+}
+
+var testSessions = sessionsStub{1: true, 2: false}
+
+func TestAuthMiddleware(t *testing.T) {
+	validToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user"}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	revokedToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user"}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+	revokedClaims, err := jwt_tokens.VerifyToken(revokedToken, testKeys)
+	require.NoError(t, err)
+
+	activeSessionToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", SessionID: 1}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+	terminatedSessionToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", SessionID: 2}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	tokenWithoutJti, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 42,
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	}).SignedString([]byte("test-secret-key"))
+	require.NoError(t, err)
+
+	denylist := token_denylist.NewInMemoryDenylist()
+	require.NoError(t, denylist.Add(context.Background(), revokedClaims["jti"].(string), time.Now().Add(5*time.Minute)))
+
+	tests := []struct {
+		name           string
+		authHeader     string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "valid token",
+			authHeader:     "Bearer " + validToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "revoked token",
+			authHeader:     "Bearer " + revokedToken,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Authorization token is revoked"}`,
+		},
+		{
+			name:           "token of active session",
+			authHeader:     "Bearer " + activeSessionToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "token of terminated session",
+			authHeader:     "Bearer " + terminatedSessionToken,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Session is terminated"}`,
+		},
+		{
+			name:           "token without jti",
+			authHeader:     "Bearer " + tokenWithoutJti,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Authorization token has no jti"}`,
+		},
+		{
+			name:           "missing header",
+			authHeader:     "",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Authorization header is missing"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := middlewares.AuthMiddleware(testKeys, denylist, testSessions, slog.Default())(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/bookings/my", nil)
+			if test.authHeader != "" {
+				req.Header.Set("Authorization", test.authHeader)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedBody != "" {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	userToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", Permissions: []string{"booking:create", "booking:read"}}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+	adminToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 1, Role: "admin", Permissions: []string{"booking:create", "booking:read", "entity:write"}}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+	// Роль admin без разрешения в токене не даёт доступа
+	adminWithoutPermissions, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 1, Role: "admin"}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		permissions    []string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "user has permission",
+			token:          userToken,
+			permissions:    []string{"booking:create"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "user has no permission",
+			token:          userToken,
+			permissions:    []string{"entity:write"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: missing permission entity:write"}`,
+		},
+		{
+			name:           "all permissions required",
+			token:          userToken,
+			permissions:    []string{"booking:read", "entity:write"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: missing permission entity:write"}`,
+		},
+		{
+			name:           "admin has permission",
+			token:          adminToken,
+			permissions:    []string{"entity:write"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "role without permissions claim",
+			token:          adminWithoutPermissions,
+			permissions:    []string{"entity:write"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: missing permission entity:write"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := middlewares.AuthMiddleware(testKeys, token_denylist.NewInMemoryDenylist(), testSessions, slog.Default())(
+				middlewares.RequirePermission(slog.Default(), test.permissions...)(next))
+
+			req := httptest.NewRequest(http.MethodPost, "/bookingEntity", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedBody != "" {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+		})
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	verifiedToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", EmailVerified: true}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+	unverifiedToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 43, Role: "user"}, testKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "verified email", token: verifiedToken, expectedStatus: http.StatusOK},
+		{name: "unverified email", token: unverifiedToken, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := middlewares.AuthMiddleware(testKeys, token_denylist.NewInMemoryDenylist(), testSessions, slog.Default())(
+				middlewares.RequireVerifiedEmail(slog.Default())(next))
+
+			req := httptest.NewRequest(http.MethodPost, "/booking", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middlewares_test
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/middlewares"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSCIMTokenMiddleware(t *testing.T) {
+	const token = "scim-token-scim-token-scim-token"
+
+	tests := []struct {
+		name           string
+		authHeader     string
+		expectedStatus int
+	}{
+		{name: "valid token", authHeader: "Bearer " + token, expectedStatus: http.StatusOK},
+		{name: "scheme is case insensitive", authHeader: "bearer " + token, expectedStatus: http.StatusOK},
+		{name: "missing header", authHeader: "", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", authHeader: "Bearer other-token", expectedStatus: http.StatusUnauthorized},
+		{name: "basic auth", authHeader: "Basic " + token, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := middlewares.SCIMTokenMiddleware(token, slog.Default())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+			if test.authHeader != "" {
+				req.Header.Set("Authorization", test.authHeader)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code)
+			if test.expectedStatus == http.StatusUnauthorized {
+				require.Equal(t, "application/scim+json", w.Header().Get("Content-Type"))
+				require.JSONEq(t, `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"401","detail":"SCIM token is missing or invalid"}`, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package middlewares_test
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystemTenantMiddleware(t *testing.T) {
+	var scoped bool
+	handler := middlewares.SystemTenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, scoped = tenant.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, scoped)
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	var id int64
+	var scoped bool
+	handler := middlewares.TenantMiddleware(7)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, scoped = tenant.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, scoped)
+	require.Equal(t, int64(7), id)
+}
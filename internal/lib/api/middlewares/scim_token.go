@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// SCIMTokenMiddleware пропускает запросы к SCIM только с выделенным bearer токеном (Config.SCIMToken)
+//
+// Токены пользователей и API ключи здесь не принимаются: SCIM клиент (HR система) не является пользователем.
+// Ошибка возвращается в формате SCIM со статус кодом 401
+func SCIMTokenMiddleware(token string, log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/scim_token.go/SCIMTokenMiddleware"
+	log = log.With(slog.String("op", op))
+	// Сравниваем хеши, что б время сравнения не зависело от длины и содержимого токена
+	expected := []byte(secure_tokens.Hash(token))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, presented, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") ||
+				subtle.ConstantTimeCompare([]byte(secure_tokens.Hash(strings.TrimSpace(presented))), expected) != 1 {
+				log.Warn("Rejected scim request with invalid token", slog.String("remote_addr", r.RemoteAddr))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+				resp.RenderSCIMError(w, http.StatusUnauthorized, "", "SCIM token is missing or invalid")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"net/http"
+)
+
+// SystemTenantMiddleware помечает запрос как системный вызов (tenant.WithSystem)
+//
+// Навешивается только на публичные маршруты до аутентификации: вход, обновление токена и сброс пароля
+// ищут пользователя по email или токену во всех организациях. Без метки запросы к репозиториям ничего не находят
+func SystemTenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(tenant.WithSystem(r.Context())))
+	})
+}
+
+// TenantMiddleware привязывает запрос к организации id (tenant.WithID). Используется для SCIM,
+// где в контексте нет пользователя, а клиент обслуживает одну организацию (Config.SCIMTenantID)
+func TenantMiddleware(id int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), id)))
+		})
+	}
+}
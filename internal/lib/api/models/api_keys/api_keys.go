@@ -0,0 +1,43 @@
+package api_keys
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"time"
+)
+
+// CreateRequest Выпуск API ключа
+//
+// UserID - пользователь, от имени которого действует ключ. Если не указан, ключ выпускается на администратора.
+// Scopes не могут быть шире разрешений роли этого пользователя
+type CreateRequest struct {
+	Name      string     `json:"name" validate:"required,max=128"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UserID    int64      `json:"user_id,omitempty" validate:"omitempty,gt=0"`
+}
+
+// CreateResponse Выпущенный ключ. Key показывается один раз, в БД хранится только хеш
+type CreateResponse struct {
+	resp.Response
+	ID  int64  `json:"id"`
+	Key string `json:"key"`
+}
+
+// APIKeyInfo Ключ в списке ключей, без секрета
+type APIKeyInfo struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	UserID     int64      `json:"user_id"`
+	CreatedBy  *int64     `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Data []APIKeyInfo `json:"data"`
+}
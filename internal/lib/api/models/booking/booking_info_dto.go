@@ -5,6 +5,7 @@ import "time"
 type BookingInfo struct {
 	Id            int64     `json:"id"`
 	UserId        int64     `json:"user_id"`
+	CreatedBy     int64     `json:"created_by"`
 	BookingEntity int64     `json:"booking_entity"`
 	StartTime     time.Time `json:"start_time"`
 	EndTime       time.Time `json:"end_time"`
@@ -21,3 +22,16 @@ type BookingsList struct {
 	Bookings []BookingInfo        `json:"data"`
 	Meta     BookingsListMetaData `json:"meta"`
 }
+
+// BookingStatusChange запись истории статусов бронирования. from_status не указан у записи о создании,
+// changed_by - у системных изменений
+type BookingStatusChange struct {
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  int64     `json:"changed_by,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type BookingStatusHistory struct {
+	History []BookingStatusChange `json:"data"`
+}
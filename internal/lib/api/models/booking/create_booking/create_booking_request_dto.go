@@ -2,10 +2,15 @@ package create_booking_dto
 
 import "time"
 
+// BookingRequest запрос на создание или изменение бронирования
+//
+// Status принимает только известные статусы. Новое бронирование создаётся в статусе pending,
+// дальше статус меняется только через эндпоинты переходов (confirm, check-in, complete, cancel, no-show)
 type BookingRequest struct {
 	UserId          int64     `json:"user_id"`
+	OnBehalfOf      int64     `json:"on_behalf_of"` // Владелец бронирования, если его создаёт представитель по делегированию
 	BookingEntityId int64     `json:"booking_entity_id"`
 	StartTime       time.Time `json:"start_time"`
 	EndTime         time.Time `json:"end_time"`
-	Status          string    `json:"status"`
+	Status          string    `json:"status" validate:"omitempty,oneof=pending confirmed checked_in completed cancelled no_show"`
 }
@@ -0,0 +1,29 @@
+package delegations
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"time"
+)
+
+// CreateDelegationRequest Делегирование своих бронирований другому пользователю (например ассистенту)
+type CreateDelegationRequest struct {
+	DelegateID int64 `json:"delegate_id" validate:"required,gt=0"`
+}
+
+// DelegationInfo Второй участник делегирования
+type DelegationInfo struct {
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DelegationListResponse Делегирования пользователя
+//
+// Granted - кому пользователь делегировал свои бронирования, Received - кто делегировал бронирования ему
+type DelegationListResponse struct {
+	resp.Response
+	Granted  []DelegationInfo `json:"granted"`
+	Received []DelegationInfo `json:"received"`
+}
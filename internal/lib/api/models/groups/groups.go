@@ -0,0 +1,59 @@
+package groups
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"time"
+)
+
+// CreateGroupRequest Создание группы пользователей (отдела, команды)
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description"`
+}
+
+type CreateGroupResponse struct {
+	resp.Response
+	ID int64 `json:"id"`
+}
+
+// GroupInfo Группа в списке групп
+type GroupInfo struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	MemberCount int64     `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type GroupListResponse struct {
+	resp.Response
+	Data []GroupInfo `json:"data"`
+}
+
+// MemberInfo Участник группы
+type MemberInfo struct {
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// GroupResponse Группа вместе с участниками
+type GroupResponse struct {
+	resp.Response
+	GroupInfo
+	Members []MemberInfo `json:"members"`
+}
+
+// BookingGroupsRequest Группы, которым доступен тип или объект бронирования
+//
+// Пустой список снимает ограничение: тип или объект становится доступен всем
+type BookingGroupsRequest struct {
+	GroupIDs []int64 `json:"group_ids" validate:"required,dive,gt=0"`
+}
+
+type BookingGroupsResponse struct {
+	resp.Response
+	GroupIDs []int64 `json:"group_ids"`
+}
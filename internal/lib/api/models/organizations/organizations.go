@@ -0,0 +1,15 @@
+package organizations
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+)
+
+// CreateOrganizationRequest Создание организации (тенанта)
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type CreateOrganizationResponse struct {
+	resp.Response
+	ID int64 `json:"id"`
+}
@@ -0,0 +1,101 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Схемы SCIM 2.0 (RFC 7643, RFC 7644)
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Типы ошибок SCIM (scimType)
+const (
+	ErrorTypeInvalidFilter = "invalidFilter"
+	ErrorTypeInvalidSyntax = "invalidSyntax"
+	ErrorTypeInvalidValue  = "invalidValue"
+	ErrorTypeInvalidPath   = "invalidPath"
+	ErrorTypeMutability    = "mutability"
+	ErrorTypeUniqueness    = "uniqueness"
+)
+
+// ContentType тип содержимого ответов SCIM
+const ContentType = "application/scim+json"
+
+// ResourceTypeUser тип ресурса в meta
+const ResourceTypeUser = "User"
+
+// User пользователь в представлении SCIM
+//
+// userName - email пользователя. Active = nil при создании означает активного пользователя
+type User struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id,omitempty"`
+	ExternalID   string       `json:"externalId,omitempty"`
+	UserName     string       `json:"userName" validate:"required,email"`
+	Name         *Name        `json:"name,omitempty"`
+	Emails       []MultiValue `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+	Active       *bool        `json:"active,omitempty"`
+	Meta         *Meta        `json:"meta,omitempty"`
+}
+
+type Name struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue значение многозначного атрибута (emails, phoneNumbers)
+type MultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ListResponse ответ на поиск пользователей. StartIndex считается с 1
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+// PatchRequest запрос на частичное изменение пользователя
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations" validate:"required,min=1,dive"`
+}
+
+// PatchOperation операция add, replace или remove. Без Path Value - объект с атрибутами пользователя
+type PatchOperation struct {
+	Op    string          `json:"op" validate:"required"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error ответ с ошибкой. Status - HTTP статус строкой, как требует RFC 7644
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func NewError(status int, scimType, detail string) Error {
+	return Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
@@ -7,6 +7,7 @@ type UserInfoList struct {
 	LastName  string `json:"last_name" validate:"required"`
 	FirstName string `json:"first_name" validate:"required"`
 	Role      string `json:"role" validate:"required"`
+	Status    string `json:"status"`
 }
 
 type UsersListMetaData struct {
@@ -0,0 +1,19 @@
+package impersonation
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"time"
+)
+
+// ImpersonationResponse Токен доступа, выданный администратору для действий от имени пользователя
+//
+// Refresh токен не выдаётся: по истечении ExpiresIn имперсонацию нужно начать заново
+type ImpersonationResponse struct {
+	resp.Response
+	AccessToken        string    `json:"access_token"`
+	TokenType          string    `json:"token_type"`
+	ExpiresIn          int64     `json:"expires_in"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	ImpersonatedUserID int64     `json:"impersonated_user_id"`
+	ActorID            int64     `json:"actor_id"`
+}
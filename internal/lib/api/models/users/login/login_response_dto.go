@@ -0,0 +1,22 @@
+package login
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+)
+
+// LoginResponse Структура ответа на успешную аутентификацию
+//
+// Если у пользователя подключена 2FA, токены не выдаются: MFARequired = true, а MFAToken нужно передать
+// вместе с кодом в /login/2fa.
+// MFAEnrollmentRequired = true, если 2FA обязательна для роли пользователя, но не подключена:
+// выдаётся только токен доступа без разрешений, с которым можно подключить 2FA
+type LoginResponse struct {
+	resp.Response
+	AccessToken           string `json:"access_token,omitempty"`
+	RefreshToken          string `json:"refresh_token,omitempty"`
+	TokenType             string `json:"token_type,omitempty"`
+	ExpiresIn             int64  `json:"expires_in,omitempty"`
+	MFARequired           bool   `json:"mfa_required,omitempty"`
+	MFAToken              string `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+}
@@ -0,0 +1,6 @@
+package logout
+
+// LogoutRequest Тело запроса /logout. Если передан refresh токен, отзывается всё его семейство
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
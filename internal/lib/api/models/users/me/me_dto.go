@@ -0,0 +1,27 @@
+package me
+
+// MeResponse Профиль текущего пользователя
+type MeResponse struct {
+	ID            int64  `json:"id"`
+	Email         string `json:"email"`
+	Phone         string `json:"phone"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// UpdateMeRequest Частичное обновление профиля текущим пользователем
+//
+// Не переданные поля не меняются. Email и роль здесь поменять нельзя
+type UpdateMeRequest struct {
+	FirstName *string `json:"first_name" validate:"omitempty,min=3,max=64"`
+	LastName  *string `json:"last_name" validate:"omitempty,min=3,max=64"`
+	Phone     *string `json:"phone" validate:"omitempty,numeric"`
+}
+
+// ChangePasswordRequest Смена пароля текущим пользователем
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
@@ -0,0 +1,34 @@
+package mfa
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+)
+
+// EnrollResponse Секрет для приложения-аутентификатора. OTPAuthURI удобно показать пользователю в виде QR кода
+type EnrollResponse struct {
+	resp.Response
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// ConfirmRequest Подтверждение подключения 2FA кодом из приложения
+type ConfirmRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// ConfirmResponse Резервные коды. Показываются один раз, повторно получить их нельзя
+type ConfirmResponse struct {
+	resp.Response
+	BackupCodes []string `json:"backup_codes"`
+}
+
+// DisableRequest Отключение 2FA требует текущий пароль
+type DisableRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// LoginRequest Второй шаг входа: токен из ответа /login и код из приложения или резервный код
+type LoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
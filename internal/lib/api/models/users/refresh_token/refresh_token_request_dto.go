@@ -0,0 +1,5 @@
+package refresh_token
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
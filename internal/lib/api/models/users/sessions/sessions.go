@@ -0,0 +1,21 @@
+package sessions
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"time"
+)
+
+// SessionInfo Активная сессия пользователя. Current - сессия, которой выдан токен текущего запроса
+type SessionInfo struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Data []SessionInfo `json:"data"`
+}
@@ -0,0 +1,5 @@
+package update_role
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required,max=64"`
+}
@@ -5,5 +5,4 @@ type UpdateUserDto struct {
 	LastName  string `json:"last_name" validate:"required,min=3,max=64"`
 	Email     string `json:"email" validate:"required,email"`
 	Phone     string `json:"phone" validate:"required,numeric"`
-	Role      string `json:"role" validate:"required"`
 }
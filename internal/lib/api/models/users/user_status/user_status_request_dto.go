@@ -0,0 +1,9 @@
+package user_status
+
+// BookingPolicyRequest Политика для будущих бронирований пользователя при деактивации или удалении
+//
+// cancel - отменить, reassign - переназначить пользователю ReassignTo, keep - оставить как есть
+type BookingPolicyRequest struct {
+	BookingPolicy string `json:"booking_policy" validate:"required,oneof=cancel reassign keep"`
+	ReassignTo    int64  `json:"reassign_to" validate:"omitempty,gt=0"`
+}
@@ -2,6 +2,7 @@ package query_params
 
 import (
 	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
 	"github.com/go-playground/validator"
 	"log/slog"
 	"net/url"
@@ -111,7 +112,7 @@ func ParseStandardQueryParams(query url.Values, log *slog.Logger, parser QueryPa
 	}
 
 	// Валидируем базовые параметры
-	if err := validator.New().Struct(params.BaseQueryParams); err != nil {
+	if err := validation.Struct(params.BaseQueryParams); err != nil {
 		validationErrors := err.(validator.ValidationErrors)
 		log.Error("Error validating query params", "err", validationErrors)
 		return params, fmt.Errorf("error validating query params: %w", err)
@@ -38,6 +38,8 @@ func ValidationError(errs validator.ValidationErrors) Response {
 		switch v.ActualTag() {
 		case "required":
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s is required", v.Field()))
+		case "password":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s does not meet the password policy", v.Field()))
 		default:
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s is invalid", v.Field()))
 		}
@@ -0,0 +1,21 @@
+package response
+
+import (
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/scim"
+	"net/http"
+)
+
+// RenderSCIM отвечает телом в формате SCIM (application/scim+json)
+func RenderSCIM(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", scim.ContentType)
+	w.WriteHeader(status)
+	if body != nil {
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+// RenderSCIMError отвечает ошибкой в формате SCIM
+func RenderSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	RenderSCIM(w, status, scim.NewError(status, scimType, detail))
+}
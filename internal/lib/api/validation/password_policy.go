@@ -0,0 +1,104 @@
+package validation
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator"
+)
+
+// passwordTag тег валидации пароля по политике паролей: `validate:"required,password"`
+const passwordTag = "password"
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy политика паролей
+//
+// MinLength и MaxLength считаются в символах. MaxBytes ограничивает длину в байтах (0 - без ограничения),
+// нужен для bcrypt, который не принимает пароли длиннее 72 байт.
+// Banned - запрещённые пароли в нижнем регистре
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	MaxBytes  int
+	Banned    map[string]struct{}
+}
+
+var passwordPolicy atomic.Pointer[PasswordPolicy]
+
+func init() {
+	policy := NewPasswordPolicy(8, 128, 0, nil)
+	passwordPolicy.Store(&policy)
+}
+
+// NewPasswordPolicy создаёт политику паролей со встроенным списком распространённых паролей,
+// дополненным extraBanned
+func NewPasswordPolicy(minLength, maxLength, maxBytes int, extraBanned []string) PasswordPolicy {
+	banned := make(map[string]struct{})
+	for _, list := range [][]string{strings.Split(commonPasswords, "\n"), extraBanned} {
+		for _, password := range list {
+			password = strings.ToLower(strings.TrimSpace(password))
+			if password != "" {
+				banned[password] = struct{}{}
+			}
+		}
+	}
+	return PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		MaxBytes:  maxBytes,
+		Banned:    banned,
+	}
+}
+
+// SetPasswordPolicy заменяет политику паролей. Вызывается при старте с параметрами из конфигурации
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy.Store(&policy)
+}
+
+// CurrentPasswordPolicy возвращает действующую политику паролей
+func CurrentPasswordPolicy() PasswordPolicy {
+	return *passwordPolicy.Load()
+}
+
+// Allows проверяет пароль на соответствие политике
+func (p PasswordPolicy) Allows(password string) bool {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength || (p.MaxLength > 0 && length > p.MaxLength) {
+		return false
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return false
+	}
+	_, banned := p.Banned[strings.ToLower(password)]
+	return !banned
+}
+
+// LoadBannedPasswords читает дополнительный список запрещённых паролей из файла (по одному паролю в строке)
+func LoadBannedPasswords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open banned passwords file: %w", err)
+	}
+	defer file.Close()
+
+	var banned []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		banned = append(banned, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read banned passwords file: %w", err)
+	}
+	return banned, nil
+}
+
+func validatePassword(fl validator.FieldLevel) bool {
+	return CurrentPasswordPolicy().Allows(fl.Field().String())
+}
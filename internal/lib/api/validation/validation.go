@@ -0,0 +1,26 @@
+package validation
+
+import (
+	"github.com/go-playground/validator"
+)
+
+// validate общий валидатор для всех DTO сервиса
+//
+// Валидатор кеширует разобранные структуры, поэтому создаётся один раз, а не на каждый запрос.
+// В нём зарегистрированы собственные теги (password)
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	if err := v.RegisterValidation(passwordTag, validatePassword); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Struct валидирует структуру по тегам validate
+//
+// Возвращает validator.ValidationErrors, если структура не прошла валидацию
+func Struct(s interface{}) error {
+	return validate.Struct(s)
+}
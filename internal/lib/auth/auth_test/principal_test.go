@@ -0,0 +1,74 @@
+package auth_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFromClaims(t *testing.T) {
+	keys := jwt_tokens.NewHMACKeySet("test-secret-key")
+	token, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", Permissions: []string{"booking:create"}}, keys, 5*time.Minute)
+	require.NoError(t, err)
+	claims, err := jwt_tokens.VerifyToken(token, keys)
+	require.NoError(t, err)
+
+	principal, err := auth.FromClaims(claims)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), principal.UserID)
+	require.Equal(t, "user", principal.Role)
+	require.Equal(t, claims["jti"], principal.TokenID)
+	require.True(t, principal.HasPermission("booking:create"))
+	require.False(t, principal.HasPermission("booking:manage_any"))
+	require.WithinDuration(t, time.Now().Add(5*time.Minute), principal.ExpiresAt, time.Minute)
+	require.False(t, principal.Impersonated())
+
+	_, err = auth.FromClaims(jwt.MapClaims{"user_role": "admin"})
+	require.ErrorIs(t, err, auth.ErrInvalidSubject)
+}
+
+func TestFromClaimsImpersonation(t *testing.T) {
+	keys := jwt_tokens.NewHMACKeySet("test-secret-key")
+	token, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", ActorID: 1}, keys, 5*time.Minute)
+	require.NoError(t, err)
+	claims, err := jwt_tokens.VerifyToken(token, keys)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"sub": float64(1)}, claims["act"])
+
+	principal, err := auth.FromClaims(claims)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), principal.UserID)
+	require.Equal(t, int64(1), principal.ActorID)
+	require.True(t, principal.Impersonated())
+}
+
+func TestFromClaimsTenant(t *testing.T) {
+	keys := jwt_tokens.NewHMACKeySet("test-secret-key")
+	token, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user", TenantID: 3}, keys, 5*time.Minute)
+	require.NoError(t, err)
+	claims, err := jwt_tokens.VerifyToken(token, keys)
+	require.NoError(t, err)
+
+	principal, err := auth.FromClaims(claims)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), principal.TenantID)
+}
+
+func TestContext(t *testing.T) {
+	_, ok := auth.FromContext(context.Background())
+	require.False(t, ok)
+
+	// Строковый ключ не подменяет пользователя запроса
+	ctx := context.WithValue(context.Background(), "principal", auth.Principal{UserID: 1})
+	_, ok = auth.FromContext(ctx)
+	require.False(t, ok)
+
+	ctx = auth.NewContext(context.Background(), auth.Principal{UserID: 7, Role: "admin"})
+	principal, ok := auth.FromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, int64(7), principal.UserID)
+}
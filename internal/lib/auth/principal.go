@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"time"
+)
+
+var ErrInvalidSubject = errors.New("token has no valid sub claim")
+
+// Principal Аутентифицированный пользователь запроса
+//
+// Заполняется один раз в AuthMiddleware из claims токена и передаётся дальше через контекст запроса,
+// поэтому хендлерам и сервисам не нужно разбирать jwt.MapClaims
+type Principal struct {
+	UserID        int64
+	Role          string
+	Permissions   []string
+	TenantID      int64
+	TokenID       string
+	ExpiresAt     time.Time
+	EmailVerified bool
+	// SessionID id сессии из claim sid. 0 - токен выдан вне сессии
+	SessionID int64
+	// APIKeyID id API ключа, если запрос аутентифицирован по X-API-Key. Для запросов с токеном доступа 0
+	APIKeyID int64
+	// ActorID id администратора из claim act, если запрос выполняется под имперсонацией. Иначе 0
+	ActorID int64
+}
+
+// Impersonated выполняется ли запрос администратором от имени пользователя
+func (p Principal) Impersonated() bool {
+	return p.ActorID != 0
+}
+
+// HasPermission проверяет, что у пользователя есть разрешение
+func (p Principal) HasPermission(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+// principalKey Приватный тип ключа контекста, что б значение нельзя было подменить или прочитать по строковому ключу
+type principalKey struct{}
+
+// NewContext возвращает копию контекста с пользователем запроса
+func NewContext(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext возвращает пользователя запроса. ok == false, если запрос не прошёл AuthMiddleware
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// FromClaims собирает Principal из claims проверенного токена доступа
+//
+// Числа в JWT декодируются как float64, поэтому приведение типов выполняется только здесь
+func FromClaims(claims jwt.MapClaims) (Principal, error) {
+	sub, ok := claims["sub"].(float64)
+	if !ok || sub <= 0 {
+		return Principal{}, ErrInvalidSubject
+	}
+	principal := Principal{UserID: int64(sub)}
+	principal.Role, _ = claims["user_role"].(string)
+	principal.TokenID, _ = claims["jti"].(string)
+	principal.EmailVerified, _ = claims["email_verified"].(bool)
+	if sessionId, ok := claims["sid"].(float64); ok {
+		principal.SessionID = int64(sessionId)
+	}
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		if actorId, ok := act["sub"].(float64); ok {
+			principal.ActorID = int64(actorId)
+		}
+	}
+	if tenantId, ok := claims["tenant_id"].(float64); ok {
+		principal.TenantID = int64(tenantId)
+	}
+	if permissions, ok := claims["permissions"].([]interface{}); ok {
+		principal.Permissions = make([]string, 0, len(permissions))
+		for _, permission := range permissions {
+			if s, ok := permission.(string); ok {
+				principal.Permissions = append(principal.Permissions, s)
+			}
+		}
+	}
+	if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+		principal.ExpiresAt = expiresAt.Time
+	}
+	return principal, nil
+}
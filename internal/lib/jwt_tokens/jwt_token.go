@@ -1,32 +1,67 @@
 package jwt_tokens
 
 import (
-	"errors"
-	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
 	"github.com/golang-jwt/jwt/v5"
+	"time"
 )
 
+// TokenSettings Параметры выдачи токенов
+type TokenSettings struct {
+	Keys            *KeySet
+	AccessTokenTTL  time.Duration // Config.JWTDuration
+	RefreshTokenTTL time.Duration // Config.RefreshTokenDuration
+}
+
 // VerifyToken verifies a JWT token and returns its claims
-func VerifyToken(tokenString string, secretKey string) (jwt.MapClaims, error) {
-	// Парсим токен
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Проверяем алгоритм подписи
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secretKey), nil
-	})
+//
+// Подпись проверяется любым ключом из набора (см. KeySet)
+func VerifyToken(tokenString string, keys *KeySet) (jwt.MapClaims, error) {
+	return keys.Verify(tokenString)
+}
+
+// AccessClaims Данные пользователя, которые записываются в токен доступа
+type AccessClaims struct {
+	UserID        int64
+	Role          string
+	Permissions   []string
+	EmailVerified bool
+	// SessionID id сессии (claim sid). 0 - токен не привязан к сессии, например токен для подключения 2FA
+	SessionID int64
+	// ActorID id администратора, который действует от имени пользователя UserID (claim act, RFC 8693).
+	// 0 - обычный токен без имперсонации
+	ActorID int64
+	// TenantID id организации пользователя (claim tenant_id), ей ограничиваются запросы к репозиториям
+	TenantID int64
+}
+
+// CreateToken создаёт токен доступа, подписанный активным ключом набора
+//
+// В токен записываются claims sub (id пользователя), user_role, permissions (разрешения роли), email_verified,
+// tenant_id (организация пользователя), exp, jti (уникальный id токена для отзыва),
+// sid (id сессии), если токен выдан в сессии, и act ({"sub": id администратора}) для токена имперсонации.
+// Время жизни токена задаётся параметром duration (Config.JWTDuration)
+func CreateToken(accessClaims AccessClaims, keys *KeySet, duration time.Duration) (string, error) {
+	jti, err := secure_tokens.Generate()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"sub":            accessClaims.UserID,
+		"user_role":      accessClaims.Role,
+		"permissions":    accessClaims.Permissions,
+		"email_verified": accessClaims.EmailVerified,
+		"exp":            time.Now().Add(duration).Unix(),
+		"jti":            jti,
+	}
+	if accessClaims.TenantID != 0 {
+		claims["tenant_id"] = accessClaims.TenantID
 	}
-	// Проверяем, валиден ли токен
-	if !token.Valid {
-		return nil, errors.New("invalid token")
+	if accessClaims.SessionID != 0 {
+		claims["sid"] = accessClaims.SessionID
 	}
-	// Извлекаем claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid claims")
+	if accessClaims.ActorID != 0 {
+		claims["act"] = map[string]any{"sub": accessClaims.ActorID}
 	}
-	return claims, nil
+	return keys.Sign(claims)
 }
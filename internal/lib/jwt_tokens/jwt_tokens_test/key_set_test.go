@@ -0,0 +1,146 @@
+package jwt_tokens_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeys создаёт во временной директории PEM файлы с ключами RSA и Ed25519 и публичный ключ RSA
+func writeKeys(t *testing.T) (rsaPath, edPath, rsaPublicPath string) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaDer, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	rsaPath = filepath.Join(dir, "rsa.pem")
+	require.NoError(t, os.WriteFile(rsaPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaDer}), 0o600))
+
+	rsaPublicDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	rsaPublicPath = filepath.Join(dir, "rsa.pub.pem")
+	require.NoError(t, os.WriteFile(rsaPublicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicDer}), 0o600))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDer, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	edPath = filepath.Join(dir, "ed.pem")
+	require.NoError(t, os.WriteFile(edPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDer}), 0o600))
+
+	return rsaPath, edPath, rsaPublicPath
+}
+
+func TestKeySetRotation(t *testing.T) {
+	rsaPath, edPath, rsaPublicPath := writeKeys(t)
+
+	// До ротации токены подписываются RSA ключом
+	oldKeys, err := jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPath}, "rsa-1", "", false)
+	require.NoError(t, err)
+	oldToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user"}, oldKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	// Во время ротации активен новый ключ Ed25519, старый RSA оставлен только публичным для проверки
+	rotatedKeys, err := jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPublicPath, "ed-2": edPath}, "ed-2", "", false)
+	require.NoError(t, err)
+	newToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user"}, rotatedKeys, 5*time.Minute)
+	require.NoError(t, err)
+
+	claims, err := jwt_tokens.VerifyToken(oldToken, rotatedKeys)
+	require.NoError(t, err, "token signed by old key should be accepted during rotation")
+	require.Equal(t, float64(42), claims["sub"])
+
+	claims, err = jwt_tokens.VerifyToken(newToken, rotatedKeys)
+	require.NoError(t, err, "token signed by new key should be accepted")
+	require.Equal(t, "user", claims["user_role"])
+
+	// После окончания ротации старый ключ удалён, и его токены больше не принимаются
+	newKeys, err := jwt_tokens.LoadKeySet(map[string]string{"ed-2": edPath}, "ed-2", "", false)
+	require.NoError(t, err)
+	_, err = jwt_tokens.VerifyToken(oldToken, newKeys)
+	require.ErrorIs(t, err, jwt_tokens.ErrUnknownKeyID)
+	_, err = jwt_tokens.VerifyToken(newToken, newKeys)
+	require.NoError(t, err)
+
+	// HS256 токены не принимаются, если общий секрет не задан
+	hmacToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user"}, jwt_tokens.NewHMACKeySet("secret"), 5*time.Minute)
+	require.NoError(t, err)
+	_, err = jwt_tokens.VerifyToken(hmacToken, newKeys)
+	require.Error(t, err)
+}
+
+func TestKeySetHMAC(t *testing.T) {
+	rsaPath, _, _ := writeKeys(t)
+	hmacToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{UserID: 42, Role: "user"}, jwt_tokens.NewHMACKeySet("secret"), 5*time.Minute)
+	require.NoError(t, err)
+
+	// Без асимметричного ключа токены подписываются и проверяются общим секретом
+	hmacKeys, err := jwt_tokens.LoadKeySet(nil, "", "secret", false)
+	require.NoError(t, err)
+	_, err = jwt_tokens.VerifyToken(hmacToken, hmacKeys)
+	require.NoError(t, err)
+
+	// При активном асимметричном ключе HS256 принимается только в режиме legacy
+	rsaKeys, err := jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPath}, "rsa-1", "secret", false)
+	require.NoError(t, err)
+	_, err = jwt_tokens.VerifyToken(hmacToken, rsaKeys)
+	require.Error(t, err)
+
+	legacyKeys, err := jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPath}, "rsa-1", "secret", true)
+	require.NoError(t, err)
+	_, err = jwt_tokens.VerifyToken(hmacToken, legacyKeys)
+	require.NoError(t, err)
+
+	// Другие HMAC алгоритмы с тем же секретом не принимаются
+	hs512Token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"sub": 42, "exp": time.Now().Add(5 * time.Minute).Unix()}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = jwt_tokens.VerifyToken(hs512Token, hmacKeys)
+	require.Error(t, err)
+	_, err = jwt_tokens.VerifyToken(hs512Token, legacyKeys)
+	require.Error(t, err)
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	_, _, rsaPublicPath := writeKeys(t)
+
+	_, err := jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPublicPath}, "rsa-1", "", false)
+	require.Error(t, err, "public key cannot be active")
+
+	_, err = jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPublicPath}, "missing", "", false)
+	require.ErrorIs(t, err, jwt_tokens.ErrUnknownKeyID)
+
+	_, err = jwt_tokens.LoadKeySet(nil, "", "", false)
+	require.ErrorIs(t, err, jwt_tokens.ErrNoSigningKey)
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPath, edPath, _ := writeKeys(t)
+
+	keys, err := jwt_tokens.LoadKeySet(map[string]string{"rsa-1": rsaPath, "ed-2": edPath}, "ed-2", "secret", false)
+	require.NoError(t, err)
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 2, "HMAC secret must not be published")
+
+	require.Equal(t, "ed-2", jwks.Keys[0].Kid)
+	require.Equal(t, "OKP", jwks.Keys[0].Kty)
+	require.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	require.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+	require.NotEmpty(t, jwks.Keys[0].X)
+
+	require.Equal(t, "rsa-1", jwks.Keys[1].Kid)
+	require.Equal(t, "RSA", jwks.Keys[1].Kty)
+	require.Equal(t, "RS256", jwks.Keys[1].Alg)
+	require.Equal(t, "AQAB", jwks.Keys[1].E)
+	require.NotEmpty(t, jwks.Keys[1].N)
+}
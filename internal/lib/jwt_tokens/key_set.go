@@ -0,0 +1,228 @@
+package jwt_tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"sort"
+)
+
+var ErrNoSigningKey = errors.New("no signing key configured")
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// signingKey Ключ подписи токенов. Если privateKey == nil, ключ используется только для проверки подписи
+// (например, старый ключ в период ротации)
+type signingKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+}
+
+// KeySet Набор ключей для подписи и проверки JWT
+//
+// Поддерживаются асимметричные ключи RS256 и EdDSA (выбираются по заголовку kid) и,
+// для обратной совместимости, общий секрет HS256. Подписывает токены активный ключ,
+// а проверка принимает любой загруженный ключ, поэтому старый и новый ключи работают одновременно в период ротации.
+// При активном асимметричном ключе токены HS256 принимаются только в режиме legacyHMAC
+type KeySet struct {
+	keys       map[string]*signingKey
+	activeKid  string
+	hmacSecret []byte
+	acceptHMAC bool
+}
+
+// NewHMACKeySet создаёт набор ключей только с общим секретом HS256
+func NewHMACKeySet(secretKey string) *KeySet {
+	return &KeySet{
+		keys:       map[string]*signingKey{},
+		hmacSecret: []byte(secretKey),
+		acceptHMAC: true,
+	}
+}
+
+// LoadKeySet загружает ключи из PEM файлов
+//
+// keyFiles - kid -> путь к PEM файлу с приватным (PKCS#8, PKCS#1) или публичным (PKIX) ключом RSA или Ed25519.
+// activeKid - ключ, которым подписываются новые токены, должен быть приватным.
+// Если activeKid пустой, токены подписываются и проверяются hmacSecret. При заданном activeKid токены HS256
+// принимаются, только если включён legacyHMAC (период перехода с общего секрета на асимметричные ключи).
+// Если hmacSecret пустой, токены HS256 не принимаются
+func LoadKeySet(keyFiles map[string]string, activeKid string, hmacSecret string, legacyHMAC bool) (*KeySet, error) {
+	keySet := &KeySet{
+		keys:       make(map[string]*signingKey, len(keyFiles)),
+		activeKid:  activeKid,
+		hmacSecret: []byte(hmacSecret),
+		acceptHMAC: len(hmacSecret) > 0 && (activeKid == "" || legacyHMAC),
+	}
+	for kid, path := range keyFiles {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", kid, err)
+		}
+		key, err := parsePEMKey(kid, pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", kid, err)
+		}
+		keySet.keys[kid] = key
+	}
+
+	if activeKid != "" {
+		key, ok := keySet.keys[activeKid]
+		if !ok {
+			return nil, fmt.Errorf("active key %s: %w", activeKid, ErrUnknownKeyID)
+		}
+		if key.privateKey == nil {
+			return nil, fmt.Errorf("active key %s has no private key", activeKid)
+		}
+	} else if len(keySet.hmacSecret) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	return keySet, nil
+}
+
+// Sign подписывает claims активным ключом
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	if ks.activeKid == "" {
+		if len(ks.hmacSecret) == 0 {
+			return "", ErrNoSigningKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmacSecret)
+	}
+	key := ks.keys[ks.activeKid]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.privateKey)
+}
+
+// Verify проверяет подпись и срок действия токена и возвращает его claims
+func (ks *KeySet) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, ks.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+	return claims, nil
+}
+
+// keyFunc выбирает ключ проверки по заголовкам токена
+//
+// Алгоритм токена должен совпадать с типом ключа, иначе возможна подмена алгоритма (например, HS256 с публичным ключом RSA).
+// Из HMAC алгоритмов принимается только HS256, которым подписывает Sign
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if token.Method != jwt.SigningMethodHS256 || !ks.acceptHMAC {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ks.hmacSecret, nil
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %s", token.Header["alg"], kid)
+	}
+	return key.publicKey, nil
+}
+
+// JWK Публичный ключ в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS Набор публичных ключей для /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные части всех асимметричных ключей. Общий секрет HS256 никогда не публикуется
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch publicKey := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func parsePEMKey(kid string, pemBytes []byte) (*signingKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, privateKey: key, publicKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, privateKey: key, publicKey: key.Public()}, nil
+	case *rsa.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, publicKey: key}, nil
+	case ed25519.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, publicKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
@@ -0,0 +1,122 @@
+package login_guard
+
+import (
+	"context"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/login_attempts"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// LockedError Вход временно заблокирован из-за неудачных попыток
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("Слишком много неудачных попыток входа, повторите через %d с", int64(e.RetryAfter.Round(time.Second).Seconds()))
+}
+
+// Settings Пороги защиты от перебора паролей (см. Config.Login*)
+//
+// После MaxAccountFailures неудачных попыток для аккаунта (MaxIPFailures для IP) вход блокируется на BaseLockout,
+// каждая следующая неудачная попытка удваивает блокировку, но не больше MaxLockout.
+// Счётчик сбрасывается, если с последней неудачной попытки прошло больше FailureWindow
+type Settings struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+	FailureWindow      time.Duration
+}
+
+// Guard Защита входа от перебора паролей по аккаунту и по IP
+type Guard struct {
+	store    login_attempts.AttemptStore
+	settings Settings
+	log      *slog.Logger
+}
+
+func NewGuard(store login_attempts.AttemptStore, settings Settings, log *slog.Logger) *Guard {
+	return &Guard{
+		store:    store,
+		settings: settings,
+		log:      log,
+	}
+}
+
+// Check возвращает *LockedError, если вход для аккаунта или IP сейчас заблокирован
+func (g *Guard) Check(ctx context.Context, email, ip string) error {
+	for _, key := range g.keys(email, ip) {
+		info, err := g.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if retryAfter := time.Until(info.LockedUntil); retryAfter > 0 {
+			return &LockedError{RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// RegisterFailure учитывает неудачную попытку входа и блокирует аккаунт или IP при превышении порога
+func (g *Guard) RegisterFailure(ctx context.Context, email, ip string) error {
+	limits := map[string]int{
+		login_attempts.AccountKey(normalizeEmail(email)): g.settings.MaxAccountFailures,
+	}
+	if ip != "" {
+		limits[login_attempts.IPKey(ip)] = g.settings.MaxIPFailures
+	}
+	for key, limit := range limits {
+		failures, err := g.store.RecordFailure(ctx, key, g.settings.FailureWindow)
+		if err != nil {
+			return err
+		}
+		if limit <= 0 || failures < limit {
+			continue
+		}
+		lockout := g.lockoutDuration(failures - limit)
+		g.log.Warn("Login locked after failed attempts", "key", key, "failures", failures, "lockout", lockout)
+		if err = g.store.Lock(ctx, key, time.Now().Add(lockout)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterSuccess сбрасывает счётчик аккаунта после успешного входа
+//
+// Счётчик IP не сбрасывается, иначе успешный вход в свой аккаунт позволял бы продолжать перебор чужих
+func (g *Guard) RegisterSuccess(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, login_attempts.AccountKey(normalizeEmail(email)))
+}
+
+// Unlock снимает блокировку аккаунта (используется администратором)
+func (g *Guard) Unlock(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, login_attempts.AccountKey(normalizeEmail(email)))
+}
+
+// lockoutDuration BaseLockout * 2^excess, но не больше MaxLockout
+func (g *Guard) lockoutDuration(excess int) time.Duration {
+	lockout := g.settings.BaseLockout
+	for i := 0; i < excess && lockout < g.settings.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > g.settings.MaxLockout {
+		lockout = g.settings.MaxLockout
+	}
+	return lockout
+}
+
+func (g *Guard) keys(email, ip string) []string {
+	keys := []string{login_attempts.AccountKey(normalizeEmail(email))}
+	if ip != "" {
+		keys = append(keys, login_attempts.IPKey(ip))
+	}
+	return keys
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,20 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogMailer Записывает письма в лог вместо отправки. Используется для локальной разработки
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) *LogMailer {
+	return &LogMailer{log: log}
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	m.log.Info("Mail message", "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
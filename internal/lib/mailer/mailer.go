@@ -0,0 +1,15 @@
+package mailer
+
+import "context"
+
+// Message Письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer Отправка писем пользователям (сброс пароля, подтверждение email и т.д.)
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPMailer Отправляет письма через SMTP сервер
+type SMTPMailer struct {
+	address string
+	auth    smtp.Auth
+	from    string
+	log     *slog.Logger
+}
+
+// NewSMTPMailer создаёт SMTPMailer. Если username пустой, авторизация на SMTP сервере не используется
+func NewSMTPMailer(host, port, username, password, from string, log *slog.Logger) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		address: net.JoinHostPort(host, port),
+		auth:    auth,
+		from:    from,
+		log:     log,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	body := "From: " + m.from + "\r\n" +
+		"To: " + message.To + "\r\n" +
+		"Subject: " + message.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		message.Body
+
+	// net/smtp не принимает контекст, поэтому письмо отправляется в горутине, а ожидание ограничено контекстом
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(m.address, m.auth, m.from, []string{message.To}, []byte(body))
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			m.log.Error("Failed to send mail", "error", err, "to", message.To)
+			return fmt.Errorf("failed to send mail: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
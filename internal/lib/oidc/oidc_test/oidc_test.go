@@ -0,0 +1,185 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const redirectURL = "http://booker.local/login/oidc/callback"
+
+// noRedirectClient не следует за редиректами, чтобы тест мог прочитать код из Location
+var noRedirectClient = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+// authorize проходит страницу входа IdP и возвращает код и state из редиректа обратно в приложение
+func authorize(t *testing.T, authURL string) (code, state string) {
+	res, err := noRedirectClient.Get(authURL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Пример из RFC 7636, приложение B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		oidc.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+
+	verifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	assert.Len(t, verifier, 43)
+}
+
+func TestState(t *testing.T) {
+	key := []byte("state-secret")
+	now := time.Now()
+	state, err := oidc.NewAuthState(time.Minute, now)
+	require.NoError(t, err)
+	encoded, err := oidc.EncodeState(state, key)
+	require.NoError(t, err)
+
+	t.Run("Valid", func(t *testing.T) {
+		decoded, err := oidc.DecodeState(encoded, key, now)
+		require.NoError(t, err)
+		assert.Equal(t, state.State, decoded.State)
+		assert.Equal(t, state.Nonce, decoded.Nonce)
+		assert.Equal(t, state.Verifier, decoded.Verifier)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		_, err := oidc.DecodeState(encoded, key, now.Add(2*time.Minute))
+		assert.ErrorIs(t, err, oidc.ErrInvalidState)
+	})
+	t.Run("WrongKey", func(t *testing.T) {
+		_, err := oidc.DecodeState(encoded, []byte("other"), now)
+		assert.ErrorIs(t, err, oidc.ErrInvalidState)
+	})
+	t.Run("Tampered", func(t *testing.T) {
+		_, err := oidc.DecodeState("x"+encoded, key, now)
+		assert.ErrorIs(t, err, oidc.ErrInvalidState)
+		_, err = oidc.DecodeState("garbage", key, now)
+		assert.ErrorIs(t, err, oidc.ErrInvalidState)
+	})
+}
+
+func TestRoleMapping(t *testing.T) {
+	mapping, err := oidc.ParseRoleMapping([]string{"idp-admins=admin", " idp-staff = user "})
+	require.NoError(t, err)
+	settings := oidc.Settings{RoleMapping: mapping}
+
+	role, ok := settings.MapRole([]string{"idp-staff", "idp-admins"})
+	assert.True(t, ok)
+	assert.Equal(t, "admin", role, "первая запись маппинга имеет приоритет")
+
+	role, ok = settings.MapRole([]string{"idp-staff"})
+	assert.True(t, ok)
+	assert.Equal(t, "user", role)
+
+	_, ok = settings.MapRole([]string{"unknown"})
+	assert.False(t, ok)
+
+	_, err = oidc.ParseRoleMapping([]string{"no-role"})
+	assert.Error(t, err)
+}
+
+func TestProvider(t *testing.T) {
+	idp := oidctest.New("booker", "client-secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{
+		Subject:       "idp-user-1",
+		Email:         "sso@example.com",
+		EmailVerified: true,
+		GivenName:     "Ivan",
+		FamilyName:    "Petrov",
+		Groups:        []string{"idp-admins"},
+	})
+
+	newFlow := func(t *testing.T, provider *oidc.Provider) (string, oidc.AuthState) {
+		state, err := oidc.NewAuthState(time.Minute, time.Now())
+		require.NoError(t, err)
+		authURL, err := provider.AuthCodeURL(context.Background(), state)
+		require.NoError(t, err)
+		code, returnedState := authorize(t, authURL)
+		require.Equal(t, state.State, returnedState)
+		return code, state
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Settings(redirectURL), nil)
+		code, state := newFlow(t, provider)
+
+		claims, err := provider.Exchange(context.Background(), code, state)
+		require.NoError(t, err)
+		assert.Equal(t, oidc.Claims{
+			Subject:       "idp-user-1",
+			Email:         "sso@example.com",
+			EmailVerified: true,
+			GivenName:     "Ivan",
+			FamilyName:    "Petrov",
+			Groups:        []string{"idp-admins"},
+		}, claims)
+
+		_, err = provider.Exchange(context.Background(), code, state)
+		assert.ErrorIs(t, err, oidc.ErrExchangeFailed, "код нельзя использовать повторно")
+	})
+
+	t.Run("WrongVerifier", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Settings(redirectURL), nil)
+		code, state := newFlow(t, provider)
+		state.Verifier = "wrong-verifier-wrong-verifier-wrong-verifier"
+
+		_, err := provider.Exchange(context.Background(), code, state)
+		assert.ErrorIs(t, err, oidc.ErrExchangeFailed)
+	})
+
+	t.Run("WrongClientSecret", func(t *testing.T) {
+		settings := idp.Settings(redirectURL)
+		settings.ClientSecret = "wrong"
+		provider := oidc.NewProvider(settings, nil)
+		code, state := newFlow(t, provider)
+
+		_, err := provider.Exchange(context.Background(), code, state)
+		assert.ErrorIs(t, err, oidc.ErrExchangeFailed)
+	})
+
+	t.Run("NonceMismatch", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Settings(redirectURL), nil)
+		code, state := newFlow(t, provider)
+		idp.NonceOverride = "other-nonce"
+		defer func() { idp.NonceOverride = "" }()
+
+		_, err := provider.Exchange(context.Background(), code, state)
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+
+	t.Run("WrongAudience", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Settings(redirectURL), nil)
+		code, state := newFlow(t, provider)
+		idp.Audience = "another-client"
+		defer func() { idp.Audience = "" }()
+
+		_, err := provider.Exchange(context.Background(), code, state)
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+
+	t.Run("IssuerMismatch", func(t *testing.T) {
+		settings := idp.Settings(redirectURL)
+		settings.Issuer = idp.Issuer() + "/"
+		provider := oidc.NewProvider(settings, nil)
+
+		state, err := oidc.NewAuthState(time.Minute, time.Now())
+		require.NoError(t, err)
+		_, err = provider.AuthCodeURL(context.Background(), state)
+		assert.True(t, errors.Is(err, oidc.ErrDiscovery))
+	})
+}
@@ -0,0 +1,227 @@
+// Package oidctest содержит поддельный OpenID Connect провайдер на httptest для тестов входа через SSO
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const keyID = "test-key"
+
+// User пользователь, от имени которого IdP выдаёт ID токен
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Groups        []string
+}
+
+type pendingCode struct {
+	user          User
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// IdP минимальный провайдер: discovery, authorize, token (с проверкой PKCE) и JWKS
+//
+// Страница входа не показывается: /authorize сразу перенаправляет на redirect_uri с кодом для текущего User
+type IdP struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	// Audience переопределяет aud ID токена, по умолчанию ClientID
+	Audience string
+	// NonceOverride подменяет nonce ID токена
+	NonceOverride string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	user  User
+	codes map[string]pendingCode
+	seq   int
+}
+
+func New(clientID, clientSecret string) *IdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	idp := &IdP{ClientID: clientID, ClientSecret: clientSecret, key: key, codes: map[string]pendingCode{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /authorize", idp.authorize)
+	mux.HandleFunc("POST /token", idp.token)
+	mux.HandleFunc("GET /jwks", idp.jwks)
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func (i *IdP) Close() {
+	i.Server.Close()
+}
+
+func (i *IdP) Issuer() string {
+	return i.Server.URL
+}
+
+// SetUser задаёт пользователя, который "войдёт" при следующем запросе /authorize
+func (i *IdP) SetUser(user User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.user = user
+}
+
+// Settings возвращает настройки клиента для этого провайдера
+func (i *IdP) Settings(redirectURL string) oidc.Settings {
+	return oidc.Settings{
+		Issuer:        i.Issuer(),
+		ClientID:      i.ClientID,
+		ClientSecret:  i.ClientSecret,
+		RedirectURL:   redirectURL,
+		GroupsClaim:   "groups",
+		DefaultRole:   "user",
+		StateTTL:      10 * time.Minute,
+		AutoProvision: true,
+	}
+}
+
+func (i *IdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.Issuer(),
+		"authorization_endpoint":                i.Issuer() + "/authorize",
+		"token_endpoint":                        i.Issuer() + "/token",
+		"jwks_uri":                              i.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"code_challenge_methods_supported":      []string{oidc.CodeChallengeMethod},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != i.ClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != oidc.CodeChallengeMethod || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	i.seq++
+	code := "code-" + strconv.Itoa(i.seq)
+	i.codes[code] = pendingCode{
+		user:          i.user,
+		clientID:      i.ClientID,
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *IdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	}
+	if !ok || clientID != i.ClientID || clientSecret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	i.mu.Lock()
+	pending, found := i.codes[r.PostForm.Get("code")]
+	// Код одноразовый
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+	if !found || pending.redirectURI != r.PostForm.Get("redirect_uri") ||
+		oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != pending.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	audience := i.Audience
+	if audience == "" {
+		audience = pending.clientID
+	}
+	nonce := pending.nonce
+	if i.NonceOverride != "" {
+		nonce = i.NonceOverride
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            i.Issuer(),
+		"sub":            pending.user.Subject,
+		"aud":            audience,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          pending.user.Email,
+		"email_verified": pending.user.EmailVerified,
+		"given_name":     pending.user.GivenName,
+		"family_name":    pending.user.FamilyName,
+		"groups":         pending.user.Groups,
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "idp-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (i *IdP) jwks(w http.ResponseWriter, _ *http.Request) {
+	public := i.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
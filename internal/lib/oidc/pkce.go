@@ -0,0 +1,21 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+)
+
+// CodeChallengeMethod метод PKCE. Метод plain не поддерживается
+const CodeChallengeMethod = "S256"
+
+// NewCodeVerifier генерирует code_verifier PKCE (RFC 7636): 43 символа base64url из 32 случайных байт
+func NewCodeVerifier() (string, error) {
+	return secure_tokens.Generate()
+}
+
+// CodeChallenge возвращает code_challenge для метода S256: base64url(sha256(verifier)) без паддинга
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+package oidc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RoleMapping соответствие группы IdP локальной роли
+type RoleMapping struct {
+	Group string
+	Role  string
+}
+
+// ParseRoleMapping разбирает записи вида группа=роль (Config.OIDCRoleMapping)
+//
+// Порядок записей задаёт приоритет: если пользователь состоит в нескольких группах, берётся роль первой подходящей записи
+func ParseRoleMapping(entries []string) ([]RoleMapping, error) {
+	mapping := make([]RoleMapping, 0, len(entries))
+	for _, entry := range entries {
+		group, role, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid oidc role mapping %q, expected group=role", entry)
+		}
+		mapping = append(mapping, RoleMapping{Group: group, Role: role})
+	}
+	return mapping, nil
+}
+
+// MapRole возвращает локальную роль для групп пользователя. ok == false, если ни одна группа не сопоставлена
+func (s Settings) MapRole(groups []string) (string, bool) {
+	for _, mapping := range s.RoleMapping {
+		if slices.Contains(groups, mapping.Group) {
+			return mapping.Role, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidState = errors.New("state входа через SSO недействителен или истёк")
+
+// AuthState данные незавершённого входа, которые хранятся в подписанной cookie до возврата пользователя от IdP
+//
+// Verifier - code_verifier PKCE, Nonce сверяется с claim nonce ID токена
+type AuthState struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewAuthState генерирует state, nonce и code_verifier для нового входа
+func NewAuthState(ttl time.Duration, now time.Time) (AuthState, error) {
+	state, err := NewCodeVerifier()
+	if err != nil {
+		return AuthState{}, err
+	}
+	nonce, err := NewCodeVerifier()
+	if err != nil {
+		return AuthState{}, err
+	}
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		return AuthState{}, err
+	}
+	return AuthState{State: state, Nonce: nonce, Verifier: verifier, ExpiresAt: now.Add(ttl)}, nil
+}
+
+// EncodeState сериализует состояние и подписывает его HMAC-SHA256: base64url(json).base64url(hmac)
+//
+// Cookie не шифруется, code_verifier в ней не секрет от самого пользователя, важно только, что его нельзя подменить
+func EncodeState(state AuthState, key []byte) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode oidc state: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded, key)), nil
+}
+
+// DecodeState проверяет подпись и срок действия состояния
+func DecodeState(value string, key []byte, now time.Time) (AuthState, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return AuthState{}, ErrInvalidState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(encoded, key)) {
+		return AuthState{}, ErrInvalidState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return AuthState{}, ErrInvalidState
+	}
+	var state AuthState
+	if err = json.Unmarshal(payload, &state); err != nil {
+		return AuthState{}, ErrInvalidState
+	}
+	if !now.Before(state.ExpiresAt) {
+		return AuthState{}, ErrInvalidState
+	}
+	return state, nil
+}
+
+func sign(value string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,25 @@
+package passwords
+
+import "sync/atomic"
+
+var defaultHasher atomic.Pointer[Hasher]
+
+func init() {
+	h, err := NewHasher(DefaultParams)
+	if err != nil {
+		panic(err)
+	}
+	defaultHasher.Store(h)
+}
+
+// Default возвращает Hasher, используемый сервисом
+//
+// До вызова SetDefault используются DefaultParams
+func Default() *Hasher {
+	return defaultHasher.Load()
+}
+
+// SetDefault заменяет Hasher, используемый сервисом. Вызывается при старте с параметрами из конфигурации
+func SetDefault(h *Hasher) {
+	defaultHasher.Store(h)
+}
@@ -0,0 +1,180 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Поддерживаемые алгоритмы хеширования
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+var ErrInvalidHash = errors.New("invalid password hash format")
+
+// Params параметры хеширования паролей
+//
+// Параметры argon2id используются при Algorithm = argon2id, BcryptCost при Algorithm = bcrypt
+type Params struct {
+	Algorithm         string
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Argon2SaltLength  uint32
+	Argon2KeyLength   uint32
+	BcryptCost        int
+}
+
+// DefaultParams параметры по умолчанию (рекомендации OWASP для argon2id)
+var DefaultParams = Params{
+	Algorithm:         AlgorithmArgon2id,
+	Argon2Memory:      64 * 1024,
+	Argon2Iterations:  3,
+	Argon2Parallelism: 2,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+	BcryptCost:        bcrypt.DefaultCost,
+}
+
+// Hasher хеширует и проверяет пароли
+//
+// Хеш хранится в версионированном формате: argon2id в формате PHC ($argon2id$v=19$m=..,t=..,p=..$salt$hash),
+// bcrypt в стандартном формате ($2a$cost$...). По префиксу хеша определяется алгоритм и его параметры,
+// поэтому старые хеши продолжают проверяться после смены настроек
+type Hasher struct {
+	params Params
+	dummy  func() string
+}
+
+// NewHasher создаёт Hasher, проверяя параметры
+func NewHasher(params Params) (*Hasher, error) {
+	switch params.Algorithm {
+	case AlgorithmArgon2id:
+		if params.Argon2Memory == 0 || params.Argon2Iterations == 0 || params.Argon2Parallelism == 0 {
+			return nil, fmt.Errorf("argon2id memory, iterations and parallelism must be positive")
+		}
+		if params.Argon2SaltLength == 0 {
+			params.Argon2SaltLength = DefaultParams.Argon2SaltLength
+		}
+		if params.Argon2KeyLength == 0 {
+			params.Argon2KeyLength = DefaultParams.Argon2KeyLength
+		}
+	case AlgorithmBcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, params.Algorithm)
+	}
+	h := &Hasher{params: params}
+	h.dummy = sync.OnceValue(func() string {
+		hash, _ := h.Hash("dummy-password")
+		return hash
+	})
+	return h, nil
+}
+
+// Hash хеширует пароль текущим алгоритмом с текущими параметрами
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.params.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Argon2Iterations, h.params.Argon2Memory, h.params.Argon2Parallelism, h.params.Argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Argon2Memory, h.params.Argon2Iterations, h.params.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify проверяет пароль по хешу
+//
+// needsRehash = true, если пароль верный, но хеш создан другим алгоритмом или с устаревшими параметрами,
+// в этом случае пароль стоит перехешировать через Hash и сохранить
+func (h *Hasher) Verify(hash string, password string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		stored, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, stored.Argon2Iterations, stored.Argon2Memory, stored.Argon2Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, candidate) != 1 {
+			return false, false, nil
+		}
+		needsRehash = h.params.Algorithm != AlgorithmArgon2id ||
+			stored.Argon2Memory != h.params.Argon2Memory ||
+			stored.Argon2Iterations != h.params.Argon2Iterations ||
+			stored.Argon2Parallelism != h.params.Argon2Parallelism ||
+			uint32(len(salt)) != h.params.Argon2SaltLength ||
+			uint32(len(key)) != h.params.Argon2KeyLength
+		return true, needsRehash, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, err
+		}
+		needsRehash = h.params.Algorithm != AlgorithmBcrypt || cost != h.params.BcryptCost
+		return true, needsRehash, nil
+	default:
+		return false, false, ErrInvalidHash
+	}
+}
+
+// VerifyDummy выполняет проверку пароля с той же стоимостью, что и Verify, но по фиктивному хешу
+//
+// Используется, когда пользователь не найден, что б время ответа не позволяло определить существование email
+func (h *Hasher) VerifyDummy(password string) {
+	_, _, _ = h.Verify(h.dummy(), password)
+}
+
+// decodeArgon2id разбирает хеш в формате PHC: $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+func decodeArgon2id(hash string) (Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	params := Params{Algorithm: AlgorithmArgon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Iterations, &params.Argon2Parallelism); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	if params.Argon2Memory == 0 || params.Argon2Iterations == 0 || params.Argon2Parallelism == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
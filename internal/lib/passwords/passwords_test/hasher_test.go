@@ -0,0 +1,90 @@
+package passwords_test
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/passwords"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// testArgon2Params дешёвые параметры argon2id, что б тесты выполнялись быстро
+var testArgon2Params = passwords.Params{
+	Algorithm:         passwords.AlgorithmArgon2id,
+	Argon2Memory:      1024,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+}
+
+func TestHashAndVerify(t *testing.T) {
+	tests := []struct {
+		testName string
+		params   passwords.Params
+		prefix   string
+	}{
+		{testName: "argon2id", params: testArgon2Params, prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{testName: "bcrypt", params: passwords.Params{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}, prefix: "$2a$04$"},
+	}
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			hasher, err := passwords.NewHasher(test.params)
+			require.NoError(t, err)
+
+			hash, err := hasher.Hash("correct-horse-battery")
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, test.prefix), hash)
+
+			ok, needsRehash, err := hasher.Verify(hash, "correct-horse-battery")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, needsRehash)
+
+			ok, _, err = hasher.Verify(hash, "wrong-password")
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	bcryptHasher, err := passwords.NewHasher(passwords.Params{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost})
+	require.NoError(t, err)
+	weakArgon2Hasher, err := passwords.NewHasher(testArgon2Params)
+	require.NoError(t, err)
+	strongerParams := testArgon2Params
+	strongerParams.Argon2Iterations = 2
+	currentHasher, err := passwords.NewHasher(strongerParams)
+	require.NoError(t, err)
+
+	bcryptHash, err := bcryptHasher.Hash("correct-horse-battery")
+	require.NoError(t, err)
+	weakArgon2Hash, err := weakArgon2Hasher.Hash("correct-horse-battery")
+	require.NoError(t, err)
+
+	for _, hash := range []string{bcryptHash, weakArgon2Hash} {
+		ok, needsRehash, err := currentHasher.Verify(hash, "correct-horse-battery")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, needsRehash, hash)
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	hasher, err := passwords.NewHasher(testArgon2Params)
+	require.NoError(t, err)
+
+	for _, hash := range []string{"", "plain-text", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$broken"} {
+		ok, _, err := hasher.Verify(hash, "correct-horse-battery")
+		assert.ErrorIs(t, err, passwords.ErrInvalidHash, hash)
+		assert.False(t, ok)
+	}
+}
+
+func TestNewHasherRejectsInvalidParams(t *testing.T) {
+	_, err := passwords.NewHasher(passwords.Params{Algorithm: "md5"})
+	assert.ErrorIs(t, err, passwords.ErrUnknownAlgorithm)
+
+	_, err = passwords.NewHasher(passwords.Params{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: 100})
+	assert.Error(t, err)
+}
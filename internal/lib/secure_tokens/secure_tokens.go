@@ -0,0 +1,31 @@
+package secure_tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// tokenBytes Количество случайных байт в токене (256 бит)
+const tokenBytes = 32
+
+// Generate генерирует криптографически стойкий случайный токен в base64url
+//
+// Используется для непрозрачных токенов (refresh токены и т.п.), которые хранятся в БД только в виде хеша
+func Generate() (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash возвращает sha256 хеш токена в hex
+//
+// Токены имеют высокую энтропию, поэтому соль и медленное хеширование (как для паролей) не нужны
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking_entities/get_booking_entity"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking_type/create_booking_type"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
 	"log/slog"
@@ -61,11 +63,14 @@ func GetBookingEntityById(id int64, bookingEntityDBRepo booking_entity_db.Bookin
 	}, nil
 }
 
-func GetBookingEntitiesList(log *slog.Logger, bookingEntityDBRepo booking_entity_db.BookingEntityRepository, ctx context.Context, queryParams query_params.ListQueryParams) (get_booking_entities_list.BookingEntityList, error) {
+// GetBookingEntitiesList возвращает список объектов бронирования, которые пользователь может забронировать
+//
+// Объекты, ограниченные группами, в которых пользователь не состоит, в список не попадают (см. groups_service.BookableBy)
+func GetBookingEntitiesList(log *slog.Logger, bookingEntityDBRepo booking_entity_db.BookingEntityRepository, ctx context.Context, principal auth.Principal, queryParams query_params.ListQueryParams) (get_booking_entities_list.BookingEntityList, error) {
 	const op = "internal/lib/services/booking_entities_service/booking_entities_service.go/GetBookingEntitiesList"
 	log = log.With(slog.String("op", op))
 
-	result, err := bookingEntityDBRepo.GetBookingEntitiesList(ctx, queryParams.Search, queryParams.Limit, queryParams.Offset, queryParams.SortParams)
+	result, err := bookingEntityDBRepo.GetBookingEntitiesList(ctx, queryParams.Search, groups_service.BookableBy(principal), queryParams.Limit, queryParams.Offset, queryParams.SortParams)
 	if err != nil {
 		log.Error("Failed to get booking entities list", "err", err)
 		return get_booking_entities_list.BookingEntityList{}, err
@@ -3,20 +3,121 @@ package booking_service
 import (
 	"context"
 	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
 	bookingModels "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking"
 	create_booking_dto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking/create_booking"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking/get_booking_by_time"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking_type/create_booking_type"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
 	"log/slog"
 )
 
-var ErrBookingNotAvailable = errors.New("Booking not available")
+// ErrBookingNotAvailable интервал занят. Это та же ошибка, что возвращает репозиторий при нарушении
+// ограничения БД на пересечение бронирований, поэтому проверка errors.Is покрывает и параллельные запросы
+var ErrBookingNotAvailable = database.ErrBookingNotAvailable
+var ErrForbidden = errors.New("Forbidden: only the booking owner, their delegate or a user with booking:manage_any permission can change this booking")
+var ErrOwnerChangeForbidden = errors.New("Forbidden: changing the booking owner requires booking:manage_any permission")
+var ErrBookForOtherForbidden = errors.New("Forbidden: creating a booking for another user requires booking:manage_any permission")
+var ErrGroupRestricted = errors.New("Forbidden: booking entity is restricted to members of specific groups")
+var ErrDelegationRequired = errors.New("Forbidden: booking on behalf of another user requires their delegation")
+var ErrOnBehalfOfConflict = errors.New("user_id and on_behalf_of refer to different users")
 
-func CreateBooking(dto create_booking_dto.BookingRequest, bookingRepo booking_db.BookingRepository, ctx context.Context, log *slog.Logger) (create_booking_type.ResponseId, error) {
+// authorizeBookingChange проверяет, что пользователь может изменить или отменить бронирование:
+// он владелец бронирования, его представитель по делегированию или у него есть разрешение booking:manage_any
+func authorizeBookingChange(delegationRepo delegations_db.DelegationRepository, ctx context.Context, booking booking_db.BookingInfo, principal auth.Principal) error {
+	if booking.UserId == principal.UserID || principal.HasPermission(authorization.PermissionBookingManageAny) {
+		return nil
+	}
+	delegated, err := delegationRepo.HasDelegation(ctx, booking.UserId, principal.UserID)
+	if err != nil {
+		return err
+	}
+	if !delegated {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// authorizeOnBehalfOf проверяет, что пользователь может создать бронирование на ownerId:
+// ownerId делегировал ему свои бронирования или у него есть разрешение booking:manage_any
+func authorizeOnBehalfOf(delegationRepo delegations_db.DelegationRepository, ctx context.Context, principal auth.Principal, ownerId int64) error {
+	if principal.HasPermission(authorization.PermissionBookingManageAny) {
+		return nil
+	}
+	delegated, err := delegationRepo.HasDelegation(ctx, ownerId, principal.UserID)
+	if err != nil {
+		return err
+	}
+	if !delegated {
+		return ErrDelegationRequired
+	}
+	return nil
+}
+
+// authorizeBookingEntity проверяет, что объект бронирования и пользователь userId состоят в организации
+// пользователя запроса, и групповые ограничения объекта и его типа для userId
+//
+// Пользователю с разрешением booking:manage_any групповые ограничения не мешают, но объекты
+// и пользователи других организаций недоступны и ему
+func authorizeBookingEntity(bookingEntityRepo booking_entity_db.BookingEntityRepository, ctx context.Context, principal auth.Principal, userId, bookingEntityId int64) error {
+	allowed, err := bookingEntityRepo.CanBook(ctx, bookingEntityId, userId)
+	if err != nil {
+		return err
+	}
+	if !allowed && !principal.HasPermission(authorization.PermissionBookingManageAny) {
+		return ErrGroupRestricted
+	}
+	return nil
+}
+
+// CreateBooking создание бронирования
+//
+// Если user_id не указан, бронирование создаётся на пользователя из токена. Создать бронирование на другого
+// пользователя по user_id может только пользователь с booking:manage_any, а по on_behalf_of - также представитель,
+// которому владелец делегировал свои бронирования. Создатель бронирования сохраняется в created_by.
+// Объект бронирования и владелец должны быть из организации пользователя запроса. Если объект или его тип
+// ограничены группами, владелец должен состоять хотя бы в одной из них.
+// Бронирование всегда создаётся в статусе pending
+func CreateBooking(dto create_booking_dto.BookingRequest, bookingRepo booking_db.BookingRepository, bookingEntityRepo booking_entity_db.BookingEntityRepository, delegationRepo delegations_db.DelegationRepository, principal auth.Principal, ctx context.Context, log *slog.Logger) (create_booking_type.ResponseId, error) {
 	log = log.With(slog.String("op", "internal/lib/services/booking_service/booking_service.go/CreateBooking"))
 
+	if dto.Status != "" && dto.Status != StatusPending {
+		return create_booking_type.ResponseId{}, ErrStatusNotEditable
+	}
+	dto.Status = StatusPending
+	if dto.UserId == 0 {
+		dto.UserId = principal.UserID
+	}
+	if dto.OnBehalfOf != 0 && dto.OnBehalfOf != principal.UserID {
+		if dto.UserId != principal.UserID && dto.UserId != dto.OnBehalfOf {
+			return create_booking_type.ResponseId{}, ErrOnBehalfOfConflict
+		}
+		if err := authorizeOnBehalfOf(delegationRepo, ctx, principal, dto.OnBehalfOf); err != nil {
+			if errors.Is(err, ErrDelegationRequired) {
+				log.Warn("User is not allowed to create booking on behalf of another user", "user_id", principal.UserID, "owner_id", dto.OnBehalfOf)
+			} else {
+				log.Error("Check delegation failed", "error", err)
+			}
+			return create_booking_type.ResponseId{}, err
+		}
+		dto.UserId = dto.OnBehalfOf
+	} else if dto.UserId != principal.UserID && !principal.HasPermission(authorization.PermissionBookingManageAny) {
+		log.Warn("User is not allowed to create booking for another user", "user_id", principal.UserID, "owner_id", dto.UserId)
+		return create_booking_type.ResponseId{}, ErrBookForOtherForbidden
+	}
+
+	if err := authorizeBookingEntity(bookingEntityRepo, ctx, principal, dto.UserId, dto.BookingEntityId); err != nil {
+		if !errors.Is(err, booking_entity_db.ErrBookingEntityNotFound) && !errors.Is(err, booking_entity_db.ErrBookingUserNotFound) && !errors.Is(err, ErrGroupRestricted) {
+			log.Error("Check booking entity groups failed", "error", err)
+		}
+		return create_booking_type.ResponseId{}, err
+	}
+
 	//Проверка, что время свободно
 	available, err := bookingRepo.CheckBookingAvailability(ctx, dto.BookingEntityId, dto.StartTime, dto.EndTime)
 	if err != nil {
@@ -26,8 +127,13 @@ func CreateBooking(dto create_booking_dto.BookingRequest, bookingRepo booking_db
 	if !available {
 		return create_booking_type.ResponseId{}, ErrBookingNotAvailable
 	}
-	id, err := bookingRepo.CreateBooking(ctx, dto.UserId, dto.BookingEntityId, dto.Status, dto.StartTime, dto.EndTime)
+	id, err := bookingRepo.CreateBooking(ctx, dto.UserId, principal.UserID, dto.BookingEntityId, dto.Status, dto.StartTime, dto.EndTime)
 	if err != nil {
+		// Интервал мог занять параллельный запрос между проверкой и вставкой
+		if errors.Is(err, ErrBookingNotAvailable) {
+			log.Warn("Booking interval was taken concurrently", "error", err)
+			return create_booking_type.ResponseId{}, ErrBookingNotAvailable
+		}
 		log.Error("CreateBooking failed", "error", err)
 		return create_booking_type.ResponseId{}, err
 	}
@@ -48,6 +154,7 @@ func GetBookingByTime(bookingRepo booking_db.BookingRepository, dto get_booking_
 		bookingInfo := bookingModels.BookingInfo{
 			Id:            booking.Id,
 			UserId:        booking.UserId,
+			CreatedBy:     booking.CreatedBy,
 			BookingEntity: booking.BookingEntityId,
 			Status:        booking.Status,
 			StartTime:     booking.StartTime,
@@ -58,13 +165,13 @@ func GetBookingByTime(bookingRepo booking_db.BookingRepository, dto get_booking_
 	return bookingsList, nil
 }
 
-// GetMyBooking Получить все бронирования у выбранного пользователя
+// GetMyBooking Получить бронирования пользователя и бронирования, которые он создал как представитель других пользователей
 func GetMyBooking(bookingRepo booking_db.BookingRepository, userId int64, queryParams query_params.ListQueryParams, log *slog.Logger, ctx context.Context) (bookingModels.BookingsList, error) {
 	log = log.With(slog.String("op", "internal/lib/services/booking_service/get_booking_by_user_id"))
 
-	bookings, err := bookingRepo.GetBookingsByUserId(ctx, userId, queryParams)
+	bookings, err := bookingRepo.GetBookingsForUser(ctx, userId, queryParams)
 	if err != nil {
-		log.Error("GetBookingByUserId failed", "error", err)
+		log.Error("GetBookingsForUser failed", "error", err)
 		return bookingModels.BookingsList{}, err
 	}
 
@@ -73,6 +180,7 @@ func GetMyBooking(bookingRepo booking_db.BookingRepository, userId int64, queryP
 		bookingInfo := bookingModels.BookingInfo{
 			Id:            booking.Id,
 			UserId:        booking.UserId,
+			CreatedBy:     booking.CreatedBy,
 			BookingEntity: booking.BookingEntityId,
 			Status:        booking.Status,
 			StartTime:     booking.StartTime,
@@ -108,6 +216,7 @@ func GetBookingByBookingEntity(bookingRepo booking_db.BookingRepository, booking
 		bookingInfo := bookingModels.BookingInfo{
 			Id:            booking.Id,
 			UserId:        booking.UserId,
+			CreatedBy:     booking.CreatedBy,
 			BookingEntity: booking.BookingEntityId,
 			Status:        booking.Status,
 			StartTime:     booking.StartTime,
@@ -140,6 +249,7 @@ func GetBookingById(bookingRepo booking_db.BookingRepository, bookingId int64, l
 	return bookingModels.BookingInfo{
 		Id:            booking.Id,
 		UserId:        booking.UserId,
+		CreatedBy:     booking.CreatedBy,
 		BookingEntity: booking.BookingEntityId,
 		Status:        booking.Status,
 		StartTime:     booking.StartTime,
@@ -148,9 +258,53 @@ func GetBookingById(bookingRepo booking_db.BookingRepository, bookingId int64, l
 }
 
 // UpdateBooking обновление бронирования
-func UpdateBooking(bookingRepo booking_db.BookingRepository, dto create_booking_dto.BookingRequest, bookingId int64, log *slog.Logger, ctx context.Context) (create_booking_type.ResponseId, error) {
+//
+// Изменить бронирование может его владелец, его представитель по делегированию или пользователь с разрешением booking:manage_any.
+// Если user_id в запросе не указан, владелец не меняется. Передать бронирование другому пользователю
+// может только пользователь с booking:manage_any. При переносе на другой объект или другому пользователю
+// проверяется, что они из той же организации, и групповые ограничения объекта.
+// Статус через обновление не меняется: переходы выполняет ChangeBookingStatus. Изменить можно только
+// бронирование в статусе pending или confirmed, иначе возвращается ErrBookingNotEditable
+func UpdateBooking(bookingRepo booking_db.BookingRepository, bookingEntityRepo booking_entity_db.BookingEntityRepository, delegationRepo delegations_db.DelegationRepository, dto create_booking_dto.BookingRequest, bookingId int64, principal auth.Principal, log *slog.Logger, ctx context.Context) (create_booking_type.ResponseId, error) {
 	log = log.With(slog.String("op", "internal/lib/services/booking_service/update_booking"))
 
+	booking, err := bookingRepo.GetBookingById(ctx, bookingId)
+	if err != nil {
+		log.Error("GetBookingById failed", "error", err)
+		return create_booking_type.ResponseId{}, err
+	}
+	if err = authorizeBookingChange(delegationRepo, ctx, booking, principal); err != nil {
+		log.Warn("User is not allowed to update booking", "user_id", principal.UserID, "owner_id", booking.UserId)
+		return create_booking_type.ResponseId{}, err
+	}
+	if !editableStatuses[booking.Status] {
+		log.Warn("Booking cannot be updated in current status", "id", bookingId, "status", booking.Status)
+		return create_booking_type.ResponseId{}, ErrBookingNotEditable
+	}
+	// Статус меняется только через переходы автомата, в запросе можно лишь повторить текущий
+	if dto.Status == "" {
+		dto.Status = booking.Status
+	}
+	if dto.Status != booking.Status {
+		log.Warn("Booking status cannot be changed by update", "status", booking.Status, "new_status", dto.Status)
+		return create_booking_type.ResponseId{}, ErrStatusNotEditable
+	}
+	if dto.UserId == 0 {
+		dto.UserId = booking.UserId
+	}
+	if dto.UserId != booking.UserId && !principal.HasPermission(authorization.PermissionBookingManageAny) {
+		log.Warn("User is not allowed to change booking owner", "user_id", principal.UserID, "new_owner_id", dto.UserId)
+		return create_booking_type.ResponseId{}, ErrOwnerChangeForbidden
+	}
+	if dto.BookingEntityId != booking.BookingEntityId || dto.UserId != booking.UserId {
+		if err = authorizeBookingEntity(bookingEntityRepo, ctx, principal, dto.UserId, dto.BookingEntityId); err != nil {
+			if !errors.Is(err, booking_entity_db.ErrBookingEntityNotFound) && !errors.Is(err, booking_entity_db.ErrBookingUserNotFound) && !errors.Is(err, ErrGroupRestricted) {
+				log.Error("Check booking entity groups failed", "error", err)
+			}
+			return create_booking_type.ResponseId{}, err
+		}
+	}
+
 	//Проверка, что время свободно
 	available, err := bookingRepo.CheckBookingAvailability(ctx, dto.BookingEntityId, dto.StartTime, dto.EndTime, bookingId)
 	if err != nil {
@@ -172,6 +326,10 @@ func UpdateBooking(bookingRepo booking_db.BookingRepository, dto create_booking_
 
 	err = bookingRepo.UpdateBooking(ctx, updateDbDto, bookingId)
 	if err != nil {
+		if errors.Is(err, ErrBookingNotAvailable) {
+			log.Warn("Booking interval was taken concurrently", "error", err)
+			return create_booking_type.ResponseId{}, ErrBookingNotAvailable
+		}
 		log.Error("Update Booking failed", "error", err)
 		return create_booking_type.ResponseId{}, err
 	}
@@ -179,15 +337,11 @@ func UpdateBooking(bookingRepo booking_db.BookingRepository, dto create_booking_
 	return create_booking_type.ResponseId{ID: bookingId}, nil
 }
 
-func DeleteBooking(bookingRepo booking_db.BookingRepository, bookingId int64, log *slog.Logger, ctx context.Context) error {
-
-	log = log.With(slog.String("op", "internal/lib/services/booking_service/delete_booking"))
-
-	err := bookingRepo.DeleteBooking(ctx, bookingId)
-	if err != nil {
-		log.Error("DeleteBooking failed", "error", err)
-		return err
-	}
-
-	return nil
+// DeleteBooking отмена бронирования: переводит его в статус cancelled. Запись и история статусов сохраняются
+//
+// Отменить бронирование может его владелец, его представитель по делегированию или пользователь с разрешением booking:manage_any.
+// Бронирование в конечном статусе или после прихода пользователя отменить нельзя (ErrInvalidStatusTransition)
+func DeleteBooking(bookingRepo booking_db.BookingRepository, delegationRepo delegations_db.DelegationRepository, bookingId int64, principal auth.Principal, log *slog.Logger, ctx context.Context) error {
+	_, err := ChangeBookingStatus(bookingRepo, delegationRepo, bookingId, StatusCancelled, principal, log, ctx)
+	return err
 }
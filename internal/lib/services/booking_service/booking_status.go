@@ -0,0 +1,138 @@
+package booking_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
+	bookingModels "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"log/slog"
+)
+
+// Статусы бронирования
+//
+// pending -> confirmed -> checked_in -> completed. Бронирование можно отменить до того, как пользователь пришёл,
+// а подтверждённое бронирование, на которое пользователь не пришёл, отмечается как no_show.
+// completed, cancelled и no_show - конечные статусы
+const (
+	StatusPending   = "pending"    // Создано и ожидает подтверждения
+	StatusConfirmed = "confirmed"  // Подтверждено
+	StatusCheckedIn = "checked_in" // Пользователь пришёл
+	StatusCompleted = "completed"  // Завершено
+	StatusCancelled = "cancelled"  // Отменено
+	StatusNoShow    = "no_show"    // Пользователь не пришёл
+)
+
+var ErrInvalidStatusTransition = errors.New("Invalid booking status transition")
+var ErrStatusChangeForbidden = errors.New("Forbidden: confirming a booking or marking it as no-show requires booking:manage_any permission")
+var ErrStatusNotEditable = errors.New("Booking status can only be changed via the confirm, check-in, complete, cancel and no-show endpoints")
+var ErrBookingNotEditable = errors.New("Only pending and confirmed bookings can be updated")
+
+// statusTransitions допустимые переходы из каждого статуса. Из конечных статусов переходов нет
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCompleted},
+}
+
+// editableStatuses статусы, в которых бронирование можно изменить: после прихода пользователя
+// и в конечных статусах время, объект и владелец бронирования не меняются
+var editableStatuses = map[string]bool{
+	StatusPending:   true,
+	StatusConfirmed: true,
+}
+
+// managerStatuses статусы, в которые бронирование переводит только пользователь с booking:manage_any.
+// В остальные статусы его переводит также владелец или его представитель по делегированию
+var managerStatuses = map[string]bool{
+	StatusConfirmed: true,
+	StatusNoShow:    true,
+}
+
+// CanTransition проверяет, что бронирование можно перевести из статуса from в статус to
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeBookingStatus переводит бронирование в статус status и записывает, кто и когда его перевёл
+//
+// Подтвердить бронирование и отметить неявку может только пользователь с booking:manage_any,
+// отменить, отметить приход и завершить - также владелец бронирования или его представитель.
+// Недопустимый переход возвращает ErrInvalidStatusTransition
+func ChangeBookingStatus(bookingRepo booking_db.BookingRepository, delegationRepo delegations_db.DelegationRepository, bookingId int64, status string, principal auth.Principal, log *slog.Logger, ctx context.Context) (bookingModels.BookingInfo, error) {
+	log = log.With(slog.String("op", "internal/lib/services/booking_service/change_booking_status"))
+
+	booking, err := bookingRepo.GetBookingById(ctx, bookingId)
+	if err != nil {
+		log.Error("GetBookingById failed", "error", err)
+		return bookingModels.BookingInfo{}, err
+	}
+	if managerStatuses[status] {
+		if !principal.HasPermission(authorization.PermissionBookingManageAny) {
+			log.Warn("User is not allowed to set booking status", "user_id", principal.UserID, "status", status)
+			return bookingModels.BookingInfo{}, ErrStatusChangeForbidden
+		}
+	} else if err = authorizeBookingChange(delegationRepo, ctx, booking, principal); err != nil {
+		log.Warn("User is not allowed to change booking status", "user_id", principal.UserID, "owner_id", booking.UserId)
+		return bookingModels.BookingInfo{}, err
+	}
+	if !CanTransition(booking.Status, status) {
+		log.Warn("Invalid booking status transition", "from", booking.Status, "to", status)
+		return bookingModels.BookingInfo{}, fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, booking.Status, status)
+	}
+
+	err = bookingRepo.ChangeStatus(ctx, bookingId, booking.Status, status, principal.UserID)
+	if err != nil {
+		if errors.Is(err, booking_db.ErrBookingStatusChanged) {
+			log.Warn("Booking status was changed concurrently", "id", bookingId)
+		} else {
+			log.Error("ChangeStatus failed", "error", err)
+		}
+		return bookingModels.BookingInfo{}, err
+	}
+
+	return bookingModels.BookingInfo{
+		Id:            booking.Id,
+		UserId:        booking.UserId,
+		CreatedBy:     booking.CreatedBy,
+		BookingEntity: booking.BookingEntityId,
+		Status:        status,
+		StartTime:     booking.StartTime,
+		EndTime:       booking.EndTime,
+	}, nil
+}
+
+// GetBookingStatusHistory история статусов бронирования
+func GetBookingStatusHistory(bookingRepo booking_db.BookingRepository, bookingId int64, log *slog.Logger, ctx context.Context) (bookingModels.BookingStatusHistory, error) {
+	log = log.With(slog.String("op", "internal/lib/services/booking_service/get_booking_status_history"))
+
+	// Бронирование ищется отдельно, чтобы отличить несуществующее бронирование от бронирования без истории
+	if _, err := bookingRepo.GetBookingById(ctx, bookingId); err != nil {
+		log.Error("GetBookingById failed", "error", err)
+		return bookingModels.BookingStatusHistory{}, err
+	}
+	history, err := bookingRepo.GetStatusHistory(ctx, bookingId)
+	if err != nil {
+		log.Error("GetStatusHistory failed", "error", err)
+		return bookingModels.BookingStatusHistory{}, err
+	}
+
+	changes := make([]bookingModels.BookingStatusChange, 0, len(history))
+	for _, change := range history {
+		changes = append(changes, bookingModels.BookingStatusChange{
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			ChangedBy:  change.ChangedBy,
+			ChangedAt:  change.ChangedAt,
+		})
+	}
+	return bookingModels.BookingStatusHistory{History: changes}, nil
+}
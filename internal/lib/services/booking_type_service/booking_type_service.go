@@ -8,6 +8,8 @@ import (
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking_type/get_booking_type_list"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking_type/update_booking_type"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
 	"log/slog"
 	"strconv"
@@ -47,11 +49,12 @@ func GetBookingTypeById(id int64, bookingTypeDBRepo booking_type_db.BookingTypeR
 	}, nil
 }
 
-func GetBookingTypeList(log *slog.Logger, bookingTypeDBRepo booking_type_db.BookingTypeRepository, ctx context.Context, queryParams query_params.ListQueryParams) (get_booking_type_list.BookingTypeList, error) {
+// GetBookingTypeList возвращает список типов бронирования, доступных пользователю с учётом групповых ограничений
+func GetBookingTypeList(log *slog.Logger, bookingTypeDBRepo booking_type_db.BookingTypeRepository, ctx context.Context, principal auth.Principal, queryParams query_params.ListQueryParams) (get_booking_type_list.BookingTypeList, error) {
 	const op = "internal/lib/services/user_service/user_service.go/GetUserList"
 	log = log.With(slog.String("op", op))
 
-	result, err := bookingTypeDBRepo.GetBookingTypeList(ctx, queryParams.Search, queryParams.Limit, queryParams.Offset, queryParams.SortParams)
+	result, err := bookingTypeDBRepo.GetBookingTypeList(ctx, queryParams.Search, groups_service.BookableBy(principal), queryParams.Limit, queryParams.Offset, queryParams.SortParams)
 	if err != nil {
 		log.Error("Failed to get users list", "err", err)
 		return get_booking_type_list.BookingTypeList{}, err
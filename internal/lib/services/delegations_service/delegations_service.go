@@ -0,0 +1,82 @@
+package delegations_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/delegations"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"log/slog"
+)
+
+var ErrSelfDelegation = errors.New("Нельзя делегировать бронирования самому себе")
+
+// Grant разрешает пользователю delegateId создавать, менять и отменять бронирования пользователя запроса
+func Grant(log *slog.Logger, delegationRepository delegations_db.DelegationRepository, ctx context.Context, principal auth.Principal, delegateId int64) error {
+	const op = "internal/lib/services/delegations_service/delegations_service.go/Grant"
+	log = log.With(slog.String("op", op), slog.Int64("owner_id", principal.UserID), slog.Int64("delegate_id", delegateId))
+
+	if delegateId == principal.UserID {
+		return ErrSelfDelegation
+	}
+	if err := delegationRepository.CreateDelegation(ctx, principal.UserID, delegateId); err != nil {
+		if !errors.Is(err, delegations_db.ErrDelegateNotFound) {
+			log.Error("Failed to create delegation", "err", err)
+		}
+		return err
+	}
+	log.Info("Bookings delegated")
+	return nil
+}
+
+// Revoke отзывает делегирование бронирований пользователя запроса пользователю delegateId
+func Revoke(log *slog.Logger, delegationRepository delegations_db.DelegationRepository, ctx context.Context, principal auth.Principal, delegateId int64) error {
+	const op = "internal/lib/services/delegations_service/delegations_service.go/Revoke"
+	log = log.With(slog.String("op", op), slog.Int64("owner_id", principal.UserID), slog.Int64("delegate_id", delegateId))
+
+	if err := delegationRepository.DeleteDelegation(ctx, principal.UserID, delegateId); err != nil {
+		if !errors.Is(err, delegations_db.ErrDelegationNotFound) {
+			log.Error("Failed to delete delegation", "err", err)
+		}
+		return err
+	}
+	log.Info("Delegation revoked")
+	return nil
+}
+
+// List возвращает делегирования пользователя запроса: кому он делегировал свои бронирования и кто делегировал ему
+func List(log *slog.Logger, delegationRepository delegations_db.DelegationRepository, ctx context.Context, principal auth.Principal) (delegations.DelegationListResponse, error) {
+	const op = "internal/lib/services/delegations_service/delegations_service.go/List"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", principal.UserID))
+
+	granted, err := delegationRepository.ListByOwner(ctx, principal.UserID)
+	if err != nil {
+		log.Error("Failed to list granted delegations", "err", err)
+		return delegations.DelegationListResponse{}, err
+	}
+	received, err := delegationRepository.ListByDelegate(ctx, principal.UserID)
+	if err != nil {
+		log.Error("Failed to list received delegations", "err", err)
+		return delegations.DelegationListResponse{}, err
+	}
+	return delegations.DelegationListResponse{
+		Response: resp.OK(),
+		Granted:  toDelegationInfo(granted),
+		Received: toDelegationInfo(received),
+	}, nil
+}
+
+func toDelegationInfo(list []delegations_db.DelegationInfo) []delegations.DelegationInfo {
+	data := make([]delegations.DelegationInfo, 0, len(list))
+	for _, delegation := range list {
+		data = append(data, delegations.DelegationInfo{
+			UserID:    delegation.UserID,
+			Email:     delegation.Email,
+			FirstName: delegation.FirstName,
+			LastName:  delegation.LastName,
+			CreatedAt: delegation.CreatedAt,
+		})
+	}
+	return data
+}
@@ -0,0 +1,208 @@
+package groups_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/groups"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"log/slog"
+)
+
+// BookableBy возвращает id пользователя для фильтрации списков по групповым ограничениям
+//
+// Пользователю с разрешением booking:manage_any доступны все типы и объекты бронирования, для него возвращается 0 (без фильтра)
+func BookableBy(principal auth.Principal) int64 {
+	if principal.HasPermission(authorization.PermissionBookingManageAny) {
+		return 0
+	}
+	return principal.UserID
+}
+
+func CreateGroup(log *slog.Logger, groupRepository groups_db.GroupRepository, ctx context.Context, request groups.CreateGroupRequest) (groups.CreateGroupResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/CreateGroup"
+	log = log.With(slog.String("op", op))
+
+	id, err := groupRepository.CreateGroup(ctx, request.Name, request.Description)
+	if err != nil {
+		if !errors.Is(err, groups_db.ErrGroupAlreadyExists) {
+			log.Error("Failed to create group", "err", err)
+		}
+		return groups.CreateGroupResponse{}, err
+	}
+	log.Info("Group created", "group_id", id, "name", request.Name)
+	return groups.CreateGroupResponse{Response: resp.OK(), ID: id}, nil
+}
+
+func ListGroups(log *slog.Logger, groupRepository groups_db.GroupRepository, ctx context.Context) (groups.GroupListResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/ListGroups"
+	log = log.With(slog.String("op", op))
+
+	result, err := groupRepository.ListGroups(ctx)
+	if err != nil {
+		log.Error("Failed to list groups", "err", err)
+		return groups.GroupListResponse{}, err
+	}
+	data := make([]groups.GroupInfo, 0, len(result))
+	for _, group := range result {
+		data = append(data, toGroupInfo(group))
+	}
+	return groups.GroupListResponse{Response: resp.OK(), Data: data}, nil
+}
+
+// GetGroup возвращает группу вместе с участниками
+func GetGroup(log *slog.Logger, groupRepository groups_db.GroupRepository, ctx context.Context, id int64) (groups.GroupResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/GetGroup"
+	log = log.With(slog.String("op", op), slog.Int64("group_id", id))
+
+	group, err := groupRepository.GetGroup(ctx, id)
+	if err != nil {
+		if !errors.Is(err, groups_db.ErrGroupNotFound) {
+			log.Error("Failed to get group", "err", err)
+		}
+		return groups.GroupResponse{}, err
+	}
+	members, err := groupRepository.ListMembers(ctx, id)
+	if err != nil {
+		log.Error("Failed to list group members", "err", err)
+		return groups.GroupResponse{}, err
+	}
+	data := make([]groups.MemberInfo, 0, len(members))
+	for _, member := range members {
+		data = append(data, groups.MemberInfo{
+			UserID:    member.UserID,
+			Email:     member.Email,
+			FirstName: member.FirstName,
+			LastName:  member.LastName,
+			AddedAt:   member.AddedAt,
+		})
+	}
+	return groups.GroupResponse{Response: resp.OK(), GroupInfo: toGroupInfo(group), Members: data}, nil
+}
+
+func DeleteGroup(log *slog.Logger, groupRepository groups_db.GroupRepository, ctx context.Context, id int64) error {
+	const op = "internal/lib/services/groups_service/groups_service.go/DeleteGroup"
+	log = log.With(slog.String("op", op), slog.Int64("group_id", id))
+
+	if err := groupRepository.DeleteGroup(ctx, id); err != nil {
+		if !errors.Is(err, groups_db.ErrGroupNotFound) {
+			log.Error("Failed to delete group", "err", err)
+		}
+		return err
+	}
+	log.Info("Group deleted")
+	return nil
+}
+
+func AddMember(log *slog.Logger, groupRepository groups_db.GroupRepository, ctx context.Context, groupId, userId int64) error {
+	const op = "internal/lib/services/groups_service/groups_service.go/AddMember"
+	log = log.With(slog.String("op", op), slog.Int64("group_id", groupId), slog.Int64("user_id", userId))
+
+	if err := groupRepository.AddMember(ctx, groupId, userId); err != nil {
+		if !errors.Is(err, groups_db.ErrGroupNotFound) && !errors.Is(err, groups_db.ErrMemberUserNotFound) {
+			log.Error("Failed to add group member", "err", err)
+		}
+		return err
+	}
+	log.Info("User added to group")
+	return nil
+}
+
+func RemoveMember(log *slog.Logger, groupRepository groups_db.GroupRepository, ctx context.Context, groupId, userId int64) error {
+	const op = "internal/lib/services/groups_service/groups_service.go/RemoveMember"
+	log = log.With(slog.String("op", op), slog.Int64("group_id", groupId), slog.Int64("user_id", userId))
+
+	if err := groupRepository.RemoveMember(ctx, groupId, userId); err != nil {
+		if !errors.Is(err, groups_db.ErrMemberNotFound) {
+			log.Error("Failed to remove group member", "err", err)
+		}
+		return err
+	}
+	log.Info("User removed from group")
+	return nil
+}
+
+// GetBookingTypeGroups возвращает группы, которым доступен тип бронирования
+func GetBookingTypeGroups(log *slog.Logger, groupRepository groups_db.GroupRepository, bookingTypeRepository booking_type_db.BookingTypeRepository, ctx context.Context, bookingTypeId int64) (groups.BookingGroupsResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/GetBookingTypeGroups"
+	log = log.With(slog.String("op", op), slog.Int64("booking_type_id", bookingTypeId))
+
+	if _, err := bookingTypeRepository.GetBookingType(ctx, bookingTypeId); err != nil {
+		return groups.BookingGroupsResponse{}, err
+	}
+	groupIds, err := groupRepository.GetBookingTypeGroups(ctx, bookingTypeId)
+	if err != nil {
+		log.Error("Failed to get booking type groups", "err", err)
+		return groups.BookingGroupsResponse{}, err
+	}
+	return groups.BookingGroupsResponse{Response: resp.OK(), GroupIDs: groupIds}, nil
+}
+
+// SetBookingTypeGroups ограничивает бронирование объектов типа участниками групп. Пустой список снимает ограничение
+func SetBookingTypeGroups(log *slog.Logger, groupRepository groups_db.GroupRepository, bookingTypeRepository booking_type_db.BookingTypeRepository, ctx context.Context, bookingTypeId int64, request groups.BookingGroupsRequest) (groups.BookingGroupsResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/SetBookingTypeGroups"
+	log = log.With(slog.String("op", op), slog.Int64("booking_type_id", bookingTypeId))
+
+	//Проверяем то тип бронирования существует
+	if _, err := bookingTypeRepository.GetBookingType(ctx, bookingTypeId); err != nil {
+		return groups.BookingGroupsResponse{}, err
+	}
+	if err := groupRepository.SetBookingTypeGroups(ctx, bookingTypeId, request.GroupIDs); err != nil {
+		if !errors.Is(err, groups_db.ErrGroupNotFound) {
+			log.Error("Failed to set booking type groups", "err", err)
+		}
+		return groups.BookingGroupsResponse{}, err
+	}
+	log.Info("Booking type groups updated", "group_ids", request.GroupIDs)
+	return GetBookingTypeGroups(log, groupRepository, bookingTypeRepository, ctx, bookingTypeId)
+}
+
+// GetBookingEntityGroups возвращает группы, которым доступен объект бронирования
+//
+// Ограничения типа объекта сюда не входят, они возвращаются GetBookingTypeGroups
+func GetBookingEntityGroups(log *slog.Logger, groupRepository groups_db.GroupRepository, bookingEntityRepository booking_entity_db.BookingEntityRepository, ctx context.Context, bookingEntityId int64) (groups.BookingGroupsResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/GetBookingEntityGroups"
+	log = log.With(slog.String("op", op), slog.Int64("booking_entity_id", bookingEntityId))
+
+	if _, err := bookingEntityRepository.GetBookingEntity(ctx, bookingEntityId); err != nil {
+		return groups.BookingGroupsResponse{}, err
+	}
+	groupIds, err := groupRepository.GetBookingEntityGroups(ctx, bookingEntityId)
+	if err != nil {
+		log.Error("Failed to get booking entity groups", "err", err)
+		return groups.BookingGroupsResponse{}, err
+	}
+	return groups.BookingGroupsResponse{Response: resp.OK(), GroupIDs: groupIds}, nil
+}
+
+// SetBookingEntityGroups ограничивает бронирование объекта участниками групп. Пустой список снимает ограничение
+func SetBookingEntityGroups(log *slog.Logger, groupRepository groups_db.GroupRepository, bookingEntityRepository booking_entity_db.BookingEntityRepository, ctx context.Context, bookingEntityId int64, request groups.BookingGroupsRequest) (groups.BookingGroupsResponse, error) {
+	const op = "internal/lib/services/groups_service/groups_service.go/SetBookingEntityGroups"
+	log = log.With(slog.String("op", op), slog.Int64("booking_entity_id", bookingEntityId))
+
+	if _, err := bookingEntityRepository.GetBookingEntity(ctx, bookingEntityId); err != nil {
+		return groups.BookingGroupsResponse{}, err
+	}
+	if err := groupRepository.SetBookingEntityGroups(ctx, bookingEntityId, request.GroupIDs); err != nil {
+		if !errors.Is(err, groups_db.ErrGroupNotFound) {
+			log.Error("Failed to set booking entity groups", "err", err)
+		}
+		return groups.BookingGroupsResponse{}, err
+	}
+	log.Info("Booking entity groups updated", "group_ids", request.GroupIDs)
+	return GetBookingEntityGroups(log, groupRepository, bookingEntityRepository, ctx, bookingEntityId)
+}
+
+func toGroupInfo(group groups_db.GroupInfo) groups.GroupInfo {
+	return groups.GroupInfo{
+		ID:          group.ID,
+		Name:        group.Name,
+		Description: group.Description,
+		MemberCount: group.MemberCount,
+		CreatedAt:   group.CreatedAt,
+	}
+}
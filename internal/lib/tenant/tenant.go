@@ -0,0 +1,89 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+)
+
+// DefaultID организация по умолчанию. В неё переносятся данные, созданные до появления организаций,
+// и попадают пользователи, зарегистрированные системными вызовами (регистрация, OIDC, create-admin)
+const DefaultID int64 = 1
+
+// noneID организация, которой нет: запросы, ограниченные ею, ничего не находят, а вставки нарушают внешний ключ
+const noneID int64 = 0
+
+type tenantKey struct{}
+
+type systemKey struct{}
+
+// WithID привязывает контекст к организации id без пользователя запроса. Используется для SCIM,
+// клиент которого обслуживает одну организацию, и командой create-admin --org
+func WithID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// WithSystem помечает контекст как системный вызов, запросы в котором не ограничиваются организацией:
+// публичные маршруты до аутентификации (регистрация, вход, обновление токена, сброс пароля) и create-admin
+func WithSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey{}, true)
+}
+
+// IsSystem проверяет, что контекст помечен WithSystem
+func IsSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey{}).(bool)
+	return system
+}
+
+// FromContext возвращает организацию запроса
+//
+// Организация берётся из Principal, который кладёт в контекст AuthMiddleware или APIKeyMiddleware, а без пользователя -
+// из WithID. Токены, выданные до появления организаций, не содержат claim tenant_id и относятся к организации по умолчанию.
+// ok == false только для системных вызовов (WithSystem), запросы в них не ограничиваются организацией.
+// Контекст без пользователя, организации и системной метки ограничивается несуществующей организацией,
+// так что забытая метка не открывает данные всех организаций
+func FromContext(ctx context.Context) (int64, bool) {
+	if principal, ok := auth.FromContext(ctx); ok {
+		if principal.TenantID == 0 {
+			return DefaultID, true
+		}
+		return principal.TenantID, true
+	}
+	if id, ok := ctx.Value(tenantKey{}).(int64); ok {
+		return id, true
+	}
+	if IsSystem(ctx) {
+		return 0, false
+	}
+	return noneID, true
+}
+
+// ForInsert организация для новой записи: организация запроса, а для системных вызовов - организация по умолчанию
+func ForInsert(ctx context.Context) int64 {
+	if id, ok := FromContext(ctx); ok {
+		return id
+	}
+	return DefaultID
+}
+
+// Condition возвращает условие "<column> = $n" для ограничения запроса организацией запроса
+// и добавляет id организации в args
+//
+// Для системных вызовов возвращает пустую строку и не меняет args
+func Condition(ctx context.Context, column string, args *[]interface{}) string {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	*args = append(*args, id)
+	return fmt.Sprintf("%s = $%d", column, len(*args))
+}
+
+// And то же, что Condition, но для добавления к уже существующему WHERE: " AND <column> = $n"
+func And(ctx context.Context, column string, args *[]interface{}) string {
+	condition := Condition(ctx, column, args)
+	if condition == "" {
+		return ""
+	}
+	return " AND " + condition
+}
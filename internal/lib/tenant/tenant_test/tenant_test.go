@@ -0,0 +1,67 @@
+package tenant_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	// Без пользователя и системной метки запрос ограничивается несуществующей организацией
+	id, ok := tenant.FromContext(context.Background())
+	require.True(t, ok)
+	require.Zero(t, id)
+	require.Zero(t, tenant.ForInsert(context.Background()))
+
+	system := tenant.WithSystem(context.Background())
+	require.True(t, tenant.IsSystem(system))
+	_, ok = tenant.FromContext(system)
+	require.False(t, ok)
+	require.Equal(t, tenant.DefaultID, tenant.ForInsert(system))
+
+	scim := tenant.WithID(context.Background(), 9)
+	id, ok = tenant.FromContext(scim)
+	require.True(t, ok)
+	require.Equal(t, int64(9), id)
+	require.Equal(t, int64(9), tenant.ForInsert(scim))
+
+	// Токен без claim tenant_id относится к организации по умолчанию
+	id, ok = tenant.FromContext(auth.NewContext(context.Background(), auth.Principal{UserID: 1}))
+	require.True(t, ok)
+	require.Equal(t, tenant.DefaultID, id)
+
+	ctx := auth.NewContext(context.Background(), auth.Principal{UserID: 1, TenantID: 7})
+	id, ok = tenant.FromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, int64(7), id)
+	require.Equal(t, int64(7), tenant.ForInsert(ctx))
+
+	// Пользователь запроса важнее системной метки
+	id, ok = tenant.FromContext(auth.NewContext(system, auth.Principal{UserID: 1, TenantID: 7}))
+	require.True(t, ok)
+	require.Equal(t, int64(7), id)
+}
+
+func TestCondition(t *testing.T) {
+	ctx := auth.NewContext(context.Background(), auth.Principal{UserID: 1, TenantID: 7})
+	args := []interface{}{"search", int64(5)}
+
+	require.Equal(t, "tenant_id = $3", tenant.Condition(ctx, "tenant_id", &args))
+	require.Equal(t, []interface{}{"search", int64(5), int64(7)}, args)
+	require.Equal(t, " AND b.tenant_id = $4", tenant.And(ctx, "b.tenant_id", &args))
+	require.Len(t, args, 4)
+
+	// Без пользователя в контексте запрос не находит ничего
+	args = []interface{}{int64(5)}
+	require.Equal(t, "tenant_id = $2", tenant.Condition(context.Background(), "tenant_id", &args))
+	require.Equal(t, []interface{}{int64(5), int64(0)}, args)
+
+	// Только системный вызов не ограничивается организацией
+	system := tenant.WithSystem(context.Background())
+	args = []interface{}{int64(5)}
+	require.Empty(t, tenant.Condition(system, "tenant_id", &args))
+	require.Empty(t, tenant.And(system, "tenant_id", &args))
+	require.Equal(t, []interface{}{int64(5)}, args)
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// BackupCodesCount сколько резервных кодов выдаётся при подключении 2FA
+const BackupCodesCount = 10
+
+// backupCodeAlphabet без похожих символов (0/o, 1/l/i)
+const backupCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+const backupCodeLength = 10
+
+// GenerateBackupCodes генерирует резервные коды вида xxxxx-xxxxx
+//
+// Коды показываются пользователю один раз, в БД хранятся только их хеши
+func GenerateBackupCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	buf := make([]byte, backupCodeLength)
+	for i := 0; i < count; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate backup code: %w", err)
+		}
+		var code strings.Builder
+		for j, b := range buf {
+			if j == backupCodeLength/2 {
+				code.WriteByte('-')
+			}
+			// 256 не делится на длину алфавита, но смещение вероятностей для одноразовых кодов несущественно
+			code.WriteByte(backupCodeAlphabet[int(b)%len(backupCodeAlphabet)])
+		}
+		codes = append(codes, code.String())
+	}
+	return codes, nil
+}
+
+// NormalizeBackupCode приводит введённый резервный код к виду, в котором он хешировался
+func NormalizeBackupCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != backupCodeLength {
+		return code
+	}
+	return code[:backupCodeLength/2] + "-" + code[backupCodeLength/2:]
+}
+
+// IsBackupCode отличает резервный код от кода TOTP (который состоит только из цифр)
+func IsBackupCode(code string) bool {
+	for _, r := range strings.TrimSpace(code) {
+		if r < '0' || r > '9' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Параметры кодов (RFC 6238): HMAC-SHA1, 6 цифр, шаг 30 секунд.
+// Других значений большинство приложений-аутентификаторов не поддерживает
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew сколько соседних шагов принимается, что б не ломать вход при расхождении часов клиента и сервера
+	Skew = 1
+)
+
+// secretBytes длина секрета (160 бит, рекомендация RFC 4226)
+const secretBytes = 20
+
+var ErrInvalidSecret = errors.New("invalid totp secret")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Settings настройки двухфакторной аутентификации
+//
+// RequiredRoles - роли, для которых 2FA обязательна (например admin).
+// Пользователь такой роли без подключённой 2FA получает при входе токен без разрешений, с которым может только подключить 2FA
+type Settings struct {
+	Issuer        string
+	RequiredRoles []string
+	ChallengeTTL  time.Duration
+	MaxAttempts   int
+}
+
+// Required проверяет, обязательна ли 2FA для роли
+func (s Settings) Required(role string) bool {
+	for _, required := range s.RequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSecret генерирует случайный секрет в base32 без паддинга
+func GenerateSecret() (string, error) {
+	buf := make([]byte, secretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// URI возвращает otpauth:// URI для QR кода приложения-аутентификатора
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(Digits))
+	values.Set("period", fmt.Sprint(int(Period.Seconds())))
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// Step номер шага времени для момента t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code возвращает код для момента t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return codeAt(key, Step(t)), nil
+}
+
+// Validate проверяет код для момента t с допуском Skew шагов в обе стороны
+//
+// Возвращает шаг, которому соответствует код. Его нужно сохранить, что б один и тот же код нельзя было использовать повторно
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(codeAt(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// codeAt HOTP (RFC 4226) для счётчика step
+func codeAt(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo)
+}
@@ -0,0 +1,103 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret секрет из тестовых векторов RFC 6238 (SHA1)
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// В RFC коды из 8 цифр, 6-значный код - это последние 6 цифр
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, test := range tests {
+		code, err := totp.Code(rfcSecret, time.Unix(test.unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, test.code, code, "unix time %d", test.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := totp.Code(rfcSecret, now)
+	require.NoError(t, err)
+
+	step, ok := totp.Validate(rfcSecret, code, now)
+	require.True(t, ok)
+	require.Equal(t, totp.Step(now), step)
+
+	// Код предыдущего шага принимается из-за допуска на расхождение часов
+	step, ok = totp.Validate(rfcSecret, code, now.Add(totp.Period))
+	require.True(t, ok)
+	require.Equal(t, totp.Step(now), step)
+
+	// Код, устаревший больше чем на Skew шагов, отклоняется
+	_, ok = totp.Validate(rfcSecret, code, now.Add(3*totp.Period))
+	require.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "000000", now)
+	require.False(t, ok)
+	_, ok = totp.Validate(rfcSecret, "12345", now)
+	require.False(t, ok)
+	_, ok = totp.Validate("not base32!", code, now)
+	require.False(t, ok)
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+
+	other, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NotEqual(t, secret, other)
+
+	uri, err := url.Parse(totp.URI("Booker", "ryan@gosling.com", secret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/Booker:ryan@gosling.com", uri.Path)
+	require.Equal(t, secret, uri.Query().Get("secret"))
+	require.Equal(t, "Booker", uri.Query().Get("issuer"))
+	require.Equal(t, "6", uri.Query().Get("digits"))
+	require.Equal(t, "30", uri.Query().Get("period"))
+}
+
+func TestBackupCodes(t *testing.T) {
+	codes, err := totp.GenerateBackupCodes(totp.BackupCodesCount)
+	require.NoError(t, err)
+	require.Len(t, codes, totp.BackupCodesCount)
+
+	seen := make(map[string]struct{})
+	for _, code := range codes {
+		require.Len(t, code, 11)
+		require.True(t, totp.IsBackupCode(code))
+		require.Equal(t, code, totp.NormalizeBackupCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))))
+		seen[code] = struct{}{}
+	}
+	require.Len(t, seen, totp.BackupCodesCount)
+	require.False(t, totp.IsBackupCode("123456"))
+}
+
+func TestSettingsRequired(t *testing.T) {
+	settings := totp.Settings{RequiredRoles: []string{"admin"}}
+	require.True(t, settings.Required("admin"))
+	require.False(t, settings.Required("user"))
+	require.False(t, totp.Settings{}.Required("admin"))
+}
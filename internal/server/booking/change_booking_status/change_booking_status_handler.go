@@ -0,0 +1,63 @@
+package change_booking_status
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ChangeBookingStatusHandler переводит бронирование в статус status
+// (POST /booking/{id}/confirm, /check-in, /complete, /cancel, /no-show)
+//
+// Недопустимый переход или статус, изменённый параллельным запросом, возвращают 409
+func ChangeBookingStatusHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, delegationRepo delegations_db.DelegationRepository, status string, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/booking/change_booking_status/ChangeBookingStatusHandler"), slog.String("status", status))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("Booking ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid booking ID"))
+			return
+		}
+
+		response, err := booking_service.ChangeBookingStatus(bookingDbRepo, delegationRepo, id, status, principal, logger, ctx)
+		if err != nil {
+			switch {
+			case errors.Is(err, booking_service.ErrForbidden), errors.Is(err, booking_service.ErrStatusChangeForbidden):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			case errors.Is(err, booking_db.ErrBookingNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, booking_service.ErrInvalidStatusTransition), errors.Is(err, booking_db.ErrBookingStatusChanged):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("ChangeBookingStatus failed", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		log.Info("Booking status changed", "id", id)
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
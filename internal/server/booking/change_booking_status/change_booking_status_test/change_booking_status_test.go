@@ -0,0 +1,313 @@
+package change_booking_status_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/change_booking_status"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/get_booking_status_history"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockBookingRepository struct {
+	mock.Mock
+}
+
+func (m *MockBookingRepository) CreateBooking(ctx context.Context, userId int64, createdBy int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error) {
+	args := m.Called(ctx, userId, createdBy, bookingEntityId, status, startTime, endTime)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockBookingRepository) CheckBookingAvailability(ctx context.Context, bookingEntityId int64, startTime time.Time, endTime time.Time, excludeBookingId ...int64) (bool, error) {
+	args := m.Called(ctx, bookingEntityId, startTime, endTime, excludeBookingId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsByTime(ctx context.Context, startTime time.Time, endTime time.Time, queryParams query_params.ListQueryParams) ([]booking_db.BookingInfo, error) {
+	args := m.Called(ctx, startTime, endTime, queryParams)
+	return args.Get(0).([]booking_db.BookingInfo), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsForUser(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (booking_db.BookingList, error) {
+	args := m.Called(ctx, userId, queryParams)
+	return args.Get(0).(booking_db.BookingList), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsByBookingEntity(ctx context.Context, BookingEntityId int64, queryParams query_params.ListQueryParams) (booking_db.BookingList, error) {
+	args := m.Called(ctx, BookingEntityId, queryParams)
+	return args.Get(0).(booking_db.BookingList), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingById(ctx context.Context, id int64) (booking_db.BookingInfo, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(booking_db.BookingInfo), args.Error(1)
+}
+
+func (m *MockBookingRepository) UpdateBooking(ctx context.Context, bookingInfo booking_db.BookingInfo, bookingId int64) error {
+	args := m.Called(ctx, bookingInfo, bookingId)
+	return args.Error(0)
+}
+
+func (m *MockBookingRepository) ChangeStatus(ctx context.Context, bookingId int64, fromStatus, toStatus string, changedBy int64) error {
+	args := m.Called(ctx, bookingId, fromStatus, toStatus, changedBy)
+	return args.Error(0)
+}
+
+func (m *MockBookingRepository) GetStatusHistory(ctx context.Context, bookingId int64) ([]booking_db.BookingStatusChange, error) {
+	args := m.Called(ctx, bookingId)
+	return args.Get(0).([]booking_db.BookingStatusChange), args.Error(1)
+}
+
+type MockDelegationRepository struct {
+	mock.Mock
+}
+
+func (m *MockDelegationRepository) CreateDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Error(0)
+}
+
+func (m *MockDelegationRepository) DeleteDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Error(0)
+}
+
+func (m *MockDelegationRepository) ListByOwner(ctx context.Context, ownerId int64) ([]delegations_db.DelegationInfo, error) {
+	args := m.Called(ctx, ownerId)
+	return args.Get(0).([]delegations_db.DelegationInfo), args.Error(1)
+}
+
+func (m *MockDelegationRepository) ListByDelegate(ctx context.Context, delegateId int64) ([]delegations_db.DelegationInfo, error) {
+	args := m.Called(ctx, delegateId)
+	return args.Get(0).([]delegations_db.DelegationInfo), args.Error(1)
+}
+
+func (m *MockDelegationRepository) HasDelegation(ctx context.Context, ownerId, delegateId int64) (bool, error) {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Bool(0), args.Error(1)
+}
+
+// bookingWithStatus бронирование пользователя 42 в статусе status
+func bookingWithStatus(status string) booking_db.BookingInfo {
+	return booking_db.BookingInfo{
+		Id:              10,
+		UserId:          42,
+		CreatedBy:       42,
+		BookingEntityId: 3,
+		StartTime:       time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC),
+		EndTime:         time.Date(2030, 1, 1, 11, 0, 0, 0, time.UTC),
+		Status:          status,
+	}
+}
+
+// newRequest создаёт запрос с параметром id маршрута и пользователем, как после AuthMiddleware
+func newRequest(method, target string, principal auth.Principal) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", "10")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+	return req.WithContext(auth.NewContext(ctx, principal))
+}
+
+func TestChangeBookingStatus(t *testing.T) {
+	owner := auth.Principal{UserID: 42, Permissions: []string{"booking:create"}}
+	otherUser := auth.Principal{UserID: 7, Permissions: []string{"booking:create"}}
+	manager := auth.Principal{UserID: 1, Permissions: []string{"booking:create", "booking:manage_any"}}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		status    string
+		setupMock func(*MockBookingRepository)
+		// setupDelegationMock нужен только для пользователя, который не владелец и не менеджер
+		setupDelegationMock func(*MockDelegationRepository)
+		expectedStatus      int
+		expectedBody        string
+	}{
+		{
+			name:      "manager confirms pending booking",
+			principal: manager,
+			status:    booking_service.StatusConfirmed,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("pending"), nil).Once()
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "pending", "confirmed", int64(1)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"status":"confirmed"`,
+		},
+		{
+			name:      "owner cannot confirm own booking",
+			principal: owner,
+			status:    booking_service.StatusConfirmed,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("pending"), nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: confirming a booking or marking it as no-show requires booking:manage_any permission"}`,
+		},
+		{
+			name:      "owner checks in confirmed booking",
+			principal: owner,
+			status:    booking_service.StatusCheckedIn,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("confirmed"), nil).Once()
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "confirmed", "checked_in", int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"status":"checked_in"`,
+		},
+		{
+			name:      "owner completes checked in booking",
+			principal: owner,
+			status:    booking_service.StatusCompleted,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("checked_in"), nil).Once()
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "checked_in", "completed", int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"status":"completed"`,
+		},
+		{
+			name:      "pending booking cannot be completed",
+			principal: owner,
+			status:    booking_service.StatusCompleted,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("pending"), nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Invalid booking status transition from pending to completed"}`,
+		},
+		{
+			name:      "cancelled booking cannot be cancelled again",
+			principal: owner,
+			status:    booking_service.StatusCancelled,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("cancelled"), nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Invalid booking status transition from cancelled to cancelled"}`,
+		},
+		{
+			name:      "manager cannot mark checked in booking as no-show",
+			principal: manager,
+			status:    booking_service.StatusNoShow,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("checked_in"), nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Invalid booking status transition from checked_in to no_show"}`,
+		},
+		{
+			name:      "other user cannot cancel booking",
+			principal: otherUser,
+			status:    booking_service.StatusCancelled,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("pending"), nil).Once()
+			},
+			setupDelegationMock: func(mockDelegationRepo *MockDelegationRepository) {
+				mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: only the booking owner, their delegate or a user with booking:manage_any permission can change this booking"}`,
+		},
+		{
+			name:      "delegate cancels booking of owner",
+			principal: otherUser,
+			status:    booking_service.StatusCancelled,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("confirmed"), nil).Once()
+				// Отмену записывает представитель, а не владелец
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "confirmed", "cancelled", int64(7)).Return(nil).Once()
+			},
+			setupDelegationMock: func(mockDelegationRepo *MockDelegationRepository) {
+				mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"status":"cancelled"`,
+		},
+		{
+			name:      "status changed by concurrent request",
+			principal: manager,
+			status:    booking_service.StatusConfirmed,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("pending"), nil).Once()
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "pending", "confirmed", int64(1)).Return(booking_db.ErrBookingStatusChanged).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Booking status was changed by another request"}`,
+		},
+		{
+			name:      "booking not found",
+			principal: manager,
+			status:    booking_service.StatusConfirmed,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(booking_db.BookingInfo{}, booking_db.ErrBookingNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"Booking not found"}`,
+		},
+		{
+			name:      "repository error",
+			principal: manager,
+			status:    booking_service.StatusConfirmed,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("pending"), nil).Once()
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "pending", "confirmed", int64(1)).Return(errors.New("connection refused")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"internal server error"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockBookingRepository)
+			mockDelegationRepo := new(MockDelegationRepository)
+			test.setupMock(mockRepo)
+			if test.setupDelegationMock != nil {
+				test.setupDelegationMock(mockDelegationRepo)
+			}
+			handler := change_booking_status.ChangeBookingStatusHandler(slog.Default(), mockRepo, mockDelegationRepo, test.status, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodPost, "/booking/10/"+test.status, test.principal))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockDelegationRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetBookingStatusHistory(t *testing.T) {
+	createdAt := time.Date(2029, 12, 1, 9, 0, 0, 0, time.UTC)
+	mockRepo := new(MockBookingRepository)
+	mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(bookingWithStatus("confirmed"), nil).Once()
+	mockRepo.On("GetStatusHistory", mock.Anything, int64(10)).Return([]booking_db.BookingStatusChange{
+		{BookingId: 10, ToStatus: "pending", ChangedBy: 42, ChangedAt: createdAt},
+		{BookingId: 10, FromStatus: "pending", ToStatus: "confirmed", ChangedBy: 1, ChangedAt: createdAt.Add(time.Hour)},
+	}, nil).Once()
+	handler := get_booking_status_history.GetBookingStatusHistoryHandler(slog.Default(), mockRepo, 5*time.Second)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(http.MethodGet, "/booking/10/history", auth.Principal{UserID: 42}))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"data":[
+		{"to_status":"pending","changed_by":42,"changed_at":"2029-12-01T09:00:00Z"},
+		{"from_status":"pending","to_status":"confirmed","changed_by":1,"changed_at":"2029-12-01T10:00:00Z"}
+	]}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
@@ -6,40 +6,38 @@ import (
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
 	create_booking_dto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking/create_booking"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
 	"github.com/go-playground/validator"
-	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
 	"net/http"
 	"time"
 )
 
-func CreateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, timeout time.Duration) http.HandlerFunc {
+// CreateBookingHandler создаёт бронирование от имени пользователя из токена (POST /booking)
+//
+// Если объект бронирования ограничен группами, в которых пользователь не состоит, возвращает 403.
+// С on_behalf_of бронирование создаётся на другого пользователя, если он делегировал свои бронирования, иначе 403
+func CreateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, bookingEntityRepo booking_entity_db.BookingEntityRepository, delegationRepo delegations_db.DelegationRepository, timeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := logger.With(slog.String("op", "internal/server/booking/create_booking/create_booking_handler.go/CreateBookingHandler"))
 
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
-		// берём айди пользователя, который бронирует из токена JWT
-		claims, ok := r.Context().Value("tokenClaims").(jwt.MapClaims)
+		// берём айди пользователя, который бронирует, из данных авторизации
+		principal, ok := auth.FromContext(r.Context())
 		if !ok {
-			log.Error("CreateBookingHandler: token claims not found in context")
-			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Token claims not found in context"))
-			return
-		}
-
-		// Извлекаем userId из claims
-		userId, ok := claims["sub"].(float64) // JWT часто возвращает числа как float64
-		if !ok {
-			log.Error("CreateBookingHandler: userId not found in claims")
-			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("UserId not found in auth token"))
+			log.Error("CreateBookingHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
 			return
 		}
 
 		var createBookingDto = create_booking_dto.BookingRequest{
-			UserId: int64(userId),
+			UserId: principal.UserID,
 		}
 
 		err := body.DecodeAndValidateJson(r, &createBookingDto)
@@ -48,6 +46,7 @@ func CreateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 			if errors.Is(err, body.ErrDecodeJSON) {
 				logger.Error("CreateBookingHandler: error decoding body", "error", err)
 				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
 			}
 			if validationErr, ok := err.(validator.ValidationErrors); ok {
 				logger.Error("Error validating request body", "err", validationErr)
@@ -58,12 +57,24 @@ func CreateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
 			return
 		}
-		response, err := booking_service.CreateBooking(createBookingDto, bookingDbRepo, ctx, logger)
+		response, err := booking_service.CreateBooking(createBookingDto, bookingDbRepo, bookingEntityRepo, delegationRepo, principal, ctx, logger)
 		if err != nil {
 			logger.Error("CreateBookingHandler: error creating booking", "error", err)
 			if errors.Is(err, booking_service.ErrBookingNotAvailable) {
 				logger.Warn("CreateBookingHandler: booking not available", "error", err)
-				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Booking not available"))
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error("Booking not available"))
+				return
+			}
+			if errors.Is(err, booking_service.ErrOnBehalfOfConflict) || errors.Is(err, booking_service.ErrStatusNotEditable) {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, booking_service.ErrGroupRestricted) || errors.Is(err, booking_service.ErrBookForOtherForbidden) || errors.Is(err, booking_service.ErrDelegationRequired) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, booking_entity_db.ErrBookingEntityNotFound) || errors.Is(err, booking_entity_db.ErrBookingUserNotFound) {
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
 				return
 			}
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
@@ -0,0 +1,386 @@
+package create_booking_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	create_booking_dto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking/create_booking"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/create_booking"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockBookingRepository struct {
+	mock.Mock
+}
+
+func (m *MockBookingRepository) CreateBooking(ctx context.Context, userId int64, createdBy int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error) {
+	args := m.Called(ctx, userId, createdBy, bookingEntityId, status, startTime, endTime)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockBookingRepository) CheckBookingAvailability(ctx context.Context, bookingEntityId int64, startTime time.Time, endTime time.Time, excludeBookingId ...int64) (bool, error) {
+	args := m.Called(ctx, bookingEntityId, startTime, endTime, excludeBookingId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsByTime(ctx context.Context, startTime time.Time, endTime time.Time, queryParams query_params.ListQueryParams) ([]booking_db.BookingInfo, error) {
+	args := m.Called(ctx, startTime, endTime, queryParams)
+	return args.Get(0).([]booking_db.BookingInfo), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsForUser(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (booking_db.BookingList, error) {
+	args := m.Called(ctx, userId, queryParams)
+	return args.Get(0).(booking_db.BookingList), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsByBookingEntity(ctx context.Context, BookingEntityId int64, queryParams query_params.ListQueryParams) (booking_db.BookingList, error) {
+	args := m.Called(ctx, BookingEntityId, queryParams)
+	return args.Get(0).(booking_db.BookingList), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingById(ctx context.Context, id int64) (booking_db.BookingInfo, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(booking_db.BookingInfo), args.Error(1)
+}
+
+func (m *MockBookingRepository) UpdateBooking(ctx context.Context, bookingInfo booking_db.BookingInfo, bookingId int64) error {
+	args := m.Called(ctx, bookingInfo, bookingId)
+	return args.Error(0)
+}
+
+func (m *MockBookingRepository) ChangeStatus(ctx context.Context, bookingId int64, fromStatus, toStatus string, changedBy int64) error {
+	args := m.Called(ctx, bookingId, fromStatus, toStatus, changedBy)
+	return args.Error(0)
+}
+
+func (m *MockBookingRepository) GetStatusHistory(ctx context.Context, bookingId int64) ([]booking_db.BookingStatusChange, error) {
+	args := m.Called(ctx, bookingId)
+	return args.Get(0).([]booking_db.BookingStatusChange), args.Error(1)
+}
+
+type MockBookingEntityRepository struct {
+	mock.Mock
+}
+
+func (m *MockBookingEntityRepository) CreateBookingEntity(ctx context.Context, bookingTypeId int64, name, description, status string, ParentId int64) (int64, error) {
+	args := m.Called(ctx, bookingTypeId, name, description, status, ParentId)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) GetBookingEntity(ctx context.Context, BookingEntityId int64) (booking_entity_db.BookingEntityInfo, error) {
+	args := m.Called(ctx, BookingEntityId)
+	return args.Get(0).(booking_entity_db.BookingEntityInfo), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) GetBookingEntitiesList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (booking_entity_db.BookingEntityListResult, error) {
+	args := m.Called(ctx, search, bookableBy, limit, offset, sortParams)
+	return args.Get(0).(booking_entity_db.BookingEntityListResult), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) UpdateBookingEntity(ctx context.Context, id int64, bookingTypeId int64, name, description, status string, ParentId int64) error {
+	args := m.Called(ctx, id, bookingTypeId, name, description, status, ParentId)
+	return args.Error(0)
+}
+
+func (m *MockBookingEntityRepository) DeleteBookingEntity(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockBookingEntityRepository) CanBook(ctx context.Context, bookingEntityId, userId int64) (bool, error) {
+	args := m.Called(ctx, bookingEntityId, userId)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockDelegationRepository struct {
+	mock.Mock
+}
+
+func (m *MockDelegationRepository) CreateDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Error(0)
+}
+
+func (m *MockDelegationRepository) DeleteDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Error(0)
+}
+
+func (m *MockDelegationRepository) ListByOwner(ctx context.Context, ownerId int64) ([]delegations_db.DelegationInfo, error) {
+	args := m.Called(ctx, ownerId)
+	return args.Get(0).([]delegations_db.DelegationInfo), args.Error(1)
+}
+
+func (m *MockDelegationRepository) ListByDelegate(ctx context.Context, delegateId int64) ([]delegations_db.DelegationInfo, error) {
+	args := m.Called(ctx, delegateId)
+	return args.Get(0).([]delegations_db.DelegationInfo), args.Error(1)
+}
+
+func (m *MockDelegationRepository) HasDelegation(ctx context.Context, ownerId, delegateId int64) (bool, error) {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestCreateBooking(t *testing.T) {
+	startTime := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(time.Hour)
+	user := auth.Principal{UserID: 42, Permissions: []string{"booking:create"}}
+	manager := auth.Principal{UserID: 1, Permissions: []string{"booking:create", "booking:manage_any"}}
+	assistant := auth.Principal{UserID: 7, Permissions: []string{"booking:create"}}
+
+	tests := []struct {
+		name            string
+		principal       auth.Principal
+		body            string
+		setupMock       func(*MockBookingRepository)
+		setupEntityMock func(*MockBookingEntityRepository)
+		// setupDelegationMock нужен только для бронирования с on_behalf_of
+		setupDelegationMock func(*MockDelegationRepository)
+		expectedStatus      int
+		expectedBody        string
+	}{
+		{
+			name:      "member of allowed group creates booking",
+			principal: user,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), startTime, endTime, []int64(nil)).Return(true, nil).Once()
+				mockRepo.On("CreateBooking", mock.Anything, int64(42), int64(42), int64(3), "pending", startTime, endTime).Return(int64(10), nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":10}`,
+		},
+		{
+			name:      "interval taken by concurrent request",
+			principal: user,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				// Проверка прошла, но параллельный запрос занял интервал раньше: вставку отклонило ограничение БД
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), startTime, endTime, []int64(nil)).Return(true, nil).Once()
+				mockRepo.On("CreateBooking", mock.Anything, int64(42), int64(42), int64(3), "pending", startTime, endTime).
+					Return(int64(0), fmt.Errorf("%w: exclusion violation", database.ErrBookingNotAvailable)).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Booking not available"}`,
+		},
+		{
+			name:      "interval already booked",
+			principal: user,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), startTime, endTime, []int64(nil)).Return(false, nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Booking not available"}`,
+		},
+		{
+			name:      "user outside of allowed groups is rejected",
+			principal: user,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				// Нет вызова мока, ограничение проверяется до проверки доступности времени
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: booking entity is restricted to members of specific groups"}`,
+		},
+		{
+			name:      "user cannot book for another user",
+			principal: auth.Principal{UserID: 7, Permissions: []string{"booking:create"}},
+			body:      `{"user_id":42,"booking_entity_id":3,"start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: creating a booking for another user requires booking:manage_any permission"}`,
+		},
+		{
+			name:      "delegate books on behalf of owner",
+			principal: assistant,
+			body:      `{"on_behalf_of":42,"booking_entity_id":3,"start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), startTime, endTime, []int64(nil)).Return(true, nil).Once()
+				// Владелец - 42, создатель - ассистент 7
+				mockRepo.On("CreateBooking", mock.Anything, int64(42), int64(7), int64(3), "pending", startTime, endTime).Return(int64(12), nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				// Групповые ограничения проверяются для владельца
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(true, nil).Once()
+			},
+			setupDelegationMock: func(mockDelegationRepo *MockDelegationRepository) {
+				mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":12}`,
+		},
+		{
+			name:      "booking on behalf of user without delegation is rejected",
+			principal: assistant,
+			body:      `{"on_behalf_of":42,"booking_entity_id":3,"start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+			},
+			setupDelegationMock: func(mockDelegationRepo *MockDelegationRepository) {
+				mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: booking on behalf of another user requires their delegation"}`,
+		},
+		{
+			name:      "user_id and on_behalf_of conflict",
+			principal: assistant,
+			body:      `{"user_id":5,"on_behalf_of":42,"booking_entity_id":3,"start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"user_id and on_behalf_of refer to different users"}`,
+		},
+		{
+			name:      "booking entity not found",
+			principal: user,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(false, booking_entity_db.ErrBookingEntityNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:      "booking cannot be created in non-initial status",
+			principal: user,
+			body:      `{"booking_entity_id":3,"status":"confirmed","start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Booking status can only be changed via the confirm, check-in, complete, cancel and no-show endpoints"}`,
+		},
+		{
+			name:      "malformed body",
+			principal: user,
+			body:      `{"booking_entity_id":3,`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			// Тело ответа - только одна ошибка, без второго ответа 500
+			expectedBody: `{"status":"ERROR","error":"failed to decode JSON"}`,
+		},
+		{
+			name:      "unknown status is rejected",
+			principal: user,
+			body:      `{"booking_entity_id":3,"status":"booked","start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "manager is not restricted by groups",
+			principal: manager,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), startTime, endTime, []int64(nil)).Return(true, nil).Once()
+				mockRepo.On("CreateBooking", mock.Anything, int64(1), int64(1), int64(3), "pending", startTime, endTime).Return(int64(11), nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				// booking:manage_any снимает групповые ограничения, но объект всё равно ищется в организации менеджера
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(1)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":11}`,
+		},
+		{
+			name:      "manager cannot book entity of another organization",
+			principal: manager,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(1)).Return(false, booking_entity_db.ErrBookingEntityNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:      "manager cannot book for user of another organization",
+			principal: manager,
+			body:      `{"user_id":42,"booking_entity_id":3,"start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(false, booking_entity_db.ErrBookingUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:      "manager books for user of own organization outside of allowed groups",
+			principal: manager,
+			body:      `{"user_id":42,"booking_entity_id":3,"start_time":"2030-01-01T10:00:00Z","end_time":"2030-01-01T11:00:00Z"}`,
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), startTime, endTime, []int64(nil)).Return(true, nil).Once()
+				mockRepo.On("CreateBooking", mock.Anything, int64(42), int64(1), int64(3), "pending", startTime, endTime).Return(int64(13), nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(42)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":13}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockBookingRepository)
+			mockEntityRepo := new(MockBookingEntityRepository)
+			mockDelegationRepo := new(MockDelegationRepository)
+			test.setupMock(mockRepo)
+			test.setupEntityMock(mockEntityRepo)
+			if test.setupDelegationMock != nil {
+				test.setupDelegationMock(mockDelegationRepo)
+			}
+			handler := create_booking.CreateBookingHandler(slog.Default(), mockRepo, mockEntityRepo, mockDelegationRepo, 5*time.Second)
+
+			body := []byte(test.body)
+			if test.body == "" {
+				body, _ = json.Marshal(create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: startTime, EndTime: endTime})
+			}
+			req := httptest.NewRequest(http.MethodPost, "/booking", bytes.NewReader(body))
+			req = req.WithContext(auth.NewContext(req.Context(), test.principal))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedBody != "" {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+			mockRepo.AssertExpectations(t)
+			mockEntityRepo.AssertExpectations(t)
+			mockDelegationRepo.AssertExpectations(t)
+		})
+	}
+}
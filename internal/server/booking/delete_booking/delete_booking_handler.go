@@ -2,9 +2,12 @@ package delete_booking
 
 import (
 	"context"
+	"errors"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
 	"github.com/go-chi/chi/v5"
 	"log/slog"
 	"net/http"
@@ -12,13 +15,22 @@ import (
 	"time"
 )
 
-func DeleteBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, timeout time.Duration) http.HandlerFunc {
+// DeleteBookingHandler отменяет бронирование (переход в статус cancelled). Бронирование не удаляется из БД,
+// история его статусов сохраняется
+func DeleteBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, delegationRepo delegations_db.DelegationRepository, timeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := logger.With(slog.String("op", "internal/lib/services/booking_service/delete_booking"))
 
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
 		BookingID := chi.URLParam(r, "id")
 		if BookingID == "" {
 			log.Error("Booking  ID is empty")
@@ -32,10 +44,19 @@ func DeleteBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 			return
 		}
 
-		err = booking_service.DeleteBooking(bookingDbRepo, id, logger, ctx)
+		err = booking_service.DeleteBooking(bookingDbRepo, delegationRepo, id, principal, logger, ctx)
 		if err != nil {
 			log.Error("DeleteBooking failed", "error", err)
-			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			switch {
+			case errors.Is(err, booking_service.ErrForbidden), errors.Is(err, booking_service.ErrOwnerChangeForbidden):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			case errors.Is(err, booking_db.ErrBookingNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, booking_service.ErrInvalidStatusTransition), errors.Is(err, booking_db.ErrBookingStatusChanged):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			default:
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			}
 			return
 		}
 		resp.RenderResponse(w, r, http.StatusNoContent, nil)
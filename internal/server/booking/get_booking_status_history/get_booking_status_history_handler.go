@@ -0,0 +1,46 @@
+package get_booking_status_history
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GetBookingStatusHistoryHandler возвращает историю статусов бронирования: кто и когда менял статус (GET /booking/{id}/history)
+func GetBookingStatusHistoryHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/booking/get_booking_status_history/GetBookingStatusHistoryHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("Booking ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid booking ID"))
+			return
+		}
+
+		response, err := booking_service.GetBookingStatusHistory(bookingDbRepo, id, logger, ctx)
+		if err != nil {
+			switch {
+			case errors.Is(err, booking_db.ErrBookingNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("GetBookingStatusHistory failed", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
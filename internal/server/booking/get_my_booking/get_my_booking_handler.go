@@ -4,9 +4,9 @@ import (
 	"context"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
-	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
 	"net/http"
 	"time"
@@ -19,19 +19,11 @@ func GetMyBookingsHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
-		// берём айди пользователя, который бронирует из токена JWT
-		claims, ok := r.Context().Value("tokenClaims").(jwt.MapClaims)
+		// берём айди пользователя, который бронирует, из данных авторизации
+		principal, ok := auth.FromContext(r.Context())
 		if !ok {
-			log.Error("GetMyBookingsHandler: token claims not found in context")
-			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Token claims not found in context"))
-			return
-		}
-
-		// Извлекаем userId из claims
-		userId, ok := claims["sub"].(float64) // JWT часто возвращает числа как float64
-		if !ok {
-			log.Error("CreateBookingHandler: userId not found in claims")
-			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("UserId not found in auth token"))
+			log.Error("GetMyBookingsHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
 			return
 		}
 
@@ -46,7 +38,7 @@ func GetMyBookingsHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 			return
 		}
 
-		response, err := booking_service.GetMyBooking(bookingDbRepo, int64(userId), parsedQuery, logger, ctx)
+		response, err := booking_service.GetMyBooking(bookingDbRepo, principal.UserID, parsedQuery, logger, ctx)
 		if err != nil {
 			log.Error("get my bookings failed", "error", err)
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
@@ -6,8 +6,11 @@ import (
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
 	create_booking_dto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking/create_booking"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator"
 	"log/slog"
@@ -16,7 +19,7 @@ import (
 	"time"
 )
 
-func UpdateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, timeout time.Duration) http.HandlerFunc {
+func UpdateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingRepository, bookingEntityRepo booking_entity_db.BookingEntityRepository, delegationRepo delegations_db.DelegationRepository, timeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := logger.With(slog.String("op", "internal/lib/services/booking_service/update_booking"))
 
@@ -36,6 +39,13 @@ func UpdateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 			return
 		}
 
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
 		var updateBookingDto create_booking_dto.BookingRequest
 		err = body.DecodeAndValidateJson(r, &updateBookingDto)
 		if err != nil {
@@ -53,10 +63,23 @@ func UpdateBookingHandler(logger *slog.Logger, bookingDbRepo booking_db.BookingR
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
 			return
 		}
-		response, err := booking_service.UpdateBooking(bookingDbRepo, updateBookingDto, id, logger, ctx)
+		response, err := booking_service.UpdateBooking(bookingDbRepo, bookingEntityRepo, delegationRepo, updateBookingDto, id, principal, logger, ctx)
 		if err != nil {
 			logger.Error("UpdateBookingHandler", "error", err)
-			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			switch {
+			case errors.Is(err, booking_service.ErrForbidden), errors.Is(err, booking_service.ErrOwnerChangeForbidden), errors.Is(err, booking_service.ErrGroupRestricted):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			case errors.Is(err, booking_db.ErrBookingNotFound), errors.Is(err, booking_entity_db.ErrBookingEntityNotFound), errors.Is(err, booking_entity_db.ErrBookingUserNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, booking_service.ErrBookingNotAvailable):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error("Booking not available"))
+			case errors.Is(err, booking_service.ErrStatusNotEditable):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			case errors.Is(err, booking_service.ErrBookingNotEditable):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			default:
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			}
 			return
 		}
 		logger.Info("Success UpdateBookingHandler", "response", response)
@@ -0,0 +1,508 @@
+package update_booking_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	create_booking_dto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/booking/create_booking"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/delete_booking"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/booking/update_booking"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockBookingRepository struct {
+	mock.Mock
+}
+
+func (m *MockBookingRepository) CreateBooking(ctx context.Context, userId int64, createdBy int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error) {
+	args := m.Called(ctx, userId, createdBy, bookingEntityId, status, startTime, endTime)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockBookingRepository) CheckBookingAvailability(ctx context.Context, bookingEntityId int64, startTime time.Time, endTime time.Time, excludeBookingId ...int64) (bool, error) {
+	args := m.Called(ctx, bookingEntityId, startTime, endTime, excludeBookingId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsByTime(ctx context.Context, startTime time.Time, endTime time.Time, queryParams query_params.ListQueryParams) ([]booking_db.BookingInfo, error) {
+	args := m.Called(ctx, startTime, endTime, queryParams)
+	return args.Get(0).([]booking_db.BookingInfo), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsForUser(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (booking_db.BookingList, error) {
+	args := m.Called(ctx, userId, queryParams)
+	return args.Get(0).(booking_db.BookingList), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingsByBookingEntity(ctx context.Context, BookingEntityId int64, queryParams query_params.ListQueryParams) (booking_db.BookingList, error) {
+	args := m.Called(ctx, BookingEntityId, queryParams)
+	return args.Get(0).(booking_db.BookingList), args.Error(1)
+}
+
+func (m *MockBookingRepository) GetBookingById(ctx context.Context, id int64) (booking_db.BookingInfo, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(booking_db.BookingInfo), args.Error(1)
+}
+
+func (m *MockBookingRepository) UpdateBooking(ctx context.Context, bookingInfo booking_db.BookingInfo, bookingId int64) error {
+	args := m.Called(ctx, bookingInfo, bookingId)
+	return args.Error(0)
+}
+
+func (m *MockBookingRepository) ChangeStatus(ctx context.Context, bookingId int64, fromStatus, toStatus string, changedBy int64) error {
+	args := m.Called(ctx, bookingId, fromStatus, toStatus, changedBy)
+	return args.Error(0)
+}
+
+func (m *MockBookingRepository) GetStatusHistory(ctx context.Context, bookingId int64) ([]booking_db.BookingStatusChange, error) {
+	args := m.Called(ctx, bookingId)
+	return args.Get(0).([]booking_db.BookingStatusChange), args.Error(1)
+}
+
+type MockBookingEntityRepository struct {
+	mock.Mock
+}
+
+func (m *MockBookingEntityRepository) CreateBookingEntity(ctx context.Context, bookingTypeId int64, name, description, status string, ParentId int64) (int64, error) {
+	args := m.Called(ctx, bookingTypeId, name, description, status, ParentId)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) GetBookingEntity(ctx context.Context, BookingEntityId int64) (booking_entity_db.BookingEntityInfo, error) {
+	args := m.Called(ctx, BookingEntityId)
+	return args.Get(0).(booking_entity_db.BookingEntityInfo), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) GetBookingEntitiesList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (booking_entity_db.BookingEntityListResult, error) {
+	args := m.Called(ctx, search, bookableBy, limit, offset, sortParams)
+	return args.Get(0).(booking_entity_db.BookingEntityListResult), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) UpdateBookingEntity(ctx context.Context, id int64, bookingTypeId int64, name, description, status string, ParentId int64) error {
+	args := m.Called(ctx, id, bookingTypeId, name, description, status, ParentId)
+	return args.Error(0)
+}
+
+func (m *MockBookingEntityRepository) DeleteBookingEntity(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockBookingEntityRepository) CanBook(ctx context.Context, bookingEntityId, userId int64) (bool, error) {
+	args := m.Called(ctx, bookingEntityId, userId)
+	return args.Bool(0), args.Error(1)
+}
+
+var existingBooking = booking_db.BookingInfo{
+	Id:              10,
+	UserId:          42,
+	BookingEntityId: 3,
+	StartTime:       time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC),
+	EndTime:         time.Date(2030, 1, 1, 11, 0, 0, 0, time.UTC),
+	Status:          "confirmed",
+}
+
+// newRequest создаёт запрос с параметром id маршрута и пользователем, как после AuthMiddleware
+func newRequest(method string, body []byte, principal auth.Principal) *http.Request {
+	req := httptest.NewRequest(method, "/booking/10", bytes.NewReader(body))
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", "10")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+	return req.WithContext(auth.NewContext(ctx, principal))
+}
+
+type MockDelegationRepository struct {
+	mock.Mock
+}
+
+func (m *MockDelegationRepository) CreateDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Error(0)
+}
+
+func (m *MockDelegationRepository) DeleteDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Error(0)
+}
+
+func (m *MockDelegationRepository) ListByOwner(ctx context.Context, ownerId int64) ([]delegations_db.DelegationInfo, error) {
+	args := m.Called(ctx, ownerId)
+	return args.Get(0).([]delegations_db.DelegationInfo), args.Error(1)
+}
+
+func (m *MockDelegationRepository) ListByDelegate(ctx context.Context, delegateId int64) ([]delegations_db.DelegationInfo, error) {
+	args := m.Called(ctx, delegateId)
+	return args.Get(0).([]delegations_db.DelegationInfo), args.Error(1)
+}
+
+func (m *MockDelegationRepository) HasDelegation(ctx context.Context, ownerId, delegateId int64) (bool, error) {
+	args := m.Called(ctx, ownerId, delegateId)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestUpdateBooking(t *testing.T) {
+	owner := auth.Principal{UserID: 42, Permissions: []string{"booking:create"}}
+	otherUser := auth.Principal{UserID: 7, Permissions: []string{"booking:create"}}
+	manager := auth.Principal{UserID: 1, Permissions: []string{"booking:create", "booking:manage_any"}}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		input     create_booking_dto.BookingRequest
+		setupMock func(*MockBookingRepository)
+		// setupEntityMock нужен только при переносе бронирования на другой объект или другому пользователю
+		setupEntityMock func(*MockBookingEntityRepository)
+		// setupDelegationMock нужен только, когда бронирование меняет не владелец
+		setupDelegationMock func(*MockDelegationRepository)
+		expectedStatus      int
+		expectedBody        string
+	}{
+		{
+			name:      "owner updates booking without user_id keeps owner",
+			principal: owner,
+			input: create_booking_dto.BookingRequest{
+				BookingEntityId: 3,
+				StartTime:       existingBooking.StartTime,
+				EndTime:         existingBooking.EndTime.Add(time.Hour),
+				Status:          "confirmed",
+			},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), mock.Anything, mock.Anything, []int64{10}).Return(true, nil).Once()
+				mockRepo.On("UpdateBooking", mock.Anything, mock.MatchedBy(func(info booking_db.BookingInfo) bool {
+					return info.UserId == 42
+				}), int64(10)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":10`,
+		},
+		{
+			name:      "update without status keeps current status",
+			principal: owner,
+			input: create_booking_dto.BookingRequest{
+				BookingEntityId: 3,
+				StartTime:       existingBooking.StartTime,
+				EndTime:         existingBooking.EndTime.Add(time.Hour),
+			},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), mock.Anything, mock.Anything, []int64{10}).Return(true, nil).Once()
+				mockRepo.On("UpdateBooking", mock.Anything, mock.MatchedBy(func(info booking_db.BookingInfo) bool {
+					return info.Status == "confirmed"
+				}), int64(10)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":10`,
+		},
+		{
+			name:      "status cannot be changed by update",
+			principal: owner,
+			input: create_booking_dto.BookingRequest{
+				BookingEntityId: 3,
+				StartTime:       existingBooking.StartTime,
+				EndTime:         existingBooking.EndTime,
+				Status:          "completed",
+			},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Booking status can only be changed via the confirm, check-in, complete, cancel and no-show endpoints"}`,
+		},
+		{
+			name:      "cancelled booking cannot be updated",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime.Add(time.Hour)},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				cancelled := existingBooking
+				cancelled.Status = "cancelled"
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(cancelled, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Only pending and confirmed bookings can be updated"}`,
+		},
+		{
+			name:      "checked in booking cannot be updated even by manager",
+			principal: manager,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime.Add(time.Hour)},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				checkedIn := existingBooking
+				checkedIn.Status = "checked_in"
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(checkedIn, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Only pending and confirmed bookings can be updated"}`,
+		},
+		{
+			name:      "other user cannot update booking",
+			principal: otherUser,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			setupDelegationMock: func(mockDelegationRepo *MockDelegationRepository) {
+				mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: only the booking owner, their delegate or a user with booking:manage_any permission can change this booking"}`,
+		},
+		{
+			name:      "delegate updates booking of owner",
+			principal: otherUser,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), mock.Anything, mock.Anything, []int64{10}).Return(true, nil).Once()
+				mockRepo.On("UpdateBooking", mock.Anything, mock.MatchedBy(func(info booking_db.BookingInfo) bool {
+					return info.UserId == 42
+				}), int64(10)).Return(nil).Once()
+			},
+			setupDelegationMock: func(mockDelegationRepo *MockDelegationRepository) {
+				mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":10`,
+		},
+		{
+			name:      "owner cannot reassign booking",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{UserId: 7, BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: changing the booking owner requires booking:manage_any permission"}`,
+		},
+		{
+			name:      "manager reassigns booking",
+			principal: manager,
+			input:     create_booking_dto.BookingRequest{UserId: 7, BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), mock.Anything, mock.Anything, []int64{10}).Return(true, nil).Once()
+				mockRepo.On("UpdateBooking", mock.Anything, mock.MatchedBy(func(info booking_db.BookingInfo) bool {
+					return info.UserId == 7
+				}), int64(10)).Return(nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				// Новый владелец проверяется в организации менеджера, групповые ограничения ему не мешают
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(7)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":10`,
+		},
+		{
+			name:      "manager cannot reassign booking to user of another organization",
+			principal: manager,
+			input:     create_booking_dto.BookingRequest{UserId: 7, BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(3), int64(7)).Return(false, booking_entity_db.ErrBookingUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:      "manager cannot move booking to entity of another organization",
+			principal: manager,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 5, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(5), int64(42)).Return(false, booking_entity_db.ErrBookingEntityNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:      "owner moves booking to entity of own group",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 4, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(4), mock.Anything, mock.Anything, []int64{10}).Return(true, nil).Once()
+				mockRepo.On("UpdateBooking", mock.Anything, mock.Anything, int64(10)).Return(nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(4), int64(42)).Return(true, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":10`,
+		},
+		{
+			name:      "owner cannot move booking to entity of another group",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 5, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			setupEntityMock: func(mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("CanBook", mock.Anything, int64(5), int64(42)).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Forbidden: booking entity is restricted to members of specific groups"}`,
+		},
+		{
+			name:      "interval already booked",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime.Add(time.Hour)},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), mock.Anything, mock.Anything, []int64{10}).Return(false, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Booking not available"}`,
+		},
+		{
+			name:      "interval taken by concurrent request",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime.Add(time.Hour)},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				// Проверка прошла, но параллельный запрос занял интервал раньше: обновление отклонило ограничение БД
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("CheckBookingAvailability", mock.Anything, int64(3), mock.Anything, mock.Anything, []int64{10}).Return(true, nil).Once()
+				mockRepo.On("UpdateBooking", mock.Anything, mock.Anything, int64(10)).
+					Return(fmt.Errorf("%w: exclusion violation", database.ErrBookingNotAvailable)).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Booking not available"}`,
+		},
+		{
+			name:      "booking not found",
+			principal: owner,
+			input:     create_booking_dto.BookingRequest{BookingEntityId: 3, StartTime: existingBooking.StartTime, EndTime: existingBooking.EndTime},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(booking_db.BookingInfo{}, booking_db.ErrBookingNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"Booking not found"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockBookingRepository)
+			mockEntityRepo := new(MockBookingEntityRepository)
+			mockDelegationRepo := new(MockDelegationRepository)
+			test.setupMock(mockRepo)
+			if test.setupEntityMock != nil {
+				test.setupEntityMock(mockEntityRepo)
+			}
+			if test.setupDelegationMock != nil {
+				test.setupDelegationMock(mockDelegationRepo)
+			}
+			handler := update_booking.UpdateBookingHandler(slog.Default(), mockRepo, mockEntityRepo, mockDelegationRepo, 5*time.Second)
+
+			body, _ := json.Marshal(test.input)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodPut, body, test.principal))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockEntityRepo.AssertExpectations(t)
+			mockDelegationRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteBooking(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      auth.Principal
+		setupMock      func(*MockBookingRepository)
+		hasDelegation  bool
+		expectedStatus int
+	}{
+		{
+			name:      "owner cancels booking",
+			principal: auth.Principal{UserID: 42, Permissions: []string{"booking:create"}},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				// Бронирование не удаляется, а переводится в статус cancelled с записью в историю
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "confirmed", "cancelled", int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:      "other user cannot cancel booking",
+			principal: auth.Principal{UserID: 7, Permissions: []string{"booking:create"}},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:      "delegate cancels booking of owner",
+			principal: auth.Principal{UserID: 7, Permissions: []string{"booking:create"}},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				// Бронирование не удаляется, а переводится в статус cancelled с записью в историю
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "confirmed", "cancelled", int64(7)).Return(nil).Once()
+			},
+			hasDelegation:  true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:      "manager cancels any booking",
+			principal: auth.Principal{UserID: 1, Permissions: []string{"booking:manage_any"}},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				// Бронирование не удаляется, а переводится в статус cancelled с записью в историю
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "confirmed", "cancelled", int64(1)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:      "completed booking cannot be cancelled",
+			principal: auth.Principal{UserID: 42, Permissions: []string{"booking:create"}},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				completed := existingBooking
+				completed.Status = "completed"
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(completed, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:      "booking status changed concurrently",
+			principal: auth.Principal{UserID: 42, Permissions: []string{"booking:create"}},
+			setupMock: func(mockRepo *MockBookingRepository) {
+				mockRepo.On("GetBookingById", mock.Anything, int64(10)).Return(existingBooking, nil).Once()
+				mockRepo.On("ChangeStatus", mock.Anything, int64(10), "confirmed", "cancelled", int64(42)).Return(booking_db.ErrBookingStatusChanged).Once()
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockBookingRepository)
+			mockDelegationRepo := new(MockDelegationRepository)
+			test.setupMock(mockRepo)
+			// Делегирование проверяется только для пользователя 7, который не владелец и без booking:manage_any
+			mockDelegationRepo.On("HasDelegation", mock.Anything, int64(42), int64(7)).Return(test.hasDelegation, nil).Maybe()
+			handler := delete_booking.DeleteBookingHandler(slog.Default(), mockRepo, mockDelegationRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodDelete, nil, test.principal))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
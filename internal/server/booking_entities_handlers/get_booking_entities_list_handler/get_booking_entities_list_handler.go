@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_entities_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
 	"log/slog"
@@ -16,6 +17,13 @@ func GetBookingEntitiesListHandler(logger *slog.Logger, bookingEntityRepository
 		const op = "internal/server/booking_entities_handlers/get_booking_entities_list_handler/get_booking_entities_list_handler.go/GetBookingEntitiesListHandler"
 		log := logger.With(slog.String("op", op))
 
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
@@ -31,7 +39,7 @@ func GetBookingEntitiesListHandler(logger *slog.Logger, bookingEntityRepository
 			return
 		}
 
-		entitiesList, err := booking_entities_service.GetBookingEntitiesList(log, bookingEntityRepository, ctx, parsedQuery)
+		entitiesList, err := booking_entities_service.GetBookingEntitiesList(log, bookingEntityRepository, ctx, principal, parsedQuery)
 		if err != nil {
 			log.Error("Error while getting booking entity list", "error", err)
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Something went wrong, while getting booking entity list"))
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/booking_type_service"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
 	"log/slog"
@@ -16,6 +17,13 @@ func GetBookingTypesListHandler(logger *slog.Logger, bookingTypeRepository booki
 		const op = "internal/server/booking_type_handlers/get_booking_types_list_handler/get_booking_type_list_handler.go/GetBookingTypesListHandler"
 		log := logger.With(slog.String("op", op))
 
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
@@ -31,7 +39,7 @@ func GetBookingTypesListHandler(logger *slog.Logger, bookingTypeRepository booki
 			return
 		}
 
-		userList, err := booking_type_service.GetBookingTypeList(log, bookingTypeRepository, ctx, parsedQuery)
+		userList, err := booking_type_service.GetBookingTypeList(log, bookingTypeRepository, ctx, principal, parsedQuery)
 		if err != nil {
 			log.Error("Error while getting booking type list", "error", err)
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Something went wrong, while getting booking type list"))
@@ -0,0 +1,41 @@
+package create_delegation
+
+import (
+	"context"
+	models "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/delegations"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/delegations_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/delegations"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CreateDelegationHandler делегирует бронирования пользователя запроса другому пользователю (POST /delegations)
+//
+// Повторное делегирование не является ошибкой
+func CreateDelegationHandler(logger *slog.Logger, delegationRepository delegations_db.DelegationRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/delegations/create_delegation/create_delegation_handler.go/CreateDelegationHandler"))
+
+		principal, ok := delegations.Principal(w, r, log)
+		if !ok {
+			return
+		}
+		var request models.CreateDelegationRequest
+		if !groups.DecodeBody(w, r, log, &request) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := delegations_service.Grant(log, delegationRepository, ctx, principal, request.DelegateID); err != nil {
+			delegations.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,39 @@
+package delegations
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/delegations_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"log/slog"
+	"net/http"
+)
+
+// Principal возвращает пользователя запроса. Если его нет в контексте, отвечает 401 и возвращает false
+func Principal(w http.ResponseWriter, r *http.Request, log *slog.Logger) (auth.Principal, bool) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		log.Error("principal not found in context")
+		resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+	}
+	return principal, ok
+}
+
+// RenderError отвечает статусом, соответствующим ошибке сервиса делегирования
+func RenderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, delegations_service.ErrSelfDelegation):
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+	case errors.Is(err, delegations_db.ErrDelegateNotFound),
+		errors.Is(err, delegations_db.ErrDelegationNotFound):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		log.Warn("Request canceled or timed out", slog.Any("err", err))
+		resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+	default:
+		log.Error("Unexpected error", "error", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+	}
+}
@@ -0,0 +1,40 @@
+package delete_delegation
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/delegations_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/delegations"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DeleteDelegationHandler отзывает делегирование бронирований пользователю (DELETE /delegations/{userId})
+//
+// Уже созданные представителем бронирования остаются у владельца
+func DeleteDelegationHandler(logger *slog.Logger, delegationRepository delegations_db.DelegationRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/delegations/delete_delegation/delete_delegation_handler.go/DeleteDelegationHandler"))
+
+		principal, ok := delegations.Principal(w, r, log)
+		if !ok {
+			return
+		}
+		delegateId, ok := groups.ParseID(w, r, log, "userId")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := delegations_service.Revoke(log, delegationRepository, ctx, principal, delegateId); err != nil {
+			delegations.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,34 @@
+package list_delegations
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/delegations_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/delegations"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/delegations_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ListDelegationsHandler возвращает делегирования пользователя запроса в обе стороны (GET /delegations)
+func ListDelegationsHandler(logger *slog.Logger, delegationRepository delegations_db.DelegationRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/delegations/list_delegations/list_delegations_handler.go/ListDelegationsHandler"))
+
+		principal, ok := delegations.Principal(w, r, log)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := delegations_service.List(log, delegationRepository, ctx, principal)
+		if err != nil {
+			delegations.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,111 @@
+package booking_groups
+
+import (
+	"context"
+	models "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/groups"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GetBookingTypeGroupsHandler возвращает группы, которым доступен тип бронирования (GET /bookingType/{id}/groups)
+func GetBookingTypeGroupsHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, bookingTypeRepository booking_type_db.BookingTypeRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/booking_groups/booking_groups_handler.go/GetBookingTypeGroupsHandler"))
+
+		id, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := groups_service.GetBookingTypeGroups(log, groupRepository, bookingTypeRepository, ctx, id)
+		if err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// SetBookingTypeGroupsHandler заменяет группы, которым доступен тип бронирования (PUT /bookingType/{id}/groups)
+func SetBookingTypeGroupsHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, bookingTypeRepository booking_type_db.BookingTypeRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/booking_groups/booking_groups_handler.go/SetBookingTypeGroupsHandler"))
+
+		id, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+		var request models.BookingGroupsRequest
+		if !groups.DecodeBody(w, r, log, &request) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := groups_service.SetBookingTypeGroups(log, groupRepository, bookingTypeRepository, ctx, id, request)
+		if err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// GetBookingEntityGroupsHandler возвращает группы, которым доступен объект бронирования (GET /bookingEntity/{id}/groups)
+func GetBookingEntityGroupsHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, bookingEntityRepository booking_entity_db.BookingEntityRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/booking_groups/booking_groups_handler.go/GetBookingEntityGroupsHandler"))
+
+		id, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := groups_service.GetBookingEntityGroups(log, groupRepository, bookingEntityRepository, ctx, id)
+		if err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// SetBookingEntityGroupsHandler заменяет группы, которым доступен объект бронирования (PUT /bookingEntity/{id}/groups)
+func SetBookingEntityGroupsHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, bookingEntityRepository booking_entity_db.BookingEntityRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/booking_groups/booking_groups_handler.go/SetBookingEntityGroupsHandler"))
+
+		id, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+		var request models.BookingGroupsRequest
+		if !groups.DecodeBody(w, r, log, &request) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := groups_service.SetBookingEntityGroups(log, groupRepository, bookingEntityRepository, ctx, id, request)
+		if err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,35 @@
+package create_group
+
+import (
+	"context"
+	models "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/groups"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CreateGroupHandler создаёт группу пользователей (POST /groups)
+func CreateGroupHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/create_group/create_group_handler.go/CreateGroupHandler"))
+
+		var request models.CreateGroupRequest
+		if !groups.DecodeBody(w, r, log, &request) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := groups_service.CreateGroup(log, groupRepository, ctx, request)
+		if err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusCreated, response)
+	}
+}
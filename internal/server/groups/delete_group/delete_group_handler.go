@@ -0,0 +1,35 @@
+package delete_group
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DeleteGroupHandler удаляет группу (DELETE /groups/{id})
+//
+// Типы и объекты бронирования, ограниченные только этой группой, становятся доступны всем
+func DeleteGroupHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/delete_group/delete_group_handler.go/DeleteGroupHandler"))
+
+		id, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := groups_service.DeleteGroup(log, groupRepository, ctx, id); err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,34 @@
+package get_group
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GetGroupHandler возвращает группу вместе с участниками (GET /groups/{id})
+func GetGroupHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/get_group/get_group_handler.go/GetGroupHandler"))
+
+		id, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := groups_service.GetGroup(log, groupRepository, ctx, id)
+		if err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,64 @@
+package group_members
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/services/groups_service"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AddMemberHandler добавляет пользователя в группу (PUT /groups/{id}/members/{userId})
+//
+// Повторное добавление не является ошибкой
+func AddMemberHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/group_members/group_members_handler.go/AddMemberHandler"))
+
+		groupId, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+		userId, ok := groups.ParseID(w, r, log, "userId")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := groups_service.AddMember(log, groupRepository, ctx, groupId, userId); err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusNoContent, nil)
+	}
+}
+
+// RemoveMemberHandler удаляет пользователя из группы (DELETE /groups/{id}/members/{userId})
+func RemoveMemberHandler(logger *slog.Logger, groupRepository groups_db.GroupRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "internal/server/groups/group_members/group_members_handler.go/RemoveMemberHandler"))
+
+		groupId, ok := groups.ParseID(w, r, log, "id")
+		if !ok {
+			return
+		}
+		userId, ok := groups.ParseID(w, r, log, "userId")
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := groups_service.RemoveMember(log, groupRepository, ctx, groupId, userId); err != nil {
+			groups.RenderError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,68 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// ParseID читает id из параметра маршрута. При ошибке отвечает 400 и возвращает false
+func ParseID(w http.ResponseWriter, r *http.Request, log *slog.Logger, param string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil || id <= 0 {
+		log.Error("Route parameter is invalid", "param", param, "error", err)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid "+param))
+		return 0, false
+	}
+	return id, true
+}
+
+// DecodeBody читает и валидирует тело запроса. При ошибке отвечает 400 или 500 и возвращает false
+func DecodeBody(w http.ResponseWriter, r *http.Request, log *slog.Logger, dst any) bool {
+	err := body.DecodeAndValidateJson(r, dst)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, body.ErrDecodeJSON) {
+		log.Error("Error decoding body", "error", err)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+		return false
+	}
+	if validationErr, ok := err.(validator.ValidationErrors); ok {
+		log.Error("Error validating request body", "err", validationErr)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+		return false
+	}
+	log.Error("Unexpected error", "err", err)
+	resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+	return false
+}
+
+// RenderError отвечает статусом, соответствующим ошибке сервиса групп
+func RenderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, groups_db.ErrGroupNotFound),
+		errors.Is(err, groups_db.ErrMemberNotFound),
+		errors.Is(err, groups_db.ErrMemberUserNotFound),
+		errors.Is(err, booking_type_db.ErrBookingTypeNotFound),
+		errors.Is(err, booking_entity_db.ErrBookingEntityNotFound):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, groups_db.ErrGroupAlreadyExists):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		log.Warn("Request canceled or timed out", slog.Any("err", err))
+		resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+	default:
+		log.Error("Unexpected error", "error", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+	}
+}
@@ -0,0 +1,323 @@
+package groups_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/booking_groups"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/create_group"
+	"github.com/ShlykovPavel/booker_microservice/internal/server/groups/group_members"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockGroupRepository struct {
+	mock.Mock
+}
+
+func (m *MockGroupRepository) CreateGroup(ctx context.Context, name, description string) (int64, error) {
+	args := m.Called(ctx, name, description)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockGroupRepository) GetGroup(ctx context.Context, id int64) (groups_db.GroupInfo, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(groups_db.GroupInfo), args.Error(1)
+}
+
+func (m *MockGroupRepository) ListGroups(ctx context.Context) ([]groups_db.GroupInfo, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]groups_db.GroupInfo), args.Error(1)
+}
+
+func (m *MockGroupRepository) DeleteGroup(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) AddMember(ctx context.Context, groupId, userId int64) error {
+	args := m.Called(ctx, groupId, userId)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) RemoveMember(ctx context.Context, groupId, userId int64) error {
+	args := m.Called(ctx, groupId, userId)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) ListMembers(ctx context.Context, groupId int64) ([]groups_db.MemberInfo, error) {
+	args := m.Called(ctx, groupId)
+	return args.Get(0).([]groups_db.MemberInfo), args.Error(1)
+}
+
+func (m *MockGroupRepository) GetBookingTypeGroups(ctx context.Context, bookingTypeId int64) ([]int64, error) {
+	args := m.Called(ctx, bookingTypeId)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockGroupRepository) SetBookingTypeGroups(ctx context.Context, bookingTypeId int64, groupIds []int64) error {
+	args := m.Called(ctx, bookingTypeId, groupIds)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) GetBookingEntityGroups(ctx context.Context, bookingEntityId int64) ([]int64, error) {
+	args := m.Called(ctx, bookingEntityId)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockGroupRepository) SetBookingEntityGroups(ctx context.Context, bookingEntityId int64, groupIds []int64) error {
+	args := m.Called(ctx, bookingEntityId, groupIds)
+	return args.Error(0)
+}
+
+type MockBookingEntityRepository struct {
+	mock.Mock
+}
+
+func (m *MockBookingEntityRepository) CreateBookingEntity(ctx context.Context, bookingTypeId int64, name, description, status string, ParentId int64) (int64, error) {
+	args := m.Called(ctx, bookingTypeId, name, description, status, ParentId)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) GetBookingEntity(ctx context.Context, BookingEntityId int64) (booking_entity_db.BookingEntityInfo, error) {
+	args := m.Called(ctx, BookingEntityId)
+	return args.Get(0).(booking_entity_db.BookingEntityInfo), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) GetBookingEntitiesList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (booking_entity_db.BookingEntityListResult, error) {
+	args := m.Called(ctx, search, bookableBy, limit, offset, sortParams)
+	return args.Get(0).(booking_entity_db.BookingEntityListResult), args.Error(1)
+}
+
+func (m *MockBookingEntityRepository) UpdateBookingEntity(ctx context.Context, id int64, bookingTypeId int64, name, description, status string, ParentId int64) error {
+	args := m.Called(ctx, id, bookingTypeId, name, description, status, ParentId)
+	return args.Error(0)
+}
+
+func (m *MockBookingEntityRepository) DeleteBookingEntity(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockBookingEntityRepository) CanBook(ctx context.Context, bookingEntityId, userId int64) (bool, error) {
+	args := m.Called(ctx, bookingEntityId, userId)
+	return args.Bool(0), args.Error(1)
+}
+
+// newRequest создаёт запрос с параметрами маршрута, как после роутера chi
+func newRequest(method, target, body string, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	routeCtx := chi.NewRouteContext()
+	for key, value := range params {
+		routeCtx.URLParams.Add(key, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+}
+
+func TestCreateGroupHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*MockGroupRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "group is created",
+			body: `{"name":"Engineering","description":"R&D department"}`,
+			setupMock: func(mockRepo *MockGroupRepository) {
+				mockRepo.On("CreateGroup", mock.Anything, "Engineering", "R&D department").Return(int64(3), nil).Once()
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"status":"OK","id":3}`,
+		},
+		{
+			name: "duplicate name",
+			body: `{"name":"Engineering"}`,
+			setupMock: func(mockRepo *MockGroupRepository) {
+				mockRepo.On("CreateGroup", mock.Anything, "Engineering", "").Return(int64(0), groups_db.ErrGroupAlreadyExists).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Группа с таким названием уже существует"}`,
+		},
+		{
+			name:           "name is required",
+			body:           `{"description":"no name"}`,
+			setupMock:      func(mockRepo *MockGroupRepository) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockGroupRepository)
+			test.setupMock(mockRepo)
+			handler := create_group.CreateGroupHandler(slog.Default(), mockRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodPost, "/groups", test.body, nil))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedBody != "" {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAddMemberHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		groupId        string
+		userId         string
+		setupMock      func(*MockGroupRepository)
+		expectedStatus int
+	}{
+		{
+			name:    "member is added",
+			groupId: "3",
+			userId:  "42",
+			setupMock: func(mockRepo *MockGroupRepository) {
+				mockRepo.On("AddMember", mock.Anything, int64(3), int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:    "user not found",
+			groupId: "3",
+			userId:  "404",
+			setupMock: func(mockRepo *MockGroupRepository) {
+				mockRepo.On("AddMember", mock.Anything, int64(3), int64(404)).Return(groups_db.ErrMemberUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "group not found",
+			groupId: "404",
+			userId:  "42",
+			setupMock: func(mockRepo *MockGroupRepository) {
+				mockRepo.On("AddMember", mock.Anything, int64(404), int64(42)).Return(groups_db.ErrGroupNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid user id",
+			groupId:        "3",
+			userId:         "abc",
+			setupMock:      func(mockRepo *MockGroupRepository) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockGroupRepository)
+			test.setupMock(mockRepo)
+			handler := group_members.AddMemberHandler(slog.Default(), mockRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			target := fmt.Sprintf("/groups/%s/members/%s", test.groupId, test.userId)
+			handler.ServeHTTP(w, newRequest(http.MethodPut, target, "", map[string]string{"id": test.groupId, "userId": test.userId}))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSetBookingEntityGroupsHandler(t *testing.T) {
+	entity := booking_entity_db.BookingEntityInfo{ID: 5, BookingTypeID: 1, Name: "Room 5"}
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*MockGroupRepository, *MockBookingEntityRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "entity is restricted to groups",
+			body: `{"group_ids":[3,4]}`,
+			setupMock: func(mockRepo *MockGroupRepository, mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("GetBookingEntity", mock.Anything, int64(5)).Return(entity, nil).Twice()
+				mockRepo.On("SetBookingEntityGroups", mock.Anything, int64(5), []int64{3, 4}).Return(nil).Once()
+				mockRepo.On("GetBookingEntityGroups", mock.Anything, int64(5)).Return([]int64{3, 4}, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK","group_ids":[3,4]}`,
+		},
+		{
+			name: "empty list removes restriction",
+			body: `{"group_ids":[]}`,
+			setupMock: func(mockRepo *MockGroupRepository, mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("GetBookingEntity", mock.Anything, int64(5)).Return(entity, nil).Twice()
+				mockRepo.On("SetBookingEntityGroups", mock.Anything, int64(5), []int64{}).Return(nil).Once()
+				mockRepo.On("GetBookingEntityGroups", mock.Anything, int64(5)).Return([]int64{}, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK","group_ids":[]}`,
+		},
+		{
+			name: "unknown group",
+			body: `{"group_ids":[404]}`,
+			setupMock: func(mockRepo *MockGroupRepository, mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("GetBookingEntity", mock.Anything, int64(5)).Return(entity, nil).Once()
+				mockRepo.On("SetBookingEntityGroups", mock.Anything, int64(5), []int64{404}).Return(fmt.Errorf("%w: %d", groups_db.ErrGroupNotFound, 404)).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"Группа не найдена: 404"}`,
+		},
+		{
+			name: "entity not found",
+			body: `{"group_ids":[3]}`,
+			setupMock: func(mockRepo *MockGroupRepository, mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("GetBookingEntity", mock.Anything, int64(5)).Return(booking_entity_db.BookingEntityInfo{}, booking_entity_db.ErrBookingEntityNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "group_ids is required",
+			body:           `{}`,
+			setupMock:      func(mockRepo *MockGroupRepository, mockEntityRepo *MockBookingEntityRepository) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "database error",
+			body: `{"group_ids":[3]}`,
+			setupMock: func(mockRepo *MockGroupRepository, mockEntityRepo *MockBookingEntityRepository) {
+				mockEntityRepo.On("GetBookingEntity", mock.Anything, int64(5)).Return(entity, nil).Once()
+				mockRepo.On("SetBookingEntityGroups", mock.Anything, int64(5), []int64{3}).Return(errors.New("db down")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockGroupRepository)
+			mockEntityRepo := new(MockBookingEntityRepository)
+			test.setupMock(mockRepo, mockEntityRepo)
+			handler := booking_groups.SetBookingEntityGroupsHandler(slog.Default(), mockRepo, mockEntityRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodPut, "/bookingEntity/5/groups", test.body, map[string]string{"id": "5"}))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedBody != "" {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+			mockRepo.AssertExpectations(t)
+			mockEntityRepo.AssertExpectations(t)
+		})
+	}
+}
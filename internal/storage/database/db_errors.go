@@ -14,6 +14,14 @@ const PSQLForeignKeyError = "23503"                // Нарушение вне
 const PSQLNotNullError = "23502"                   // Нельзя вставить NULL
 const PSQLStringDataRightTruncationError = "22001" // Данные слишком длинные
 const PSQLSyntaxError = "42601"                    // Синтаксическая ошибка в SQL
+const PSQLExclusionError = "23P01"                 // Нарушение ограничения-исключения
+
+// BookingsNoOverlapConstraint ограничение-исключение, запрещающее пересечение бронирований одного объекта
+const BookingsNoOverlapConstraint = "excl_bookings_no_overlap"
+
+// ErrBookingNotAvailable интервал уже занят другим бронированием. Возвращается PsqlErrorHandler,
+// когда вставка или изменение бронирования нарушает BookingsNoOverlapConstraint
+var ErrBookingNotAvailable = errors.New("Booking not available")
 
 func PsqlErrorHandler(err error) error {
 	if pgErr, ok := err.(*pgconn.PgError); ok {
@@ -28,6 +36,11 @@ func PsqlErrorHandler(err error) error {
 			return fmt.Errorf("данные слишком длинные: %w", err)
 		case PSQLSyntaxError: // syntax_error
 			return fmt.Errorf("синтаксическая ошибка в SQL: %w", err)
+		case PSQLExclusionError: // exclusion_violation
+			if pgErr.ConstraintName == BookingsNoOverlapConstraint {
+				return fmt.Errorf("%w: %w", ErrBookingNotAvailable, err)
+			}
+			return fmt.Errorf("нарушение ограничения-исключения: %w", err)
 		default:
 			return fmt.Errorf("ошибка PostgreSQL (%s): %w", pgErr.Code, err)
 		}
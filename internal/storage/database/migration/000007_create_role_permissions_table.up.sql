@@ -0,0 +1,22 @@
+CREATE TABLE role_permissions
+(
+    role       VARCHAR(64) NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO role_permissions (role, permission)
+VALUES ('admin', 'booking:create'),
+       ('admin', 'booking:read'),
+       ('admin', 'booking:manage_any'),
+       ('admin', 'entity:read'),
+       ('admin', 'entity:write'),
+       ('admin', 'booking_type:read'),
+       ('admin', 'booking_type:write'),
+       ('admin', 'user:read'),
+       ('admin', 'user:manage'),
+       ('user', 'booking:create'),
+       ('user', 'booking:read'),
+       ('user', 'entity:read'),
+       ('user', 'booking_type:read');
@@ -0,0 +1,7 @@
+CREATE TABLE login_attempts
+(
+    key             VARCHAR(320)             NOT NULL PRIMARY KEY,
+    failures        INT                      NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until    TIMESTAMP WITH TIME ZONE NULL
+);
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD COLUMN status     VARCHAR(16)              NOT NULL DEFAULT 'active',
+    ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE NULL;
+
+ALTER TABLE users
+    ADD CONSTRAINT chk_users_status CHECK (status IN ('active', 'deactivated', 'deleted'));
+
+CREATE INDEX idx_users_status ON users (status);
+CREATE INDEX idx_bookings_user_id ON bookings (user_id);
@@ -0,0 +1,14 @@
+-- actor_id и target_id без внешних ключей, что б записи аудита сохранялись после удаления пользователей
+CREATE TABLE audit_log
+(
+    id          SERIAL PRIMARY KEY,
+    actor_id    BIGINT                   NULL,
+    action      VARCHAR(64)              NOT NULL,
+    target_type VARCHAR(32)              NOT NULL,
+    target_id   BIGINT                   NULL,
+    details     JSONB                    NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_target ON audit_log (target_type, target_id);
+CREATE INDEX idx_audit_log_actor_id ON audit_log (actor_id);
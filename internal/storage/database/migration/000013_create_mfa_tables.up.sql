@@ -0,0 +1,36 @@
+-- Секрет TOTP пользователя. confirmed_at = NULL пока пользователь не подтвердил подключение кодом
+CREATE TABLE user_totp
+(
+    user_id        BIGINT                   NOT NULL PRIMARY KEY,
+    secret         VARCHAR(64)              NOT NULL,
+    confirmed_at   TIMESTAMP WITH TIME ZONE NULL,
+    last_used_step BIGINT                   NULL,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_user_totp_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE mfa_backup_codes
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    BIGINT                   NOT NULL,
+    code_hash  VARCHAR(64)              NOT NULL,
+    used_at    TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_mfa_backup_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT uq_mfa_backup_codes_user_code UNIQUE (user_id, code_hash)
+);
+
+-- Незавершённые входы: пароль проверен, ожидается второй фактор
+CREATE TABLE mfa_challenges
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    BIGINT                   NOT NULL,
+    token_hash VARCHAR(64)              NOT NULL UNIQUE,
+    attempts   INT                      NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_mfa_challenges_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges (user_id);
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission = 'api_key:manage';
+DROP TABLE IF EXISTS api_keys;
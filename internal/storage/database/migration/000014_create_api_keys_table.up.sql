@@ -0,0 +1,22 @@
+-- API ключи для автоматизации. Хранится только sha256 хеш ключа, key_prefix нужен что б ключ можно было узнать в списке
+-- user_id - пользователь, от имени которого действует ключ
+CREATE TABLE api_keys
+(
+    id           SERIAL PRIMARY KEY,
+    name         VARCHAR(128)             NOT NULL,
+    key_prefix   VARCHAR(16)              NOT NULL,
+    secret_hash  VARCHAR(64)              NOT NULL UNIQUE,
+    scopes       TEXT[]                   NOT NULL DEFAULT '{}',
+    user_id      BIGINT                   NOT NULL,
+    created_by   BIGINT                   NULL,
+    expires_at   TIMESTAMP WITH TIME ZONE NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE NULL,
+    revoked_at   TIMESTAMP WITH TIME ZONE NULL,
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+
+INSERT INTO role_permissions (role, permission)
+VALUES ('admin', 'api_key:manage');
@@ -0,0 +1,16 @@
+-- Сессия = семейство refresh токенов (family_id), которое начинается при входе и наследуется при ротации.
+-- id сессии записывается в токен доступа (claim sid), по terminated_at AuthMiddleware отклоняет токены завершённых сессий
+CREATE TABLE sessions
+(
+    id            SERIAL PRIMARY KEY,
+    user_id       BIGINT                   NOT NULL,
+    family_id     VARCHAR(64)              NOT NULL UNIQUE,
+    user_agent    VARCHAR(512)             NOT NULL DEFAULT '',
+    ip            VARCHAR(64)              NOT NULL DEFAULT '',
+    created_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    terminated_at TIMESTAMP WITH TIME ZONE NULL,
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
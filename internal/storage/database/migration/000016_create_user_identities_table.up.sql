@@ -0,0 +1,13 @@
+-- Внешние учётные записи (OpenID Connect), связанные с локальными пользователями.
+-- Пользователь определяется парой issuer + subject, email провайдера используется только при первой привязке
+CREATE TABLE user_identities
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    BIGINT                   NOT NULL,
+    issuer     VARCHAR(255)             NOT NULL,
+    subject    VARCHAR(255)             NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_user_identities_subject UNIQUE (issuer, subject),
+    CONSTRAINT uq_user_identities_user UNIQUE (user_id, issuer),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
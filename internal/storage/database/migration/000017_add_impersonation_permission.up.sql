@@ -0,0 +1,3 @@
+-- Вход от имени пользователя (POST /admin/impersonate/{userId}) доступен только администраторам
+INSERT INTO role_permissions (role, permission)
+VALUES ('admin', 'user:impersonate');
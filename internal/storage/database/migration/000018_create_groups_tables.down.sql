@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission = 'group:manage';
+DROP TABLE IF EXISTS booking_entity_groups;
+DROP TABLE IF EXISTS booking_type_groups;
+DROP TABLE IF EXISTS user_group_members;
+DROP TABLE IF EXISTS user_groups;
@@ -0,0 +1,50 @@
+-- Группы пользователей (отделы, команды) и ограничение бронирования типов и объектов бронирования группами.
+-- Тип или объект без записей в booking_type_groups / booking_entity_groups доступен всем,
+-- иначе только участникам хотя бы одной из указанных групп
+CREATE TABLE user_groups
+(
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(100)             NOT NULL UNIQUE,
+    description TEXT                     NOT NULL DEFAULT '',
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_user_groups_updated_at
+    BEFORE UPDATE
+    ON user_groups
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE user_group_members
+(
+    group_id   BIGINT                   NOT NULL,
+    user_id    BIGINT                   NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    CONSTRAINT fk_user_group_members_group FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_group_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_group_members_user_id ON user_group_members (user_id);
+
+CREATE TABLE booking_type_groups
+(
+    booking_type_id BIGINT NOT NULL,
+    group_id        BIGINT NOT NULL,
+    PRIMARY KEY (booking_type_id, group_id),
+    CONSTRAINT fk_booking_type_groups_type FOREIGN KEY (booking_type_id) REFERENCES booking_types (id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_type_groups_group FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE
+);
+
+CREATE TABLE booking_entity_groups
+(
+    booking_entity_id BIGINT NOT NULL,
+    group_id          BIGINT NOT NULL,
+    PRIMARY KEY (booking_entity_id, group_id),
+    CONSTRAINT fk_booking_entity_groups_entity FOREIGN KEY (booking_entity_id) REFERENCES booking_entities (id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_entity_groups_group FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE
+);
+
+INSERT INTO role_permissions (role, permission)
+VALUES ('admin', 'group:manage');
@@ -0,0 +1,10 @@
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE booking_entities
+    DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE booking_types
+    DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS tenant_id;
+
+DROP TABLE IF EXISTS organizations;
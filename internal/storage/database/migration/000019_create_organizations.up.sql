@@ -0,0 +1,38 @@
+-- Организации (тенанты). Пользователи, типы и объекты бронирования и бронирования принадлежат одной организации,
+-- репозитории ограничивают запросы организацией пользователя из токена доступа.
+-- Существующие данные переносятся в организацию по умолчанию с id 1
+CREATE TABLE organizations
+(
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(100)             NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_organizations_updated_at
+    BEFORE UPDATE
+    ON organizations
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO organizations (id, name)
+VALUES (1, 'Default');
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), (SELECT MAX(id) FROM organizations));
+
+ALTER TABLE users
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_users_tenant FOREIGN KEY (tenant_id) REFERENCES organizations (id);
+ALTER TABLE booking_types
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_booking_types_tenant FOREIGN KEY (tenant_id) REFERENCES organizations (id);
+ALTER TABLE booking_entities
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_booking_entities_tenant FOREIGN KEY (tenant_id) REFERENCES organizations (id);
+ALTER TABLE bookings
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_bookings_tenant FOREIGN KEY (tenant_id) REFERENCES organizations (id);
+
+CREATE INDEX idx_users_tenant_id ON users (tenant_id);
+CREATE INDEX idx_booking_types_tenant_id ON booking_types (tenant_id);
+CREATE INDEX idx_booking_entities_tenant_id ON booking_entities (tenant_id);
+CREATE INDEX idx_bookings_tenant_id ON bookings (tenant_id);
@@ -0,0 +1,3 @@
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS created_by;
+DROP TABLE IF EXISTS booking_delegations;
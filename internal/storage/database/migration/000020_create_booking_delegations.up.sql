@@ -0,0 +1,24 @@
+-- Делегирование бронирований: владелец (owner_id) разрешает представителю (delegate_id), например ассистенту,
+-- создавать, менять и отменять свои бронирования. В бронировании сохраняется, кто его создал (created_by)
+CREATE TABLE booking_delegations
+(
+    owner_id    BIGINT NOT NULL,
+    delegate_id BIGINT NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (owner_id, delegate_id),
+    CONSTRAINT chk_booking_delegations_self CHECK (owner_id <> delegate_id),
+    CONSTRAINT fk_booking_delegations_owner FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_delegations_delegate FOREIGN KEY (delegate_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_booking_delegations_delegate_id ON booking_delegations (delegate_id);
+
+-- Существующие бронирования считаются созданными их владельцами
+ALTER TABLE bookings
+    ADD COLUMN created_by BIGINT;
+UPDATE bookings
+SET created_by = user_id;
+ALTER TABLE bookings
+    ALTER COLUMN created_by SET NOT NULL;
+
+CREATE INDEX idx_bookings_created_by ON bookings (created_by);
@@ -0,0 +1,5 @@
+ALTER TABLE bookings
+    DROP CONSTRAINT IF EXISTS excl_bookings_no_overlap;
+
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS time_range;
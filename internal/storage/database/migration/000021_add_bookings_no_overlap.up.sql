@@ -0,0 +1,12 @@
+-- Запрет пересечения бронирований одного объекта на уровне БД. Проверка CheckBookingAvailability перед вставкой
+-- не защищает от параллельных запросов, поэтому пересечение интервалов запрещается ограничением-исключением.
+-- Отменённые бронирования интервал не занимают. Если в таблице уже есть пересекающиеся бронирования,
+-- миграция завершится ошибкой: их нужно отменить вручную
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE bookings
+    ADD COLUMN time_range TSTZRANGE GENERATED ALWAYS AS (tstzrange(start_time, end_time, '[)')) STORED;
+
+ALTER TABLE bookings
+    ADD CONSTRAINT excl_bookings_no_overlap EXCLUDE USING gist (booking_entity_id WITH =, time_range WITH &&)
+        WHERE (status IS DISTINCT FROM 'cancelled');
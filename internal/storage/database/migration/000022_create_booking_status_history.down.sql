@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS booking_status_history;
+
+ALTER TABLE bookings
+    DROP CONSTRAINT IF EXISTS chk_bookings_status;
+ALTER TABLE bookings
+    ALTER COLUMN status DROP NOT NULL;
@@ -0,0 +1,29 @@
+-- Статусы бронирования ограничены конечным автоматом:
+-- pending -> confirmed -> checked_in -> completed, отмена (cancelled) и неявка (no_show) - конечные статусы.
+-- Статусы, заданные клиентами до появления автомата, считаются pending: такие бронирования
+-- и раньше занимали интервал, поэтому ограничение на пересечение не нарушается
+UPDATE bookings
+SET status = 'pending'
+WHERE status IS NULL
+   OR status NOT IN ('pending', 'confirmed', 'checked_in', 'completed', 'cancelled', 'no_show');
+
+ALTER TABLE bookings
+    ALTER COLUMN status SET NOT NULL;
+ALTER TABLE bookings
+    ADD CONSTRAINT chk_bookings_status CHECK (status IN ('pending', 'confirmed', 'checked_in', 'completed', 'cancelled', 'no_show'));
+
+-- История смены статусов: кто и когда перевёл бронирование. from_status пуст у записи о создании,
+-- changed_by пуст у системных изменений (например, отмена бронирований деактивированного через SCIM пользователя)
+CREATE TABLE booking_status_history
+(
+    id          BIGSERIAL PRIMARY KEY,
+    booking_id  BIGINT                   NOT NULL,
+    from_status VARCHAR(20),
+    to_status   VARCHAR(20)              NOT NULL,
+    changed_by  BIGINT,
+    changed_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_booking_status_history_booking FOREIGN KEY (booking_id) REFERENCES bookings (id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_status_history_changed_by FOREIGN KEY (changed_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_booking_status_history_booking_id ON booking_status_history (booking_id, changed_at);
@@ -0,0 +1,7 @@
+ALTER TABLE user_groups
+    DROP CONSTRAINT IF EXISTS uq_user_groups_tenant_name;
+ALTER TABLE user_groups
+    ADD CONSTRAINT user_groups_name_key UNIQUE (name);
+
+ALTER TABLE user_groups
+    DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,18 @@
+-- Группы пользователей принадлежат организации, как пользователи и типы и объекты бронирования.
+-- Существующие группы переносятся в организацию по умолчанию, название группы уникально в пределах организации
+ALTER TABLE user_groups
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1,
+    ADD CONSTRAINT fk_user_groups_tenant FOREIGN KEY (tenant_id) REFERENCES organizations (id);
+
+ALTER TABLE user_groups
+    DROP CONSTRAINT IF EXISTS user_groups_name_key;
+ALTER TABLE user_groups
+    ADD CONSTRAINT uq_user_groups_tenant_name UNIQUE (tenant_id, name);
+
+-- Участники из других организаций могли попасть в группы до появления ограничения, они удаляются из групп
+DELETE
+FROM user_group_members m
+    USING user_groups g, users u
+WHERE g.id = m.group_id
+  AND u.id = m.user_id
+  AND u.tenant_id <> g.tenant_id;
@@ -0,0 +1,3 @@
+ALTER TABLE bookings
+    DROP CONSTRAINT IF EXISTS fk_bookings_created_by,
+    DROP CONSTRAINT IF EXISTS fk_bookings_user;
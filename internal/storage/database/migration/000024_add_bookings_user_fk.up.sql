@@ -0,0 +1,13 @@
+-- Бронирования ссылаются на существующих пользователей. Бронирования уже удалённых пользователей
+-- записать не на кого, они удаляются, а бронирования, созданные удалёнными пользователями, записываются на владельцев
+DELETE
+FROM bookings b
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = b.user_id);
+UPDATE bookings b
+SET created_by = b.user_id
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = b.created_by);
+
+-- Без ON DELETE: пользователя с бронированиями удаляет только PurgeUser, который сначала убирает его бронирования
+ALTER TABLE bookings
+    ADD CONSTRAINT fk_bookings_user FOREIGN KEY (user_id) REFERENCES users (id),
+    ADD CONSTRAINT fk_bookings_created_by FOREIGN KEY (created_by) REFERENCES users (id);
@@ -0,0 +1,4 @@
+-- Создание организаций (POST /organizations). Разрешение выдаётся роли admin, но действует только
+-- для администраторов организации по умолчанию, которые обслуживают весь сервис
+INSERT INTO role_permissions (role, permission)
+VALUES ('admin', 'organization:manage');
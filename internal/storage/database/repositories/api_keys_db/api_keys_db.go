@@ -0,0 +1,216 @@
+package api_keys_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("API ключ не найден")
+var ErrAPIKeyInvalid = errors.New("API ключ недействителен, отозван или истёк")
+var ErrAPIKeyUserNotFound = errors.New("Пользователь для API ключа не найден")
+
+// lastUsedPrecision как часто обновляется last_used_at, что б не писать в БД на каждый запрос
+const lastUsedPrecision = time.Minute
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key APIKeyCreate) (int64, error)
+	ListAPIKeys(ctx context.Context) ([]APIKeyInfo, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	Authenticate(ctx context.Context, secretHash string) (APIKeyPrincipal, error)
+	TouchLastUsed(ctx context.Context, id int64) error
+}
+
+// APIKeyCreate данные нового ключа. Сам ключ не сохраняется, только его хеш
+type APIKeyCreate struct {
+	Name       string
+	Prefix     string
+	SecretHash string
+	Scopes     []string
+	UserID     int64
+	CreatedBy  int64
+	ExpiresAt  *time.Time
+}
+
+// APIKeyInfo ключ в списке ключей
+type APIKeyInfo struct {
+	ID         int64
+	Name       string
+	Prefix     string
+	Scopes     []string
+	UserID     int64
+	CreatedBy  *int64
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// APIKeyPrincipal данные для аутентификации запроса по ключу: сам ключ и пользователь, от имени которого он действует
+type APIKeyPrincipal struct {
+	ID                int64
+	Scopes            []string
+	UserID            int64
+	UserRole          string
+	UserEmailVerified bool
+	UserTenantID      int64
+}
+
+// APIKeyRepositoryImpl Ключ принадлежит организации пользователя, от имени которого он действует.
+// Создание, список и отзыв ключей ограничиваются организацией пользователя запроса (см. tenant.FromContext),
+// Authenticate выполняется до аутентификации и не ограничивается
+type APIKeyRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewAPIKeyRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *APIKeyRepositoryImpl {
+	return &APIKeyRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// CreateAPIKey создаёт ключ. Пользователь ключа из другой организации - ErrAPIKeyUserNotFound
+func (ak *APIKeyRepositoryImpl) CreateAPIKey(ctx context.Context, key APIKeyCreate) (int64, error) {
+	query := `INSERT INTO api_keys (name, key_prefix, secret_hash, scopes, user_id, created_by, expires_at)
+SELECT $1, $2, $3, $4, u.id, $6, $7 FROM users u WHERE u.id = $5`
+
+	var expiresAt *time.Time
+	if key.ExpiresAt != nil {
+		utc := key.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	args := []interface{}{key.Name, key.Prefix, key.SecretHash, key.Scopes, key.UserID, key.CreatedBy, expiresAt}
+	query += tenant.And(ctx, "u.tenant_id", &args) + " RETURNING id"
+
+	var id int64
+	err := ak.db.QueryRow(ctx, query, args...).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrAPIKeyUserNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ak.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLForeignKeyError {
+			return 0, ErrAPIKeyUserNotFound
+		}
+		ak.log.Error("Failed to create api key", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, nil
+}
+
+// ListAPIKeys возвращает все ключи организации, включая отозванные и истёкшие
+func (ak *APIKeyRepositoryImpl) ListAPIKeys(ctx context.Context) ([]APIKeyInfo, error) {
+	query := `SELECT k.id, k.name, k.key_prefix, k.scopes, k.user_id, k.created_by, k.expires_at, k.last_used_at, k.revoked_at, k.created_at
+FROM api_keys k
+JOIN users u ON u.id = k.user_id`
+	var args []interface{}
+	if condition := tenant.Condition(ctx, "u.tenant_id", &args); condition != "" {
+		query += " WHERE " + condition
+	}
+	query += " ORDER BY k.id"
+
+	rows, err := ak.db.Query(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ak.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		ak.log.Error("Failed to list api keys", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	keys := make([]APIKeyInfo, 0)
+	for rows.Next() {
+		var key APIKeyInfo
+		err = rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Scopes, &key.UserID, &key.CreatedBy, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+		if err != nil {
+			ak.log.Error("Failed to scan api key", "error", err)
+			return nil, database.PsqlErrorHandler(err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ak.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		ak.log.Error("Failed to iterate api keys", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ. Повторный отзыв не является ошибкой
+func (ak *APIKeyRepositoryImpl) RevokeAPIKey(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys k SET revoked_at = COALESCE(k.revoked_at, CURRENT_TIMESTAMP)
+FROM users u
+WHERE u.id = k.user_id AND k.id = $1`
+	args := []interface{}{id}
+	query += tenant.And(ctx, "u.tenant_id", &args)
+
+	result, err := ak.db.Exec(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ak.log); ctxErr != nil {
+			return ctxErr
+		}
+		ak.log.Error("Failed to revoke api key", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate ищет действующий ключ по хешу
+//
+// Ключ недействителен, если он отозван, истёк или пользователь, от имени которого он действует, не активен.
+// Во всех этих случаях возвращается ErrAPIKeyInvalid
+func (ak *APIKeyRepositoryImpl) Authenticate(ctx context.Context, secretHash string) (APIKeyPrincipal, error) {
+	query := `SELECT k.id, k.scopes, u.id, u.role, u.email_verified, u.tenant_id
+FROM api_keys k
+JOIN users u ON u.id = k.user_id
+WHERE k.secret_hash = $1
+  AND k.revoked_at IS NULL
+  AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP)
+  AND u.status = 'active'`
+
+	var key APIKeyPrincipal
+	err := ak.db.QueryRow(ctx, query, secretHash).Scan(&key.ID, &key.Scopes, &key.UserID, &key.UserRole, &key.UserEmailVerified, &key.UserTenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKeyPrincipal{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ak.log); ctxErr != nil {
+			return APIKeyPrincipal{}, ctxErr
+		}
+		ak.log.Error("Failed to authenticate api key", "error", err)
+		return APIKeyPrincipal{}, database.PsqlErrorHandler(err)
+	}
+	return key, nil
+}
+
+// TouchLastUsed обновляет время последнего использования ключа не чаще раза в lastUsedPrecision
+func (ak *APIKeyRepositoryImpl) TouchLastUsed(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - $2::interval)`
+
+	_, err := ak.db.Exec(ctx, query, id, lastUsedPrecision.String())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ak.log); ctxErr != nil {
+			return ctxErr
+		}
+		ak.log.Error("Failed to update api key last used time", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
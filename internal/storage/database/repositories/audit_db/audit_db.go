@@ -0,0 +1,95 @@
+package audit_db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+// Действия, которые попадают в журнал аудита
+const (
+	ActionUserRoleChanged = "user.role_changed"
+	ActionAdminCreated    = "user.admin_created"
+	ActionUserSignedOut   = "user.signed_out_everywhere"
+	ActionAPIKeyCreated   = "api_key.created"
+	ActionAPIKeyRevoked   = "api_key.revoked"
+	ActionUserProvisioned = "user.provisioned"
+	ActionIdentityLinked  = "user.identity_linked"
+	// ActionImpersonationStarted администратор получил токен имперсонации
+	ActionImpersonationStarted = "user.impersonation_started"
+	// ActionImpersonatedRequest изменяющий запрос, выполненный под имперсонацией
+	ActionImpersonatedRequest = "impersonation.request"
+	// ActionBookingReassigned бронирование передано другому пользователю при деактивации или удалении владельца
+	ActionBookingReassigned = "booking.reassigned"
+	// ActionOrganizationCreated создана организация (POST /organizations или create-admin --org)
+	ActionOrganizationCreated = "organization.created"
+)
+
+// Типы объектов аудита
+const (
+	TargetUser         = "user"
+	TargetAPIKey       = "api_key"
+	TargetBooking      = "booking"
+	TargetOrganization = "organization"
+)
+
+// Entry Запись журнала аудита
+//
+// ActorID = 0 означает, что действие выполнено не пользователем (например, командой create-admin).
+// Для действий под имперсонацией ActorID - администратор, а TargetID - пользователь, от имени которого он действует
+type Entry struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+	Details    map[string]any
+}
+
+type AuditRepository interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+type AuditRepositoryImpl struct {
+	dbPoll *pgxpool.Pool
+	log    *slog.Logger
+}
+
+func NewAuditRepository(db *pgxpool.Pool, log *slog.Logger) *AuditRepositoryImpl {
+	return &AuditRepositoryImpl{
+		dbPoll: db,
+		log:    log,
+	}
+}
+
+// Record Сохраняет запись в журнал аудита
+func (a *AuditRepositoryImpl) Record(ctx context.Context, entry Entry) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	detailsJson, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+
+	query := `INSERT INTO audit_log (actor_id, action, target_type, target_id, details) VALUES ($1, $2, $3, $4, $5)`
+	_, err = a.dbPoll.Exec(ctx, query, nullableId(entry.ActorID), entry.Action, entry.TargetType, nullableId(entry.TargetID), detailsJson)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, a.log); ctxErr != nil {
+			return ctxErr
+		}
+		a.log.Error("Failed to insert audit log entry", slog.Any("error", err))
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func nullableId(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
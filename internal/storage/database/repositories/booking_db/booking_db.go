@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
 	"strings"
@@ -16,18 +18,23 @@ var ErrStartTimeAfterEndTime = errors.New("Start time after end time")
 var ErrBookingNotFound = errors.New("Booking not found")
 
 type BookingRepository interface {
-	CreateBooking(ctx context.Context, userId int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error)
+	CreateBooking(ctx context.Context, userId int64, createdBy int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error)
 	CheckBookingAvailability(ctx context.Context, bookingEntityId int64, startTime time.Time, endTime time.Time, excludeBookingId ...int64) (bool, error)
 	GetBookingsByTime(ctx context.Context, startTime time.Time, endTime time.Time, queryParams query_params.ListQueryParams) ([]BookingInfo, error)
-	GetBookingsByUserId(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (BookingList, error)
+	GetBookingsForUser(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (BookingList, error)
 	GetBookingsByBookingEntity(ctx context.Context, BookingEntityId int64, queryParams query_params.ListQueryParams) (BookingList, error)
 	GetBookingById(ctx context.Context, id int64) (BookingInfo, error)
 	UpdateBooking(ctx context.Context, bookingInfo BookingInfo, bookingId int64) error
-	DeleteBooking(ctx context.Context, bookingId int64) error
+	ChangeStatus(ctx context.Context, bookingId int64, fromStatus, toStatus string, changedBy int64) error
+	GetStatusHistory(ctx context.Context, bookingId int64) ([]BookingStatusChange, error)
 }
+
+// BookingInfo бронирование. CreatedBy - пользователь, создавший бронирование: отличается от владельца UserId,
+// если бронирование создал представитель владельца по делегированию
 type BookingInfo struct {
 	Id              int64
 	UserId          int64
+	CreatedBy       int64
 	BookingEntityId int64
 	StartTime       time.Time
 	EndTime         time.Time
@@ -39,6 +46,7 @@ type BookingList struct {
 	Total    int64
 }
 
+// BookingRepositoryImpl Запросы ограничиваются организацией пользователя запроса (см. tenant.FromContext)
 type BookingRepositoryImpl struct {
 	dbPoll *pgxpool.Pool
 	log    *slog.Logger
@@ -51,7 +59,10 @@ func NewBookingRepository(db *pgxpool.Pool, log *slog.Logger) *BookingRepository
 	}
 }
 
-func (b *BookingRepositoryImpl) CreateBooking(ctx context.Context, userId int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error) {
+// CreateBooking создаёт бронирование пользователя userId. createdBy - пользователь, который его создаёт
+//
+// Создание записывается в историю статусов от имени createdBy
+func (b *BookingRepositoryImpl) CreateBooking(ctx context.Context, userId int64, createdBy int64, bookingEntityId int64, status string, startTime time.Time, endTime time.Time) (int64, error) {
 	//Конвертация времени в UTC (если пришло не в UTC)
 	startTime = startTime.UTC()
 	endTime = endTime.UTC()
@@ -62,11 +73,20 @@ func (b *BookingRepositoryImpl) CreateBooking(ctx context.Context, userId int64,
 	if status == "" {
 		status = "pending"
 	}
-	query := `INSERT INTO bookings (user_id, booking_entity_id, start_time, end_time, status) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	// Создание записывается в историю статусов тем же запросом
+	query := `WITH created AS (
+    INSERT INTO bookings (user_id, created_by, booking_entity_id, start_time, end_time, status, tenant_id)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING id, status
+), history AS (
+    INSERT INTO booking_status_history (booking_id, to_status, changed_by)
+    SELECT id, status, $2 FROM created
+)
+SELECT id FROM created`
 
 	var id int64
 	b.log.Debug("create booking sql request", "query", query)
-	err := b.dbPoll.QueryRow(ctx, query, userId, bookingEntityId, startTime, endTime, status).Scan(&id)
+	err := b.dbPoll.QueryRow(ctx, query, userId, createdBy, bookingEntityId, startTime, endTime, status, tenant.ForInsert(ctx)).Scan(&id)
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
 		b.log.Error("Failed to create booking entity", "error", dbErr)
@@ -100,6 +120,7 @@ func (b *BookingRepositoryImpl) CheckBookingAvailability(ctx context.Context, bo
 		query += ` AND id != $4`
 		args = append(args, excludeBookingId[0])
 	}
+	query += tenant.And(ctx, "tenant_id", &args)
 
 	var count int64
 	b.log.Debug("check availability sql request", "query", query, "booking_entity_id", bookingEntityId, "start_time", startTime, "end_time", endTime)
@@ -121,9 +142,11 @@ func (b *BookingRepositoryImpl) GetBookingsByTime(ctx context.Context, startTime
 	if startTime.After(endTime) || startTime.Equal(endTime) {
 		return nil, ErrStartTimeAfterEndTime
 	}
-	query := `SELECT id, user_id, booking_entity_id, start_time, end_time, status 
+	query := `SELECT id, user_id, created_by, booking_entity_id, start_time, end_time, status 
         FROM bookings 
         WHERE (start_time, end_time) OVERLAPS ($1, $2)`
+	args := []interface{}{startTime.UTC(), endTime.UTC()}
+	query += tenant.And(ctx, "tenant_id", &args)
 
 	// Сортировка
 	var orderBy []string
@@ -139,7 +162,7 @@ func (b *BookingRepositoryImpl) GetBookingsByTime(ctx context.Context, startTime
 	}
 
 	b.log.Debug("get booking sql request", "query", query)
-	rows, err := b.dbPoll.Query(ctx, query, startTime.UTC(), endTime.UTC())
+	rows, err := b.dbPoll.Query(ctx, query, args...)
 	defer rows.Close()
 	if err != nil {
 		b.log.Error("Failed to get bookings by time", "error", err)
@@ -149,7 +172,7 @@ func (b *BookingRepositoryImpl) GetBookingsByTime(ctx context.Context, startTime
 	var bookings []BookingInfo
 	for rows.Next() {
 		var bookingInfo BookingInfo
-		if err = rows.Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status); err != nil {
+		if err = rows.Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.CreatedBy, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status); err != nil {
 			b.log.Error("Error scanning booking row", slog.Any("error", err))
 			return nil, fmt.Errorf("error scanning booking row: %w", err)
 		}
@@ -158,11 +181,16 @@ func (b *BookingRepositoryImpl) GetBookingsByTime(ctx context.Context, startTime
 	return bookings, nil
 }
 
-func (b *BookingRepositoryImpl) GetBookingsByUserId(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (BookingList, error) {
-	query := `SELECT id, user_id, booking_entity_id, start_time, end_time, status FROM bookings WHERE user_id = $1`
-	countQuery := "SELECT COUNT(*) FROM bookings WHERE user_id = $1"
+// GetBookingsForUser возвращает бронирования пользователя и бронирования, которые он создал для других пользователей как представитель
+func (b *BookingRepositoryImpl) GetBookingsForUser(ctx context.Context, userId int64, queryParams query_params.ListQueryParams) (BookingList, error) {
+	query := `SELECT id, user_id, created_by, booking_entity_id, start_time, end_time, status FROM bookings WHERE (user_id = $1 OR created_by = $1)`
+	countQuery := "SELECT COUNT(*) FROM bookings WHERE (user_id = $1 OR created_by = $1)"
 	args := []interface{}{userId}
-	countArgs := []interface{}{userId}
+	if condition := tenant.And(ctx, "tenant_id", &args); condition != "" {
+		query += condition
+		countQuery += condition
+	}
+	countArgs := append([]interface{}{}, args...)
 
 	// Сортировка
 	var orderBy []string
@@ -190,7 +218,7 @@ func (b *BookingRepositoryImpl) GetBookingsByUserId(ctx context.Context, userId
 	}
 
 	// Получение бронирований
-	b.log.Debug("GetBookingsByUserId sql request", "query", query)
+	b.log.Debug("GetBookingsForUser sql request", "query", query)
 	rows, err := b.dbPoll.Query(ctx, query, args...)
 	if err != nil {
 		b.log.Error("Failed to query users", slog.Any("error", err))
@@ -201,7 +229,7 @@ func (b *BookingRepositoryImpl) GetBookingsByUserId(ctx context.Context, userId
 	var bookingsList []BookingInfo
 	for rows.Next() {
 		var bookingInfo BookingInfo
-		if err = rows.Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status); err != nil {
+		if err = rows.Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.CreatedBy, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status); err != nil {
 			b.log.Error("Error scanning booking row", slog.Any("error", err))
 			return BookingList{}, fmt.Errorf("failed to scan booking row: %w", err)
 		}
@@ -213,10 +241,14 @@ func (b *BookingRepositoryImpl) GetBookingsByUserId(ctx context.Context, userId
 }
 
 func (b *BookingRepositoryImpl) GetBookingsByBookingEntity(ctx context.Context, BookingEntityId int64, queryParams query_params.ListQueryParams) (BookingList, error) {
-	query := `SELECT id, user_id, booking_entity_id, start_time, end_time, status FROM bookings WHERE booking_entity_id = $1`
+	query := `SELECT id, user_id, created_by, booking_entity_id, start_time, end_time, status FROM bookings WHERE booking_entity_id = $1`
 	countQuery := "SELECT COUNT(*) FROM bookings WHERE booking_entity_id = $1"
 	args := []interface{}{BookingEntityId}
-	countArgs := []interface{}{BookingEntityId}
+	if condition := tenant.And(ctx, "tenant_id", &args); condition != "" {
+		query += condition
+		countQuery += condition
+	}
+	countArgs := append([]interface{}{}, args...)
 
 	// Сортировка
 	var orderBy []string
@@ -254,7 +286,7 @@ func (b *BookingRepositoryImpl) GetBookingsByBookingEntity(ctx context.Context,
 	var bookingsList []BookingInfo
 	for rows.Next() {
 		var bookingInfo BookingInfo
-		if err = rows.Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status); err != nil {
+		if err = rows.Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.CreatedBy, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status); err != nil {
 			b.log.Error("Error scanning booking row", slog.Any("error", err))
 			return BookingList{}, fmt.Errorf("failed to scan booking row: %w", err)
 		}
@@ -266,11 +298,16 @@ func (b *BookingRepositoryImpl) GetBookingsByBookingEntity(ctx context.Context,
 }
 
 func (b *BookingRepositoryImpl) GetBookingById(ctx context.Context, id int64) (BookingInfo, error) {
-	query := `SELECT id, user_id, booking_entity_id, start_time, end_time, status FROM bookings WHERE id = $1`
+	query := `SELECT id, user_id, created_by, booking_entity_id, start_time, end_time, status FROM bookings WHERE id = $1`
+	args := []interface{}{id}
+	query += tenant.And(ctx, "tenant_id", &args)
 	b.log.Debug("get booking by id sql request", "query", query)
 
 	var bookingInfo BookingInfo
-	err := b.dbPoll.QueryRow(ctx, query, id).Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status)
+	err := b.dbPoll.QueryRow(ctx, query, args...).Scan(&bookingInfo.Id, &bookingInfo.UserId, &bookingInfo.CreatedBy, &bookingInfo.BookingEntityId, &bookingInfo.StartTime, &bookingInfo.EndTime, &bookingInfo.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return BookingInfo{}, ErrBookingNotFound
+	}
 	if err != nil {
 		b.log.Error("Failed to get booking by id", "bookingId", id, "error", err)
 		return BookingInfo{}, database.PsqlErrorHandler(err)
@@ -281,9 +318,11 @@ func (b *BookingRepositoryImpl) GetBookingById(ctx context.Context, id int64) (B
 
 func (b *BookingRepositoryImpl) UpdateBooking(ctx context.Context, bookingInfo BookingInfo, bookingId int64) error {
 	query := `UPDATE bookings SET user_id =$1, booking_entity_id = $2, start_time = $3, end_time = $4, status =$5 WHERE id = $6`
+	args := []interface{}{bookingInfo.UserId, bookingInfo.BookingEntityId, bookingInfo.StartTime, bookingInfo.EndTime, bookingInfo.Status, bookingId}
+	query += tenant.And(ctx, "tenant_id", &args)
 
 	b.log.Debug("Updating booking sql request", "query", query)
-	result, err := b.dbPoll.Exec(ctx, query, bookingInfo.UserId, bookingInfo.BookingEntityId, bookingInfo.StartTime, bookingInfo.EndTime, bookingInfo.Status, bookingId)
+	result, err := b.dbPoll.Exec(ctx, query, args...)
 	if err != nil {
 		b.log.Error("Error editing booking in db", slog.Any("error", err))
 		return database.PsqlErrorHandler(err)
@@ -294,19 +333,3 @@ func (b *BookingRepositoryImpl) UpdateBooking(ctx context.Context, bookingInfo B
 	b.log.Debug("Update booking successful ", "id", bookingInfo.Id, "user_id", bookingInfo.UserId)
 	return nil
 }
-
-func (b *BookingRepositoryImpl) DeleteBooking(ctx context.Context, bookingId int64) error {
-	query := `DELETE FROM bookings WHERE id = $1`
-
-	b.log.Debug("Deleting booking sql request", "query", query)
-	result, err := b.dbPoll.Exec(ctx, query, bookingId)
-	if err != nil {
-		b.log.Error("Error deleting editing booking in db", slog.Any("error", err))
-		return database.PsqlErrorHandler(err)
-	}
-	if result.RowsAffected() == 0 {
-		return ErrBookingNotFound
-	}
-	b.log.Debug("Delete booking successful ", "id", bookingId)
-	return nil
-}
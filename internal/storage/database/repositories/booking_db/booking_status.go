@@ -0,0 +1,115 @@
+package booking_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"log/slog"
+	"time"
+)
+
+var ErrBookingStatusChanged = errors.New("Booking status was changed by another request")
+
+// BookingStatusChange запись истории статусов бронирования.
+// FromStatus пуст у записи о создании, ChangedBy равен 0 у системных изменений
+type BookingStatusChange struct {
+	BookingId  int64
+	FromStatus string
+	ToStatus   string
+	ChangedBy  int64
+	ChangedAt  time.Time
+}
+
+// ChangeStatus переводит бронирование из статуса fromStatus в toStatus и записывает смену в историю от имени changedBy
+//
+// Строка бронирования блокируется до конца транзакции. Если статус уже не fromStatus,
+// его изменил параллельный запрос, и возвращается ErrBookingStatusChanged
+func (b *BookingRepositoryImpl) ChangeStatus(ctx context.Context, bookingId int64, fromStatus, toStatus string, changedBy int64) error {
+	tx, err := b.dbPoll.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	args := []interface{}{bookingId}
+	query := `SELECT status FROM bookings WHERE id = $1` + tenant.And(ctx, "tenant_id", &args) + ` FOR UPDATE`
+	var current string
+	err = tx.QueryRow(ctx, query, args...).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrBookingNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, b.log); ctxErr != nil {
+			return ctxErr
+		}
+		b.log.Error("Failed to lock booking", "bookingId", bookingId, "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if current != fromStatus {
+		return ErrBookingStatusChanged
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE bookings SET status = $1 WHERE id = $2`, toStatus, bookingId); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, b.log); ctxErr != nil {
+			return ctxErr
+		}
+		b.log.Error("Failed to update booking status", slog.Any("error", err))
+		return database.PsqlErrorHandler(err)
+	}
+	historyQuery := `INSERT INTO booking_status_history (booking_id, from_status, to_status, changed_by)
+VALUES ($1, $2, $3, NULLIF($4::BIGINT, 0))`
+	if _, err = tx.Exec(ctx, historyQuery, bookingId, fromStatus, toStatus, changedBy); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, b.log); ctxErr != nil {
+			return ctxErr
+		}
+		b.log.Error("Failed to record booking status change", slog.Any("error", err))
+		return database.PsqlErrorHandler(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit booking status change", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	b.log.Debug("Booking status changed", "id", bookingId, "from", fromStatus, "to", toStatus, "changed_by", changedBy)
+	return nil
+}
+
+// GetStatusHistory возвращает историю статусов бронирования в порядке изменений
+func (b *BookingRepositoryImpl) GetStatusHistory(ctx context.Context, bookingId int64) ([]BookingStatusChange, error) {
+	args := []interface{}{bookingId}
+	query := `SELECT h.booking_id, COALESCE(h.from_status, ''), h.to_status, COALESCE(h.changed_by, 0), h.changed_at
+FROM booking_status_history h
+         JOIN bookings b ON b.id = h.booking_id
+WHERE h.booking_id = $1` + tenant.And(ctx, "b.tenant_id", &args) + `
+ORDER BY h.changed_at, h.id`
+
+	b.log.Debug("get booking status history sql request", "query", query)
+	rows, err := b.dbPoll.Query(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, b.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		b.log.Error("Failed to query booking status history", slog.Any("error", err))
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	history := []BookingStatusChange{}
+	for rows.Next() {
+		var change BookingStatusChange
+		if err = rows.Scan(&change.BookingId, &change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.ChangedAt); err != nil {
+			b.log.Error("Error scanning booking status history row", slog.Any("error", err))
+			return nil, fmt.Errorf("failed to scan booking status history row: %w", err)
+		}
+		change.ChangedAt = change.ChangedAt.UTC()
+		history = append(history, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return history, nil
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
@@ -13,13 +15,15 @@ import (
 )
 
 var ErrBookingEntityNotFound = errors.New("Объект бронирования не найден ")
+var ErrBookingUserNotFound = errors.New("Пользователь бронирования не найден ")
 
 type BookingEntityRepository interface {
 	CreateBookingEntity(ctx context.Context, bookingTypeId int64, name, description, status string, ParentId int64) (int64, error)
 	GetBookingEntity(ctx context.Context, BookingEntityId int64) (BookingEntityInfo, error)
-	GetBookingEntitiesList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (BookingEntityListResult, error)
+	GetBookingEntitiesList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (BookingEntityListResult, error)
 	UpdateBookingEntity(ctx context.Context, id int64, bookingTypeId int64, name, description, status string, ParentId int64) error
 	DeleteBookingEntity(ctx context.Context, id int64) error
+	CanBook(ctx context.Context, bookingEntityId, userId int64) (bool, error)
 }
 type BookingEntityInfo struct {
 	ID            int64  `json:"id"`
@@ -34,6 +38,7 @@ type BookingEntityListResult struct {
 	Total           int64
 }
 
+// BookingEntityRepositoryImpl Запросы ограничиваются организацией пользователя запроса (см. tenant.FromContext)
 type BookingEntityRepositoryImpl struct {
 	dbPoll *pgxpool.Pool
 	log    *slog.Logger
@@ -47,9 +52,9 @@ func NewBookingEntityRepository(db *pgxpool.Pool, log *slog.Logger) *BookingEnti
 }
 
 func (be *BookingEntityRepositoryImpl) CreateBookingEntity(ctx context.Context, bookingTypeId int64, name, description, status string, ParentId int64) (int64, error) {
-	query := `INSERT INTO booking_entities (booking_type_id, name, description, parent_id) VALUES ($1, $2, $3, $4) RETURNING id`
+	query := `INSERT INTO booking_entities (booking_type_id, name, description, parent_id, tenant_id) VALUES ($1, $2, $3, $4, $5) RETURNING id`
 	var id int64
-	err := be.dbPoll.QueryRow(ctx, query, bookingTypeId, name, description, ParentId).Scan(&id)
+	err := be.dbPoll.QueryRow(ctx, query, bookingTypeId, name, description, ParentId, tenant.ForInsert(ctx)).Scan(&id)
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
 		be.log.Error("Failed to create booking entity", "error", err)
@@ -60,9 +65,11 @@ func (be *BookingEntityRepositoryImpl) CreateBookingEntity(ctx context.Context,
 
 func (be *BookingEntityRepositoryImpl) GetBookingEntity(ctx context.Context, BookingEntityId int64) (BookingEntityInfo, error) {
 	query := `SELECT booking_type_id, name, description, status, parent_id FROM booking_entities WHERE id = $1`
+	args := []interface{}{BookingEntityId}
+	query += tenant.And(ctx, "tenant_id", &args)
 
 	var bookingEntity BookingEntityInfo
-	err := be.dbPoll.QueryRow(ctx, query, BookingEntityId).Scan(
+	err := be.dbPoll.QueryRow(ctx, query, args...).Scan(
 		&bookingEntity.BookingTypeID,
 		&bookingEntity.Name,
 		&bookingEntity.Description,
@@ -81,21 +88,37 @@ func (be *BookingEntityRepositoryImpl) GetBookingEntity(ctx context.Context, Boo
 	return bookingEntity, nil
 }
 
-func (be *BookingEntityRepositoryImpl) GetBookingEntitiesList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (BookingEntityListResult, error) {
+// GetBookingEntitiesList возвращает список объектов бронирования
+//
+// bookableBy - id пользователя: если не 0, возвращаются только объекты, которые он может забронировать
+// с учётом групповых ограничений объекта и его типа
+func (be *BookingEntityRepositoryImpl) GetBookingEntitiesList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (BookingEntityListResult, error) {
 	// Базовый SQL-запрос для пользователей
 	query := "SELECT id, booking_type_id, name, description, status, parent_id FROM booking_entities"
 	countQuery := "SELECT COUNT(*) FROM booking_entities"
-	searchQuery := " WHERE name ILIKE $1 OR description ILIKE $1"
 	args := []interface{}{}
-	countArgs := []interface{}{}
+	var conditions []string
 
 	// Фильтрация по search
 	if search != "" {
-		query += searchQuery
-		countQuery += searchQuery
 		args = append(args, "%"+search+"%")
-		countArgs = append(countArgs, "%"+search+"%")
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%[1]d OR description ILIKE $%[1]d)", len(args)))
 	}
+	// Фильтрация по групповым ограничениям
+	if bookableBy != 0 {
+		args = append(args, bookableBy)
+		conditions = append(conditions, groups_db.BookingEntityAllowedCondition("booking_entities.id", "booking_entities.booking_type_id", len(args)))
+	}
+	// Только записи организации пользователя запроса
+	if condition := tenant.Condition(ctx, "tenant_id", &args); condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) > 0 {
+		where := " WHERE " + strings.Join(conditions, " AND ")
+		query += where
+		countQuery += where
+	}
+	countArgs := append([]interface{}{}, args...)
 
 	// Сортировка
 	var orderBy []string
@@ -152,8 +175,10 @@ func (be *BookingEntityRepositoryImpl) GetBookingEntitiesList(ctx context.Contex
 
 func (be *BookingEntityRepositoryImpl) UpdateBookingEntity(ctx context.Context, id int64, bookingTypeId int64, name, description, status string, ParentId int64) error {
 	query := `UPDATE booking_entities SET booking_type_id = $1, name = $2, description = $3, status = $4, parent_id = $5 WHERE id = $6`
+	args := []interface{}{bookingTypeId, name, description, status, ParentId, id}
+	query += tenant.And(ctx, "tenant_id", &args)
 
-	result, err := be.dbPoll.Exec(ctx, query, bookingTypeId, name, description, status, ParentId, id)
+	result, err := be.dbPoll.Exec(ctx, query, args...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return ErrBookingEntityNotFound
@@ -171,7 +196,9 @@ func (be *BookingEntityRepositoryImpl) UpdateBookingEntity(ctx context.Context,
 
 func (be *BookingEntityRepositoryImpl) DeleteBookingEntity(ctx context.Context, id int64) error {
 	query := `DELETE FROM booking_entities WHERE id = $1`
-	result, err := be.dbPoll.Exec(ctx, query, id)
+	args := []interface{}{id}
+	query += tenant.And(ctx, "tenant_id", &args)
+	result, err := be.dbPoll.Exec(ctx, query, args...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return ErrBookingEntityNotFound
@@ -186,3 +213,32 @@ func (be *BookingEntityRepositoryImpl) DeleteBookingEntity(ctx context.Context,
 	be.log.Debug("booking entity deleted successfully", "id", id)
 	return nil
 }
+
+// CanBook проверяет групповые ограничения объекта бронирования и его типа для пользователя
+//
+// Если объект не найден в организации пользователя запроса, возвращает ErrBookingEntityNotFound,
+// если пользователь userId не состоит в организации объекта - ErrBookingUserNotFound
+func (be *BookingEntityRepositoryImpl) CanBook(ctx context.Context, bookingEntityId, userId int64) (bool, error) {
+	query := `SELECT ` + groups_db.BookingEntityAllowedCondition("booking_entities.id", "booking_entities.booking_type_id", 2) + `,
+    EXISTS (SELECT 1 FROM users u WHERE u.id = $2 AND u.tenant_id = booking_entities.tenant_id)
+FROM booking_entities WHERE id = $1`
+	args := []interface{}{bookingEntityId, userId}
+	query += tenant.And(ctx, "tenant_id", &args)
+
+	var allowed, userFound bool
+	err := be.dbPoll.QueryRow(ctx, query, args...).Scan(&allowed, &userFound)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrBookingEntityNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, be.log); ctxErr != nil {
+			return false, ctxErr
+		}
+		be.log.Error("Failed to check booking entity groups", "error", err)
+		return false, database.PsqlErrorHandler(err)
+	}
+	if !userFound {
+		return false, ErrBookingUserNotFound
+	}
+	return allowed, nil
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
@@ -17,7 +19,7 @@ var ErrBookingTypeNotFound = errors.New("Тип бронирования не н
 type BookingTypeRepository interface {
 	CreateBookingType(ctx context.Context, name, description string) (int64, error)
 	GetBookingType(ctx context.Context, BookingTypeId int64) (BookingTypeInfo, error)
-	GetBookingTypeList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (BookingTypeListResult, error)
+	GetBookingTypeList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (BookingTypeListResult, error)
 	UpdateBookingType(ctx context.Context, id int64, name, description string) error
 	DeleteBookingType(ctx context.Context, id int64) error
 }
@@ -31,6 +33,7 @@ type BookingTypeListResult struct {
 	Total        int64
 }
 
+// BookingTypeRepositoryImpl Запросы ограничиваются организацией пользователя запроса (см. tenant.FromContext)
 type BookingTypeRepositoryImpl struct {
 	dbPoll *pgxpool.Pool
 	log    *slog.Logger
@@ -44,10 +47,10 @@ func NewBookingTypeRepository(db *pgxpool.Pool, log *slog.Logger) *BookingTypeRe
 }
 
 func (bt *BookingTypeRepositoryImpl) CreateBookingType(ctx context.Context, name, description string) (int64, error) {
-	query := `INSERT INTO booking_types (name, description) VALUES ($1, $2) RETURNING id`
+	query := `INSERT INTO booking_types (name, description, tenant_id) VALUES ($1, $2, $3) RETURNING id`
 
 	var id int64
-	err := bt.dbPoll.QueryRow(ctx, query, name, description).Scan(&id)
+	err := bt.dbPoll.QueryRow(ctx, query, name, description, tenant.ForInsert(ctx)).Scan(&id)
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
 		bt.log.Error("Failed to create booking type", "error", err)
@@ -58,9 +61,11 @@ func (bt *BookingTypeRepositoryImpl) CreateBookingType(ctx context.Context, name
 
 func (bt *BookingTypeRepositoryImpl) GetBookingType(ctx context.Context, BookingTypeId int64) (BookingTypeInfo, error) {
 	query := `SELECT name, description FROM booking_types WHERE id = $1`
+	args := []interface{}{BookingTypeId}
+	query += tenant.And(ctx, "tenant_id", &args)
 
 	var bookingType BookingTypeInfo
-	err := bt.dbPoll.QueryRow(ctx, query, BookingTypeId).Scan(
+	err := bt.dbPoll.QueryRow(ctx, query, args...).Scan(
 		&bookingType.Name,
 		&bookingType.Description)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -76,21 +81,36 @@ func (bt *BookingTypeRepositoryImpl) GetBookingType(ctx context.Context, Booking
 	return bookingType, nil
 }
 
-func (bt *BookingTypeRepositoryImpl) GetBookingTypeList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (BookingTypeListResult, error) {
+// GetBookingTypeList возвращает список типов бронирования
+//
+// bookableBy - id пользователя: если не 0, возвращаются только типы, доступные ему с учётом групповых ограничений
+func (bt *BookingTypeRepositoryImpl) GetBookingTypeList(ctx context.Context, search string, bookableBy int64, limit, offset int, sortParams []query_params.SortParam) (BookingTypeListResult, error) {
 	// Базовый SQL-запрос для пользователей
 	query := "SELECT id, name, description FROM booking_types"
 	countQuery := "SELECT COUNT(*) FROM booking_types"
-	searchQuery := " WHERE name ILIKE $1 OR description ILIKE $1"
 	args := []interface{}{}
-	countArgs := []interface{}{}
+	var conditions []string
 
 	// Фильтрация по search
 	if search != "" {
-		query += searchQuery
-		countQuery += searchQuery
 		args = append(args, "%"+search+"%")
-		countArgs = append(countArgs, "%"+search+"%")
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%[1]d OR description ILIKE $%[1]d)", len(args)))
 	}
+	// Фильтрация по групповым ограничениям
+	if bookableBy != 0 {
+		args = append(args, bookableBy)
+		conditions = append(conditions, groups_db.BookingTypeAllowedCondition("booking_types.id", len(args)))
+	}
+	// Только записи организации пользователя запроса
+	if condition := tenant.Condition(ctx, "tenant_id", &args); condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) > 0 {
+		where := " WHERE " + strings.Join(conditions, " AND ")
+		query += where
+		countQuery += where
+	}
+	countArgs := append([]interface{}{}, args...)
 
 	// Сортировка
 	//TODO Изменить сортировку на отдельные query
@@ -148,8 +168,10 @@ func (bt *BookingTypeRepositoryImpl) GetBookingTypeList(ctx context.Context, sea
 
 func (bt *BookingTypeRepositoryImpl) UpdateBookingType(ctx context.Context, id int64, name, description string) error {
 	query := `UPDATE booking_types SET name = $1, description = $2 WHERE id = $3`
+	args := []interface{}{name, description, id}
+	query += tenant.And(ctx, "tenant_id", &args)
 
-	result, err := bt.dbPoll.Exec(ctx, query, name, description, id)
+	result, err := bt.dbPoll.Exec(ctx, query, args...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return ErrBookingTypeNotFound
@@ -167,7 +189,9 @@ func (bt *BookingTypeRepositoryImpl) UpdateBookingType(ctx context.Context, id i
 
 func (bt *BookingTypeRepositoryImpl) DeleteBookingType(ctx context.Context, id int64) error {
 	query := `DELETE FROM booking_types WHERE id = $1`
-	result, err := bt.dbPoll.Exec(ctx, query, id)
+	args := []interface{}{id}
+	query += tenant.And(ctx, "tenant_id", &args)
+	result, err := bt.dbPoll.Exec(ctx, query, args...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return ErrBookingTypeNotFound
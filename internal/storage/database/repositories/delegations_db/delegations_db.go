@@ -0,0 +1,153 @@
+package delegations_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrDelegationNotFound = errors.New("Делегирование не найдено")
+var ErrDelegateNotFound = errors.New("Пользователь, которому делегируются бронирования, не найден или не активен")
+
+type DelegationRepository interface {
+	CreateDelegation(ctx context.Context, ownerId, delegateId int64) error
+	DeleteDelegation(ctx context.Context, ownerId, delegateId int64) error
+	ListByOwner(ctx context.Context, ownerId int64) ([]DelegationInfo, error)
+	ListByDelegate(ctx context.Context, delegateId int64) ([]DelegationInfo, error)
+	HasDelegation(ctx context.Context, ownerId, delegateId int64) (bool, error)
+}
+
+// DelegationInfo делегирование со стороны одного из пользователей: UserID и контакты - второй участник
+type DelegationInfo struct {
+	UserID    int64
+	Email     string
+	FirstName string
+	LastName  string
+	CreatedAt time.Time
+}
+
+type DelegationRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewDelegationRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *DelegationRepositoryImpl {
+	return &DelegationRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// CreateDelegation разрешает пользователю delegateId управлять бронированиями ownerId. Повторное создание не является ошибкой
+//
+// Представителем может быть только активный пользователь той же организации, иначе возвращается ErrDelegateNotFound
+func (dr *DelegationRepositoryImpl) CreateDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	query := `INSERT INTO booking_delegations (owner_id, delegate_id)
+SELECT $1, u.id FROM users u WHERE u.id = $2 AND u.status = 'active'`
+	args := []interface{}{ownerId, delegateId}
+	query += tenant.And(ctx, "u.tenant_id", &args) + ` ON CONFLICT DO NOTHING`
+
+	result, err := dr.db.Exec(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, dr.log); ctxErr != nil {
+			return ctxErr
+		}
+		dr.log.Error("Failed to create delegation", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		// Ни одной строки: либо делегирование уже есть, либо представитель не найден
+		exists, err := dr.HasDelegation(ctx, ownerId, delegateId)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrDelegateNotFound
+		}
+	}
+	return nil
+}
+
+func (dr *DelegationRepositoryImpl) DeleteDelegation(ctx context.Context, ownerId, delegateId int64) error {
+	result, err := dr.db.Exec(ctx, `DELETE FROM booking_delegations WHERE owner_id = $1 AND delegate_id = $2`, ownerId, delegateId)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, dr.log); ctxErr != nil {
+			return ctxErr
+		}
+		dr.log.Error("Failed to delete delegation", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDelegationNotFound
+	}
+	return nil
+}
+
+// ListByOwner возвращает представителей, которым пользователь ownerId делегировал свои бронирования
+func (dr *DelegationRepositoryImpl) ListByOwner(ctx context.Context, ownerId int64) ([]DelegationInfo, error) {
+	query := `SELECT u.id, u.email, u.first_name, u.last_name, d.created_at
+FROM booking_delegations d
+JOIN users u ON u.id = d.delegate_id
+WHERE d.owner_id = $1
+ORDER BY u.id`
+	return dr.list(ctx, query, ownerId)
+}
+
+// ListByDelegate возвращает владельцев, которые делегировали свои бронирования пользователю delegateId
+func (dr *DelegationRepositoryImpl) ListByDelegate(ctx context.Context, delegateId int64) ([]DelegationInfo, error) {
+	query := `SELECT u.id, u.email, u.first_name, u.last_name, d.created_at
+FROM booking_delegations d
+JOIN users u ON u.id = d.owner_id
+WHERE d.delegate_id = $1
+ORDER BY u.id`
+	return dr.list(ctx, query, delegateId)
+}
+
+// HasDelegation проверяет, что пользователь delegateId может управлять бронированиями ownerId
+func (dr *DelegationRepositoryImpl) HasDelegation(ctx context.Context, ownerId, delegateId int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM booking_delegations WHERE owner_id = $1 AND delegate_id = $2)`
+
+	var exists bool
+	if err := dr.db.QueryRow(ctx, query, ownerId, delegateId).Scan(&exists); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, dr.log); ctxErr != nil {
+			return false, ctxErr
+		}
+		dr.log.Error("Failed to check delegation", "error", err)
+		return false, database.PsqlErrorHandler(err)
+	}
+	return exists, nil
+}
+
+func (dr *DelegationRepositoryImpl) list(ctx context.Context, query string, userId int64) ([]DelegationInfo, error) {
+	rows, err := dr.db.Query(ctx, query, userId)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, dr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		dr.log.Error("Failed to list delegations", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	delegations := make([]DelegationInfo, 0)
+	for rows.Next() {
+		var delegation DelegationInfo
+		if err = rows.Scan(&delegation.UserID, &delegation.Email, &delegation.FirstName, &delegation.LastName, &delegation.CreatedAt); err != nil {
+			dr.log.Error("Failed to scan delegation", "error", err)
+			return nil, database.PsqlErrorHandler(err)
+		}
+		delegations = append(delegations, delegation)
+	}
+	if err = rows.Err(); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, dr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		dr.log.Error("Failed to iterate delegations", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return delegations, nil
+}
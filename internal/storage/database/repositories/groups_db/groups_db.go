@@ -0,0 +1,394 @@
+package groups_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var ErrGroupNotFound = errors.New("Группа не найдена")
+var ErrGroupAlreadyExists = errors.New("Группа с таким названием уже существует")
+var ErrMemberNotFound = errors.New("Пользователь не состоит в группе")
+var ErrMemberUserNotFound = errors.New("Пользователь не найден")
+
+type GroupRepository interface {
+	CreateGroup(ctx context.Context, name, description string) (int64, error)
+	GetGroup(ctx context.Context, id int64) (GroupInfo, error)
+	ListGroups(ctx context.Context) ([]GroupInfo, error)
+	DeleteGroup(ctx context.Context, id int64) error
+	AddMember(ctx context.Context, groupId, userId int64) error
+	RemoveMember(ctx context.Context, groupId, userId int64) error
+	ListMembers(ctx context.Context, groupId int64) ([]MemberInfo, error)
+	GetBookingTypeGroups(ctx context.Context, bookingTypeId int64) ([]int64, error)
+	SetBookingTypeGroups(ctx context.Context, bookingTypeId int64, groupIds []int64) error
+	GetBookingEntityGroups(ctx context.Context, bookingEntityId int64) ([]int64, error)
+	SetBookingEntityGroups(ctx context.Context, bookingEntityId int64, groupIds []int64) error
+}
+
+// GroupInfo группа пользователей
+type GroupInfo struct {
+	ID          int64
+	Name        string
+	Description string
+	MemberCount int64
+	CreatedAt   time.Time
+}
+
+// MemberInfo участник группы
+type MemberInfo struct {
+	UserID    int64
+	Email     string
+	FirstName string
+	LastName  string
+	AddedAt   time.Time
+}
+
+// BookingTypeAllowedCondition SQL условие "тип бронирования доступен пользователю"
+//
+// Тип без групп доступен всем, иначе только участникам хотя бы одной из его групп.
+// typeColumn - колонка с id типа во внешнем запросе, userParam - номер параметра с id пользователя
+func BookingTypeAllowedCondition(typeColumn string, userParam int) string {
+	return fmt.Sprintf(`(NOT EXISTS (SELECT 1 FROM booking_type_groups btg WHERE btg.booking_type_id = %[1]s)
+OR EXISTS (SELECT 1 FROM booking_type_groups btg JOIN user_group_members ugm ON ugm.group_id = btg.group_id
+WHERE btg.booking_type_id = %[1]s AND ugm.user_id = $%[2]d))`, typeColumn, userParam)
+}
+
+// BookingEntityAllowedCondition SQL условие "объект бронирования доступен пользователю"
+//
+// Пользователь должен проходить ограничения и самого объекта, и его типа (см. BookingTypeAllowedCondition)
+func BookingEntityAllowedCondition(entityColumn, typeColumn string, userParam int) string {
+	return fmt.Sprintf(`((NOT EXISTS (SELECT 1 FROM booking_entity_groups beg WHERE beg.booking_entity_id = %[1]s)
+OR EXISTS (SELECT 1 FROM booking_entity_groups beg JOIN user_group_members ugm ON ugm.group_id = beg.group_id
+WHERE beg.booking_entity_id = %[1]s AND ugm.user_id = $%[2]d))
+AND %[3]s)`, entityColumn, userParam, BookingTypeAllowedCondition(typeColumn, userParam))
+}
+
+// GroupRepositoryImpl Запросы ограничиваются организацией пользователя запроса (см. tenant.FromContext).
+// В группу можно добавить только пользователя той же организации
+type GroupRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewGroupRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *GroupRepositoryImpl {
+	return &GroupRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+func (gr *GroupRepositoryImpl) CreateGroup(ctx context.Context, name, description string) (int64, error) {
+	query := `INSERT INTO user_groups (name, description, tenant_id) VALUES ($1, $2, $3) RETURNING id`
+
+	var id int64
+	err := gr.db.QueryRow(ctx, query, name, description, tenant.ForInsert(ctx)).Scan(&id)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return 0, ErrGroupAlreadyExists
+		}
+		gr.log.Error("Failed to create group", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, nil
+}
+
+func (gr *GroupRepositoryImpl) GetGroup(ctx context.Context, id int64) (GroupInfo, error) {
+	query := `SELECT g.id, g.name, g.description, g.created_at,
+       (SELECT COUNT(*) FROM user_group_members m WHERE m.group_id = g.id)
+FROM user_groups g WHERE g.id = $1`
+	args := []interface{}{id}
+	query += tenant.And(ctx, "g.tenant_id", &args)
+
+	var group GroupInfo
+	err := gr.db.QueryRow(ctx, query, args...).Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.MemberCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GroupInfo{}, ErrGroupNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return GroupInfo{}, ctxErr
+		}
+		gr.log.Error("Failed to get group", "error", err)
+		return GroupInfo{}, database.PsqlErrorHandler(err)
+	}
+	return group, nil
+}
+
+func (gr *GroupRepositoryImpl) ListGroups(ctx context.Context) ([]GroupInfo, error) {
+	query := `SELECT g.id, g.name, g.description, g.created_at,
+       (SELECT COUNT(*) FROM user_group_members m WHERE m.group_id = g.id)
+FROM user_groups g`
+	var args []interface{}
+	if condition := tenant.Condition(ctx, "g.tenant_id", &args); condition != "" {
+		query += " WHERE " + condition
+	}
+	query += " ORDER BY g.name"
+
+	rows, err := gr.db.Query(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		gr.log.Error("Failed to list groups", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	groups := make([]GroupInfo, 0)
+	for rows.Next() {
+		var group GroupInfo
+		if err = rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.MemberCount); err != nil {
+			gr.log.Error("Failed to scan group", "error", err)
+			return nil, database.PsqlErrorHandler(err)
+		}
+		groups = append(groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		gr.log.Error("Failed to iterate groups", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return groups, nil
+}
+
+// DeleteGroup удаляет группу. Вместе с ней удаляются членство и ограничения типов и объектов бронирования этой группой
+func (gr *GroupRepositoryImpl) DeleteGroup(ctx context.Context, id int64) error {
+	args := []interface{}{id}
+	query := `DELETE FROM user_groups WHERE id = $1` + tenant.And(ctx, "tenant_id", &args)
+	result, err := gr.db.Exec(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return ctxErr
+		}
+		gr.log.Error("Failed to delete group", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// AddMember добавляет пользователя в группу. Повторное добавление не является ошибкой
+//
+// Группа и пользователь ищутся в организации пользователя запроса: группа другой организации - ErrGroupNotFound,
+// пользователь другой организации - ErrMemberUserNotFound
+func (gr *GroupRepositoryImpl) AddMember(ctx context.Context, groupId, userId int64) error {
+	groupArgs := []interface{}{groupId}
+	groupQuery := `SELECT EXISTS (SELECT 1 FROM user_groups WHERE id = $1` + tenant.And(ctx, "tenant_id", &groupArgs) + `)`
+	if err := gr.exists(ctx, groupQuery, groupArgs, ErrGroupNotFound); err != nil {
+		return err
+	}
+	userArgs := []interface{}{userId}
+	userQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1` + tenant.And(ctx, "tenant_id", &userArgs) + `)`
+	if err := gr.exists(ctx, userQuery, userArgs, ErrMemberUserNotFound); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := gr.db.Exec(ctx, query, groupId, userId)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return ctxErr
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLForeignKeyError {
+			if pgErr.ConstraintName == "fk_user_group_members_group" {
+				return ErrGroupNotFound
+			}
+			return ErrMemberUserNotFound
+		}
+		gr.log.Error("Failed to add group member", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func (gr *GroupRepositoryImpl) RemoveMember(ctx context.Context, groupId, userId int64) error {
+	args := []interface{}{groupId, userId}
+	query := `DELETE FROM user_group_members m USING user_groups g
+WHERE g.id = m.group_id AND m.group_id = $1 AND m.user_id = $2` + tenant.And(ctx, "g.tenant_id", &args)
+	result, err := gr.db.Exec(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return ctxErr
+		}
+		gr.log.Error("Failed to remove group member", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+func (gr *GroupRepositoryImpl) ListMembers(ctx context.Context, groupId int64) ([]MemberInfo, error) {
+	query := `SELECT u.id, u.email, u.first_name, u.last_name, m.created_at
+FROM user_group_members m
+JOIN users u ON u.id = m.user_id
+JOIN user_groups g ON g.id = m.group_id
+WHERE m.group_id = $1`
+	args := []interface{}{groupId}
+	query += tenant.And(ctx, "g.tenant_id", &args)
+	query += " ORDER BY u.id"
+
+	rows, err := gr.db.Query(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		gr.log.Error("Failed to list group members", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	members := make([]MemberInfo, 0)
+	for rows.Next() {
+		var member MemberInfo
+		if err = rows.Scan(&member.UserID, &member.Email, &member.FirstName, &member.LastName, &member.AddedAt); err != nil {
+			gr.log.Error("Failed to scan group member", "error", err)
+			return nil, database.PsqlErrorHandler(err)
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		gr.log.Error("Failed to iterate group members", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return members, nil
+}
+
+// GetBookingTypeGroups возвращает группы, которым доступен тип бронирования. Пустой список - тип доступен всем
+func (gr *GroupRepositoryImpl) GetBookingTypeGroups(ctx context.Context, bookingTypeId int64) ([]int64, error) {
+	return gr.getGroupIds(ctx, `SELECT btg.group_id FROM booking_type_groups btg
+JOIN user_groups g ON g.id = btg.group_id
+WHERE btg.booking_type_id = $1`, bookingTypeId)
+}
+
+// SetBookingTypeGroups заменяет группы, которым доступен тип бронирования. Пустой список снимает ограничение
+func (gr *GroupRepositoryImpl) SetBookingTypeGroups(ctx context.Context, bookingTypeId int64, groupIds []int64) error {
+	return gr.setGroupIds(ctx,
+		`DELETE FROM booking_type_groups WHERE booking_type_id = $1`,
+		`INSERT INTO booking_type_groups (booking_type_id, group_id) SELECT $1, g.id FROM user_groups g WHERE g.id = $2`,
+		bookingTypeId, groupIds)
+}
+
+// GetBookingEntityGroups возвращает группы, которым доступен объект бронирования. Пустой список - объект доступен всем
+func (gr *GroupRepositoryImpl) GetBookingEntityGroups(ctx context.Context, bookingEntityId int64) ([]int64, error) {
+	return gr.getGroupIds(ctx, `SELECT beg.group_id FROM booking_entity_groups beg
+JOIN user_groups g ON g.id = beg.group_id
+WHERE beg.booking_entity_id = $1`, bookingEntityId)
+}
+
+// SetBookingEntityGroups заменяет группы, которым доступен объект бронирования. Пустой список снимает ограничение
+func (gr *GroupRepositoryImpl) SetBookingEntityGroups(ctx context.Context, bookingEntityId int64, groupIds []int64) error {
+	return gr.setGroupIds(ctx,
+		`DELETE FROM booking_entity_groups WHERE booking_entity_id = $1`,
+		`INSERT INTO booking_entity_groups (booking_entity_id, group_id) SELECT $1, g.id FROM user_groups g WHERE g.id = $2`,
+		bookingEntityId, groupIds)
+}
+
+// getGroupIds возвращает группы ограничения. query должен соединять группы как g, к нему добавляется
+// ограничение организацией и сортировка
+func (gr *GroupRepositoryImpl) getGroupIds(ctx context.Context, query string, id int64) ([]int64, error) {
+	args := []interface{}{id}
+	query += tenant.And(ctx, "g.tenant_id", &args) + " ORDER BY g.id"
+	rows, err := gr.db.Query(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		gr.log.Error("Failed to get restriction groups", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	groupIds, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		gr.log.Error("Failed to scan restriction groups", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return groupIds, nil
+}
+
+// setGroupIds заменяет набор групп одной транзакцией. Несуществующая группа или группа другой организации - ErrGroupNotFound
+//
+// insertQuery выбирает группу как g, к нему добавляется ограничение организацией
+func (gr *GroupRepositoryImpl) setGroupIds(ctx context.Context, deleteQuery, insertQuery string, id int64, groupIds []int64) error {
+	tx, err := gr.db.Begin(ctx)
+	if err != nil {
+		gr.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, deleteQuery, id); err != nil {
+		return gr.txError(ctx, err, "Failed to delete restriction groups")
+	}
+	seen := make(map[int64]bool, len(groupIds))
+	for _, groupId := range groupIds {
+		if seen[groupId] {
+			continue
+		}
+		seen[groupId] = true
+		args := []interface{}{id, groupId}
+		query := insertQuery + tenant.And(ctx, "g.tenant_id", &args)
+		result, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLForeignKeyError && strings.HasSuffix(pgErr.ConstraintName, "_group") {
+				return fmt.Errorf("%w: %d", ErrGroupNotFound, groupId)
+			}
+			return gr.txError(ctx, err, "Failed to insert restriction group")
+		}
+		// Ноль строк - группы нет в организации пользователя запроса
+		if result.RowsAffected() == 0 {
+			return fmt.Errorf("%w: %d", ErrGroupNotFound, groupId)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		gr.log.Error("Failed to commit restriction groups", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// exists выполняет запрос SELECT EXISTS и возвращает notFound, если запись не найдена
+func (gr *GroupRepositoryImpl) exists(ctx context.Context, query string, args []interface{}, notFound error) error {
+	var found bool
+	if err := gr.db.QueryRow(ctx, query, args...).Scan(&found); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+			return ctxErr
+		}
+		gr.log.Error("Failed to check existence", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if !found {
+		return notFound
+	}
+	return nil
+}
+
+func (gr *GroupRepositoryImpl) txError(ctx context.Context, err error, msg string) error {
+	if ctxErr := database.DbCtxError(ctx, err, gr.log); ctxErr != nil {
+		return ctxErr
+	}
+	gr.log.Error(msg, "error", err)
+	return database.PsqlErrorHandler(err)
+}
@@ -0,0 +1,55 @@
+package permissions_db
+
+import (
+	"context"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+type PermissionRepository interface {
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+}
+
+type PermissionRepositoryImpl struct {
+	dbPoll *pgxpool.Pool
+	log    *slog.Logger
+}
+
+func NewPermissionRepository(db *pgxpool.Pool, log *slog.Logger) *PermissionRepositoryImpl {
+	return &PermissionRepositoryImpl{
+		dbPoll: db,
+		log:    log,
+	}
+}
+
+// GetRolePermissions Возвращает список разрешений роли. Для неизвестной роли возвращается пустой список
+func (p *PermissionRepositoryImpl) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	query := `SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission`
+
+	rows, err := p.dbPoll.Query(ctx, query, role)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, p.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		p.log.Error("Failed to query role permissions", slog.Any("error", err))
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			p.log.Error("Error scanning permission row", slog.Any("error", err))
+			return nil, fmt.Errorf("error scanning permission row: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		p.log.Error("Error reading rows", slog.Any("error", err))
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	return permissions, nil
+}
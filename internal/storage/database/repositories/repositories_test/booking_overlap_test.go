@@ -0,0 +1,89 @@
+package repositories_test
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCreateBookingConcurrentOverlap параллельные вставки пересекающихся бронирований одного объекта.
+// Проверка доступности в них не участвует, пересечение должно отклонить ограничение excl_bookings_no_overlap
+func TestCreateBookingConcurrentOverlap(t *testing.T) {
+	f := newTenantFixture(t)
+
+	const parallel = 10
+	userA := f.createUser(t, f.ctxA, "dave")
+	typeA, err := f.types.CreateBookingType(f.ctxA, "hall-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "hall-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	startTime := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+
+	start := make(chan struct{})
+	errs := make([]error, parallel)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			// Интервалы сдвинуты на минуты, но все пересекаются друг с другом
+			offset := time.Duration(i) * time.Minute
+			_, errs[i] = f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", startTime.Add(offset), startTime.Add(offset+time.Hour))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorIs(t, err, database.ErrBookingNotAvailable)
+	}
+	require.Equal(t, 1, created)
+
+	byEntity, err := f.bookings.GetBookingsByBookingEntity(f.ctxA, entityA, f.listAll)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), byEntity.Total)
+}
+
+func TestBookingOverlapConstraintBoundaries(t *testing.T) {
+	f := newTenantFixture(t)
+
+	userA := f.createUser(t, f.ctxA, "erin")
+	typeA, err := f.types.CreateBookingType(f.ctxA, "booth-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "booth-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	otherEntity, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "booth-2-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	startTime := time.Now().Add(72 * time.Hour).Truncate(time.Second).UTC()
+	endTime := startTime.Add(time.Hour)
+
+	first, err := f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", startTime, endTime)
+	require.NoError(t, err)
+
+	// Интервал полуоткрытый: следующее бронирование может начаться в момент окончания предыдущего
+	_, err = f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", endTime, endTime.Add(time.Hour))
+	require.NoError(t, err)
+	// Другой объект в то же время не занят
+	_, err = f.bookings.CreateBooking(f.ctxA, userA, userA, otherEntity, "", startTime, endTime)
+	require.NoError(t, err)
+
+	// Перенос на занятое время тоже отклоняется ограничением
+	second, err := f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", startTime.Add(-time.Hour), startTime)
+	require.NoError(t, err)
+	err = f.bookings.UpdateBooking(f.ctxA, booking_db.BookingInfo{UserId: userA, BookingEntityId: entityA, StartTime: startTime.Add(-time.Hour), EndTime: startTime.Add(30 * time.Minute), Status: "pending"}, second)
+	require.ErrorIs(t, err, database.ErrBookingNotAvailable)
+
+	// Отменённое бронирование интервал не занимает
+	require.NoError(t, f.bookings.UpdateBooking(f.ctxA, booking_db.BookingInfo{UserId: userA, BookingEntityId: entityA, StartTime: startTime, EndTime: endTime, Status: "cancelled"}, first))
+	_, err = f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", startTime, endTime)
+	require.NoError(t, err)
+}
@@ -0,0 +1,42 @@
+package repositories_test
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBookingStatusHistory(t *testing.T) {
+	f := newTenantFixture(t)
+
+	userA := f.createUser(t, f.ctxA, "frank")
+	managerA := f.createUser(t, f.ctxA, "grace")
+	typeA, err := f.types.CreateBookingType(f.ctxA, "court-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "court-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	startTime := time.Now().Add(96 * time.Hour).Truncate(time.Second).UTC()
+	bookingA, err := f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", startTime, startTime.Add(time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, f.bookings.ChangeStatus(f.ctxA, bookingA, "pending", "confirmed", managerA))
+	// Переход из устаревшего статуса означает, что статус уже изменил другой запрос
+	require.ErrorIs(t, f.bookings.ChangeStatus(f.ctxA, bookingA, "pending", "cancelled", userA), booking_db.ErrBookingStatusChanged)
+	// Бронирование другой организации не найдено
+	require.ErrorIs(t, f.bookings.ChangeStatus(f.ctxB, bookingA, "confirmed", "cancelled", userA), booking_db.ErrBookingNotFound)
+
+	booking, err := f.bookings.GetBookingById(f.ctxA, bookingA)
+	require.NoError(t, err)
+	require.Equal(t, "confirmed", booking.Status)
+
+	history, err := f.bookings.GetStatusHistory(f.ctxA, bookingA)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, booking_db.BookingStatusChange{BookingId: bookingA, ToStatus: "pending", ChangedBy: userA, ChangedAt: history[0].ChangedAt}, history[0])
+	require.Equal(t, booking_db.BookingStatusChange{BookingId: bookingA, FromStatus: "pending", ToStatus: "confirmed", ChangedBy: managerA, ChangedAt: history[1].ChangedAt}, history[1])
+
+	history, err = f.bookings.GetStatusHistory(f.ctxB, bookingA)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
@@ -0,0 +1,38 @@
+package repositories_test
+
+import (
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestReplaceVerificationToken(t *testing.T) {
+	f := newTenantFixture(t)
+	verifications := email_verification_db.NewEmailVerificationRepository(f.pool, f.logger)
+
+	userId := f.createUser(t, f.ctxA, "sara")
+	expiredHash := "expired-" + f.suffix
+	require.NoError(t, verifications.CreateVerificationToken(f.ctxA, userId, expiredHash, time.Now().Add(-time.Minute)))
+	_, err := verifications.VerifyEmail(f.ctxA, expiredHash)
+	require.ErrorIs(t, err, email_verification_db.ErrVerificationTokenInvalid)
+
+	// Пока не прошёл интервал повторной отправки, новый токен не выдаётся
+	require.ErrorIs(t, verifications.ReplaceVerificationToken(f.ctxA, userId, "early-"+f.suffix, time.Now().Add(time.Hour), time.Hour),
+		email_verification_db.ErrVerificationResendTooSoon)
+
+	// Вместо истёкшего токена выдаётся новый, прежний перестаёт действовать
+	firstHash := "first-" + f.suffix
+	require.NoError(t, verifications.ReplaceVerificationToken(f.ctxA, userId, firstHash, time.Now().Add(time.Hour), 0))
+	secondHash := "second-" + f.suffix
+	require.NoError(t, verifications.ReplaceVerificationToken(f.ctxA, userId, secondHash, time.Now().Add(time.Hour), 0))
+	_, err = verifications.VerifyEmail(f.ctxA, firstHash)
+	require.ErrorIs(t, err, email_verification_db.ErrVerificationTokenInvalid)
+
+	verifiedId, err := verifications.VerifyEmail(f.ctxA, secondHash)
+	require.NoError(t, err)
+	require.Equal(t, userId, verifiedId)
+	user, err := f.users.GetUser(f.ctxA, userId)
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+}
@@ -0,0 +1,59 @@
+package repositories_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/roles"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Команда create-admin --org: организация создаётся при первом запуске, а администратор попадает в неё
+func TestCreateAdminInOrganization(t *testing.T) {
+	f := newTenantFixture(t)
+	organizations := organizations_db.NewOrganizationRepository(f.pool, f.logger)
+	audit := audit_db.NewAuditRepository(f.pool, f.logger)
+	name := "acme-" + f.suffix
+
+	organizationId, err := roles.EnsureOrganization(f.logger, organizations, audit, tenant.WithSystem(context.Background()), name)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = f.pool.Exec(context.Background(), `DELETE FROM audit_log WHERE target_type = $1 AND target_id = $2`, audit_db.TargetOrganization, organizationId)
+		_, _ = f.pool.Exec(context.Background(), `DELETE FROM users WHERE tenant_id = $1`, organizationId)
+		_, _ = f.pool.Exec(context.Background(), `DELETE FROM organizations WHERE id = $1`, organizationId)
+	})
+
+	// Повторный запуск находит ту же организацию
+	sameId, err := roles.EnsureOrganization(f.logger, organizations, audit, tenant.WithSystem(context.Background()), name)
+	require.NoError(t, err)
+	require.Equal(t, organizationId, sameId)
+	_, err = organizations.CreateOrganization(context.Background(), name)
+	require.ErrorIs(t, err, organizations_db.ErrOrganizationAlreadyExists)
+
+	organizationCtx := tenant.WithID(tenant.WithSystem(context.Background()), organizationId)
+	adminId, changed, err := roles.EnsureAdmin(f.logger, f.users, audit, organizationCtx, create_user.UserCreate{
+		FirstName: "Admin",
+		LastName:  "Acme",
+		Email:     "admin-" + f.suffix + "@acme.example",
+		Password:  "correct-horse-battery",
+		Phone:     "70000000000",
+	})
+	require.NoError(t, err)
+	require.True(t, changed)
+	t.Cleanup(func() {
+		_, _ = f.pool.Exec(context.Background(), `DELETE FROM audit_log WHERE target_type = $1 AND target_id = $2`, audit_db.TargetUser, adminId)
+	})
+
+	admin, err := f.users.GetUser(tenant.WithSystem(context.Background()), adminId)
+	require.NoError(t, err)
+	require.Equal(t, organizationId, admin.TenantID)
+	require.Equal(t, roles.RoleAdmin, admin.Role)
+
+	// Администратор новой организации не виден из других организаций
+	_, err = f.users.GetUser(f.ctxA, adminId)
+	require.ErrorIs(t, err, users_db.ErrUserNotFound)
+}
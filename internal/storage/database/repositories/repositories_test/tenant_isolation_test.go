@@ -0,0 +1,287 @@
+package repositories_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_entity_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_type_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// Тесты изоляции организаций выполняются на реальной БД с применёнными миграциями.
+// Строка подключения задаётся переменной TEST_DATABASE_URL, без неё тесты пропускаются
+const testDatabaseURLEnv = "TEST_DATABASE_URL"
+
+type tenantFixture struct {
+	pool     *pgxpool.Pool
+	ctxA     context.Context
+	ctxB     context.Context
+	tenantA  int64
+	tenantB  int64
+	suffix   string
+	listAll  query_params.ListQueryParams
+	logger   *slog.Logger
+	bookings *booking_db.BookingRepositoryImpl
+	entities *booking_entity_db.BookingEntityRepositoryImpl
+	types    *booking_type_db.BookingTypeRepositoryImpl
+	groups   *groups_db.GroupRepositoryImpl
+	users    *users_db.UserRepositoryImpl
+}
+
+func newTenantFixture(t *testing.T) *tenantFixture {
+	databaseURL := os.Getenv(testDatabaseURLEnv)
+	if databaseURL == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+
+	pool, err := pgxpool.New(ctx, databaseURL)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	f := &tenantFixture{
+		pool:    pool,
+		suffix:  fmt.Sprintf("%d", time.Now().UnixNano()),
+		listAll: query_params.ListQueryParams{BaseQueryParams: query_params.BaseQueryParams{Limit: 100, Page: 1}},
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	err = pool.QueryRow(ctx, `INSERT INTO organizations (name) VALUES ($1) RETURNING id`, "tenant-a-"+f.suffix).Scan(&f.tenantA)
+	require.NoError(t, err)
+	err = pool.QueryRow(ctx, `INSERT INTO organizations (name) VALUES ($1) RETURNING id`, "tenant-b-"+f.suffix).Scan(&f.tenantB)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		// Данные тестовых организаций удаляются вместе с ними, начиная с зависимых таблиц
+		for _, table := range []string{"bookings", "booking_entities", "booking_types", "user_groups", "users"} {
+			_, _ = pool.Exec(context.Background(), `DELETE FROM `+table+` WHERE tenant_id IN ($1, $2)`, f.tenantA, f.tenantB)
+		}
+		_, _ = pool.Exec(context.Background(), `DELETE FROM organizations WHERE id IN ($1, $2)`, f.tenantA, f.tenantB)
+	})
+
+	f.ctxA = auth.NewContext(ctx, auth.Principal{UserID: 1, TenantID: f.tenantA})
+	f.ctxB = auth.NewContext(ctx, auth.Principal{UserID: 1, TenantID: f.tenantB})
+	f.bookings = booking_db.NewBookingRepository(pool, f.logger)
+	f.entities = booking_entity_db.NewBookingEntityRepository(pool, f.logger)
+	f.types = booking_type_db.NewBookingTypeRepository(pool, f.logger)
+	f.groups = groups_db.NewGroupRepository(pool, f.logger)
+	f.users = users_db.NewUsersDB(pool, f.logger)
+	return f
+}
+
+func (f *tenantFixture) createUser(t *testing.T, ctx context.Context, name string) int64 {
+	id, err := f.users.CreateUser(ctx, &create_user.UserCreate{
+		FirstName: name,
+		LastName:  "Tenant",
+		Email:     fmt.Sprintf("%s-%s@example.com", name, f.suffix),
+		Password:  "hash",
+		Phone:     "79990000000",
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func TestUserRepositoryTenantIsolation(t *testing.T) {
+	f := newTenantFixture(t)
+
+	userA := f.createUser(t, f.ctxA, "alice")
+	userB := f.createUser(t, f.ctxB, "bob")
+
+	user, err := f.users.GetUser(f.ctxA, userA)
+	require.NoError(t, err)
+	require.Equal(t, f.tenantA, user.TenantID)
+
+	_, err = f.users.GetUser(f.ctxB, userA)
+	require.ErrorIs(t, err, users_db.ErrUserNotFound)
+	_, err = f.users.GetUserByEmail(f.ctxB, user.Email)
+	require.ErrorIs(t, err, users_db.ErrUserNotFound)
+	require.ErrorIs(t, f.users.UpdateRole(f.ctxB, userA, "admin"), users_db.ErrUserNotFound)
+	require.ErrorIs(t, f.users.UpdateProfile(f.ctxB, userA, "Mallory", "Tenant", "1"), users_db.ErrUserNotFound)
+	require.ErrorIs(t, f.users.UpdatePassword(f.ctxB, userA, "other"), users_db.ErrUserNotFound)
+	require.ErrorIs(t, f.users.SetStatus(f.ctxB, userA, users_db.UserStatusDeactivated, users_db.BookingPolicyKeep, 0), users_db.ErrUserNotFound)
+	// Бронирования нельзя переназначить пользователю другой организации
+	require.ErrorIs(t, f.users.SetStatus(f.ctxA, userA, users_db.UserStatusDeactivated, users_db.BookingPolicyReassign, userB), users_db.ErrReassignTargetInvalid)
+
+	list, err := f.users.GetUserList(f.ctxB, f.suffix, 100, 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), list.Total)
+	require.Len(t, list.Users, 1)
+	require.Equal(t, userB, list.Users[0].ID)
+
+	// Вход выполняется системным вызовом и находит пользователя любой организации,
+	// а контекст без пользователя и системной метки не находит никого
+	_, err = f.users.GetUserByEmail(context.Background(), user.Email)
+	require.ErrorIs(t, err, users_db.ErrUserNotFound)
+	user, err = f.users.GetUserByEmail(tenant.WithSystem(context.Background()), user.Email)
+	require.NoError(t, err)
+	require.Equal(t, userA, user.ID)
+}
+
+func TestBookingTypeAndEntityRepositoryTenantIsolation(t *testing.T) {
+	f := newTenantFixture(t)
+
+	typeA, err := f.types.CreateBookingType(f.ctxA, "room-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "room-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+
+	_, err = f.types.GetBookingType(f.ctxB, typeA)
+	require.ErrorIs(t, err, booking_type_db.ErrBookingTypeNotFound)
+	require.ErrorIs(t, f.types.UpdateBookingType(f.ctxB, typeA, "stolen", ""), booking_type_db.ErrBookingTypeNotFound)
+	types, err := f.types.GetBookingTypeList(f.ctxB, f.suffix, 0, 100, 0, nil)
+	require.NoError(t, err)
+	require.Zero(t, types.Total)
+	require.Empty(t, types.BookingTypes)
+
+	_, err = f.entities.GetBookingEntity(f.ctxB, entityA)
+	require.ErrorIs(t, err, booking_entity_db.ErrBookingEntityNotFound)
+	require.ErrorIs(t, f.entities.UpdateBookingEntity(f.ctxB, entityA, typeA, "stolen", "", "active", 0), booking_entity_db.ErrBookingEntityNotFound)
+	_, err = f.entities.CanBook(f.ctxB, entityA, 1)
+	require.ErrorIs(t, err, booking_entity_db.ErrBookingEntityNotFound)
+	entities, err := f.entities.GetBookingEntitiesList(f.ctxB, f.suffix, 0, 100, 0, nil)
+	require.NoError(t, err)
+	require.Zero(t, entities.Total)
+	require.Empty(t, entities.BookingEntities)
+
+	require.ErrorIs(t, f.entities.DeleteBookingEntity(f.ctxB, entityA), booking_entity_db.ErrBookingEntityNotFound)
+	require.ErrorIs(t, f.types.DeleteBookingType(f.ctxB, typeA), booking_type_db.ErrBookingTypeNotFound)
+
+	// В своей организации записи доступны
+	types, err = f.types.GetBookingTypeList(f.ctxA, f.suffix, 0, 100, 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), types.Total)
+	_, err = f.entities.GetBookingEntity(f.ctxA, entityA)
+	require.NoError(t, err)
+
+	// Забронировать объект можно только на пользователя его организации
+	userA := f.createUser(t, f.ctxA, "liam")
+	userB := f.createUser(t, f.ctxB, "mia")
+	allowed, err := f.entities.CanBook(f.ctxA, entityA, userA)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	_, err = f.entities.CanBook(f.ctxA, entityA, userB)
+	require.ErrorIs(t, err, booking_entity_db.ErrBookingUserNotFound)
+}
+
+func TestBookingRepositoryTenantIsolation(t *testing.T) {
+	f := newTenantFixture(t)
+
+	userA := f.createUser(t, f.ctxA, "carol")
+	typeA, err := f.types.CreateBookingType(f.ctxA, "desk-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "desk-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	startTime := time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+	endTime := startTime.Add(time.Hour)
+	bookingA, err := f.bookings.CreateBooking(f.ctxA, userA, userA, entityA, "", startTime, endTime)
+	require.NoError(t, err)
+
+	_, err = f.bookings.GetBookingById(f.ctxB, bookingA)
+	require.ErrorIs(t, err, booking_db.ErrBookingNotFound)
+	require.ErrorIs(t, f.bookings.UpdateBooking(f.ctxB, booking_db.BookingInfo{UserId: userA, BookingEntityId: entityA, StartTime: startTime, EndTime: endTime, Status: "cancelled"}, bookingA), booking_db.ErrBookingNotFound)
+	require.ErrorIs(t, f.bookings.ChangeStatus(f.ctxB, bookingA, "pending", "cancelled", 0), booking_db.ErrBookingNotFound)
+
+	byUser, err := f.bookings.GetBookingsForUser(f.ctxB, userA, f.listAll)
+	require.NoError(t, err)
+	require.Zero(t, byUser.Total)
+	require.Empty(t, byUser.Bookings)
+	byEntity, err := f.bookings.GetBookingsByBookingEntity(f.ctxB, entityA, f.listAll)
+	require.NoError(t, err)
+	require.Zero(t, byEntity.Total)
+	require.Empty(t, byEntity.Bookings)
+	byTime, err := f.bookings.GetBookingsByTime(f.ctxB, startTime, endTime, f.listAll)
+	require.NoError(t, err)
+	require.Empty(t, byTime)
+
+	// В своей организации бронирование видно и занимает интервал
+	booking, err := f.bookings.GetBookingById(f.ctxA, bookingA)
+	require.NoError(t, err)
+	require.Equal(t, entityA, booking.BookingEntityId)
+	available, err := f.bookings.CheckBookingAvailability(f.ctxA, entityA, startTime, endTime)
+	require.NoError(t, err)
+	require.False(t, available)
+}
+
+func TestGroupRepositoryTenantIsolation(t *testing.T) {
+	f := newTenantFixture(t)
+
+	userA := f.createUser(t, f.ctxA, "heidi")
+	userB := f.createUser(t, f.ctxB, "ivan")
+	groupA, err := f.groups.CreateGroup(f.ctxA, "team-"+f.suffix, "")
+	require.NoError(t, err)
+	// Название группы уникально только в пределах организации
+	groupB, err := f.groups.CreateGroup(f.ctxB, "team-"+f.suffix, "")
+	require.NoError(t, err)
+	require.NoError(t, f.groups.AddMember(f.ctxA, groupA, userA))
+
+	_, err = f.groups.GetGroup(f.ctxB, groupA)
+	require.ErrorIs(t, err, groups_db.ErrGroupNotFound)
+	groups, err := f.groups.ListGroups(f.ctxB)
+	require.NoError(t, err)
+	for _, group := range groups {
+		require.NotEqual(t, groupA, group.ID)
+	}
+	members, err := f.groups.ListMembers(f.ctxB, groupA)
+	require.NoError(t, err)
+	require.Empty(t, members)
+
+	require.ErrorIs(t, f.groups.AddMember(f.ctxB, groupA, userB), groups_db.ErrGroupNotFound)
+	// Пользователя другой организации нельзя добавить в свою группу
+	require.ErrorIs(t, f.groups.AddMember(f.ctxB, groupB, userA), groups_db.ErrMemberUserNotFound)
+	require.ErrorIs(t, f.groups.RemoveMember(f.ctxB, groupA, userA), groups_db.ErrMemberNotFound)
+	require.ErrorIs(t, f.groups.DeleteGroup(f.ctxB, groupA), groups_db.ErrGroupNotFound)
+
+	// Тип бронирования нельзя ограничить группой другой организации
+	typeB, err := f.types.CreateBookingType(f.ctxB, "lab-"+f.suffix, "")
+	require.NoError(t, err)
+	require.ErrorIs(t, f.groups.SetBookingTypeGroups(f.ctxB, typeB, []int64{groupA}), groups_db.ErrGroupNotFound)
+	require.NoError(t, f.groups.SetBookingTypeGroups(f.ctxB, typeB, []int64{groupB, groupB}))
+	groupIds, err := f.groups.GetBookingTypeGroups(f.ctxB, typeB)
+	require.NoError(t, err)
+	require.Equal(t, []int64{groupB}, groupIds)
+
+	members, err = f.groups.ListMembers(f.ctxA, groupA)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	require.Equal(t, userA, members[0].UserID)
+}
+
+func TestAPIKeyRepositoryTenantIsolation(t *testing.T) {
+	f := newTenantFixture(t)
+	keys := api_keys_db.NewAPIKeyRepository(f.pool, f.logger)
+
+	userA := f.createUser(t, f.ctxA, "judy")
+	userB := f.createUser(t, f.ctxB, "kate")
+	keyA, err := keys.CreateAPIKey(f.ctxA, api_keys_db.APIKeyCreate{Name: "ci", Prefix: "a" + f.suffix[:7], SecretHash: "hash-a-" + f.suffix, UserID: userA})
+	require.NoError(t, err)
+	// Ключ нельзя выпустить от имени пользователя другой организации
+	_, err = keys.CreateAPIKey(f.ctxB, api_keys_db.APIKeyCreate{Name: "ci", Prefix: "b" + f.suffix[:7], SecretHash: "hash-b-" + f.suffix, UserID: userA})
+	require.ErrorIs(t, err, api_keys_db.ErrAPIKeyUserNotFound)
+	_, err = keys.CreateAPIKey(f.ctxB, api_keys_db.APIKeyCreate{Name: "ci", Prefix: "b" + f.suffix[:7], SecretHash: "hash-b-" + f.suffix, UserID: userB})
+	require.NoError(t, err)
+
+	list, err := keys.ListAPIKeys(f.ctxB)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, userB, list[0].UserID)
+	require.ErrorIs(t, keys.RevokeAPIKey(f.ctxB, keyA), api_keys_db.ErrAPIKeyNotFound)
+
+	list, err = keys.ListAPIKeys(f.ctxA)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, keyA, list[0].ID)
+	require.Nil(t, list[0].RevokedAt)
+}
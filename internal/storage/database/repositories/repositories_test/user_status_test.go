@@ -0,0 +1,93 @@
+package repositories_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/booking_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSetStatusReassignRespectsGroups(t *testing.T) {
+	f := newTenantFixture(t)
+
+	owner := f.createUser(t, f.ctxA, "nick")
+	outsider := f.createUser(t, f.ctxA, "olga")
+	member := f.createUser(t, f.ctxA, "paul")
+	groupA, err := f.groups.CreateGroup(f.ctxA, "lab-"+f.suffix, "")
+	require.NoError(t, err)
+	require.NoError(t, f.groups.AddMember(f.ctxA, groupA, owner))
+	require.NoError(t, f.groups.AddMember(f.ctxA, groupA, member))
+	typeA, err := f.types.CreateBookingType(f.ctxA, "lab-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "lab-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	require.NoError(t, f.groups.SetBookingEntityGroups(f.ctxA, entityA, []int64{groupA}))
+	startTime := time.Now().Add(120 * time.Hour).Truncate(time.Second).UTC()
+	bookingA, err := f.bookings.CreateBooking(f.ctxA, owner, owner, entityA, "", startTime, startTime.Add(time.Hour))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = f.pool.Exec(context.Background(), `DELETE FROM audit_log WHERE target_type = $1 AND target_id = $2`, audit_db.TargetBooking, bookingA)
+	})
+
+	// Пользователь вне группы объекта не может получить бронирование, и статус владельца не меняется
+	err = f.users.SetStatus(f.ctxA, owner, users_db.UserStatusDeactivated, users_db.BookingPolicyReassign, outsider)
+	require.ErrorIs(t, err, users_db.ErrReassignTargetRestricted)
+	user, err := f.users.GetUser(f.ctxA, owner)
+	require.NoError(t, err)
+	require.Equal(t, users_db.UserStatusActive, user.Status)
+	booking, err := f.bookings.GetBookingById(f.ctxA, bookingA)
+	require.NoError(t, err)
+	require.Equal(t, owner, booking.UserId)
+
+	require.NoError(t, f.users.SetStatus(f.ctxA, owner, users_db.UserStatusDeactivated, users_db.BookingPolicyReassign, member))
+	booking, err = f.bookings.GetBookingById(f.ctxA, bookingA)
+	require.NoError(t, err)
+	require.Equal(t, member, booking.UserId)
+
+	// Переназначение записано в журнал аудита от имени пользователя запроса
+	var actorId, fromUserId, toUserId int64
+	err = f.pool.QueryRow(f.ctxA, `SELECT actor_id, (details->>'from_user_id')::BIGINT, (details->>'to_user_id')::BIGINT
+FROM audit_log WHERE action = $1 AND target_type = $2 AND target_id = $3`, audit_db.ActionBookingReassigned, audit_db.TargetBooking, bookingA).
+		Scan(&actorId, &fromUserId, &toUserId)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), actorId)
+	require.Equal(t, owner, fromUserId)
+	require.Equal(t, member, toUserId)
+}
+
+func TestPurgeUserWithBookings(t *testing.T) {
+	f := newTenantFixture(t)
+
+	owner := f.createUser(t, f.ctxA, "quinn")
+	assistant := f.createUser(t, f.ctxA, "rita")
+	typeA, err := f.types.CreateBookingType(f.ctxA, "studio-"+f.suffix, "")
+	require.NoError(t, err)
+	entityA, err := f.entities.CreateBookingEntity(f.ctxA, typeA, "studio-"+f.suffix, "", "active", 0)
+	require.NoError(t, err)
+	startTime := time.Now().Add(144 * time.Hour).Truncate(time.Second).UTC()
+	ownBooking, err := f.bookings.CreateBooking(f.ctxA, owner, owner, entityA, "", startTime, startTime.Add(time.Hour))
+	require.NoError(t, err)
+	// Бронирование, которое владелец создал как представитель ассистента
+	delegatedBooking, err := f.bookings.CreateBooking(f.ctxA, assistant, owner, entityA, "", startTime.Add(2*time.Hour), startTime.Add(3*time.Hour))
+	require.NoError(t, err)
+
+	// Удалённого с политикой keep пользователя нельзя окончательно удалить, пока его бронирования действуют
+	require.ErrorIs(t, f.users.PurgeUser(f.ctxA, owner), users_db.ErrUserNotDeleted)
+	require.NoError(t, f.users.SetStatus(f.ctxA, owner, users_db.UserStatusDeleted, users_db.BookingPolicyKeep, 0))
+	require.ErrorIs(t, f.users.PurgeUser(f.ctxA, owner), users_db.ErrUserHasBookings)
+	require.ErrorIs(t, f.users.PurgeUser(f.ctxB, owner), users_db.ErrUserNotFound)
+
+	require.NoError(t, f.bookings.ChangeStatus(f.ctxA, ownBooking, "pending", "cancelled", assistant))
+	require.NoError(t, f.users.PurgeUser(f.ctxA, owner))
+
+	_, err = f.users.GetUser(f.ctxA, owner)
+	require.ErrorIs(t, err, users_db.ErrUserNotFound)
+	_, err = f.bookings.GetBookingById(f.ctxA, ownBooking)
+	require.ErrorIs(t, err, booking_db.ErrBookingNotFound)
+	booking, err := f.bookings.GetBookingById(f.ctxA, delegatedBooking)
+	require.NoError(t, err)
+	require.Equal(t, assistant, booking.CreatedBy)
+}
@@ -0,0 +1,173 @@
+package sessions_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("Сессия не найдена")
+var ErrSessionTerminated = errors.New("Сессия завершена")
+
+// Ограничения длины колонок, более длинные значения обрезаются
+const (
+	maxUserAgentLength = 512
+	maxIPLength        = 64
+)
+
+// SessionChecker проверяет, что сессия токена доступа не завершена. Используется в AuthMiddleware
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionId int64) (bool, error)
+}
+
+type SessionRepository interface {
+	SessionChecker
+	TouchSession(ctx context.Context, userId int64, familyId string, client ClientInfo) (int64, error)
+	ListSessions(ctx context.Context, userId int64) ([]SessionInfo, error)
+	TerminateSession(ctx context.Context, userId, sessionId int64) (string, error)
+}
+
+// ClientInfo Клиент, с которого выполнен вход или обновление токенов
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionInfo Активная сессия пользователя
+type SessionInfo struct {
+	ID         int64
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+type SessionRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewSessionRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *SessionRepositoryImpl {
+	return &SessionRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// TouchSession создаёт сессию для семейства refresh токенов или обновляет last_seen_at, user agent и IP существующей
+//
+// Вызывается при входе и при каждой ротации refresh токена, поэтому last_seen_at точен до времени жизни токена доступа.
+// Сессия для семейства, начатого до появления таблицы sessions, создаётся при первой ротации.
+// Для завершённой сессии возвращается ErrSessionTerminated
+func (s *SessionRepositoryImpl) TouchSession(ctx context.Context, userId int64, familyId string, client ClientInfo) (int64, error) {
+	query := `INSERT INTO sessions (user_id, family_id, user_agent, ip)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (family_id) DO UPDATE
+    SET last_seen_at = CURRENT_TIMESTAMP,
+        user_agent   = EXCLUDED.user_agent,
+        ip           = EXCLUDED.ip
+WHERE sessions.terminated_at IS NULL
+RETURNING id`
+
+	var id int64
+	err := s.db.QueryRow(ctx, query, userId, familyId, truncate(client.UserAgent, maxUserAgentLength), truncate(client.IP, maxIPLength)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrSessionTerminated
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		s.log.Error("Failed to save session", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, nil
+}
+
+// IsSessionActive возвращает false, если сессия завершена или не существует
+func (s *SessionRepositoryImpl) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND terminated_at IS NULL)`
+
+	var active bool
+	err := s.db.QueryRow(ctx, query, sessionId).Scan(&active)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return false, ctxErr
+		}
+		s.log.Error("Failed to check session", "error", err)
+		return false, database.PsqlErrorHandler(err)
+	}
+	return active, nil
+}
+
+// ListSessions возвращает незавершённые сессии пользователя, последние активные первыми
+func (s *SessionRepositoryImpl) ListSessions(ctx context.Context, userId int64) ([]SessionInfo, error) {
+	query := `SELECT id, user_agent, ip, created_at, last_seen_at
+FROM sessions
+WHERE user_id = $1 AND terminated_at IS NULL
+ORDER BY last_seen_at DESC, id DESC`
+
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		s.log.Error("Failed to list sessions", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	sessions := make([]SessionInfo, 0)
+	for rows.Next() {
+		var session SessionInfo
+		if err = rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			s.log.Error("Failed to scan session", "error", err)
+			return nil, database.PsqlErrorHandler(err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return nil, ctxErr
+		}
+		s.log.Error("Failed to iterate sessions", "error", err)
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return sessions, nil
+}
+
+// TerminateSession завершает сессию пользователя и возвращает семейство её refresh токенов
+//
+// Сессия другого пользователя и уже завершённая сессия считаются не найденными (ErrSessionNotFound).
+// Refresh токены семейства отзывает вызывающий код (RefreshTokenRepository.RevokeFamily)
+func (s *SessionRepositoryImpl) TerminateSession(ctx context.Context, userId, sessionId int64) (string, error) {
+	query := `UPDATE sessions SET terminated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND terminated_at IS NULL
+RETURNING family_id`
+
+	var familyId string
+	err := s.db.QueryRow(ctx, query, sessionId, userId).Scan(&familyId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrSessionNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return "", ctxErr
+		}
+		s.log.Error("Failed to terminate session", "error", err)
+		return "", database.PsqlErrorHandler(err)
+	}
+	return familyId, nil
+}
+
+func truncate(value string, maxLength int) string {
+	runes := []rune(value)
+	if len(runes) > maxLength {
+		return string(runes[:maxLength])
+	}
+	return value
+}
@@ -0,0 +1,33 @@
+package login_attempts
+
+import (
+	"context"
+	"time"
+)
+
+// AttemptInfo Состояние неудачных попыток входа по ключу (аккаунт или IP)
+type AttemptInfo struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// AttemptStore Хранилище неудачных попыток входа
+//
+// Ключ - идентификатор аккаунта или IP адреса (см. AccountKey, IPKey).
+// Счётчик сбрасывается, если с последней неудачной попытки прошло больше window
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (AttemptInfo, error)
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// AccountKey ключ попыток входа для аккаунта
+func AccountKey(email string) string {
+	return "account:" + email
+}
+
+// IPKey ключ попыток входа для IP адреса
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,77 @@
+package login_attempts
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// InMemoryStore Реализация AttemptStore в памяти процесса
+//
+// Подходит для локальной разработки и тестов. При нескольких репликах каждая считает попытки отдельно
+type InMemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+func (s *InMemoryStore) Get(ctx context.Context, key string) (AttemptInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return AttemptInfo{}, nil
+	}
+	return AttemptInfo{Failures: entry.failures, LockedUntil: entry.lockedUntil}, nil
+}
+
+func (s *InMemoryStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	if now.Sub(entry.lastFailureAt) > window {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.lastFailureAt = now
+	return entry.failures, nil
+}
+
+func (s *InMemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	entry.lockedUntil = until
+	return nil
+}
+
+func (s *InMemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
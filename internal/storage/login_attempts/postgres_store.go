@@ -0,0 +1,95 @@
+package login_attempts
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// PostgresStore Реализация AttemptStore в PostgreSQL. Попытки считаются общими для всех реплик сервиса
+type PostgresStore struct {
+	dbPoll *pgxpool.Pool
+	log    *slog.Logger
+}
+
+func NewPostgresStore(db *pgxpool.Pool, log *slog.Logger) *PostgresStore {
+	return &PostgresStore{
+		dbPoll: db,
+		log:    log,
+	}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (AttemptInfo, error) {
+	query := `SELECT failures, locked_until FROM login_attempts WHERE key = $1`
+
+	var info AttemptInfo
+	var lockedUntil *time.Time
+	err := s.dbPoll.QueryRow(ctx, query, key).Scan(&info.Failures, &lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AttemptInfo{}, nil
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return AttemptInfo{}, ctxErr
+		}
+		s.log.Error("Failed to get login attempts", "error", err)
+		return AttemptInfo{}, database.PsqlErrorHandler(err)
+	}
+	if lockedUntil != nil {
+		info.LockedUntil = *lockedUntil
+	}
+	return info, nil
+}
+
+// RecordFailure Увеличивает счётчик неудачных попыток одним запросом, поэтому параллельные попытки не теряются
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, CURRENT_TIMESTAMP)
+ON CONFLICT (key) DO UPDATE SET
+    failures = CASE WHEN login_attempts.last_failure_at < CURRENT_TIMESTAMP - $2::interval THEN 1 ELSE login_attempts.failures + 1 END,
+    last_failure_at = CURRENT_TIMESTAMP
+RETURNING failures`
+
+	var failures int
+	err := s.dbPoll.QueryRow(ctx, query, key, window).Scan(&failures)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		s.log.Error("Failed to record login failure", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return failures, nil
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `INSERT INTO login_attempts (key, failures, last_failure_at, locked_until) VALUES ($1, 0, CURRENT_TIMESTAMP, $2)
+ON CONFLICT (key) DO UPDATE SET locked_until = EXCLUDED.locked_until`
+
+	_, err := s.dbPoll.Exec(ctx, query, key, until.UTC())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return ctxErr
+		}
+		s.log.Error("Failed to lock login", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	query := `DELETE FROM login_attempts WHERE key = $1`
+
+	_, err := s.dbPoll.Exec(ctx, query, key)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, s.log); ctxErr != nil {
+			return ctxErr
+		}
+		s.log.Error("Failed to reset login attempts", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
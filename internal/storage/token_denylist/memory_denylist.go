@@ -0,0 +1,47 @@
+package token_denylist
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InMemoryDenylist Реализация TokenDenylist в памяти процесса
+//
+// Подходит для локальной разработки и тестов. При нескольких репликах отзыв виден только в одной из них
+type InMemoryDenylist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func NewInMemoryDenylist() *InMemoryDenylist {
+	return &InMemoryDenylist{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Add Добавляет jti в список отозванных. Заодно удаляет записи с истёкшим exp
+func (d *InMemoryDenylist) Add(ctx context.Context, jti string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for key, exp := range d.entries {
+		if exp.Before(now) {
+			delete(d.entries, key)
+		}
+	}
+	d.entries[jti] = expiresAt
+	return nil
+}
+
+func (d *InMemoryDenylist) IsDenied(ctx context.Context, jti string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	expiresAt, ok := d.entries[jti]
+	if !ok {
+		return false, nil
+	}
+	return !expiresAt.Before(time.Now()), nil
+}
@@ -0,0 +1,57 @@
+package token_denylist
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// PostgresDenylist Реализация TokenDenylist в PostgreSQL. Работает при нескольких репликах сервиса
+type PostgresDenylist struct {
+	dbPoll *pgxpool.Pool
+	log    *slog.Logger
+}
+
+func NewPostgresDenylist(db *pgxpool.Pool, log *slog.Logger) *PostgresDenylist {
+	return &PostgresDenylist{
+		dbPoll: db,
+		log:    log,
+	}
+}
+
+// Add Добавляет jti в список отозванных. Заодно удаляет записи с истёкшим exp
+func (d *PostgresDenylist) Add(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+
+	_, err := d.dbPoll.Exec(ctx, query, jti, expiresAt.UTC())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, d.log); ctxErr != nil {
+			return ctxErr
+		}
+		d.log.Error("Failed to add token to denylist", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+
+	cleanupQuery := `DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP`
+	if _, err = d.dbPoll.Exec(ctx, cleanupQuery); err != nil {
+		d.log.Warn("Failed to cleanup expired revoked tokens", "error", err)
+	}
+	return nil
+}
+
+func (d *PostgresDenylist) IsDenied(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at >= CURRENT_TIMESTAMP)`
+
+	var denied bool
+	err := d.dbPoll.QueryRow(ctx, query, jti).Scan(&denied)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, d.log); ctxErr != nil {
+			return false, ctxErr
+		}
+		d.log.Error("Failed to check token in denylist", "error", err)
+		return false, database.PsqlErrorHandler(err)
+	}
+	return denied, nil
+}
@@ -0,0 +1,14 @@
+package token_denylist
+
+import (
+	"context"
+	"time"
+)
+
+// TokenDenylist Список отозванных токенов доступа (по jti)
+//
+// Токен хранится в списке только до истечения его exp, после этого он и так не пройдёт проверку
+type TokenDenylist interface {
+	Add(ctx context.Context, jti string, expiresAt time.Time) error
+	IsDenied(ctx context.Context, jti string) (bool, error)
+}
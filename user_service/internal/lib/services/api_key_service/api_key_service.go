@@ -0,0 +1,165 @@
+package api_key_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/api_keys"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// KeyPrefix префикс всех API ключей, по нему ключ легко узнать в логах и конфигурации сервисов
+const KeyPrefix = "bk_"
+
+// displayPrefixLength сколько первых символов ключа сохраняется в открытом виде для списка ключей
+const displayPrefixLength = 11
+
+var ErrUnknownScope = errors.New("Разрешение не может быть выдано API ключу")
+var ErrScopeNotAllowed = errors.New("Разрешение не входит в разрешения роли пользователя")
+var ErrExpiresInPast = errors.New("Срок действия ключа уже истёк")
+var ErrOwnerInactive = errors.New("Нельзя выпустить ключ для неактивного пользователя")
+
+// Create выпускает API ключ и возвращает его в открытом виде. Повторно получить ключ нельзя
+//
+// Scopes ключа ограничены authorization.APIKeyScopes и разрешениями роли владельца ключа,
+// поэтому ключ не даёт владельцу больше прав, чем у него есть при входе по паролю
+func Create(log *slog.Logger, apiKeyRepository api_keys_db.APIKeyRepository, userRepository users_db.UserRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, ctx context.Context, principal auth.Principal, request api_keys.CreateRequest, now time.Time) (api_keys.CreateResponse, error) {
+	const op = "user_service/internal/lib/services/api_key_service/api_key_service.go/Create"
+	log = log.With(slog.String("op", op))
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return api_keys.CreateResponse{}, ErrExpiresInPast
+	}
+	ownerId := request.UserID
+	if ownerId == 0 {
+		ownerId = principal.UserID
+	}
+	owner, err := userRepository.GetUser(ctx, ownerId)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return api_keys.CreateResponse{}, err
+	}
+	if owner.Status != "" && owner.Status != users_db.UserStatusActive {
+		return api_keys.CreateResponse{}, ErrOwnerInactive
+	}
+	rolePermissions, err := permissionRepository.GetRolePermissions(ctx, owner.Role)
+	if err != nil {
+		log.Error("Failed to get role permissions", "err", err, "role", owner.Role)
+		return api_keys.CreateResponse{}, err
+	}
+	scopes := make([]string, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !slices.Contains(authorization.APIKeyScopes, scope) {
+			return api_keys.CreateResponse{}, fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+		if !slices.Contains(rolePermissions, scope) {
+			return api_keys.CreateResponse{}, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	secret, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate api key", "err", err)
+		return api_keys.CreateResponse{}, err
+	}
+	key := KeyPrefix + secret
+	id, err := apiKeyRepository.CreateAPIKey(ctx, api_keys_db.APIKeyCreate{
+		Name:       request.Name,
+		Prefix:     key[:displayPrefixLength],
+		SecretHash: secure_tokens.Hash(key),
+		Scopes:     scopes,
+		UserID:     ownerId,
+		CreatedBy:  principal.UserID,
+		ExpiresAt:  request.ExpiresAt,
+	})
+	if err != nil {
+		log.Error("Failed to save api key", "err", err)
+		return api_keys.CreateResponse{}, err
+	}
+	log.Info("API key created", "api_key_id", id, "user_id", ownerId, "created_by", principal.UserID)
+
+	// Ошибка записи в журнал аудита не отменяет выпуск ключа, только логируется
+	err = auditRepository.Record(ctx, audit_db.Entry{
+		ActorID:    principal.UserID,
+		Action:     audit_db.ActionAPIKeyCreated,
+		TargetType: audit_db.TargetAPIKey,
+		TargetID:   id,
+		Details:    map[string]any{"name": request.Name, "user_id": ownerId, "scopes": scopes},
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionAPIKeyCreated)
+	}
+	return api_keys.CreateResponse{
+		Response: resp.OK(),
+		ID:       id,
+		Key:      key,
+	}, nil
+}
+
+// List возвращает все ключи без секретов
+func List(log *slog.Logger, apiKeyRepository api_keys_db.APIKeyRepository, ctx context.Context) (api_keys.ListResponse, error) {
+	const op = "user_service/internal/lib/services/api_key_service/api_key_service.go/List"
+	log = log.With(slog.String("op", op))
+
+	keys, err := apiKeyRepository.ListAPIKeys(ctx)
+	if err != nil {
+		log.Error("Failed to list api keys", "err", err)
+		return api_keys.ListResponse{}, err
+	}
+	data := make([]api_keys.APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, api_keys.APIKeyInfo{
+			ID:         key.ID,
+			Name:       key.Name,
+			Prefix:     key.Prefix,
+			Scopes:     key.Scopes,
+			UserID:     key.UserID,
+			CreatedBy:  key.CreatedBy,
+			ExpiresAt:  key.ExpiresAt,
+			LastUsedAt: key.LastUsedAt,
+			RevokedAt:  key.RevokedAt,
+			CreatedAt:  key.CreatedAt,
+		})
+	}
+	return api_keys.ListResponse{Response: resp.OK(), Data: data}, nil
+}
+
+// Revoke отзывает ключ. Запросы с отозванным ключом сразу начинают получать 401
+func Revoke(log *slog.Logger, apiKeyRepository api_keys_db.APIKeyRepository, auditRepository audit_db.AuditRepository, ctx context.Context, principal auth.Principal, id int64) error {
+	const op = "user_service/internal/lib/services/api_key_service/api_key_service.go/Revoke"
+	log = log.With(slog.String("op", op), slog.Int64("api_key_id", id))
+
+	if err := apiKeyRepository.RevokeAPIKey(ctx, id); err != nil {
+		if !errors.Is(err, api_keys_db.ErrAPIKeyNotFound) {
+			log.Error("Failed to revoke api key", "err", err)
+		}
+		return err
+	}
+	log.Info("API key revoked", "revoked_by", principal.UserID)
+
+	err := auditRepository.Record(ctx, audit_db.Entry{
+		ActorID:    principal.UserID,
+		Action:     audit_db.ActionAPIKeyRevoked,
+		TargetType: audit_db.TargetAPIKey,
+		TargetID:   id,
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionAPIKeyRevoked)
+	}
+	return nil
+}
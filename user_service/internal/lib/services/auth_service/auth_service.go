@@ -0,0 +1,403 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/mfa"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/login_guard"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/passwords"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/token_denylist"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/mfa_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"time"
+)
+
+var ErrInvalidCredentials = errors.New("Неверный email или пароль")
+var ErrInvalidRefreshToken = errors.New("Refresh токен недействителен")
+var ErrRefreshTokenReused = errors.New("Refresh токен уже был использован, все сессии этого входа завершены")
+var ErrInvalidAccessToken = errors.New("Токен доступа не содержит jti или exp")
+var ErrUserDeactivated = errors.New("Учётная запись деактивирована")
+var ErrInvalidMFAToken = errors.New("Токен второго шага входа недействителен или истёк, войдите заново")
+
+const tokenTypeBearer = "Bearer"
+
+// Login проверяет email и пароль пользователя и выдаёт подписанный токен доступа и refresh токен
+//
+// Каждый вход начинает новое семейство refresh токенов и новую сессию с user agent и IP клиента.
+// Если хеш пароля создан устаревшим алгоритмом или с устаревшими параметрами, пароль перехешируется.
+// Если у пользователя подключена 2FA, вместо токенов возвращается токен второго шага входа (см. CompleteMFALogin)
+func Login(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, ctx context.Context, dto login.LoginRequest, client sessions_db.ClientInfo, settings jwt_tokens.TokenSettings, mfaSettings totp.Settings) (login.LoginResponse, error) {
+	const op = "user_service/internal/lib/services/auth_service/auth_service.go/Login"
+	log = log.With(slog.String("op", op))
+
+	user, err := userRepository.GetUserByEmail(ctx, dto.Email)
+	if err != nil {
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			log.Debug("Пользователь не найден", "email", dto.Email)
+			// Проверяем фиктивный хеш, что б время ответа не позволяло определить существование email
+			passwords.Default().VerifyDummy(dto.Password)
+			return login.LoginResponse{}, ErrInvalidCredentials
+		}
+		log.Error("Ошибка поиска пользователя в БД", "err", err)
+		return login.LoginResponse{}, err
+	}
+
+	ok, needsRehash := users.VerifyPassword(user.PasswordHash, dto.Password, log)
+	if !ok {
+		return login.LoginResponse{}, ErrInvalidCredentials
+	}
+	// Статус проверяется после пароля, что б он не раскрывался без знания пароля
+	switch user.Status {
+	case users_db.UserStatusDeleted:
+		log.Debug("Deleted user tried to log in", "user_id", user.ID)
+		return login.LoginResponse{}, ErrInvalidCredentials
+	case users_db.UserStatusDeactivated:
+		log.Debug("Deactivated user tried to log in", "user_id", user.ID)
+		return login.LoginResponse{}, ErrUserDeactivated
+	}
+	if needsRehash {
+		rehashPassword(log, userRepository, ctx, user.ID, dto.Password)
+	}
+
+	return completeLogin(log, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, ctx, user, client, settings, mfaSettings)
+}
+
+// completeLogin завершает вход пользователя, личность которого уже подтверждена (паролем или через SSO)
+//
+// Если у пользователя подключена 2FA, возвращается токен второго шага, если 2FA обязательна для роли,
+// но не подключена - токен только для её подключения, иначе начинается новая сессия
+func completeLogin(log *slog.Logger, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, ctx context.Context, user users_db.UserInfo, client sessions_db.ClientInfo, settings jwt_tokens.TokenSettings, mfaSettings totp.Settings) (login.LoginResponse, error) {
+	totpInfo, err := mfaRepository.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, mfa_db.ErrTOTPNotFound) {
+		log.Error("Failed to get totp secret", "err", err)
+		return login.LoginResponse{}, err
+	}
+	if err == nil && totpInfo.Confirmed() {
+		return startMFAChallenge(log, mfaRepository, ctx, user.ID, mfaSettings)
+	}
+	if mfaSettings.Required(user.Role) {
+		log.Info("User must enroll 2FA, issuing restricted access token", "user_id", user.ID, "role", user.Role)
+		return issueEnrollmentToken(log, user, settings)
+	}
+
+	log.Debug("User logged in", "user_id", user.ID)
+	return startSession(log, refreshTokenRepository, sessionRepository, permissionRepository, ctx, user, client, settings)
+}
+
+// CompleteMFALogin второй шаг входа: проверяет токен второго шага и код 2FA и выдаёт токены
+//
+// Попытки ввода кода учитываются guard так же, как неудачные попытки входа по паролю,
+// кроме того, на один токен второго шага даётся не больше mfaSettings.MaxAttempts попыток
+func CompleteMFALogin(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, guard *login_guard.Guard, ctx context.Context, dto mfa.LoginRequest, client sessions_db.ClientInfo, settings jwt_tokens.TokenSettings, mfaSettings totp.Settings) (login.LoginResponse, error) {
+	const op = "user_service/internal/lib/services/auth_service/auth_service.go/CompleteMFALogin"
+	log = log.With(slog.String("op", op))
+
+	challenge, err := mfaRepository.GetChallenge(ctx, secure_tokens.Hash(dto.MFAToken))
+	if err != nil {
+		if errors.Is(err, mfa_db.ErrChallengeInvalid) {
+			return login.LoginResponse{}, ErrInvalidMFAToken
+		}
+		log.Error("Failed to get mfa challenge", "err", err)
+		return login.LoginResponse{}, err
+	}
+	log = log.With(slog.Int64("user_id", challenge.UserID))
+
+	user, err := userRepository.GetUser(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			return login.LoginResponse{}, ErrInvalidMFAToken
+		}
+		log.Error("Ошибка поиска пользователя в БД", "err", err)
+		return login.LoginResponse{}, err
+	}
+	if user.Status == users_db.UserStatusDeactivated || user.Status == users_db.UserStatusDeleted {
+		log.Debug("User is not active", "status", user.Status)
+		return login.LoginResponse{}, ErrInvalidMFAToken
+	}
+	if err = guard.Check(ctx, user.Email, client.IP); err != nil {
+		return login.LoginResponse{}, err
+	}
+
+	attempts, err := mfaRepository.RegisterChallengeAttempt(ctx, challenge.ID)
+	if err != nil {
+		if errors.Is(err, mfa_db.ErrChallengeInvalid) {
+			return login.LoginResponse{}, ErrInvalidMFAToken
+		}
+		log.Error("Failed to register mfa challenge attempt", "err", err)
+		return login.LoginResponse{}, err
+	}
+	if mfaSettings.MaxAttempts > 0 && attempts > mfaSettings.MaxAttempts {
+		log.Warn("Too many mfa attempts for challenge")
+		return login.LoginResponse{}, ErrInvalidMFAToken
+	}
+
+	err = mfa_service.VerifyCode(log, mfaRepository, ctx, user.ID, dto.Code, time.Now())
+	if err != nil {
+		if errors.Is(err, mfa_service.ErrInvalidCode) {
+			if guardErr := guard.RegisterFailure(ctx, user.Email, client.IP); guardErr != nil {
+				log.Error("Failed to register failed mfa attempt", "err", guardErr)
+			}
+		}
+		return login.LoginResponse{}, err
+	}
+	if err = mfaRepository.ConsumeChallenge(ctx, challenge.ID); err != nil {
+		if errors.Is(err, mfa_db.ErrChallengeInvalid) {
+			return login.LoginResponse{}, ErrInvalidMFAToken
+		}
+		log.Error("Failed to consume mfa challenge", "err", err)
+		return login.LoginResponse{}, err
+	}
+	if err = guard.RegisterSuccess(ctx, user.Email); err != nil {
+		log.Error("Failed to reset failed logins", "err", err)
+	}
+
+	log.Debug("User logged in with second factor")
+	return startSession(log, refreshTokenRepository, sessionRepository, permissionRepository, ctx, user, client, settings)
+}
+
+// startSession начинает новое семейство refresh токенов и сессию для него и выдаёт пару токенов
+func startSession(log *slog.Logger, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, ctx context.Context, user users_db.UserInfo, client sessions_db.ClientInfo, settings jwt_tokens.TokenSettings) (login.LoginResponse, error) {
+	familyId, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate refresh token family", "err", err)
+		return login.LoginResponse{}, err
+	}
+	refreshToken, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate refresh token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	sessionId, err := sessionRepository.TouchSession(ctx, user.ID, familyId, client)
+	if err != nil {
+		log.Error("Failed to save session", "err", err)
+		return login.LoginResponse{}, err
+	}
+	err = refreshTokenRepository.CreateRefreshToken(ctx, user.ID, familyId, secure_tokens.Hash(refreshToken), time.Now().Add(settings.RefreshTokenTTL))
+	if err != nil {
+		log.Error("Failed to save refresh token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	return issueTokens(log, permissionRepository, ctx, user, sessionId, refreshToken, settings)
+}
+
+// startMFAChallenge создаёт токен второго шага входа
+func startMFAChallenge(log *slog.Logger, mfaRepository mfa_db.MFARepository, ctx context.Context, userId int64, mfaSettings totp.Settings) (login.LoginResponse, error) {
+	mfaToken, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate mfa token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	err = mfaRepository.CreateChallenge(ctx, userId, secure_tokens.Hash(mfaToken), time.Now().Add(mfaSettings.ChallengeTTL))
+	if err != nil {
+		log.Error("Failed to save mfa challenge", "err", err)
+		return login.LoginResponse{}, err
+	}
+	log.Debug("Password accepted, waiting for second factor", "user_id", userId)
+	return login.LoginResponse{
+		Response:    resp.OK(),
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}, nil
+}
+
+// issueEnrollmentToken выдаёт токен доступа без разрешений и без refresh токена
+//
+// С ним доступны только маршруты без разрешений (профиль и подключение 2FA). После подключения 2FA нужно войти заново
+func issueEnrollmentToken(log *slog.Logger, user users_db.UserInfo, settings jwt_tokens.TokenSettings) (login.LoginResponse, error) {
+	accessToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{
+		UserID:        user.ID,
+		Role:          user.Role,
+		Permissions:   []string{},
+		EmailVerified: user.EmailVerified,
+		TenantID:      user.TenantID,
+	}, settings.Keys, settings.AccessTokenTTL)
+	if err != nil {
+		log.Error("Failed to create access token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	return login.LoginResponse{
+		Response:              resp.OK(),
+		AccessToken:           accessToken,
+		TokenType:             tokenTypeBearer,
+		ExpiresIn:             int64(settings.AccessTokenTTL.Seconds()),
+		MFAEnrollmentRequired: true,
+	}, nil
+}
+
+// RefreshTokens обменивает refresh токен на новую пару токенов (ротация)
+//
+// Использованный refresh токен становится недействительным. Если уже использованный токен предъявлен повторно,
+// значит он мог быть украден, поэтому отзывается всё семейство токенов и пользователь должен войти заново.
+// Ротация обновляет last_seen_at, user agent и IP сессии семейства
+func RefreshTokens(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, ctx context.Context, refreshToken string, client sessions_db.ClientInfo, settings jwt_tokens.TokenSettings) (login.LoginResponse, error) {
+	const op = "user_service/internal/lib/services/auth_service/auth_service.go/RefreshTokens"
+	log = log.With(slog.String("op", op))
+
+	tokenInfo, err := refreshTokenRepository.GetRefreshToken(ctx, secure_tokens.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, refresh_tokens_db.ErrRefreshTokenNotFound) {
+			log.Debug("Refresh token not found")
+			return login.LoginResponse{}, ErrInvalidRefreshToken
+		}
+		log.Error("Failed to get refresh token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	log = log.With(slog.Int64("user_id", tokenInfo.UserID), slog.String("family_id", tokenInfo.FamilyID))
+
+	if tokenInfo.RevokedAt != nil {
+		log.Debug("Refresh token is revoked")
+		return login.LoginResponse{}, ErrInvalidRefreshToken
+	}
+	if tokenInfo.UsedAt != nil {
+		return login.LoginResponse{}, revokeReusedFamily(log, refreshTokenRepository, ctx, tokenInfo.FamilyID)
+	}
+	if time.Now().After(tokenInfo.ExpiresAt) {
+		log.Debug("Refresh token is expired")
+		return login.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	user, err := userRepository.GetUser(ctx, tokenInfo.UserID)
+	if err != nil {
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			return login.LoginResponse{}, ErrInvalidRefreshToken
+		}
+		log.Error("Ошибка поиска пользователя в БД", "err", err)
+		return login.LoginResponse{}, err
+	}
+	if user.Status == users_db.UserStatusDeactivated || user.Status == users_db.UserStatusDeleted {
+		log.Debug("User is not active", "status", user.Status)
+		return login.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	sessionId, err := sessionRepository.TouchSession(ctx, user.ID, tokenInfo.FamilyID, client)
+	if err != nil {
+		if errors.Is(err, sessions_db.ErrSessionTerminated) {
+			log.Debug("Session of refresh token is terminated")
+			return login.LoginResponse{}, ErrInvalidRefreshToken
+		}
+		log.Error("Failed to update session", "err", err)
+		return login.LoginResponse{}, err
+	}
+
+	newRefreshToken, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate refresh token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	err = refreshTokenRepository.RotateRefreshToken(ctx, tokenInfo.ID, secure_tokens.Hash(newRefreshToken), time.Now().Add(settings.RefreshTokenTTL))
+	if err != nil {
+		if errors.Is(err, refresh_tokens_db.ErrRefreshTokenAlreadyUsed) {
+			// Токен успели использовать между чтением и ротацией
+			return login.LoginResponse{}, revokeReusedFamily(log, refreshTokenRepository, ctx, tokenInfo.FamilyID)
+		}
+		log.Error("Failed to rotate refresh token", "err", err)
+		return login.LoginResponse{}, err
+	}
+
+	log.Debug("Refresh token rotated")
+	return issueTokens(log, permissionRepository, ctx, user, sessionId, newRefreshToken, settings)
+}
+
+// rehashPassword перехеширует пароль текущими параметрами
+//
+// Ошибка только логируется: вход не должен завершаться неудачей из-за того, что хеш не удалось обновить
+func rehashPassword(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, userId int64, password string) {
+	passwordHash, err := users.HashUserPassword(password, log)
+	if err != nil {
+		return
+	}
+	if err = userRepository.UpdatePassword(ctx, userId, passwordHash); err != nil {
+		log.Error("Failed to update rehashed password", "err", err, "user_id", userId)
+		return
+	}
+	log.Info("Password rehashed with current parameters", "user_id", userId)
+}
+
+func revokeReusedFamily(log *slog.Logger, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, familyId string) error {
+	log.Warn("Refresh token reuse detected, revoking token family")
+	if err := refreshTokenRepository.RevokeFamily(ctx, familyId); err != nil {
+		log.Error("Failed to revoke refresh token family", "err", err)
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issueTokens выдаёт токен доступа с разрешениями роли пользователя
+//
+// Разрешения читаются из БД при каждой выдаче токена, поэтому изменение роли вступает в силу не позже истечения токена доступа
+func issueTokens(log *slog.Logger, permissionRepository permissions_db.PermissionRepository, ctx context.Context, user users_db.UserInfo, sessionId int64, refreshToken string, settings jwt_tokens.TokenSettings) (login.LoginResponse, error) {
+	permissions, err := permissionRepository.GetRolePermissions(ctx, user.Role)
+	if err != nil {
+		log.Error("Failed to get role permissions", "err", err, "role", user.Role)
+		return login.LoginResponse{}, err
+	}
+	accessToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{
+		UserID:        user.ID,
+		Role:          user.Role,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerified,
+		TenantID:      user.TenantID,
+		SessionID:     sessionId,
+	}, settings.Keys, settings.AccessTokenTTL)
+	if err != nil {
+		log.Error("Failed to create access token", "err", err)
+		return login.LoginResponse{}, err
+	}
+	return login.LoginResponse{
+		Response:     resp.OK(),
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int64(settings.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Logout отзывает токен доступа: его jti попадает в denylist до истечения exp токена
+//
+// Если передан refresh токен того же пользователя, отзывается и его семейство, что б сессию нельзя было продлить
+func Logout(log *slog.Logger, denylist token_denylist.TokenDenylist, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, principal auth.Principal, refreshToken string) error {
+	const op = "user_service/internal/lib/services/auth_service/auth_service.go/Logout"
+	log = log.With(slog.String("op", op))
+
+	if principal.TokenID == "" || principal.ExpiresAt.IsZero() {
+		return ErrInvalidAccessToken
+	}
+	if err := denylist.Add(ctx, principal.TokenID, principal.ExpiresAt); err != nil {
+		log.Error("Failed to add token to denylist", "err", err)
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	tokenInfo, err := refreshTokenRepository.GetRefreshToken(ctx, secure_tokens.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, refresh_tokens_db.ErrRefreshTokenNotFound) {
+			log.Debug("Refresh token for logout not found")
+			return nil
+		}
+		log.Error("Failed to get refresh token", "err", err)
+		return err
+	}
+	if principal.UserID != tokenInfo.UserID {
+		log.Warn("Refresh token belongs to another user, skipping revocation")
+		return nil
+	}
+	if err = refreshTokenRepository.RevokeFamily(ctx, tokenInfo.FamilyID); err != nil {
+		log.Error("Failed to revoke refresh token family", "err", err)
+		return err
+	}
+	return nil
+}
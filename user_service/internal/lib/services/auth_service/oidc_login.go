@@ -0,0 +1,193 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/identities_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"strings"
+)
+
+var ErrSSOEmailMissing = errors.New("Провайдер SSO не передал email пользователя")
+var ErrSSOEmailNotVerified = errors.New("Email не подтверждён провайдером SSO, привязать учётную запись нельзя")
+var ErrSSOProvisioningDisabled = errors.New("Пользователь не найден, а автоматическое создание учётных записей отключено")
+var ErrSSOAccountConflict = errors.New("Учётная запись с этим email уже привязана к другому пользователю SSO")
+
+// LoginOIDC входит пользователем, личность которого подтвердил провайдер OpenID Connect
+//
+// Пользователь ищется по привязанной учётной записи (issuer + sub). Если привязки нет, учётная запись
+// привязывается к пользователю с тем же email (только если провайдер подтвердил email),
+// а если такого пользователя нет - он создаётся со случайным паролем (если включено AutoProvision).
+// Если группы пользователя сопоставлены локальной роли, роль синхронизируется при каждом входе.
+// Дальше вход проходит так же, как по паролю, включая 2FA
+func LoginOIDC(log *slog.Logger, userRepository users_db.UserRepository, identityRepository identities_db.IdentityRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, auditRepository audit_db.AuditRepository, ctx context.Context, claims oidc.Claims, client sessions_db.ClientInfo, oidcSettings oidc.Settings, settings jwt_tokens.TokenSettings, mfaSettings totp.Settings) (login.LoginResponse, error) {
+	const op = "user_service/internal/lib/services/auth_service/oidc_login.go/LoginOIDC"
+	log = log.With(slog.String("op", op), slog.String("subject", claims.Subject))
+
+	user, err := findOrProvisionUser(log, userRepository, identityRepository, permissionRepository, auditRepository, ctx, claims, oidcSettings)
+	if err != nil {
+		return login.LoginResponse{}, err
+	}
+	switch user.Status {
+	case users_db.UserStatusDeleted, users_db.UserStatusDeactivated:
+		log.Debug("Inactive user tried to log in with sso", "user_id", user.ID, "status", user.Status)
+		return login.LoginResponse{}, ErrUserDeactivated
+	}
+
+	user, err = syncRole(log, userRepository, permissionRepository, auditRepository, ctx, user, claims.Groups, oidcSettings)
+	if err != nil {
+		return login.LoginResponse{}, err
+	}
+	return completeLogin(log, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, ctx, user, client, settings, mfaSettings)
+}
+
+func findOrProvisionUser(log *slog.Logger, userRepository users_db.UserRepository, identityRepository identities_db.IdentityRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, ctx context.Context, claims oidc.Claims, oidcSettings oidc.Settings) (users_db.UserInfo, error) {
+	userId, err := identityRepository.GetUserIDByIdentity(ctx, oidcSettings.Issuer, claims.Subject)
+	if err == nil {
+		user, err := userRepository.GetUser(ctx, userId)
+		if err != nil {
+			log.Error("Failed to get linked user", "err", err, "user_id", userId)
+		}
+		return user, err
+	}
+	if !errors.Is(err, identities_db.ErrIdentityNotFound) {
+		log.Error("Failed to get user identity", "err", err)
+		return users_db.UserInfo{}, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return users_db.UserInfo{}, ErrSSOEmailMissing
+	}
+	// Без подтверждения email провайдером кто угодно мог бы указать у себя чужой адрес и получить доступ к его учётной записи
+	if !claims.EmailVerified {
+		return users_db.UserInfo{}, ErrSSOEmailNotVerified
+	}
+
+	user, err := userRepository.GetUserByEmail(ctx, email)
+	if err == nil {
+		if err = identityRepository.LinkIdentity(ctx, user.ID, oidcSettings.Issuer, claims.Subject); err != nil {
+			if errors.Is(err, identities_db.ErrIdentityAlreadyLinked) {
+				return users_db.UserInfo{}, ErrSSOAccountConflict
+			}
+			log.Error("Failed to link user identity", "err", err)
+			return users_db.UserInfo{}, err
+		}
+		log.Info("SSO identity linked to existing user", "user_id", user.ID)
+		recordSSOEvent(log, auditRepository, ctx, audit_db.ActionIdentityLinked, user.ID, map[string]any{"issuer": oidcSettings.Issuer})
+		return user, nil
+	}
+	if !errors.Is(err, users_db.ErrUserNotFound) {
+		log.Error("Ошибка поиска пользователя в БД", "err", err)
+		return users_db.UserInfo{}, err
+	}
+
+	if !oidcSettings.AutoProvision {
+		return users_db.UserInfo{}, ErrSSOProvisioningDisabled
+	}
+	return provisionUser(log, userRepository, identityRepository, permissionRepository, auditRepository, ctx, email, claims, oidcSettings)
+}
+
+// provisionUser создаёт пользователя по данным провайдера. Пароль случайный, задать свой можно через сброс пароля
+func provisionUser(log *slog.Logger, userRepository users_db.UserRepository, identityRepository identities_db.IdentityRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, ctx context.Context, email string, claims oidc.Claims, oidcSettings oidc.Settings) (users_db.UserInfo, error) {
+	role := oidcSettings.DefaultRole
+	if mapped, ok := oidcSettings.MapRole(claims.Groups); ok && knownRole(log, permissionRepository, ctx, mapped) {
+		role = mapped
+	}
+
+	password, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate password", "err", err)
+		return users_db.UserInfo{}, err
+	}
+	passwordHash, err := users.HashUserPassword(password, log)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	firstName := claims.GivenName
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(email, "@")
+	}
+	userinfo := create_user.UserCreate{
+		FirstName: firstName,
+		LastName:  claims.FamilyName,
+		Email:     email,
+		Password:  passwordHash,
+		Phone:     claims.PhoneNumber,
+	}
+
+	id, err := identityRepository.ProvisionUser(ctx, &userinfo, role, claims.EmailVerified, oidcSettings.Issuer, claims.Subject)
+	if err != nil {
+		if errors.Is(err, identities_db.ErrIdentityAlreadyLinked) || errors.Is(err, users_db.ErrEmailAlreadyExists) {
+			// Параллельный вход того же пользователя успел создать учётную запись
+			return users_db.UserInfo{}, ErrSSOAccountConflict
+		}
+		log.Error("Failed to provision user", "err", err)
+		return users_db.UserInfo{}, err
+	}
+	log.Info("User provisioned from sso", "user_id", id, "role", role)
+	recordSSOEvent(log, auditRepository, ctx, audit_db.ActionUserProvisioned, id, map[string]any{"issuer": oidcSettings.Issuer, "role": role})
+
+	user, err := userRepository.GetUser(ctx, id)
+	if err != nil {
+		log.Error("Failed to get provisioned user", "err", err, "user_id", id)
+	}
+	return user, err
+}
+
+// syncRole приводит роль пользователя к роли, сопоставленной его группам у провайдера.
+// Если ни одна группа не сопоставлена, роль не меняется, что б не сбрасывать роли, выданные локально
+func syncRole(log *slog.Logger, userRepository users_db.UserRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, ctx context.Context, user users_db.UserInfo, groups []string, oidcSettings oidc.Settings) (users_db.UserInfo, error) {
+	role, ok := oidcSettings.MapRole(groups)
+	if !ok || role == user.Role || !knownRole(log, permissionRepository, ctx, role) {
+		return user, nil
+	}
+	if err := userRepository.UpdateRole(ctx, user.ID, role); err != nil {
+		log.Error("Failed to sync user role from sso groups", "err", err, "user_id", user.ID)
+		return users_db.UserInfo{}, err
+	}
+	log.Info("User role synced from sso groups", "user_id", user.ID, "previous_role", user.Role, "role", role)
+	recordSSOEvent(log, auditRepository, ctx, audit_db.ActionUserRoleChanged, user.ID, map[string]any{"role": role, "previous_role": user.Role, "source": "oidc"})
+	user.Role = role
+	return user, nil
+}
+
+// knownRole проверяет, что роль из маппинга существует. Ошибка в настройках не должна выдавать роль без разрешений
+func knownRole(log *slog.Logger, permissionRepository permissions_db.PermissionRepository, ctx context.Context, role string) bool {
+	permissions, err := permissionRepository.GetRolePermissions(ctx, role)
+	if err != nil {
+		log.Error("Failed to get role permissions", "err", err, "role", role)
+		return false
+	}
+	if len(permissions) == 0 {
+		log.Warn("OIDC role mapping points to unknown role, ignoring", "role", role)
+		return false
+	}
+	return true
+}
+
+// recordSSOEvent пишет в журнал аудита изменения, сделанные при входе через SSO. Действие выполняет сама система, ActorID не заполняется
+func recordSSOEvent(log *slog.Logger, auditRepository audit_db.AuditRepository, ctx context.Context, action string, userId int64, details map[string]any) {
+	err := auditRepository.Record(ctx, audit_db.Entry{
+		Action:     action,
+		TargetType: audit_db.TargetUser,
+		TargetID:   userId,
+		Details:    details,
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", action)
+	}
+}
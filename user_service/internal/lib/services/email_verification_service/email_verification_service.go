@@ -0,0 +1,115 @@
+package email_verification_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"time"
+)
+
+var ErrInvalidVerificationToken = errors.New("Токен подтверждения email недействителен или истёк")
+var ErrEmailAlreadyVerified = errors.New("Email уже подтверждён")
+var ErrResendTooSoon = errors.New("Письмо с подтверждением уже отправлено недавно, попробуйте позже")
+
+// VerificationSettings Настройки подтверждения email
+//
+// VerifyURL - адрес подтверждения, к которому добавляется токен (например https://booker.example/verify-email?token=)
+// ResendInterval - минимальный интервал между выдачей токенов одному пользователю при повторной отправке
+type VerificationSettings struct {
+	TokenTTL       time.Duration
+	VerifyURL      string
+	ResendInterval time.Duration
+}
+
+// SendVerification создаёт одноразовый токен подтверждения email и отправляет ссылку пользователю
+func SendVerification(log *slog.Logger, verificationRepository email_verification_db.EmailVerificationRepository, mail mailer.Mailer, ctx context.Context, userId int64, email string, settings VerificationSettings) error {
+	const op = "user_service/internal/lib/services/email_verification_service/email_verification_service.go/SendVerification"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	token, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate email verification token", "err", err)
+		return err
+	}
+	err = verificationRepository.CreateVerificationToken(ctx, userId, secure_tokens.Hash(token), time.Now().Add(settings.TokenTTL))
+	if err != nil {
+		log.Error("Failed to save email verification token", "err", err)
+		return err
+	}
+
+	return sendVerificationMail(log, mail, ctx, email, token, settings)
+}
+
+// ResendVerification выдаёт пользователю новый токен подтверждения email взамен прежних и отправляет ссылку повторно
+//
+// Нужна, если письмо при регистрации не дошло или ссылка истекла. Прежние неиспользованные токены перестают действовать.
+// Чаще, чем раз в settings.ResendInterval, новый токен не выдаётся
+func ResendVerification(log *slog.Logger, userRepository users_db.UserRepository, verificationRepository email_verification_db.EmailVerificationRepository, mail mailer.Mailer, ctx context.Context, userId int64, settings VerificationSettings) error {
+	const op = "user_service/internal/lib/services/email_verification_service/email_verification_service.go/ResendVerification"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	user, err := userRepository.GetUser(ctx, userId)
+	if err != nil {
+		log.Error("Failed to get user", "err", err)
+		return err
+	}
+	if user.EmailVerified {
+		log.Debug("Email is already verified")
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate email verification token", "err", err)
+		return err
+	}
+	err = verificationRepository.ReplaceVerificationToken(ctx, userId, secure_tokens.Hash(token), time.Now().Add(settings.TokenTTL), settings.ResendInterval)
+	if err != nil {
+		if errors.Is(err, email_verification_db.ErrVerificationResendTooSoon) {
+			log.Debug("Email verification token was issued recently")
+			return ErrResendTooSoon
+		}
+		log.Error("Failed to replace email verification token", "err", err)
+		return err
+	}
+
+	return sendVerificationMail(log, mail, ctx, user.Email, token, settings)
+}
+
+func sendVerificationMail(log *slog.Logger, mail mailer.Mailer, ctx context.Context, email string, token string, settings VerificationSettings) error {
+	message := mailer.Message{
+		To:      email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf("Для подтверждения email перейдите по ссылке: %s%s\nСсылка действительна %s.",
+			settings.VerifyURL, token, settings.TokenTTL),
+	}
+	if err := mail.Send(ctx, message); err != nil {
+		log.Error("Failed to send email verification mail", "err", err)
+		return err
+	}
+	log.Debug("Email verification mail sent")
+	return nil
+}
+
+// VerifyEmail подтверждает email пользователя по токену из письма. Токен одноразовый
+func VerifyEmail(log *slog.Logger, verificationRepository email_verification_db.EmailVerificationRepository, ctx context.Context, token string) error {
+	const op = "user_service/internal/lib/services/email_verification_service/email_verification_service.go/VerifyEmail"
+	log = log.With(slog.String("op", op))
+
+	userId, err := verificationRepository.VerifyEmail(ctx, secure_tokens.Hash(token))
+	if err != nil {
+		if errors.Is(err, email_verification_db.ErrVerificationTokenInvalid) {
+			log.Debug("Email verification token is invalid")
+			return ErrInvalidVerificationToken
+		}
+		log.Error("Failed to verify email", "err", err)
+		return err
+	}
+	log.Info("Email verified", "user_id", userId)
+	return nil
+}
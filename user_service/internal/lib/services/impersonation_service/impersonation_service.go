@@ -0,0 +1,96 @@
+package impersonation_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/authorization"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/impersonation"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+const tokenTypeBearer = "Bearer"
+
+var ErrSelfImpersonation = errors.New("Нельзя войти от имени самого себя")
+var ErrNestedImpersonation = errors.New("Нельзя начать имперсонацию из-под имперсонации")
+var ErrTargetInactive = errors.New("Нельзя войти от имени неактивного пользователя")
+var ErrTargetPrivileged = errors.New("Нельзя войти от имени пользователя, которому доступна имперсонация")
+
+// Start выдаёт администратору короткоживущий токен доступа от имени пользователя targetID
+//
+// В токене sub - пользователь, act.sub - администратор, разрешения берутся из роли пользователя.
+// Токен привязывается к сессии администратора: при её завершении токен имперсонации тоже перестаёт действовать.
+// Войти от имени другого администратора (роль с разрешением user:impersonate) нельзя
+func Start(log *slog.Logger, userRepository users_db.UserRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, ctx context.Context, principal auth.Principal, targetID int64, settings jwt_tokens.TokenSettings, ttl time.Duration, now time.Time) (impersonation.ImpersonationResponse, error) {
+	const op = "user_service/internal/lib/services/impersonation_service/impersonation_service.go/Start"
+	log = log.With(slog.String("op", op), slog.Int64("actor_id", principal.UserID), slog.Int64("user_id", targetID))
+
+	if principal.Impersonated() {
+		return impersonation.ImpersonationResponse{}, ErrNestedImpersonation
+	}
+	if principal.UserID == targetID {
+		return impersonation.ImpersonationResponse{}, ErrSelfImpersonation
+	}
+	user, err := userRepository.GetUser(ctx, targetID)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return impersonation.ImpersonationResponse{}, err
+	}
+	if user.Status != "" && user.Status != users_db.UserStatusActive {
+		return impersonation.ImpersonationResponse{}, ErrTargetInactive
+	}
+	permissions, err := permissionRepository.GetRolePermissions(ctx, user.Role)
+	if err != nil {
+		log.Error("Failed to get role permissions", "err", err, "role", user.Role)
+		return impersonation.ImpersonationResponse{}, err
+	}
+	if slices.Contains(permissions, authorization.PermissionUserImpersonate) {
+		return impersonation.ImpersonationResponse{}, ErrTargetPrivileged
+	}
+
+	accessToken, err := jwt_tokens.CreateToken(jwt_tokens.AccessClaims{
+		UserID:        user.ID,
+		Role:          user.Role,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerified,
+		TenantID:      user.TenantID,
+		SessionID:     principal.SessionID,
+		ActorID:       principal.UserID,
+	}, settings.Keys, ttl)
+	if err != nil {
+		log.Error("Failed to create access token", "err", err)
+		return impersonation.ImpersonationResponse{}, err
+	}
+	expiresAt := now.Add(ttl)
+	log.Info("Impersonation started", "expires_at", expiresAt)
+
+	// Ошибка записи в журнал аудита не отменяет выдачу токена, только логируется
+	err = auditRepository.Record(ctx, audit_db.Entry{
+		ActorID:    principal.UserID,
+		Action:     audit_db.ActionImpersonationStarted,
+		TargetType: audit_db.TargetUser,
+		TargetID:   user.ID,
+		Details:    map[string]any{"role": user.Role, "expires_at": expiresAt},
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionImpersonationStarted)
+	}
+	return impersonation.ImpersonationResponse{
+		Response:           resp.OK(),
+		AccessToken:        accessToken,
+		TokenType:          tokenTypeBearer,
+		ExpiresIn:          int64(ttl.Seconds()),
+		ExpiresAt:          expiresAt,
+		ImpersonatedUserID: user.ID,
+		ActorID:            principal.UserID,
+	}, nil
+}
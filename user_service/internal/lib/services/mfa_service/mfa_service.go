@@ -0,0 +1,176 @@
+package mfa_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/mfa"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"time"
+)
+
+var ErrMFAAlreadyEnabled = errors.New("Двухфакторная аутентификация уже подключена")
+var ErrMFANotEnrolled = errors.New("Двухфакторная аутентификация не подключена")
+var ErrInvalidCode = errors.New("Неверный код подтверждения")
+var ErrMFARequiredByPolicy = errors.New("Для вашей роли двухфакторная аутентификация обязательна")
+var ErrWrongPassword = errors.New("Пароль указан неверно")
+
+// Enroll начинает подключение 2FA: генерирует новый секрет и otpauth URI для приложения-аутентификатора
+//
+// Пока подключение не подтверждено кодом (Confirm), вход работает без второго фактора и повторный вызов заменяет секрет
+func Enroll(log *slog.Logger, userRepository users_db.UserRepository, mfaRepository mfa_db.MFARepository, ctx context.Context, userId int64, settings totp.Settings) (mfa.EnrollResponse, error) {
+	const op = "user_service/internal/lib/services/mfa_service/mfa_service.go/Enroll"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	user, err := userRepository.GetUser(ctx, userId)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return mfa.EnrollResponse{}, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error("Failed to generate totp secret", "err", err)
+		return mfa.EnrollResponse{}, err
+	}
+	if err = mfaRepository.SaveTOTPSecret(ctx, userId, secret); err != nil {
+		if errors.Is(err, mfa_db.ErrTOTPAlreadyConfirmed) {
+			return mfa.EnrollResponse{}, ErrMFAAlreadyEnabled
+		}
+		log.Error("Failed to save totp secret", "err", err)
+		return mfa.EnrollResponse{}, err
+	}
+	log.Info("TOTP enrollment started")
+	return mfa.EnrollResponse{
+		Response:   resp.OK(),
+		Secret:     secret,
+		OTPAuthURI: totp.URI(settings.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm подтверждает подключение 2FA кодом из приложения и выдаёт резервные коды
+//
+// Резервные коды хранятся только в виде хешей, поэтому показываются пользователю один раз
+func Confirm(log *slog.Logger, mfaRepository mfa_db.MFARepository, ctx context.Context, userId int64, code string, now time.Time) (mfa.ConfirmResponse, error) {
+	const op = "user_service/internal/lib/services/mfa_service/mfa_service.go/Confirm"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	info, err := mfaRepository.GetTOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, mfa_db.ErrTOTPNotFound) {
+			return mfa.ConfirmResponse{}, ErrMFANotEnrolled
+		}
+		log.Error("Failed to get totp secret", "err", err)
+		return mfa.ConfirmResponse{}, err
+	}
+	if info.Confirmed() {
+		return mfa.ConfirmResponse{}, ErrMFAAlreadyEnabled
+	}
+	step, ok := totp.Validate(info.Secret, code, now)
+	if !ok {
+		return mfa.ConfirmResponse{}, ErrInvalidCode
+	}
+
+	backupCodes, err := totp.GenerateBackupCodes(totp.BackupCodesCount)
+	if err != nil {
+		log.Error("Failed to generate backup codes", "err", err)
+		return mfa.ConfirmResponse{}, err
+	}
+	hashes := make([]string, 0, len(backupCodes))
+	for _, backupCode := range backupCodes {
+		hashes = append(hashes, secure_tokens.Hash(backupCode))
+	}
+	if err = mfaRepository.ConfirmTOTP(ctx, userId, step, hashes); err != nil {
+		if errors.Is(err, mfa_db.ErrTOTPAlreadyConfirmed) {
+			return mfa.ConfirmResponse{}, ErrMFAAlreadyEnabled
+		}
+		log.Error("Failed to confirm totp", "err", err)
+		return mfa.ConfirmResponse{}, err
+	}
+	log.Info("TOTP enrollment confirmed")
+	return mfa.ConfirmResponse{Response: resp.OK(), BackupCodes: backupCodes}, nil
+}
+
+// Disable отключает 2FA после проверки пароля
+//
+// Если 2FA обязательна для роли пользователя, отключить её нельзя
+func Disable(log *slog.Logger, userRepository users_db.UserRepository, mfaRepository mfa_db.MFARepository, ctx context.Context, principal auth.Principal, password string, settings totp.Settings) error {
+	const op = "user_service/internal/lib/services/mfa_service/mfa_service.go/Disable"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", principal.UserID))
+
+	user, err := userRepository.GetUser(ctx, principal.UserID)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return err
+	}
+	if !users.ComparePassword(user.PasswordHash, password, log) {
+		return ErrWrongPassword
+	}
+	if settings.Required(user.Role) {
+		return ErrMFARequiredByPolicy
+	}
+	if err = mfaRepository.DeleteTOTP(ctx, user.ID); err != nil {
+		if errors.Is(err, mfa_db.ErrTOTPNotFound) {
+			return ErrMFANotEnrolled
+		}
+		log.Error("Failed to delete totp", "err", err)
+		return err
+	}
+	log.Info("TOTP disabled")
+	return nil
+}
+
+// VerifyCode проверяет второй фактор при входе: код из приложения или резервный код
+//
+// Каждый код можно использовать только один раз. Возвращает ErrInvalidCode, если код не подошёл
+func VerifyCode(log *slog.Logger, mfaRepository mfa_db.MFARepository, ctx context.Context, userId int64, code string, now time.Time) error {
+	const op = "user_service/internal/lib/services/mfa_service/mfa_service.go/VerifyCode"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	if totp.IsBackupCode(code) {
+		err := mfaRepository.UseBackupCode(ctx, userId, secure_tokens.Hash(totp.NormalizeBackupCode(code)))
+		if err != nil {
+			if errors.Is(err, mfa_db.ErrBackupCodeInvalid) {
+				return ErrInvalidCode
+			}
+			log.Error("Failed to use backup code", "err", err)
+			return err
+		}
+		log.Info("Backup code used")
+		return nil
+	}
+
+	info, err := mfaRepository.GetTOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, mfa_db.ErrTOTPNotFound) {
+			return ErrInvalidCode
+		}
+		log.Error("Failed to get totp secret", "err", err)
+		return err
+	}
+	if !info.Confirmed() {
+		return ErrInvalidCode
+	}
+	step, ok := totp.Validate(info.Secret, code, now)
+	if !ok {
+		return ErrInvalidCode
+	}
+	if err = mfaRepository.UseTOTPStep(ctx, userId, step); err != nil {
+		if errors.Is(err, mfa_db.ErrTOTPStepUsed) {
+			log.Warn("TOTP code reuse attempt")
+			return ErrInvalidCode
+		}
+		log.Error("Failed to update totp step", "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package organization_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/organizations"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
+	"log/slog"
+)
+
+var ErrNotSystemAdmin = errors.New("Создавать организации могут только администраторы организации по умолчанию")
+
+// Create создаёт организацию
+//
+// Разрешение organization:manage есть у роли admin в любой организации, поэтому дополнительно проверяется,
+// что пользователь запроса из организации по умолчанию - администраторы остальных организаций управляют только своей
+func Create(log *slog.Logger, organizationRepository organizations_db.OrganizationRepository, auditRepository audit_db.AuditRepository, ctx context.Context, principal auth.Principal, request organizations.CreateOrganizationRequest) (organizations.CreateOrganizationResponse, error) {
+	const op = "user_service/internal/lib/services/organization_service/organization_service.go/Create"
+	log = log.With(slog.String("op", op))
+
+	if tenantId, _ := tenant.FromContext(ctx); tenantId != tenant.DefaultID {
+		log.Warn("Organization creation outside of the default organization", "user_id", principal.UserID, "tenant_id", tenantId)
+		return organizations.CreateOrganizationResponse{}, ErrNotSystemAdmin
+	}
+
+	id, err := organizationRepository.CreateOrganization(ctx, request.Name)
+	if err != nil {
+		log.Error("Failed to create organization", "err", err)
+		return organizations.CreateOrganizationResponse{}, err
+	}
+
+	// Ошибка записи в журнал аудита не отменяет создание организации, только логируется
+	err = auditRepository.Record(ctx, audit_db.Entry{
+		ActorID:    principal.UserID,
+		Action:     audit_db.ActionOrganizationCreated,
+		TargetType: audit_db.TargetOrganization,
+		TargetID:   id,
+		Details:    map[string]any{"name": request.Name},
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionOrganizationCreated)
+	}
+	log.Info("Organization created", "id", id, "user_id", principal.UserID)
+	return organizations.CreateOrganizationResponse{Response: resp.OK(), ID: id}, nil
+}
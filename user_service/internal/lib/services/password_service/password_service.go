@@ -0,0 +1,140 @@
+package password_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/password_reset_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("Токен сброса пароля недействителен или истёк")
+var ErrWrongCurrentPassword = errors.New("Текущий пароль указан неверно")
+
+// ResetSettings Настройки сброса пароля
+//
+// ResetURL - адрес страницы сброса пароля, к которому добавляется токен (например https://booker.example/reset?token=)
+type ResetSettings struct {
+	TokenTTL time.Duration
+	ResetURL string
+}
+
+// ForgotPassword создаёт одноразовый токен сброса пароля и отправляет его на email пользователя
+//
+// Если пользователь не найден, ошибка не возвращается, что б ответ не позволял определить существование email
+func ForgotPassword(log *slog.Logger, userRepository users_db.UserRepository, resetRepository password_reset_db.PasswordResetRepository, mail mailer.Mailer, ctx context.Context, email string, settings ResetSettings) error {
+	const op = "user_service/internal/lib/services/password_service/password_service.go/ForgotPassword"
+	log = log.With(slog.String("op", op))
+
+	user, err := userRepository.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			log.Debug("Password reset requested for unknown email")
+			return nil
+		}
+		log.Error("Ошибка поиска пользователя в БД", "err", err)
+		return err
+	}
+	if user.Status == users_db.UserStatusDeactivated || user.Status == users_db.UserStatusDeleted {
+		log.Debug("Password reset requested for inactive user", "user_id", user.ID)
+		return nil
+	}
+
+	token, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate password reset token", "err", err)
+		return err
+	}
+	err = resetRepository.CreateResetToken(ctx, user.ID, secure_tokens.Hash(token), time.Now().Add(settings.TokenTTL))
+	if err != nil {
+		log.Error("Failed to save password reset token", "err", err)
+		return err
+	}
+
+	message := mailer.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Для сброса пароля перейдите по ссылке: %s%s\nСсылка действительна %s. Если вы не запрашивали сброс пароля, проигнорируйте это письмо.",
+			settings.ResetURL, token, settings.TokenTTL),
+	}
+	if err = mail.Send(ctx, message); err != nil {
+		log.Error("Failed to send password reset mail", "err", err, "user_id", user.ID)
+		return err
+	}
+	log.Debug("Password reset mail sent", "user_id", user.ID)
+	return nil
+}
+
+// ResetPassword меняет пароль по токену сброса
+//
+// Токен одноразовый. После смены пароля отзываются все refresh токены пользователя, поэтому все его сессии завершаются
+func ResetPassword(log *slog.Logger, userRepository users_db.UserRepository, resetRepository password_reset_db.PasswordResetRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, token string, newPassword string) error {
+	const op = "user_service/internal/lib/services/password_service/password_service.go/ResetPassword"
+	log = log.With(slog.String("op", op))
+
+	userId, err := resetRepository.ConsumeResetToken(ctx, secure_tokens.Hash(token))
+	if err != nil {
+		if errors.Is(err, password_reset_db.ErrResetTokenInvalid) {
+			log.Debug("Password reset token is invalid")
+			return ErrInvalidResetToken
+		}
+		log.Error("Failed to consume password reset token", "err", err)
+		return err
+	}
+	log = log.With(slog.Int64("user_id", userId))
+
+	passwordHash, err := users.HashUserPassword(newPassword, log)
+	if err != nil {
+		return err
+	}
+	if err = userRepository.UpdatePassword(ctx, userId, passwordHash); err != nil {
+		log.Error("Failed to update password", "err", err)
+		return err
+	}
+	if err = refreshTokenRepository.RevokeAllForUser(ctx, userId); err != nil {
+		log.Error("Failed to revoke user refresh tokens", "err", err)
+		return err
+	}
+	log.Info("Password reset")
+	return nil
+}
+
+// ChangePassword меняет пароль пользователя после проверки текущего пароля
+//
+// Как и при сбросе пароля, отзываются все refresh токены пользователя
+func ChangePassword(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, userId int64, currentPassword string, newPassword string) error {
+	const op = "user_service/internal/lib/services/password_service/password_service.go/ChangePassword"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	user, err := userRepository.GetUser(ctx, userId)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return err
+	}
+	if !users.ComparePassword(user.PasswordHash, currentPassword, log) {
+		return ErrWrongCurrentPassword
+	}
+
+	passwordHash, err := users.HashUserPassword(newPassword, log)
+	if err != nil {
+		return err
+	}
+	if err = userRepository.UpdatePassword(ctx, userId, passwordHash); err != nil {
+		log.Error("Failed to update password", "err", err)
+		return err
+	}
+	if err = refreshTokenRepository.RevokeAllForUser(ctx, userId); err != nil {
+		log.Error("Failed to revoke user refresh tokens", "err", err)
+		return err
+	}
+	log.Info("Password changed")
+	return nil
+}
@@ -0,0 +1,393 @@
+package scim_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/scim"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("Поддерживается только фильтр userName eq \"значение\"")
+var ErrInvalidPath = errors.New("Атрибут не поддерживается")
+var ErrInvalidValue = errors.New("Недопустимое значение атрибута")
+var ErrImmutable = errors.New("Атрибут нельзя удалить")
+
+// MaxCount максимальный размер страницы при поиске пользователей
+const MaxCount = 200
+
+// filterPattern фильтр вида userName eq "value". Имя атрибута и оператор в SCIM регистронезависимы
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// attributes изменяемые через SCIM поля пользователя
+type attributes struct {
+	Email     string
+	FirstName string
+	LastName  string
+	Phone     string
+	Active    bool
+}
+
+func attributesOf(user users_db.UserInfo) attributes {
+	return attributes{
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Phone:     user.Phone,
+		Active:    user.Status == users_db.UserStatusActive,
+	}
+}
+
+// ToSCIM переводит пользователя в представление SCIM. location - адрес ресурса для meta.location
+func ToSCIM(user users_db.UserInfo, location string) scim.User {
+	active := user.Status == users_db.UserStatusActive
+	result := scim.User{
+		Schemas:  []string{scim.SchemaUser},
+		ID:       strconv.FormatInt(user.ID, 10),
+		UserName: user.Email,
+		Name:     &scim.Name{GivenName: user.FirstName, FamilyName: user.LastName},
+		Emails:   []scim.MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:   &active,
+		Meta:     &scim.Meta{ResourceType: scim.ResourceTypeUser, Location: location},
+	}
+	if user.Phone != "" {
+		result.PhoneNumbers = []scim.MultiValue{{Value: user.Phone, Type: "work", Primary: true}}
+	}
+	return result
+}
+
+// CreateUser создаёт пользователя. Пароль случайный: такие пользователи входят через SSO или задают пароль через сброс
+func CreateUser(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, user scim.User) (users_db.UserInfo, error) {
+	const op = "user_service/internal/lib/services/scim_service/scim_service.go/CreateUser"
+	log = log.With(slog.String("op", op))
+
+	attrs := attributes{Active: true}
+	applyUser(&attrs, user)
+
+	password, err := secure_tokens.Generate()
+	if err != nil {
+		log.Error("Failed to generate password", "err", err)
+		return users_db.UserInfo{}, err
+	}
+	passwordHash, err := users.HashUserPassword(password, log)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	id, err := userRepository.CreateUser(ctx, &create_user.UserCreate{
+		FirstName: attrs.FirstName,
+		LastName:  attrs.LastName,
+		Email:     attrs.Email,
+		Password:  passwordHash,
+		Phone:     attrs.Phone,
+	})
+	if err != nil {
+		if !errors.Is(err, users_db.ErrEmailAlreadyExists) {
+			log.Error("Failed to create user", "err", err)
+		}
+		return users_db.UserInfo{}, err
+	}
+	log.Info("User provisioned via scim", "user_id", id)
+
+	if !attrs.Active {
+		if err = userRepository.SetStatus(ctx, id, users_db.UserStatusDeactivated, users_db.BookingPolicyKeep, 0); err != nil {
+			log.Error("Failed to deactivate provisioned user", "err", err, "user_id", id)
+			return users_db.UserInfo{}, err
+		}
+	}
+	return getUser(log, userRepository, ctx, id)
+}
+
+// GetUser возвращает пользователя. Удалённые пользователи для SCIM не существуют
+func GetUser(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, id int64) (users_db.UserInfo, error) {
+	const op = "user_service/internal/lib/services/scim_service/scim_service.go/GetUser"
+	return getUser(log.With(slog.String("op", op)), userRepository, ctx, id)
+}
+
+// ListUsers ищет пользователей. filter - пустой или userName eq "email", startIndex считается с 1
+func ListUsers(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, filter string, startIndex, count int) (users_db.UserListResult, error) {
+	const op = "user_service/internal/lib/services/scim_service/scim_service.go/ListUsers"
+	log = log.With(slog.String("op", op))
+
+	if filter == "" {
+		result, err := userRepository.GetUserList(ctx, "", count, startIndex-1, nil)
+		if err != nil {
+			log.Error("Failed to get user list", "err", err)
+		}
+		return result, err
+	}
+
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil || !strings.EqualFold(match[1], "userName") {
+		return users_db.UserListResult{}, ErrInvalidFilter
+	}
+	email := strings.ReplaceAll(match[2], `\"`, `"`)
+	user, err := userRepository.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			return users_db.UserListResult{Users: []users_db.UserInfo{}}, nil
+		}
+		log.Error("Ошибка поиска пользователя в БД", "err", err)
+		return users_db.UserListResult{}, err
+	}
+	if user.Status == users_db.UserStatusDeleted {
+		return users_db.UserListResult{Users: []users_db.UserInfo{}}, nil
+	}
+	// Фильтр находит не больше одного пользователя, пагинация применяется к этому результату
+	if startIndex > 1 || count == 0 {
+		return users_db.UserListResult{Users: []users_db.UserInfo{}, Total: 1}, nil
+	}
+	return users_db.UserListResult{Users: []users_db.UserInfo{user}, Total: 1}, nil
+}
+
+// ReplaceUser заменяет атрибуты пользователя (PUT). Не переданные name и phoneNumbers очищаются,
+// не переданный active не меняет статус
+func ReplaceUser(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, id int64, user scim.User, policy users_db.BookingPolicy) (users_db.UserInfo, error) {
+	const op = "user_service/internal/lib/services/scim_service/scim_service.go/ReplaceUser"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", id))
+
+	current, err := getUser(log, userRepository, ctx, id)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	attrs := attributes{Active: attributesOf(current).Active}
+	applyUser(&attrs, user)
+	return save(log, userRepository, refreshTokenRepository, ctx, current, attrs, policy)
+}
+
+// PatchUser применяет операции add, replace и remove (PATCH)
+//
+// Поддерживаются атрибуты userName, active, name (и name.givenName, name.familyName) и phoneNumbers.
+// emails и externalId не хранятся: email пользователя задаётся через userName, такие операции пропускаются
+func PatchUser(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, id int64, patch scim.PatchRequest, policy users_db.BookingPolicy) (users_db.UserInfo, error) {
+	const op = "user_service/internal/lib/services/scim_service/scim_service.go/PatchUser"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", id))
+
+	current, err := getUser(log, userRepository, ctx, id)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	attrs := attributesOf(current)
+	for _, operation := range patch.Operations {
+		if err = applyOperation(&attrs, operation); err != nil {
+			return users_db.UserInfo{}, err
+		}
+	}
+	return save(log, userRepository, refreshTokenRepository, ctx, current, attrs, policy)
+}
+
+// DeactivateUser деактивирует пользователя (DELETE). Запись не удаляется, повторный вызов ничего не меняет
+//
+// policy применяется к будущим бронированиям пользователя, так же как в ReplaceUser и PatchUser при active = false
+func DeactivateUser(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, id int64, policy users_db.BookingPolicy) error {
+	const op = "user_service/internal/lib/services/scim_service/scim_service.go/DeactivateUser"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", id))
+
+	current, err := getUser(log, userRepository, ctx, id)
+	if err != nil {
+		return err
+	}
+	return setActive(log, userRepository, refreshTokenRepository, ctx, current, false, policy)
+}
+
+func getUser(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, id int64) (users_db.UserInfo, error) {
+	user, err := userRepository.GetUser(ctx, id)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return users_db.UserInfo{}, err
+	}
+	if user.Status == users_db.UserStatusDeleted {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// save сохраняет изменившиеся атрибуты и статус
+func save(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, current users_db.UserInfo, attrs attributes, policy users_db.BookingPolicy) (users_db.UserInfo, error) {
+	if _, err := mail.ParseAddress(attrs.Email); err != nil {
+		return users_db.UserInfo{}, fmt.Errorf("%w: userName must be an email", ErrInvalidValue)
+	}
+	before := attributesOf(current)
+	if attrs.Email != before.Email || attrs.FirstName != before.FirstName || attrs.LastName != before.LastName || attrs.Phone != before.Phone {
+		if err := userRepository.UpdateUser(ctx, current.ID, attrs.FirstName, attrs.LastName, attrs.Email, attrs.Phone); err != nil {
+			if !errors.Is(err, users_db.ErrEmailAlreadyExists) && !errors.Is(err, users_db.ErrUserNotFound) {
+				log.Error("Failed to update user", "err", err)
+			}
+			return users_db.UserInfo{}, err
+		}
+	}
+	if err := setActive(log, userRepository, refreshTokenRepository, ctx, current, attrs.Active, policy); err != nil {
+		return users_db.UserInfo{}, err
+	}
+	return getUser(log, userRepository, ctx, current.ID)
+}
+
+// setActive активирует или деактивирует пользователя. При деактивации отзываются все его refresh токены
+func setActive(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, user users_db.UserInfo, active bool, policy users_db.BookingPolicy) error {
+	if active == (user.Status == users_db.UserStatusActive) {
+		return nil
+	}
+	if active {
+		if err := userRepository.SetStatus(ctx, user.ID, users_db.UserStatusActive, users_db.BookingPolicyKeep, 0); err != nil {
+			log.Error("Failed to activate user", "err", err)
+			return err
+		}
+		log.Info("User activated via scim")
+		return nil
+	}
+
+	if err := userRepository.SetStatus(ctx, user.ID, users_db.UserStatusDeactivated, policy, 0); err != nil {
+		log.Error("Failed to deactivate user", "err", err)
+		return err
+	}
+	if err := refreshTokenRepository.RevokeAllForUser(ctx, user.ID); err != nil {
+		log.Error("Failed to revoke user refresh tokens", "err", err)
+		return err
+	}
+	log.Info("User deprovisioned via scim", "booking_policy", policy)
+	return nil
+}
+
+// applyUser переносит атрибуты из полного представления пользователя (POST и PUT)
+func applyUser(attrs *attributes, user scim.User) {
+	attrs.Email = strings.TrimSpace(user.UserName)
+	attrs.FirstName, attrs.LastName = "", ""
+	if user.Name != nil {
+		attrs.FirstName, attrs.LastName = user.Name.GivenName, user.Name.FamilyName
+	}
+	attrs.Phone = primaryValue(user.PhoneNumbers)
+	if user.Active != nil {
+		attrs.Active = *user.Active
+	}
+}
+
+func applyOperation(attrs *attributes, operation scim.PatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidValue, operation.Op)
+	}
+	if operation.Path == "" {
+		if op == "remove" {
+			return fmt.Errorf("%w: remove requires path", ErrInvalidPath)
+		}
+		// Без path value - объект с атрибутами, неизвестные атрибуты (например, расширения схемы) пропускаются
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &values); err != nil {
+			return fmt.Errorf("%w: value must be an object", ErrInvalidValue)
+		}
+		for path, value := range values {
+			err := applyPath(attrs, op, path, value)
+			if err != nil && !errors.Is(err, ErrInvalidPath) {
+				return err
+			}
+		}
+		return nil
+	}
+	return applyPath(attrs, op, operation.Path, operation.Value)
+}
+
+func applyPath(attrs *attributes, op, path string, value json.RawMessage) error {
+	remove := op == "remove"
+	lowerPath := strings.ToLower(path)
+	switch {
+	case lowerPath == "username":
+		if remove {
+			return fmt.Errorf("%w: userName", ErrImmutable)
+		}
+		return decodeString(value, &attrs.Email)
+	case lowerPath == "active":
+		if remove {
+			return fmt.Errorf("%w: active", ErrImmutable)
+		}
+		return decodeBool(value, &attrs.Active)
+	case lowerPath == "name.givenname":
+		if remove {
+			attrs.FirstName = ""
+			return nil
+		}
+		return decodeString(value, &attrs.FirstName)
+	case lowerPath == "name.familyname":
+		if remove {
+			attrs.LastName = ""
+			return nil
+		}
+		return decodeString(value, &attrs.LastName)
+	case lowerPath == "name":
+		if remove {
+			attrs.FirstName, attrs.LastName = "", ""
+			return nil
+		}
+		var name scim.Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return fmt.Errorf("%w: name", ErrInvalidValue)
+		}
+		attrs.FirstName, attrs.LastName = name.GivenName, name.FamilyName
+		return nil
+	case lowerPath == "phonenumbers":
+		if remove {
+			attrs.Phone = ""
+			return nil
+		}
+		var phones []scim.MultiValue
+		if err := json.Unmarshal(value, &phones); err != nil {
+			return fmt.Errorf("%w: phoneNumbers", ErrInvalidValue)
+		}
+		attrs.Phone = primaryValue(phones)
+		return nil
+	case strings.HasPrefix(lowerPath, "phonenumbers[") && strings.HasSuffix(lowerPath, "].value"):
+		// Хранится один телефон, фильтр по типу (например, phoneNumbers[type eq "work"].value) не учитывается
+		if remove {
+			attrs.Phone = ""
+			return nil
+		}
+		return decodeString(value, &attrs.Phone)
+	case lowerPath == "externalid", lowerPath == "emails", strings.HasPrefix(lowerPath, "emails["):
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidPath, path)
+}
+
+func decodeString(value json.RawMessage, dst *string) error {
+	if err := json.Unmarshal(value, dst); err != nil {
+		return fmt.Errorf("%w: expected string", ErrInvalidValue)
+	}
+	return nil
+}
+
+// decodeBool принимает и булево значение, и строку: некоторые клиенты передают active как "False"
+func decodeBool(value json.RawMessage, dst *bool) error {
+	if err := json.Unmarshal(value, dst); err == nil {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		if parsed, err := strconv.ParseBool(text); err == nil {
+			*dst = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: expected boolean", ErrInvalidValue)
+}
+
+func primaryValue(values []scim.MultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package session_service
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/sessions"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+)
+
+// List возвращает активные сессии текущего пользователя
+func List(log *slog.Logger, sessionRepository sessions_db.SessionRepository, ctx context.Context, principal auth.Principal) (sessions.ListResponse, error) {
+	const op = "user_service/internal/lib/services/session_service/session_service.go/List"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", principal.UserID))
+
+	result, err := sessionRepository.ListSessions(ctx, principal.UserID)
+	if err != nil {
+		log.Error("Failed to list sessions", "err", err)
+		return sessions.ListResponse{}, err
+	}
+	data := make([]sessions.SessionInfo, 0, len(result))
+	for _, session := range result {
+		data = append(data, sessions.SessionInfo{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.ID == principal.SessionID,
+		})
+	}
+	return sessions.ListResponse{Response: resp.OK(), Data: data}, nil
+}
+
+// Terminate завершает сессию текущего пользователя и отзывает её refresh токены
+//
+// Токены доступа этой сессии перестают приниматься AuthMiddleware сразу, не дожидаясь истечения
+func Terminate(log *slog.Logger, sessionRepository sessions_db.SessionRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, principal auth.Principal, sessionId int64) error {
+	const op = "user_service/internal/lib/services/session_service/session_service.go/Terminate"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", principal.UserID), slog.Int64("session_id", sessionId))
+
+	familyId, err := sessionRepository.TerminateSession(ctx, principal.UserID, sessionId)
+	if err != nil {
+		if !errors.Is(err, sessions_db.ErrSessionNotFound) {
+			log.Error("Failed to terminate session", "err", err)
+		}
+		return err
+	}
+	if err = refreshTokenRepository.RevokeFamily(ctx, familyId); err != nil {
+		log.Error("Failed to revoke refresh token family", "err", err)
+		return err
+	}
+	log.Info("Session terminated")
+	return nil
+}
+
+// TerminateAll завершает все сессии пользователя (выход на всех устройствах). Выполняется администратором
+func TerminateAll(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, auditRepository audit_db.AuditRepository, ctx context.Context, principal auth.Principal, userId int64) error {
+	const op = "user_service/internal/lib/services/session_service/session_service.go/TerminateAll"
+	log = log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	if _, err := userRepository.GetUser(ctx, userId); err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return err
+	}
+	if err := refreshTokenRepository.RevokeAllForUser(ctx, userId); err != nil {
+		log.Error("Failed to revoke user refresh tokens", "err", err)
+		return err
+	}
+	log.Info("User signed out everywhere", "signed_out_by", principal.UserID)
+
+	// Ошибка записи в журнал аудита не отменяет завершение сессий, только логируется
+	err := auditRepository.Record(ctx, audit_db.Entry{
+		ActorID:    principal.UserID,
+		Action:     audit_db.ActionUserSignedOut,
+		TargetType: audit_db.TargetUser,
+		TargetID:   userId,
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionUserSignedOut)
+	}
+	return nil
+}
@@ -5,13 +5,25 @@ import (
 	"errors"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/get_user_by_id"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/get_users_list"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/me"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/update_user"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
 	"log/slog"
+	"slices"
 	"strconv"
 )
 
+var ErrUnknownRole = errors.New("Роль не существует")
+var ErrOwnRoleChange = errors.New("Нельзя изменить собственную роль")
+var ErrOwnStatusChange = errors.New("Нельзя изменить статус собственной учётной записи")
+var ErrInvalidStatusTransition = errors.New("Недопустимая смена статуса пользователя")
+var ErrReassignTargetRequired = errors.New("Для политики reassign нужно указать другого пользователя в reassign_to")
+
 func GetUser(log *slog.Logger, userRepository users_db.UserRepository, userId int64, ctx context.Context) (get_user_by_id.UserInfo, error) {
 	const op = "internal/lib/services/user_service/user_service.go/GetUser"
 	log = log.With(slog.String("op", op),
@@ -56,6 +68,7 @@ func GetUserList(log *slog.Logger, userRepository users_db.UserRepository, ctx c
 			LastName:  user.LastName,
 			FirstName: user.FirstName,
 			Role:      user.Role,
+			Status:    user.Status,
 		}
 		userList = append(userList, userInfo)
 	}
@@ -78,7 +91,7 @@ func UpdateUser(log *slog.Logger, userRepository users_db.UserRepository, ctx co
 	log = log.With(slog.String("op", op),
 		slog.String("UserId", strconv.FormatInt(id, 10)))
 
-	err := userRepository.UpdateUser(ctx, id, dto.FirstName, dto.LastName, dto.Email, dto.Phone, dto.Role)
+	err := userRepository.UpdateUser(ctx, id, dto.FirstName, dto.LastName, dto.Email, dto.Phone)
 	if err != nil {
 		log.Error("Failed to update user", "err", err)
 		return err
@@ -86,15 +99,200 @@ func UpdateUser(log *slog.Logger, userRepository users_db.UserRepository, ctx co
 	return nil
 }
 
-func DeleteUser(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, id int64) error {
+// GetProfile возвращает профиль пользователя для GET /users/me
+func GetProfile(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, userId int64) (me.MeResponse, error) {
+	const op = "internal/lib/services/user_service/user_service.go/GetProfile"
+	log = log.With(slog.String("op", op),
+		slog.String("UserId", strconv.FormatInt(userId, 10)))
+
+	user, err := userRepository.GetUser(ctx, userId)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return me.MeResponse{}, err
+	}
+	return me.MeResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Phone:         user.Phone,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+	}, nil
+}
+
+// UpdateProfile частично обновляет профиль пользователя: меняются только переданные поля (имя, фамилия, телефон)
+func UpdateProfile(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, userId int64, dto me.UpdateMeRequest) (me.MeResponse, error) {
+	const op = "internal/lib/services/user_service/user_service.go/UpdateProfile"
+	log = log.With(slog.String("op", op),
+		slog.String("UserId", strconv.FormatInt(userId, 10)))
+
+	user, err := userRepository.GetUser(ctx, userId)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
+		return me.MeResponse{}, err
+	}
+	if dto.FirstName != nil {
+		user.FirstName = *dto.FirstName
+	}
+	if dto.LastName != nil {
+		user.LastName = *dto.LastName
+	}
+	if dto.Phone != nil {
+		user.Phone = *dto.Phone
+	}
+	if err = userRepository.UpdateProfile(ctx, userId, user.FirstName, user.LastName, user.Phone); err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Failed to update user profile", "err", err)
+		}
+		return me.MeResponse{}, err
+	}
+	return me.MeResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Phone:         user.Phone,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+	}, nil
+}
+
+// UpdateRole меняет роль пользователя
+//
+// Роль должна существовать в role_permissions. Свою роль менять нельзя, что б администратор случайно не лишил себя прав
+func UpdateRole(log *slog.Logger, userRepository users_db.UserRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, ctx context.Context, principal auth.Principal, id int64, role string) error {
+	const op = "internal/lib/services/user_service/user_service.go/UpdateRole"
+	log = log.With(slog.String("op", op),
+		slog.String("UserId", strconv.FormatInt(id, 10)))
+
+	if principal.UserID == id {
+		return ErrOwnRoleChange
+	}
+	permissions, err := permissionRepository.GetRolePermissions(ctx, role)
+	if err != nil {
+		log.Error("Failed to get role permissions", "err", err, "role", role)
+		return err
+	}
+	if len(permissions) == 0 {
+		return ErrUnknownRole
+	}
+	if err = userRepository.UpdateRole(ctx, id, role); err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Failed to update user role", "err", err)
+		}
+		return err
+	}
+	log.Info("User role changed", "role", role, "changed_by", principal.UserID)
+
+	// Ошибка записи в журнал аудита не откатывает смену роли, только логируется
+	err = auditRepository.Record(ctx, audit_db.Entry{
+		ActorID:    principal.UserID,
+		Action:     audit_db.ActionUserRoleChanged,
+		TargetType: audit_db.TargetUser,
+		TargetID:   id,
+		Details:    map[string]any{"role": role},
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionUserRoleChanged)
+	}
+	return nil
+}
+
+// DeactivateUser деактивирует пользователя: он больше не может войти, все его refresh токены отзываются
+//
+// К будущим бронированиям пользователя применяется политика policy (cancel, reassign или keep)
+func DeactivateUser(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, principal auth.Principal, id int64, policy users_db.BookingPolicy, reassignTo int64) error {
+	const op = "internal/lib/services/user_service/user_service.go/DeactivateUser"
+	log = log.With(slog.String("op", op),
+		slog.String("UserId", strconv.FormatInt(id, 10)))
+
+	return changeStatus(log, userRepository, refreshTokenRepository, ctx, principal, id, users_db.UserStatusDeactivated, policy, reassignTo)
+}
+
+// ActivateUser снова разрешает вход деактивированному пользователю
+func ActivateUser(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, principal auth.Principal, id int64) error {
+	const op = "internal/lib/services/user_service/user_service.go/ActivateUser"
+	log = log.With(slog.String("op", op),
+		slog.String("UserId", strconv.FormatInt(id, 10)))
+
+	return changeStatus(log, userRepository, nil, ctx, principal, id, users_db.UserStatusActive, users_db.BookingPolicyKeep, 0)
+}
+
+// DeleteUser мягко удаляет пользователя: запись остаётся в БД со статусом deleted и deleted_at,
+// пользователь пропадает из списков и не может войти
+//
+// К будущим бронированиям пользователя применяется политика policy. Окончательно удалить запись можно через PurgeUser
+func DeleteUser(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, principal auth.Principal, id int64, policy users_db.BookingPolicy, reassignTo int64) error {
 	const op = "internal/lib/services/user_service/user_service.go/DeleteUser"
 	log = log.With(slog.String("op", op),
 		slog.String("UserId", strconv.FormatInt(id, 10)))
 
-	err := userRepository.DeleteUser(ctx, id)
+	return changeStatus(log, userRepository, refreshTokenRepository, ctx, principal, id, users_db.UserStatusDeleted, policy, reassignTo)
+}
+
+// PurgeUser окончательно удаляет запись пользователя. Доступно только для пользователя в статусе deleted
+// без действующих бронирований
+func PurgeUser(log *slog.Logger, userRepository users_db.UserRepository, ctx context.Context, id int64) error {
+	const op = "internal/lib/services/user_service/user_service.go/PurgeUser"
+	log = log.With(slog.String("op", op),
+		slog.String("UserId", strconv.FormatInt(id, 10)))
+
+	err := userRepository.PurgeUser(ctx, id)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) && !errors.Is(err, users_db.ErrUserNotDeleted) && !errors.Is(err, users_db.ErrUserHasBookings) {
+			log.Error("Failed to purge user", "err", err)
+		}
+		return err
+	}
+	log.Info("User purged")
+	return nil
+}
+
+// userStatusTransitions допустимые переходы статуса: новый статус -> статусы, из которых в него можно перейти
+var userStatusTransitions = map[string][]string{
+	users_db.UserStatusActive:      {users_db.UserStatusDeactivated},
+	users_db.UserStatusDeactivated: {users_db.UserStatusActive},
+	users_db.UserStatusDeleted:     {users_db.UserStatusActive, users_db.UserStatusDeactivated},
+}
+
+func changeStatus(log *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, ctx context.Context, principal auth.Principal, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	if principal.UserID == id {
+		return ErrOwnStatusChange
+	}
+	if policy == users_db.BookingPolicyReassign && (reassignTo == 0 || reassignTo == id) {
+		return ErrReassignTargetRequired
+	}
+
+	user, err := userRepository.GetUser(ctx, id)
 	if err != nil {
-		log.Error("Failed to delete user", "err", err)
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Ошибка поиска пользователя в БД", "err", err)
+		}
 		return err
 	}
+	if !slices.Contains(userStatusTransitions[status], user.Status) {
+		log.Debug("Invalid user status transition", "from", user.Status, "to", status)
+		return ErrInvalidStatusTransition
+	}
+
+	if err = userRepository.SetStatus(ctx, id, status, policy, reassignTo); err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) && !errors.Is(err, users_db.ErrReassignTargetInvalid) && !errors.Is(err, users_db.ErrReassignTargetRestricted) {
+			log.Error("Failed to change user status", "err", err)
+		}
+		return err
+	}
+	// Отзываем refresh токены, что б пользователь не мог продлить уже выданные токены доступа
+	if refreshTokenRepository != nil {
+		if err = refreshTokenRepository.RevokeAllForUser(ctx, id); err != nil {
+			log.Error("Failed to revoke user refresh tokens", "err", err)
+			return err
+		}
+	}
+	log.Info("User status changed", "from", user.Status, "to", status, "booking_policy", policy, "changed_by", principal.UserID)
 	return nil
 }
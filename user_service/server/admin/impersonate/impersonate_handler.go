@@ -0,0 +1,67 @@
+package impersonate
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/impersonation_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ImpersonateHandler выдаёт администратору токен доступа от имени пользователя (POST /admin/impersonate/{userId})
+//
+// Доступен только с разрешением user:impersonate. Токен живёт ttl и не продлевается
+func ImpersonateHandler(logger *slog.Logger, userRepository users_db.UserRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, settings jwt_tokens.TokenSettings, ttl time.Duration, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/admin/impersonate/impersonate_handler.go/ImpersonateHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("ImpersonateHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := impersonation_service.Start(log, userRepository, permissionRepository, auditRepository, ctx, principal, userID, settings, ttl, time.Now())
+		if err != nil {
+			switch {
+			case errors.Is(err, impersonation_service.ErrSelfImpersonation):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			case errors.Is(err, impersonation_service.ErrNestedImpersonation),
+				errors.Is(err, impersonation_service.ErrTargetPrivileged):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			case errors.Is(err, impersonation_service.ErrTargetInactive):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrUserNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+			case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("ImpersonateHandler: error while starting impersonation", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
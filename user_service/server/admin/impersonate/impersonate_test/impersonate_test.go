@@ -0,0 +1,248 @@
+package impersonate_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/admin/impersonate"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+var testSettings = jwt_tokens.TokenSettings{
+	Keys:            jwt_tokens.NewHMACKeySet("test-secret-key"),
+	AccessTokenTTL:  time.Hour,
+	RefreshTokenTTL: 24 * time.Hour,
+}
+
+var adminPrincipal = auth.Principal{UserID: 1, Role: "admin", Permissions: []string{"user:impersonate"}, SessionID: 7}
+
+func TestImpersonateHandler(t *testing.T) {
+	userPermissions := []string{"booking:create", "booking:read"}
+	tests := []struct {
+		name           string
+		userId         string
+		principal      auth.Principal
+		setupMock      func(*MockUserRepository, *MockPermissionRepository, *MockAuditRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:      "token is issued and audited",
+			userId:    "42",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusActive, EmailVerified: true}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return(userPermissions, nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionImpersonationStarted && entry.ActorID == 1 && entry.TargetID == 42
+				})).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:      "audit failure does not block impersonation",
+			userId:    "42",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusActive, EmailVerified: true}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return(userPermissions, nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.Anything).Return(errors.New("db down")).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:      "self impersonation",
+			userId:    "1",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя войти от имени самого себя"}`,
+		},
+		{
+			name:      "nested impersonation",
+			userId:    "42",
+			principal: auth.Principal{UserID: 5, Role: "user", Permissions: []string{"user:impersonate"}, ActorID: 1},
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя начать имперсонацию из-под имперсонации"}`,
+		},
+		{
+			name:      "another admin cannot be impersonated",
+			userId:    "2",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(2)).Return(users_db.UserInfo{ID: 2, Role: "admin", Status: users_db.UserStatusActive}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"user:manage", "user:impersonate"}, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя войти от имени пользователя, которому доступна имперсонация"}`,
+		},
+		{
+			name:      "inactive user",
+			userId:    "42",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusDeactivated}, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя войти от имени неактивного пользователя"}`,
+		},
+		{
+			name:      "user not found",
+			userId:    "404",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(404)).Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"User not found"}`,
+		},
+		{
+			name:      "invalid user id",
+			userId:    "abc",
+			principal: adminPrincipal,
+			setupMock: func(mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Invalid user ID"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockUserRepo := new(MockUserRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockUserRepo, mockPermissionRepo, mockAuditRepo)
+			handler := impersonate.ImpersonateHandler(slog.Default(), mockUserRepo, mockPermissionRepo, mockAuditRepo, testSettings, 15*time.Minute, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/impersonate/"+test.userId, nil)
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("userId", test.userId)
+			ctx := context.WithValue(auth.NewContext(req.Context(), test.principal), chi.RouteCtxKey, routeCtx)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req.WithContext(ctx))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedStatus == http.StatusOK {
+				var response struct {
+					AccessToken        string `json:"access_token"`
+					ExpiresIn          int64  `json:"expires_in"`
+					ImpersonatedUserID int64  `json:"impersonated_user_id"`
+					ActorID            int64  `json:"actor_id"`
+				}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.Equal(t, int64(15*60), response.ExpiresIn)
+				require.Equal(t, int64(42), response.ImpersonatedUserID)
+				require.Equal(t, int64(1), response.ActorID)
+
+				// Токен выдан от имени пользователя, с его разрешениями, id администратора в act и сессией администратора
+				claims, err := jwt_tokens.VerifyToken(response.AccessToken, testSettings.Keys)
+				require.NoError(t, err)
+				principal, err := auth.FromClaims(claims)
+				require.NoError(t, err)
+				require.Equal(t, int64(42), principal.UserID)
+				require.Equal(t, int64(1), principal.ActorID)
+				require.Equal(t, int64(7), principal.SessionID)
+				require.Equal(t, userPermissions, principal.Permissions)
+				require.True(t, principal.Impersonated())
+				require.WithinDuration(t, time.Now().Add(15*time.Minute), principal.ExpiresAt, 5*time.Second)
+			} else {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+			mockUserRepo.AssertExpectations(t)
+			mockPermissionRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
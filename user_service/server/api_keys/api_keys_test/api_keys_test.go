@@ -0,0 +1,326 @@
+package api_keys_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/api_keys/create_api_key"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/api_keys/revoke_api_key"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) CreateAPIKey(ctx context.Context, key api_keys_db.APIKeyCreate) (int64, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]api_keys_db.APIKeyInfo, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]api_keys_db.APIKeyInfo), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) Authenticate(ctx context.Context, secretHash string) (api_keys_db.APIKeyPrincipal, error) {
+	args := m.Called(ctx, secretHash)
+	return args.Get(0).(api_keys_db.APIKeyPrincipal), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) TouchLastUsed(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+var adminPrincipal = auth.Principal{UserID: 1, Role: "admin", Permissions: []string{"api_key:manage"}}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	userPermissions := []string{"booking:create", "booking:read", "entity:read"}
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*MockAPIKeyRepository, *MockUserRepository, *MockPermissionRepository, *MockAuditRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "key for another user is created and audited",
+			body: `{"name":"calendar sync","scopes":["booking:read","entity:read","booking:read"],"user_id":42}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return(userPermissions, nil).Once()
+				mockKeyRepo.On("CreateAPIKey", mock.Anything, mock.MatchedBy(func(key api_keys_db.APIKeyCreate) bool {
+					// Повторяющиеся scopes не сохраняются
+					return key.Name == "calendar sync" && key.UserID == 42 && key.CreatedBy == 1 &&
+						slices.Equal(key.Scopes, []string{"booking:read", "entity:read"}) &&
+						strings.HasPrefix(key.Prefix, "bk_") && len(key.SecretHash) == 64
+				})).Return(int64(5), nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionAPIKeyCreated && entry.ActorID == 1 && entry.TargetID == 5
+				})).Return(nil).Once()
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "scope outside of owner role is rejected",
+			body: `{"name":"sync","scopes":["entity:write"],"user_id":42}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return(userPermissions, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Разрешение не входит в разрешения роли пользователя: entity:write"}`,
+		},
+		{
+			name: "api_key:manage cannot be granted",
+			body: `{"name":"sync","scopes":["api_key:manage"]}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(1)).Return(users_db.UserInfo{ID: 1, Role: "admin", Status: users_db.UserStatusActive}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"api_key:manage", "user:manage"}, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Разрешение не может быть выдано API ключу: api_key:manage"}`,
+		},
+		{
+			name: "expiry in the past",
+			body: `{"name":"sync","scopes":["booking:read"],"expires_at":"2000-01-01T00:00:00Z"}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				// Нет вызова мока, срок проверяется до обращения к БД
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Срок действия ключа уже истёк"}`,
+		},
+		{
+			name: "inactive owner",
+			body: `{"name":"sync","scopes":["booking:read"],"user_id":42}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusDeactivated}, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя выпустить ключ для неактивного пользователя"}`,
+		},
+		{
+			name: "owner not found",
+			body: `{"name":"sync","scopes":["booking:read"],"user_id":404}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(404)).Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"User not found"}`,
+		},
+		{
+			name: "scopes are required",
+			body: `{"name":"sync","scopes":[]}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Scopes is invalid"}`,
+		},
+		{
+			name: "repository error",
+			body: `{"name":"sync","scopes":["booking:read"]}`,
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockUserRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockUserRepo.On("GetUser", mock.Anything, int64(1)).Return(users_db.UserInfo{ID: 1, Role: "admin"}, nil).Once()
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"booking:read"}, nil).Once()
+				mockKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(int64(0), errors.New("db is down")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"internal server error"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockKeyRepo := new(MockAPIKeyRepository)
+			mockUserRepo := new(MockUserRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockKeyRepo, mockUserRepo, mockPermissionRepo, mockAuditRepo)
+			handler := create_api_key.CreateAPIKeyHandler(slog.Default(), mockKeyRepo, mockUserRepo, mockPermissionRepo, mockAuditRepo, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodPost, "/api-keys", bytes.NewBufferString(test.body))
+			req = req.WithContext(auth.NewContext(req.Context(), adminPrincipal))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			if test.expectedStatus == http.StatusCreated {
+				var response struct {
+					ID  int64  `json:"id"`
+					Key string `json:"key"`
+				}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.Equal(t, int64(5), response.ID)
+				// В БД сохранён хеш именно того ключа, который вернулся клиенту
+				createCall := mockKeyRepo.Calls[0].Arguments.Get(1).(api_keys_db.APIKeyCreate)
+				require.Equal(t, secure_tokens.Hash(response.Key), createCall.SecretHash)
+				require.True(t, strings.HasPrefix(response.Key, createCall.Prefix))
+			} else {
+				require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			}
+			mockKeyRepo.AssertExpectations(t)
+			mockUserRepo.AssertExpectations(t)
+			mockPermissionRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		keyId          string
+		setupMock      func(*MockAPIKeyRepository, *MockAuditRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "success is audited",
+			keyId: "5",
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockAuditRepo *MockAuditRepository) {
+				mockKeyRepo.On("RevokeAPIKey", mock.Anything, int64(5)).Return(nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionAPIKeyRevoked && entry.ActorID == 1 && entry.TargetID == 5
+				})).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:  "key not found",
+			keyId: "404",
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockAuditRepo *MockAuditRepository) {
+				mockKeyRepo.On("RevokeAPIKey", mock.Anything, int64(404)).Return(api_keys_db.ErrAPIKeyNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"API key not found"}`,
+		},
+		{
+			name:  "invalid id",
+			keyId: "abc",
+			setupMock: func(mockKeyRepo *MockAPIKeyRepository, mockAuditRepo *MockAuditRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Invalid API key ID"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockKeyRepo := new(MockAPIKeyRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockKeyRepo, mockAuditRepo)
+			handler := revoke_api_key.RevokeAPIKeyHandler(slog.Default(), mockKeyRepo, mockAuditRepo, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api-keys/"+test.keyId, nil)
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("id", test.keyId)
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req.WithContext(auth.NewContext(ctx, adminPrincipal)))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockKeyRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package create_api_key
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/api_keys"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/api_key_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CreateAPIKeyHandler выпускает API ключ (POST /api-keys)
+//
+// Доступен только с разрешением api_key:manage. Ключ возвращается в ответе один раз
+func CreateAPIKeyHandler(logger *slog.Logger, apiKeyRepository api_keys_db.APIKeyRepository, userRepository users_db.UserRepository, permissionRepository permissions_db.PermissionRepository, auditRepository audit_db.AuditRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/api_keys/create_api_key/create_api_key_handler.go/CreateAPIKeyHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("CreateAPIKeyHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var createRequest api_keys.CreateRequest
+		err := body.DecodeAndValidateJson(r, &createRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("CreateAPIKeyHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		response, err := api_key_service.Create(log, apiKeyRepository, userRepository, permissionRepository, auditRepository, ctx, principal, createRequest, time.Now())
+		if err != nil {
+			switch {
+			case errors.Is(err, api_key_service.ErrUnknownScope),
+				errors.Is(err, api_key_service.ErrScopeNotAllowed),
+				errors.Is(err, api_key_service.ErrExpiresInPast),
+				errors.Is(err, api_key_service.ErrOwnerInactive):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrUserNotFound), errors.Is(err, api_keys_db.ErrAPIKeyUserNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+			case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("CreateAPIKeyHandler: error while creating api key", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusCreated, response)
+	}
+}
@@ -0,0 +1,37 @@
+package list_api_keys
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/api_key_service"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ListAPIKeysHandler возвращает список API ключей без секретов (GET /api-keys)
+//
+// Отозванные и истёкшие ключи тоже попадают в список
+func ListAPIKeysHandler(logger *slog.Logger, apiKeyRepository api_keys_db.APIKeyRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/api_keys/list_api_keys/list_api_keys_handler.go/ListAPIKeysHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := api_key_service.List(log, apiKeyRepository, ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+				return
+			}
+			log.Error("ListAPIKeysHandler: error while listing api keys", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,56 @@
+package revoke_api_key
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/api_keys_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/api_key_service"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RevokeAPIKeyHandler отзывает API ключ (DELETE /api-keys/{id})
+func RevokeAPIKeyHandler(logger *slog.Logger, apiKeyRepository api_keys_db.APIKeyRepository, auditRepository audit_db.AuditRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/api_keys/revoke_api_key/revoke_api_key_handler.go/RevokeAPIKeyHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("RevokeAPIKeyHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("API key ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid API key ID"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		err = api_key_service.Revoke(log, apiKeyRepository, auditRepository, ctx, principal, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, api_keys_db.ErrAPIKeyNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("API key not found"))
+			case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("RevokeAPIKeyHandler: error while revoking api key", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
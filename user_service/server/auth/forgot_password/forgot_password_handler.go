@@ -0,0 +1,56 @@
+package forgot_password
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/password_reset"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/password_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/password_reset_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ForgotPasswordHandler отправляет на email ссылку для сброса пароля
+//
+// Всегда отвечает 200 на корректный запрос, даже если пользователь не найден или письмо не отправлено,
+// что б по ответу нельзя было определить, зарегистрирован ли email.
+// resetURL - адрес страницы сброса пароля, к которому добавляется токен
+func ForgotPasswordHandler(logger *slog.Logger, userRepository users_db.UserRepository, resetRepository password_reset_db.PasswordResetRepository, mail mailer.Mailer, tokenTTL time.Duration, resetURL string, timeout time.Duration) http.HandlerFunc {
+	settings := password_service.ResetSettings{TokenTTL: tokenTTL, ResetURL: resetURL}
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/forgot_password/forgot_password_handler.go/ForgotPasswordHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var forgotRequest password_reset.ForgotPasswordRequest
+		err := body.DecodeAndValidateJson(r, &forgotRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("ForgotPasswordHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		err = password_service.ForgotPassword(log, userRepository, resetRepository, mail, ctx, forgotRequest.Email, settings)
+		if err != nil {
+			log.Error("ForgotPasswordHandler: error while requesting password reset", "error", err)
+		}
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
@@ -0,0 +1,157 @@
+package forgot_password_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/password_reset"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/forgot_password"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockPasswordResetRepository struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepository) CreateResetToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepository) ConsumeResetToken(ctx context.Context, tokenHash string) (int64, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// recordingMailer Запоминает отправленные письма
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, message mailer.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+const resetURL = "https://booker.test/reset?token="
+
+func TestForgotPassword(t *testing.T) {
+	t.Run("known email gets reset link", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockResetRepo := new(MockPasswordResetRepository)
+		mail := &recordingMailer{}
+		var savedHash string
+		mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").
+			Return(users_db.UserInfo{ID: 42, Email: "ryanGosling@gmail.com"}, nil).Once()
+		mockResetRepo.On("CreateResetToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+			Run(func(args mock.Arguments) { savedHash = args.String(2) }).
+			Return(nil).Once()
+
+		w := doForgotRequest(mockRepo, mockResetRepo, mail, "ryanGosling@gmail.com")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, mail.messages, 1)
+		require.Equal(t, "ryanGosling@gmail.com", mail.messages[0].To)
+
+		// В письме отправляется сам токен, а в БД сохраняется только его хеш
+		start := strings.Index(mail.messages[0].Body, resetURL)
+		require.NotEqual(t, -1, start)
+		token := strings.Fields(mail.messages[0].Body[start+len(resetURL):])[0]
+		require.Equal(t, secure_tokens.Hash(token), savedHash)
+		mockRepo.AssertExpectations(t)
+		mockResetRepo.AssertExpectations(t)
+	})
+
+	t.Run("unknown email returns same response without mail", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockResetRepo := new(MockPasswordResetRepository)
+		mail := &recordingMailer{}
+		mockRepo.On("GetUserByEmail", mock.Anything, "unknown@gmail.com").
+			Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+
+		w := doForgotRequest(mockRepo, mockResetRepo, mail, "unknown@gmail.com")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"status":"OK"}`, w.Body.String())
+		require.Empty(t, mail.messages)
+		mockResetRepo.AssertNotCalled(t, "CreateResetToken")
+	})
+}
+
+func doForgotRequest(mockRepo *MockUserRepository, mockResetRepo *MockPasswordResetRepository, mail mailer.Mailer, email string) *httptest.ResponseRecorder {
+	handler := forgot_password.ForgotPasswordHandler(slog.Default(), mockRepo, mockResetRepo, mail, time.Hour, resetURL, 5*time.Second)
+	body, _ := json.Marshal(password_reset.ForgotPasswordRequest{Email: email})
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
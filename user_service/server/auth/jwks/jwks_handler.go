@@ -0,0 +1,22 @@
+package jwks
+
+import (
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"log/slog"
+	"net/http"
+)
+
+// JWKSHandler отдаёт публичные ключи проверки токенов в формате JWKS (RFC 7517)
+//
+// Другие сервисы проверяют токены по этим ключам и не должны знать ключ подписи
+func JWKSHandler(logger *slog.Logger, keys *jwt_tokens.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/jwks/jwks_handler.go/JWKSHandler"))
+
+		jwks := keys.JWKS()
+		log.Debug("Serving JWKS", "keys", len(jwks.Keys))
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		resp.RenderResponse(w, r, http.StatusOK, jwks)
+	}
+}
@@ -0,0 +1,127 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	loginDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/login_guard"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/auth_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LoginHandler аутентифицирует пользователя по email и паролю и возвращает токен доступа и refresh токен
+//
+// Неудачные попытки учитываются guard по аккаунту и IP. Пока вход заблокирован, возвращается 429 с заголовком Retry-After.
+// Если у пользователя подключена 2FA, возвращается mfa_token для второго шага входа (/login/2fa)
+func LoginHandler(logger *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, guard *login_guard.Guard, tokenSettings jwt_tokens.TokenSettings, mfaSettings totp.Settings, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/login/login_handler.go/LoginHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var loginRequest loginDto.LoginRequest
+		err := body.DecodeAndValidateJson(r, &loginRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("LoginHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		ip := ClientIP(r)
+		if err = guard.Check(ctx, loginRequest.Email, ip); err != nil {
+			RenderGuardError(w, r, log, err)
+			return
+		}
+
+		response, err := auth_service.Login(log, userRepository, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, ctx, loginRequest, ClientInfo(r), tokenSettings, mfaSettings)
+		if err != nil {
+			if errors.Is(err, auth_service.ErrInvalidCredentials) {
+				if guardErr := guard.RegisterFailure(ctx, loginRequest.Email, ip); guardErr != nil {
+					log.Error("LoginHandler: error while registering failed login", "error", guardErr)
+				}
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, auth_service.ErrUserDeactivated) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+				return
+			}
+			log.Error("LoginHandler: error while logging in", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		// При входе с 2FA счётчик неудачных попыток сбрасывается только после проверки второго фактора
+		if !response.MFARequired {
+			if err = guard.RegisterSuccess(ctx, loginRequest.Email); err != nil {
+				log.Error("LoginHandler: error while resetting failed logins", "error", err)
+			}
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// RenderGuardError отвечает на ошибку guard: 429 с заголовком Retry-After, если вход заблокирован
+func RenderGuardError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	var lockedErr *login_guard.LockedError
+	if errors.As(err, &lockedErr) {
+		log.Warn("LoginHandler: login is locked", "retry_after", lockedErr.RetryAfter)
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(lockedErr.RetryAfter.Seconds())), 10))
+		resp.RenderResponse(w, r, http.StatusTooManyRequests, resp.Error(err.Error()))
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		log.Warn("Request canceled or timed out", slog.Any("err", err))
+		resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+		return
+	}
+	log.Error("LoginHandler: error while checking login attempts", "error", err)
+	resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+}
+
+// ClientInfo user agent и IP клиента для сессии
+func ClientInfo(r *http.Request) sessions_db.ClientInfo {
+	return sessions_db.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ClientIP(r),
+	}
+}
+
+// ClientIP IP адрес клиента без порта
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
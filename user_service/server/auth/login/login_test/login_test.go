@@ -0,0 +1,579 @@
+package login_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	loginDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/login_guard"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/login_attempts"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKeys = jwt_tokens.NewHMACKeySet("test-secret-key")
+
+var testGuardSettings = login_guard.Settings{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      10,
+	BaseLockout:        time.Minute,
+	MaxLockout:         time.Hour,
+	FailureWindow:      15 * time.Minute,
+}
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	args := m.Called(ctx, sessionId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, userId int64, familyId string, client sessions_db.ClientInfo) (int64, error) {
+	args := m.Called(ctx, userId, familyId, client)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepository) ListSessions(ctx context.Context, userId int64) ([]sessions_db.SessionInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).([]sessions_db.SessionInfo), args.Error(1)
+}
+
+func (m *MockSessionRepository) TerminateSession(ctx context.Context, userId, sessionId int64) (string, error) {
+	args := m.Called(ctx, userId, sessionId)
+	return args.String(0), args.Error(1)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+func (m *MockMFARepository) GetTOTP(ctx context.Context, userId int64) (mfa_db.TOTPInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(mfa_db.TOTPInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) SaveTOTPSecret(ctx context.Context, userId int64, secret string) error {
+	args := m.Called(ctx, userId, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) ConfirmTOTP(ctx context.Context, userId int64, step int64, backupCodeHashes []string) error {
+	args := m.Called(ctx, userId, step, backupCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userId int64, step int64) error {
+	args := m.Called(ctx, userId, step)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseBackupCode(ctx context.Context, userId int64, codeHash string) error {
+	args := m.Called(ctx, userId, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) DeleteTOTP(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) CreateChallenge(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) GetChallenge(ctx context.Context, tokenHash string) (mfa_db.ChallengeInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(mfa_db.ChallengeInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) RegisterChallengeAttempt(ctx context.Context, id int64) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockMFARepository) ConsumeChallenge(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// testMFASettings 2FA обязательна для администраторов
+var testMFASettings = totp.Settings{
+	Issuer:        "Booker",
+	RequiredRoles: []string{"admin"},
+	ChallengeTTL:  5 * time.Minute,
+	MaxAttempts:   5,
+}
+
+func TestLogin(t *testing.T) {
+	passwordHash, err := users.HashUserPassword("correct-password", slog.Default())
+	require.NoError(t, err)
+	// Хеш в старом формате (bcrypt), должен быть перехеширован в argon2id при входе
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		input          loginDto.LoginRequest
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "success login",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+					ID:           42,
+					Email:        "ryanGosling@gmail.com",
+					PasswordHash: passwordHash,
+					Role:         "user",
+				}, nil).Once()
+				mockRefreshRepo.On("CreateRefreshToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+		},
+		{
+			name:  "legacy hash is rehashed on login",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+					ID:           42,
+					PasswordHash: string(legacyHash),
+					Role:         "user",
+				}, nil).Once()
+				mockRepo.On("UpdatePassword", mock.Anything, int64(42), mock.MatchedBy(func(passwordHash string) bool {
+					return strings.HasPrefix(passwordHash, "$argon2id$")
+				})).Return(nil).Once()
+				mockRefreshRepo.On("CreateRefreshToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+		},
+		{
+			name:  "rehash failure does not break login",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+					ID:           42,
+					PasswordHash: string(legacyHash),
+					Role:         "user",
+				}, nil).Once()
+				mockRepo.On("UpdatePassword", mock.Anything, int64(42), mock.AnythingOfType("string")).
+					Return(errors.New("database error")).Once()
+				mockRefreshRepo.On("CreateRefreshToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+		},
+		{
+			name:  "deactivated user",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+					ID:           42,
+					PasswordHash: passwordHash,
+					Role:         "user",
+					Status:       users_db.UserStatusDeactivated,
+				}, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Учётная запись деактивирована"}`,
+		},
+		{
+			name:  "deleted user",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+					ID:           42,
+					PasswordHash: passwordHash,
+					Role:         "user",
+					Status:       users_db.UserStatusDeleted,
+				}, nil).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Неверный email или пароль"}`,
+		},
+		{
+			name:  "wrong password",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "wrong-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+					ID:           42,
+					PasswordHash: passwordHash,
+					Role:         "user",
+				}, nil).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Неверный email или пароль"}`,
+		},
+		{
+			name:  "unknown email",
+			input: loginDto.LoginRequest{Email: "unknown@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "unknown@gmail.com").
+					Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Неверный email или пароль"}`,
+		},
+		{
+			name:  "missing password",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Password is required"}`,
+		},
+		{
+			name:  "database error",
+			input: loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").
+					Return(users_db.UserInfo{}, errors.New("database error")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"internal server error"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := slog.Default()
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").
+				Return([]string{"booking:create", "booking:read"}, nil).Maybe()
+			tokenSettings := jwt_tokens.TokenSettings{
+				Keys:            testKeys,
+				AccessTokenTTL:  5 * time.Minute,
+				RefreshTokenTTL: time.Hour,
+			}
+			mockMFARepo := new(MockMFARepository)
+			mockMFARepo.On("GetTOTP", mock.Anything, mock.AnythingOfType("int64")).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Maybe()
+			mockSessionRepo := new(MockSessionRepository)
+			mockSessionRepo.On("TouchSession", mock.Anything, mock.AnythingOfType("int64"), mock.AnythingOfType("string"), mock.Anything).
+				Return(int64(11), nil).Maybe()
+			guard := login_guard.NewGuard(login_attempts.NewInMemoryStore(), testGuardSettings, logger)
+			handler := login.LoginHandler(logger, mockRepo, mockRefreshRepo, mockSessionRepo, mockPermissionRepo, mockMFARepo, guard, tokenSettings, testMFASettings, 5*time.Second)
+
+			// Настраиваем мок
+			test.setupMock(mockRepo, mockRefreshRepo)
+
+			// Создаём запрос
+			body, _ := json.Marshal(test.input)
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+			req = req.WithContext(context.WithValue(context.Background(), middleware.RequestIDKey, "test-id"))
+			w := httptest.NewRecorder()
+
+			// Вызываем хендлер
+			handler.ServeHTTP(w, req)
+
+			// Проверяем статус и тело ответа
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
+
+			// Для успешного входа проверяем, что выданный токен проходит проверку и содержит нужные claims
+			if test.expectedStatus == http.StatusOK {
+				var response loginDto.LoginResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.Equal(t, int64(300), response.ExpiresIn)
+				require.NotEmpty(t, response.RefreshToken)
+
+				claims, err := jwt_tokens.VerifyToken(response.AccessToken, testKeys)
+				require.NoError(t, err, "issued token should be valid")
+				require.Equal(t, float64(42), claims["sub"])
+				require.Equal(t, []interface{}{"booking:create", "booking:read"}, claims["permissions"])
+				require.Equal(t, "user", claims["user_role"])
+				require.NotNil(t, claims["exp"])
+				require.Equal(t, float64(11), claims["sid"], "token should be bound to the new session")
+			}
+
+			// Проверяем, что все ожидаемые вызовы мока выполнены
+			mockRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	passwordHash, err := users.HashUserPassword("correct-password", slog.Default())
+	require.NoError(t, err)
+
+	logger := slog.Default()
+	mockRepo := new(MockUserRepository)
+	mockRefreshRepo := new(MockRefreshTokenRepository)
+	mockSessionRepo := new(MockSessionRepository)
+	mockPermissionRepo := new(MockPermissionRepository)
+	mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+		ID:           42,
+		Email:        "ryanGosling@gmail.com",
+		PasswordHash: passwordHash,
+		Role:         "user",
+	}, nil)
+	mockMFARepo := new(MockMFARepository)
+	mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound)
+	store := login_attempts.NewInMemoryStore()
+	guard := login_guard.NewGuard(store, testGuardSettings, logger)
+	handler := login.LoginHandler(logger, mockRepo, mockRefreshRepo, mockSessionRepo, mockPermissionRepo, mockMFARepo, guard, jwt_tokens.TokenSettings{
+		Keys:            testKeys,
+		AccessTokenTTL:  5 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, testMFASettings, 5*time.Second)
+
+	doLogin := func(email, password, remoteAddr string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(loginDto.LoginRequest{Email: email, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < testGuardSettings.MaxAccountFailures; i++ {
+		w := doLogin("ryanGosling@gmail.com", "wrong-password", "10.0.0.1:1234")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Аккаунт заблокирован даже для правильного пароля и с другого IP
+	w := doLogin("RyanGosling@gmail.com", "correct-password", "10.0.0.2:1234")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Следующая неудачная попытка после блокировки удваивает время блокировки
+	require.NoError(t, guard.RegisterFailure(context.Background(), "ryanGosling@gmail.com", ""))
+	info, err := store.Get(context.Background(), login_attempts.AccountKey("ryangosling@gmail.com"))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(2*time.Minute), info.LockedUntil, 5*time.Second)
+
+	// После разблокировки администратором вход снова возможен
+	require.NoError(t, guard.Unlock(context.Background(), "ryanGosling@gmail.com"))
+	mockSessionRepo.On("TouchSession", mock.Anything, int64(42), mock.AnythingOfType("string"), sessions_db.ClientInfo{IP: "10.0.0.2"}).
+		Return(int64(11), nil).Once()
+	mockRefreshRepo.On("CreateRefreshToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Return(nil).Once()
+	mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return([]string{}, nil).Once()
+	w = doLogin("ryanGosling@gmail.com", "correct-password", "10.0.0.2:1234")
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoginSecondFactor(t *testing.T) {
+	passwordHash, err := users.HashUserPassword("correct-password", slog.Default())
+	require.NoError(t, err)
+	confirmedAt := time.Now()
+	tokenSettings := jwt_tokens.TokenSettings{
+		Keys:            testKeys,
+		AccessTokenTTL:  5 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}
+
+	doLogin := func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(loginDto.LoginRequest{Email: "ryanGosling@gmail.com", Password: "correct-password"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("enrolled user gets mfa token instead of tokens", func(t *testing.T) {
+		logger := slog.Default()
+		mockRepo := new(MockUserRepository)
+		mockRefreshRepo := new(MockRefreshTokenRepository)
+		mockSessionRepo := new(MockSessionRepository)
+		mockPermissionRepo := new(MockPermissionRepository)
+		mockMFARepo := new(MockMFARepository)
+		mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+			ID:           42,
+			Email:        "ryanGosling@gmail.com",
+			PasswordHash: passwordHash,
+			Role:         "user",
+		}, nil).Once()
+		mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{UserID: 42, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &confirmedAt}, nil).Once()
+		var challengeHash string
+		mockMFARepo.On("CreateChallenge", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+			Run(func(args mock.Arguments) { challengeHash = args.String(2) }).
+			Return(nil).Once()
+
+		store := login_attempts.NewInMemoryStore()
+		guard := login_guard.NewGuard(store, testGuardSettings, logger)
+		// Неудачная попытка до входа не должна сбрасываться, пока не проверен второй фактор
+		require.NoError(t, guard.RegisterFailure(context.Background(), "ryanGosling@gmail.com", ""))
+		handler := login.LoginHandler(logger, mockRepo, mockRefreshRepo, mockSessionRepo, mockPermissionRepo, mockMFARepo, guard, tokenSettings, testMFASettings, 5*time.Second)
+
+		w := doLogin(handler)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response loginDto.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.True(t, response.MFARequired)
+		require.NotEmpty(t, response.MFAToken)
+		require.Empty(t, response.AccessToken)
+		require.Empty(t, response.RefreshToken)
+		require.Equal(t, secure_tokens.Hash(response.MFAToken), challengeHash, "only token hash is stored")
+
+		info, err := store.Get(context.Background(), login_attempts.AccountKey("ryangosling@gmail.com"))
+		require.NoError(t, err)
+		require.Equal(t, 1, info.Failures)
+
+		mockRepo.AssertExpectations(t)
+		mockMFARepo.AssertExpectations(t)
+		mockRefreshRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockSessionRepo.AssertNotCalled(t, "TouchSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin without 2fa gets restricted token when policy requires 2fa", func(t *testing.T) {
+		logger := slog.Default()
+		mockRepo := new(MockUserRepository)
+		mockRefreshRepo := new(MockRefreshTokenRepository)
+		mockSessionRepo := new(MockSessionRepository)
+		mockPermissionRepo := new(MockPermissionRepository)
+		mockMFARepo := new(MockMFARepository)
+		mockRepo.On("GetUserByEmail", mock.Anything, "ryanGosling@gmail.com").Return(users_db.UserInfo{
+			ID:           42,
+			Email:        "ryanGosling@gmail.com",
+			PasswordHash: passwordHash,
+			Role:         "admin",
+		}, nil).Once()
+		mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Once()
+
+		guard := login_guard.NewGuard(login_attempts.NewInMemoryStore(), testGuardSettings, logger)
+		handler := login.LoginHandler(logger, mockRepo, mockRefreshRepo, mockSessionRepo, mockPermissionRepo, mockMFARepo, guard, tokenSettings, testMFASettings, 5*time.Second)
+
+		w := doLogin(handler)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response loginDto.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.True(t, response.MFAEnrollmentRequired)
+		require.Empty(t, response.RefreshToken)
+
+		claims, err := jwt_tokens.VerifyToken(response.AccessToken, testKeys)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{}, claims["permissions"], "restricted token has no permissions")
+
+		mockPermissionRepo.AssertNotCalled(t, "GetRolePermissions", mock.Anything, mock.Anything)
+		mockRefreshRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockSessionRepo.AssertNotCalled(t, "TouchSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,70 @@
+package login_mfa
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/mfa"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/login_guard"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/auth_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/mfa_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// LoginMFAHandler второй шаг входа для пользователей с 2FA (POST /login/2fa)
+//
+// Принимает mfa_token из ответа /login и код из приложения-аутентификатора или резервный код, возвращает токены
+func LoginMFAHandler(logger *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, guard *login_guard.Guard, tokenSettings jwt_tokens.TokenSettings, mfaSettings totp.Settings, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/login_mfa/login_mfa_handler.go/LoginMFAHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var mfaRequest mfa.LoginRequest
+		err := body.DecodeAndValidateJson(r, &mfaRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("LoginMFAHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		response, err := auth_service.CompleteMFALogin(log, userRepository, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, guard, ctx, mfaRequest, login.ClientInfo(r), tokenSettings, mfaSettings)
+		if err != nil {
+			var lockedErr *login_guard.LockedError
+			switch {
+			case errors.Is(err, auth_service.ErrInvalidMFAToken), errors.Is(err, mfa_service.ErrInvalidCode):
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(err.Error()))
+			case errors.As(err, &lockedErr), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				login.RenderGuardError(w, r, log, err)
+			default:
+				log.Error("LoginMFAHandler: error while logging in", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,383 @@
+package login_mfa_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	loginDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/mfa"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/login_guard"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/login_attempts"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testKeys = jwt_tokens.NewHMACKeySet("test-secret-key")
+
+var testGuardSettings = login_guard.Settings{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      10,
+	BaseLockout:        time.Minute,
+	MaxLockout:         time.Hour,
+	FailureWindow:      15 * time.Minute,
+}
+
+var testMFASettings = totp.Settings{
+	Issuer:        "Booker",
+	RequiredRoles: []string{"admin"},
+	ChallengeTTL:  5 * time.Minute,
+	MaxAttempts:   5,
+}
+
+// testSecret секрет TOTP пользователя в тестах
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+const testMFAToken = "mfa-token"
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	args := m.Called(ctx, sessionId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, userId int64, familyId string, client sessions_db.ClientInfo) (int64, error) {
+	args := m.Called(ctx, userId, familyId, client)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepository) ListSessions(ctx context.Context, userId int64) ([]sessions_db.SessionInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).([]sessions_db.SessionInfo), args.Error(1)
+}
+
+func (m *MockSessionRepository) TerminateSession(ctx context.Context, userId, sessionId int64) (string, error) {
+	args := m.Called(ctx, userId, sessionId)
+	return args.String(0), args.Error(1)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+func (m *MockMFARepository) GetTOTP(ctx context.Context, userId int64) (mfa_db.TOTPInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(mfa_db.TOTPInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) SaveTOTPSecret(ctx context.Context, userId int64, secret string) error {
+	args := m.Called(ctx, userId, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) ConfirmTOTP(ctx context.Context, userId int64, step int64, backupCodeHashes []string) error {
+	args := m.Called(ctx, userId, step, backupCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userId int64, step int64) error {
+	args := m.Called(ctx, userId, step)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseBackupCode(ctx context.Context, userId int64, codeHash string) error {
+	args := m.Called(ctx, userId, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) DeleteTOTP(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) CreateChallenge(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) GetChallenge(ctx context.Context, tokenHash string) (mfa_db.ChallengeInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(mfa_db.ChallengeInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) RegisterChallengeAttempt(ctx context.Context, id int64) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockMFARepository) ConsumeChallenge(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestLoginMFA(t *testing.T) {
+	confirmedAt := time.Now()
+	now := time.Now()
+	currentCode, err := totp.Code(testSecret, now)
+	require.NoError(t, err)
+	// Шаг кода, который должен быть сохранён как использованный
+	currentStep := totp.Step(now)
+	challenge := mfa_db.ChallengeInfo{ID: 7, UserID: 42, ExpiresAt: time.Now().Add(time.Minute)}
+	user := users_db.UserInfo{ID: 42, Email: "ryanGosling@gmail.com", Role: "user"}
+	totpInfo := mfa_db.TOTPInfo{UserID: 42, Secret: testSecret, ConfirmedAt: &confirmedAt}
+
+	tests := []struct {
+		name             string
+		input            mfa.LoginRequest
+		setupMock        func(*MockUserRepository, *MockMFARepository, *MockRefreshTokenRepository)
+		expectedStatus   int
+		expectedBody     string
+		expectedFailures int
+	}{
+		{
+			name:  "success with totp code",
+			input: mfa.LoginRequest{MFAToken: testMFAToken, Code: currentCode},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockMFARepo.On("GetChallenge", mock.Anything, secure_tokens.Hash(testMFAToken)).Return(challenge, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockMFARepo.On("RegisterChallengeAttempt", mock.Anything, int64(7)).Return(1, nil).Once()
+				mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(totpInfo, nil).Once()
+				mockMFARepo.On("UseTOTPStep", mock.Anything, int64(42), currentStep).Return(nil).Once()
+				mockMFARepo.On("ConsumeChallenge", mock.Anything, int64(7)).Return(nil).Once()
+				mockRefreshRepo.On("CreateRefreshToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+		},
+		{
+			name:  "success with backup code",
+			input: mfa.LoginRequest{MFAToken: testMFAToken, Code: "ABCDE FGHJK"},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockMFARepo.On("GetChallenge", mock.Anything, secure_tokens.Hash(testMFAToken)).Return(challenge, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockMFARepo.On("RegisterChallengeAttempt", mock.Anything, int64(7)).Return(1, nil).Once()
+				mockMFARepo.On("UseBackupCode", mock.Anything, int64(42), secure_tokens.Hash("abcde-fghjk")).Return(nil).Once()
+				mockMFARepo.On("ConsumeChallenge", mock.Anything, int64(7)).Return(nil).Once()
+				mockRefreshRepo.On("CreateRefreshToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+		},
+		{
+			name:  "wrong code counts as failed login",
+			input: mfa.LoginRequest{MFAToken: testMFAToken, Code: "000000"},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockMFARepo.On("GetChallenge", mock.Anything, secure_tokens.Hash(testMFAToken)).Return(challenge, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockMFARepo.On("RegisterChallengeAttempt", mock.Anything, int64(7)).Return(1, nil).Once()
+				mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(totpInfo, nil).Once()
+			},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedBody:     `{"status":"ERROR","error":"Неверный код подтверждения"}`,
+			expectedFailures: 1,
+		},
+		{
+			name:  "reused totp code",
+			input: mfa.LoginRequest{MFAToken: testMFAToken, Code: currentCode},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockMFARepo.On("GetChallenge", mock.Anything, secure_tokens.Hash(testMFAToken)).Return(challenge, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockMFARepo.On("RegisterChallengeAttempt", mock.Anything, int64(7)).Return(1, nil).Once()
+				mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(totpInfo, nil).Once()
+				mockMFARepo.On("UseTOTPStep", mock.Anything, int64(42), currentStep).Return(mfa_db.ErrTOTPStepUsed).Once()
+			},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedBody:     `{"status":"ERROR","error":"Неверный код подтверждения"}`,
+			expectedFailures: 1,
+		},
+		{
+			name:  "too many attempts for one challenge",
+			input: mfa.LoginRequest{MFAToken: testMFAToken, Code: currentCode},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockMFARepo.On("GetChallenge", mock.Anything, secure_tokens.Hash(testMFAToken)).Return(challenge, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockMFARepo.On("RegisterChallengeAttempt", mock.Anything, int64(7)).Return(6, nil).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Токен второго шага входа недействителен или истёк, войдите заново"}`,
+		},
+		{
+			name:  "unknown or expired mfa token",
+			input: mfa.LoginRequest{MFAToken: testMFAToken, Code: currentCode},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockMFARepo.On("GetChallenge", mock.Anything, secure_tokens.Hash(testMFAToken)).Return(mfa_db.ChallengeInfo{}, mfa_db.ErrChallengeInvalid).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Токен второго шага входа недействителен или истёк, войдите заново"}`,
+		},
+		{
+			name:  "missing code",
+			input: mfa.LoginRequest{MFAToken: testMFAToken},
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Code is required"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := slog.Default()
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockMFARepo := new(MockMFARepository)
+			mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").
+				Return([]string{"booking:create", "booking:read"}, nil).Maybe()
+			mockSessionRepo := new(MockSessionRepository)
+			mockSessionRepo.On("TouchSession", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.Anything).
+				Return(int64(11), nil).Maybe()
+			test.setupMock(mockRepo, mockMFARepo, mockRefreshRepo)
+
+			store := login_attempts.NewInMemoryStore()
+			guard := login_guard.NewGuard(store, testGuardSettings, logger)
+			tokenSettings := jwt_tokens.TokenSettings{
+				Keys:            testKeys,
+				AccessTokenTTL:  5 * time.Minute,
+				RefreshTokenTTL: time.Hour,
+			}
+			handler := login_mfa.LoginMFAHandler(logger, mockRepo, mockRefreshRepo, mockSessionRepo, mockPermissionRepo, mockMFARepo, guard, tokenSettings, testMFASettings, 5*time.Second)
+
+			body, _ := json.Marshal(test.input)
+			req := httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
+
+			if test.expectedStatus == http.StatusOK {
+				var response loginDto.LoginResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.NotEmpty(t, response.RefreshToken)
+				claims, err := jwt_tokens.VerifyToken(response.AccessToken, testKeys)
+				require.NoError(t, err)
+				require.Equal(t, float64(42), claims["sub"])
+				require.Equal(t, float64(11), claims["sid"])
+			}
+
+			info, err := store.Get(context.Background(), login_attempts.AccountKey("ryangosling@gmail.com"))
+			require.NoError(t, err)
+			require.Equal(t, test.expectedFailures, info.Failures)
+
+			mockRepo.AssertExpectations(t)
+			mockMFARepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package logout
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	logoutDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/logout"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/token_denylist"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/auth_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// LogoutHandler отзывает текущий токен доступа (и, опционально, семейство refresh токенов)
+//
+// Должен вызываться внутри группы с AuthMiddleware
+func LogoutHandler(logger *slog.Logger, denylist token_denylist.TokenDenylist, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/logout/logout_handler.go/LogoutHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("LogoutHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		// Тело запроса необязательное
+		var logoutRequest logoutDto.LogoutRequest
+		if r.ContentLength != 0 {
+			if err := body.DecodeAndValidateJson(r, &logoutRequest); err != nil {
+				log.Error("LogoutHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+		}
+
+		err := auth_service.Logout(log, denylist, refreshTokenRepository, ctx, principal, logoutRequest.RefreshToken)
+		if err != nil {
+			if errors.Is(err, auth_service.ErrInvalidAccessToken) {
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(err.Error()))
+				return
+			}
+			log.Error("LogoutHandler: error while logging out", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
@@ -0,0 +1,161 @@
+package oidc_login
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/auth_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/identities_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// StateCookieName cookie с подписанным состоянием незавершённого входа через SSO
+const StateCookieName = "booker_oidc_state"
+
+// stateCookiePath cookie нужна только обработчику возврата от провайдера
+const stateCookiePath = "/login/oidc"
+
+// CookieSettings настройки cookie состояния входа. Key - ключ HMAC подписи
+type CookieSettings struct {
+	Key    []byte
+	Secure bool
+}
+
+// StartHandler начинает вход через SSO: сохраняет state, nonce и code_verifier PKCE в подписанной cookie
+// и перенаправляет пользователя на страницу входа провайдера
+func StartHandler(logger *slog.Logger, provider *oidc.Provider, cookieSettings CookieSettings, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/oidc_login/oidc_login_handler.go/StartHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		state, err := oidc.NewAuthState(provider.Settings().StateTTL, time.Now())
+		if err != nil {
+			log.Error("Failed to generate oidc state", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		authURL, err := provider.AuthCodeURL(ctx, state)
+		if err != nil {
+			renderProviderError(w, r, log, err)
+			return
+		}
+		cookieValue, err := oidc.EncodeState(state, cookieSettings.Key)
+		if err != nil {
+			log.Error("Failed to encode oidc state", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     StateCookieName,
+			Value:    cookieValue,
+			Path:     stateCookiePath,
+			MaxAge:   int(provider.Settings().StateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   cookieSettings.Secure,
+			// Lax, а не Strict: cookie должна прийти при переходе с сайта провайдера
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// CallbackHandler обрабатывает возврат от провайдера: сверяет state, обменивает код на ID токен
+// и входит пользователем (см. auth_service.LoginOIDC). Ответ такой же, как у /login
+func CallbackHandler(logger *slog.Logger, provider *oidc.Provider, userRepository users_db.UserRepository, identityRepository identities_db.IdentityRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, mfaRepository mfa_db.MFARepository, auditRepository audit_db.AuditRepository, cookieSettings CookieSettings, tokenSettings jwt_tokens.TokenSettings, mfaSettings totp.Settings, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/oidc_login/oidc_login_handler.go/CallbackHandler"))
+
+		// Состояние одноразовое, cookie удаляется при любом исходе
+		http.SetCookie(w, &http.Cookie{
+			Name:     StateCookieName,
+			Value:    "",
+			Path:     stateCookiePath,
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   cookieSettings.Secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		query := r.URL.Query()
+		if idpError := query.Get("error"); idpError != "" {
+			log.Info("SSO provider returned error", "error", idpError, "description", query.Get("error_description"))
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("SSO login failed: "+idpError))
+			return
+		}
+		cookie, err := r.Cookie(StateCookieName)
+		if err != nil {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(oidc.ErrInvalidState.Error()))
+			return
+		}
+		state, err := oidc.DecodeState(cookie.Value, cookieSettings.Key, time.Now())
+		if err != nil || query.Get("state") != state.State {
+			log.Warn("OIDC state mismatch")
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(oidc.ErrInvalidState.Error()))
+			return
+		}
+		code := query.Get("code")
+		if code == "" {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("field code is required"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		claims, err := provider.Exchange(ctx, code, state)
+		if err != nil {
+			renderProviderError(w, r, log, err)
+			return
+		}
+
+		response, err := auth_service.LoginOIDC(log, userRepository, identityRepository, refreshTokenRepository, sessionRepository, permissionRepository, mfaRepository, auditRepository, ctx, claims, login.ClientInfo(r), provider.Settings(), tokenSettings, mfaSettings)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth_service.ErrUserDeactivated),
+				errors.Is(err, auth_service.ErrSSOEmailMissing),
+				errors.Is(err, auth_service.ErrSSOEmailNotVerified),
+				errors.Is(err, auth_service.ErrSSOProvisioningDisabled):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			case errors.Is(err, auth_service.ErrSSOAccountConflict):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("CallbackHandler: error while logging in", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// renderProviderError отвечает на ошибку обращения к провайдеру SSO
+func renderProviderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+		log.Warn("SSO login rejected", "err", err)
+		resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("SSO login failed"))
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		log.Warn("Request canceled or timed out", slog.Any("err", err))
+		resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+	default:
+		log.Error("SSO provider is unavailable", "err", err)
+		resp.RenderResponse(w, r, http.StatusBadGateway, resp.Error("SSO provider is unavailable"))
+	}
+}
@@ -0,0 +1,573 @@
+package oidc_login_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	loginDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/oidc/oidctest"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/oidc_login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/identities_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKeys = jwt_tokens.NewHMACKeySet("test-secret-key")
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	args := m.Called(ctx, sessionId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, userId int64, familyId string, client sessions_db.ClientInfo) (int64, error) {
+	args := m.Called(ctx, userId, familyId, client)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepository) ListSessions(ctx context.Context, userId int64) ([]sessions_db.SessionInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).([]sessions_db.SessionInfo), args.Error(1)
+}
+
+func (m *MockSessionRepository) TerminateSession(ctx context.Context, userId, sessionId int64) (string, error) {
+	args := m.Called(ctx, userId, sessionId)
+	return args.String(0), args.Error(1)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+func (m *MockMFARepository) GetTOTP(ctx context.Context, userId int64) (mfa_db.TOTPInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(mfa_db.TOTPInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) SaveTOTPSecret(ctx context.Context, userId int64, secret string) error {
+	args := m.Called(ctx, userId, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) ConfirmTOTP(ctx context.Context, userId int64, step int64, backupCodeHashes []string) error {
+	args := m.Called(ctx, userId, step, backupCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userId int64, step int64) error {
+	args := m.Called(ctx, userId, step)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseBackupCode(ctx context.Context, userId int64, codeHash string) error {
+	args := m.Called(ctx, userId, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) DeleteTOTP(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) CreateChallenge(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) GetChallenge(ctx context.Context, tokenHash string) (mfa_db.ChallengeInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(mfa_db.ChallengeInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) RegisterChallengeAttempt(ctx context.Context, id int64) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockMFARepository) ConsumeChallenge(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockIdentityRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdentityRepository) GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int64, error) {
+	args := m.Called(ctx, issuer, subject)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockIdentityRepository) LinkIdentity(ctx context.Context, userId int64, issuer, subject string) error {
+	args := m.Called(ctx, userId, issuer, subject)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) ProvisionUser(ctx context.Context, userinfo *create_user.UserCreate, role string, emailVerified bool, issuer, subject string) (int64, error) {
+	args := m.Called(ctx, userinfo, role, emailVerified, issuer, subject)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+// testMFASettings 2FA обязательна для администраторов
+var testMFASettings = totp.Settings{
+	Issuer:        "Booker",
+	RequiredRoles: []string{"admin"},
+	ChallengeTTL:  5 * time.Minute,
+	MaxAttempts:   5,
+}
+
+const redirectURL = "http://booker.local/login/oidc/callback"
+
+var testCookieSettings = oidc_login.CookieSettings{Key: []byte("state-secret")}
+
+// noRedirectClient не следует за редиректами, что б тест мог прочитать код из Location
+var noRedirectClient = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+type mocks struct {
+	users       *MockUserRepository
+	identities  *MockIdentityRepository
+	refresh     *MockRefreshTokenRepository
+	sessions    *MockSessionRepository
+	permissions *MockPermissionRepository
+	mfa         *MockMFARepository
+	audit       *MockAuditRepository
+}
+
+func newMocks() mocks {
+	m := mocks{
+		users:       new(MockUserRepository),
+		identities:  new(MockIdentityRepository),
+		refresh:     new(MockRefreshTokenRepository),
+		sessions:    new(MockSessionRepository),
+		permissions: new(MockPermissionRepository),
+		mfa:         new(MockMFARepository),
+		audit:       new(MockAuditRepository),
+	}
+	m.permissions.On("GetRolePermissions", mock.Anything, "user").Return([]string{"booking:create", "booking:read"}, nil).Maybe()
+	m.permissions.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"user:manage"}, nil).Maybe()
+	m.permissions.On("GetRolePermissions", mock.Anything, "ghost").Return([]string{}, nil).Maybe()
+	m.refresh.On("CreateRefreshToken", mock.Anything, mock.AnythingOfType("int64"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Maybe()
+	m.sessions.On("TouchSession", mock.Anything, mock.AnythingOfType("int64"), mock.AnythingOfType("string"), mock.Anything).Return(int64(11), nil).Maybe()
+	m.audit.On("Record", mock.Anything, mock.Anything).Return(nil).Maybe()
+	return m
+}
+
+// loginThroughIdP проходит весь поток: /login/oidc -> страница входа IdP -> /login/oidc/callback
+func loginThroughIdP(t *testing.T, provider *oidc.Provider, m mocks) *httptest.ResponseRecorder {
+	logger := slog.Default()
+
+	start := oidc_login.StartHandler(logger, provider, testCookieSettings, 5*time.Second)
+	w := httptest.NewRecorder()
+	start.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, oidc_login.StateCookieName, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, oidc.CodeChallengeMethod, authURL.Query().Get("code_challenge_method"))
+	require.NotEmpty(t, authURL.Query().Get("code_challenge"))
+
+	res, err := noRedirectClient.Get(authURL.String())
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	callbackURL, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+
+	return callback(provider, m, callbackURL.RawQuery, cookies[0])
+}
+
+func callback(provider *oidc.Provider, m mocks, rawQuery string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	tokenSettings := jwt_tokens.TokenSettings{
+		Keys:            testKeys,
+		AccessTokenTTL:  5 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}
+	handler := oidc_login.CallbackHandler(slog.Default(), provider, m.users, m.identities, m.refresh, m.sessions, m.permissions, m.mfa, m.audit, testCookieSettings, tokenSettings, testMFASettings, 5*time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?"+rawQuery, nil)
+	req = req.WithContext(context.WithValue(context.Background(), middleware.RequestIDKey, "test-id"))
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := oidctest.New("booker", "client-secret")
+	defer idp.Close()
+	issuer := idp.Issuer()
+
+	idpUser := oidctest.User{
+		Subject:       "idp-user-1",
+		Email:         "sso@example.com",
+		EmailVerified: true,
+		GivenName:     "Ivan",
+		FamilyName:    "Petrov",
+		Groups:        []string{"staff"},
+	}
+
+	tests := []struct {
+		name           string
+		user           oidctest.User
+		autoProvision  bool
+		mapping        []oidc.RoleMapping
+		setupMock      func(m mocks)
+		expectedStatus int
+		expectedBody   string
+		expectedRole   string
+	}{
+		{
+			name:          "linked identity",
+			user:          idpUser,
+			autoProvision: true,
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-1").Return(int64(42), nil).Once()
+				m.users.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Email: "sso@example.com", Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				m.mfa.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+			expectedRole:   "user",
+		},
+		{
+			name:          "existing user is linked by verified email and role is synced from groups",
+			user:          idpUser,
+			autoProvision: true,
+			mapping:       []oidc.RoleMapping{{Group: "staff", Role: "user"}},
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-1").Return(int64(0), identities_db.ErrIdentityNotFound).Once()
+				m.users.On("GetUserByEmail", mock.Anything, "sso@example.com").Return(users_db.UserInfo{ID: 42, Email: "sso@example.com", Role: "manager", Status: users_db.UserStatusActive}, nil).Once()
+				m.identities.On("LinkIdentity", mock.Anything, int64(42), issuer, "idp-user-1").Return(nil).Once()
+				m.users.On("UpdateRole", mock.Anything, int64(42), "user").Return(nil).Once()
+				m.mfa.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+			expectedRole:   "user",
+		},
+		{
+			name:          "new user is provisioned with mapped role",
+			user:          oidctest.User{Subject: "idp-user-2", Email: "new@example.com", EmailVerified: true, GivenName: "Anna", Groups: []string{"idp-admins", "staff"}},
+			autoProvision: true,
+			mapping:       []oidc.RoleMapping{{Group: "idp-admins", Role: "admin"}, {Group: "staff", Role: "user"}},
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-2").Return(int64(0), identities_db.ErrIdentityNotFound).Once()
+				m.users.On("GetUserByEmail", mock.Anything, "new@example.com").Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+				m.identities.On("ProvisionUser", mock.Anything, mock.MatchedBy(func(u *create_user.UserCreate) bool {
+					return u.Email == "new@example.com" && u.FirstName == "Anna" && strings.HasPrefix(u.Password, "$argon2id$")
+				}), "admin", true, issuer, "idp-user-2").Return(int64(43), nil).Once()
+				m.users.On("GetUser", mock.Anything, int64(43)).Return(users_db.UserInfo{ID: 43, Email: "new@example.com", Role: "admin", Status: users_db.UserStatusActive}, nil).Once()
+				m.mfa.On("GetTOTP", mock.Anything, int64(43)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Once()
+			},
+			// Для администраторов 2FA обязательна, поэтому выдаётся только токен для её подключения
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"mfa_enrollment_required":true`,
+		},
+		{
+			name:          "mapping to unknown role falls back to default role",
+			user:          oidctest.User{Subject: "idp-user-2", Email: "new@example.com", EmailVerified: true, Groups: []string{"ghosts"}},
+			autoProvision: true,
+			mapping:       []oidc.RoleMapping{{Group: "ghosts", Role: "ghost"}},
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-2").Return(int64(0), identities_db.ErrIdentityNotFound).Once()
+				m.users.On("GetUserByEmail", mock.Anything, "new@example.com").Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+				m.identities.On("ProvisionUser", mock.Anything, mock.MatchedBy(func(u *create_user.UserCreate) bool {
+					return u.FirstName == "new"
+				}), "user", true, issuer, "idp-user-2").Return(int64(43), nil).Once()
+				m.users.On("GetUser", mock.Anything, int64(43)).Return(users_db.UserInfo{ID: 43, Email: "new@example.com", Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				m.mfa.On("GetTOTP", mock.Anything, int64(43)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+			expectedRole:   "user",
+		},
+		{
+			name:          "linked user with 2FA gets second step",
+			user:          idpUser,
+			autoProvision: true,
+			setupMock: func(m mocks) {
+				confirmedAt := time.Now()
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-1").Return(int64(42), nil).Once()
+				m.users.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				m.mfa.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{UserID: 42, ConfirmedAt: &confirmedAt}, nil).Once()
+				m.mfa.On("CreateChallenge", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"mfa_required":true`,
+		},
+		{
+			name:          "unverified email is not linked",
+			user:          oidctest.User{Subject: "idp-user-3", Email: "sso@example.com", EmailVerified: false},
+			autoProvision: true,
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-3").Return(int64(0), identities_db.ErrIdentityNotFound).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Email не подтверждён провайдером SSO, привязать учётную запись нельзя"}`,
+		},
+		{
+			name:          "email already linked to another identity",
+			user:          idpUser,
+			autoProvision: true,
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-1").Return(int64(0), identities_db.ErrIdentityNotFound).Once()
+				m.users.On("GetUserByEmail", mock.Anything, "sso@example.com").Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				m.identities.On("LinkIdentity", mock.Anything, int64(42), issuer, "idp-user-1").Return(identities_db.ErrIdentityAlreadyLinked).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Учётная запись с этим email уже привязана к другому пользователю SSO"}`,
+		},
+		{
+			name:          "auto provisioning disabled",
+			user:          idpUser,
+			autoProvision: false,
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-1").Return(int64(0), identities_db.ErrIdentityNotFound).Once()
+				m.users.On("GetUserByEmail", mock.Anything, "sso@example.com").Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Пользователь не найден, а автоматическое создание учётных записей отключено"}`,
+		},
+		{
+			name:          "deactivated linked user",
+			user:          idpUser,
+			autoProvision: true,
+			setupMock: func(m mocks) {
+				m.identities.On("GetUserIDByIdentity", mock.Anything, issuer, "idp-user-1").Return(int64(42), nil).Once()
+				m.users.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user", Status: users_db.UserStatusDeactivated}, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Учётная запись деактивирована"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := idp.Settings(redirectURL)
+			settings.AutoProvision = test.autoProvision
+			settings.RoleMapping = test.mapping
+			provider := oidc.NewProvider(settings, nil)
+			idp.SetUser(test.user)
+
+			m := newMocks()
+			test.setupMock(m)
+
+			w := loginThroughIdP(t, provider, m)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status: %s", w.Body.String())
+			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
+
+			if test.expectedRole != "" {
+				var response loginDto.LoginResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.NotEmpty(t, response.RefreshToken)
+				claims, err := jwt_tokens.VerifyToken(response.AccessToken, testKeys)
+				require.NoError(t, err)
+				require.Equal(t, test.expectedRole, claims["user_role"])
+				require.Equal(t, float64(11), claims["sid"])
+			}
+
+			m.users.AssertExpectations(t)
+			m.identities.AssertExpectations(t)
+			m.mfa.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidState(t *testing.T) {
+	idp := oidctest.New("booker", "client-secret")
+	defer idp.Close()
+	provider := oidc.NewProvider(idp.Settings(redirectURL), nil)
+
+	state, err := oidc.NewAuthState(time.Minute, time.Now())
+	require.NoError(t, err)
+	value, err := oidc.EncodeState(state, testCookieSettings.Key)
+	require.NoError(t, err)
+	cookie := &http.Cookie{Name: oidc_login.StateCookieName, Value: value}
+
+	tests := []struct {
+		name           string
+		query          string
+		cookie         *http.Cookie
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "missing cookie",
+			query:          "code=abc&state=" + state.State,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"state входа через SSO недействителен или истёк"}`,
+		},
+		{
+			name:           "state mismatch",
+			query:          "code=abc&state=other",
+			cookie:         cookie,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"state входа через SSO недействителен или истёк"}`,
+		},
+		{
+			name:           "forged cookie",
+			query:          "code=abc&state=" + state.State,
+			cookie:         &http.Cookie{Name: oidc_login.StateCookieName, Value: value + "x"},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"state входа через SSO недействителен или истёк"}`,
+		},
+		{
+			name:           "provider returned error",
+			query:          "error=access_denied&state=" + state.State,
+			cookie:         cookie,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"SSO login failed: access_denied"}`,
+		},
+		{
+			name:           "unknown code",
+			query:          "code=unknown&state=" + state.State,
+			cookie:         cookie,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"SSO login failed"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMocks()
+			w := callback(provider, m, test.query, test.cookie)
+
+			require.Equal(t, test.expectedStatus, w.Code)
+			require.Equal(t, test.expectedBody, strings.TrimSpace(w.Body.String()))
+			m.identities.AssertNotCalled(t, "GetUserIDByIdentity", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
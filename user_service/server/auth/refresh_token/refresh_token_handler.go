@@ -0,0 +1,65 @@
+package refresh_token
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	refreshTokenDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/refresh_token"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/permissions_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/auth_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/login"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RefreshTokenHandler обменивает refresh токен на новую пару токенов
+func RefreshTokenHandler(logger *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, sessionRepository sessions_db.SessionRepository, permissionRepository permissions_db.PermissionRepository, tokenSettings jwt_tokens.TokenSettings, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/refresh_token/refresh_token_handler.go/RefreshTokenHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var refreshRequest refreshTokenDto.RefreshTokenRequest
+		err := body.DecodeAndValidateJson(r, &refreshRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("RefreshTokenHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		response, err := auth_service.RefreshTokens(log, userRepository, refreshTokenRepository, sessionRepository, permissionRepository, ctx, refreshRequest.RefreshToken, login.ClientInfo(r), tokenSettings)
+		if err != nil {
+			if errors.Is(err, auth_service.ErrInvalidRefreshToken) || errors.Is(err, auth_service.ErrRefreshTokenReused) {
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+				return
+			}
+			log.Error("RefreshTokenHandler: error while refreshing tokens", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
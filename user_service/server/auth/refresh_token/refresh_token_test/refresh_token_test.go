@@ -0,0 +1,319 @@
+package refresh_token_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	loginDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/login"
+	refreshTokenDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/refresh_token"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/refresh_token"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testKeys = jwt_tokens.NewHMACKeySet("test-secret-key")
+
+const testRefreshToken = "test-refresh-token"
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	args := m.Called(ctx, sessionId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, userId int64, familyId string, client sessions_db.ClientInfo) (int64, error) {
+	args := m.Called(ctx, userId, familyId, client)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepository) ListSessions(ctx context.Context, userId int64) ([]sessions_db.SessionInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).([]sessions_db.SessionInfo), args.Error(1)
+}
+
+func (m *MockSessionRepository) TerminateSession(ctx context.Context, userId, sessionId int64) (string, error) {
+	args := m.Called(ctx, userId, sessionId)
+	return args.String(0), args.Error(1)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func TestRefreshToken(t *testing.T) {
+	usedAt := time.Now().Add(-time.Minute)
+	tokenHash := secure_tokens.Hash(testRefreshToken)
+
+	tests := []struct {
+		name           string
+		input          refreshTokenDto.RefreshTokenRequest
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository)
+		sessionErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "success rotation",
+			input: refreshTokenDto.RefreshTokenRequest{RefreshToken: testRefreshToken},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRefreshRepo.On("GetRefreshToken", mock.Anything, tokenHash).Return(refresh_tokens_db.RefreshTokenInfo{
+					ID:        7,
+					UserID:    42,
+					FamilyID:  "family",
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user"}, nil).Once()
+				mockRefreshRepo.On("RotateRefreshToken", mock.Anything, int64(7), mock.MatchedBy(func(newHash string) bool {
+					return newHash != tokenHash
+				}), mock.AnythingOfType("time.Time")).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"token_type":"Bearer"`,
+		},
+		{
+			name:  "reused token revokes family",
+			input: refreshTokenDto.RefreshTokenRequest{RefreshToken: testRefreshToken},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRefreshRepo.On("GetRefreshToken", mock.Anything, tokenHash).Return(refresh_tokens_db.RefreshTokenInfo{
+					ID:        7,
+					UserID:    42,
+					FamilyID:  "family",
+					ExpiresAt: time.Now().Add(time.Hour),
+					UsedAt:    &usedAt,
+				}, nil).Once()
+				mockRefreshRepo.On("RevokeFamily", mock.Anything, "family").Return(nil).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Refresh токен уже был использован, все сессии этого входа завершены"}`,
+		},
+		{
+			name:  "concurrent rotation revokes family",
+			input: refreshTokenDto.RefreshTokenRequest{RefreshToken: testRefreshToken},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRefreshRepo.On("GetRefreshToken", mock.Anything, tokenHash).Return(refresh_tokens_db.RefreshTokenInfo{
+					ID:        7,
+					UserID:    42,
+					FamilyID:  "family",
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user"}, nil).Once()
+				mockRefreshRepo.On("RotateRefreshToken", mock.Anything, int64(7), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+					Return(refresh_tokens_db.ErrRefreshTokenAlreadyUsed).Once()
+				mockRefreshRepo.On("RevokeFamily", mock.Anything, "family").Return(nil).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Refresh токен уже был использован, все сессии этого входа завершены"}`,
+		},
+		{
+			name:  "terminated session",
+			input: refreshTokenDto.RefreshTokenRequest{RefreshToken: testRefreshToken},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRefreshRepo.On("GetRefreshToken", mock.Anything, tokenHash).Return(refresh_tokens_db.RefreshTokenInfo{
+					ID:        7,
+					UserID:    42,
+					FamilyID:  "family",
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil).Once()
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42, Role: "user"}, nil).Once()
+				// Нет вызова RotateRefreshToken, так как сессия уже завершена
+			},
+			sessionErr:     sessions_db.ErrSessionTerminated,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Refresh токен недействителен"}`,
+		},
+		{
+			name:  "expired token",
+			input: refreshTokenDto.RefreshTokenRequest{RefreshToken: testRefreshToken},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRefreshRepo.On("GetRefreshToken", mock.Anything, tokenHash).Return(refresh_tokens_db.RefreshTokenInfo{
+					ID:        7,
+					UserID:    42,
+					FamilyID:  "family",
+					ExpiresAt: time.Now().Add(-time.Hour),
+				}, nil).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Refresh токен недействителен"}`,
+		},
+		{
+			name:  "unknown token",
+			input: refreshTokenDto.RefreshTokenRequest{RefreshToken: testRefreshToken},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRefreshRepo.On("GetRefreshToken", mock.Anything, tokenHash).
+					Return(refresh_tokens_db.RefreshTokenInfo{}, refresh_tokens_db.ErrRefreshTokenNotFound).Once()
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Refresh токен недействителен"}`,
+		},
+		{
+			name:  "missing token",
+			input: refreshTokenDto.RefreshTokenRequest{},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field RefreshToken is required"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := slog.Default()
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").
+				Return([]string{"booking:create", "booking:read"}, nil).Maybe()
+			tokenSettings := jwt_tokens.TokenSettings{
+				Keys:            testKeys,
+				AccessTokenTTL:  5 * time.Minute,
+				RefreshTokenTTL: time.Hour,
+			}
+			mockSessionRepo := new(MockSessionRepository)
+			mockSessionRepo.On("TouchSession", mock.Anything, int64(42), "family", mock.Anything).
+				Return(int64(11), test.sessionErr).Maybe()
+			handler := refresh_token.RefreshTokenHandler(logger, mockRepo, mockRefreshRepo, mockSessionRepo, mockPermissionRepo, tokenSettings, 5*time.Second)
+
+			// Настраиваем мок
+			test.setupMock(mockRepo, mockRefreshRepo)
+
+			// Создаём запрос
+			body, _ := json.Marshal(test.input)
+			req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader(body))
+			req = req.WithContext(context.WithValue(context.Background(), middleware.RequestIDKey, "test-id"))
+			w := httptest.NewRecorder()
+
+			// Вызываем хендлер
+			handler.ServeHTTP(w, req)
+
+			// Проверяем статус и тело ответа
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
+
+			// При успешной ротации выдаётся новый refresh токен и валидный токен доступа
+			if test.expectedStatus == http.StatusOK {
+				var response loginDto.LoginResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.NotEmpty(t, response.RefreshToken)
+				require.NotEqual(t, testRefreshToken, response.RefreshToken)
+
+				claims, err := jwt_tokens.VerifyToken(response.AccessToken, testKeys)
+				require.NoError(t, err, "issued token should be valid")
+				require.Equal(t, float64(42), claims["sub"])
+				require.Equal(t, []interface{}{"booking:create", "booking:read"}, claims["permissions"])
+				require.Equal(t, float64(11), claims["sid"], "token should stay bound to the session of the family")
+			}
+
+			// Проверяем, что все ожидаемые вызовы мока выполнены
+			mockRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package reset_password
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/password_reset"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/password_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/password_reset_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ResetPasswordHandler устанавливает новый пароль по токену из письма и завершает все сессии пользователя
+func ResetPasswordHandler(logger *slog.Logger, userRepository users_db.UserRepository, resetRepository password_reset_db.PasswordResetRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/reset_password/reset_password_handler.go/ResetPasswordHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var resetRequest password_reset.ResetPasswordRequest
+		err := body.DecodeAndValidateJson(r, &resetRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("ResetPasswordHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		err = password_service.ResetPassword(log, userRepository, resetRepository, refreshTokenRepository, ctx, resetRequest.Token, resetRequest.Password)
+		if err != nil {
+			if errors.Is(err, password_service.ErrInvalidResetToken) {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+				return
+			}
+			log.Error("ResetPasswordHandler: error while resetting password", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
@@ -0,0 +1,190 @@
+package reset_password_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/password_reset"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/auth/reset_password"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/password_reset_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+type MockPasswordResetRepository struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepository) CreateResetToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepository) ConsumeResetToken(ctx context.Context, tokenHash string) (int64, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestResetPassword(t *testing.T) {
+	const resetToken = "reset-token"
+	tokenHash := secure_tokens.Hash(resetToken)
+
+	tests := []struct {
+		name           string
+		input          password_reset.ResetPasswordRequest
+		setupMock      func(*MockUserRepository, *MockPasswordResetRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "success reset revokes all sessions",
+			input: password_reset.ResetPasswordRequest{Token: resetToken, Password: "new-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockResetRepo *MockPasswordResetRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockResetRepo.On("ConsumeResetToken", mock.Anything, tokenHash).Return(int64(42), nil).Once()
+				mockRepo.On("UpdatePassword", mock.Anything, int64(42), mock.MatchedBy(func(passwordHash string) bool {
+					return users.ComparePassword(passwordHash, "new-password", slog.Default())
+				})).Return(nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:  "used or expired token",
+			input: password_reset.ResetPasswordRequest{Token: resetToken, Password: "new-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockResetRepo *MockPasswordResetRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockResetRepo.On("ConsumeResetToken", mock.Anything, tokenHash).Return(int64(0), password_reset_db.ErrResetTokenInvalid).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Токен сброса пароля недействителен или истёк"}`,
+		},
+		{
+			name:  "missing token",
+			input: password_reset.ResetPasswordRequest{Password: "new-password"},
+			setupMock: func(mockRepo *MockUserRepository, mockResetRepo *MockPasswordResetRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Token is required"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockResetRepo := new(MockPasswordResetRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			test.setupMock(mockRepo, mockResetRepo, mockRefreshRepo)
+			handler := reset_password.ResetPasswordHandler(slog.Default(), mockRepo, mockResetRepo, mockRefreshRepo, 5*time.Second)
+
+			body, _ := json.Marshal(test.input)
+			req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockResetRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
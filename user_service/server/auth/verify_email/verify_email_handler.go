@@ -0,0 +1,47 @@
+package verify_email
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/email_verification_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// VerifyEmailHandler подтверждает email по токену из ссылки GET /verify-email?token=...
+//
+// Новый статус попадает в claim email_verified при следующей выдаче токена доступа (вход или обновление токена)
+func VerifyEmailHandler(logger *slog.Logger, verificationRepository email_verification_db.EmailVerificationRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/auth/verify_email/verify_email_handler.go/VerifyEmailHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("field token is required"))
+			return
+		}
+
+		err := email_verification_service.VerifyEmail(log, verificationRepository, ctx, token)
+		if err != nil {
+			if errors.Is(err, email_verification_service.ErrInvalidVerificationToken) {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+				return
+			}
+			log.Error("VerifyEmailHandler: error while verifying email", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
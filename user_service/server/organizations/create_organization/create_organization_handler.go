@@ -0,0 +1,73 @@
+package create_organization
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/organizations"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/organization_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CreateOrganizationHandler создаёт организацию (POST /organizations)
+//
+// Доступен только с разрешением organization:manage администраторам организации по умолчанию.
+// Первого администратора новой организации создаёт команда create-admin --org
+func CreateOrganizationHandler(logger *slog.Logger, organizationRepository organizations_db.OrganizationRepository, auditRepository audit_db.AuditRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/organizations/create_organization/create_organization_handler.go/CreateOrganizationHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("CreateOrganizationHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var createRequest organizations.CreateOrganizationRequest
+		err := body.DecodeAndValidateJson(r, &createRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("CreateOrganizationHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		response, err := organization_service.Create(log, organizationRepository, auditRepository, ctx, principal, createRequest)
+		if err != nil {
+			switch {
+			case errors.Is(err, organization_service.ErrNotSystemAdmin):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			case errors.Is(err, organizations_db.ErrOrganizationAlreadyExists):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("CreateOrganizationHandler: error while creating organization", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusCreated, response)
+	}
+}
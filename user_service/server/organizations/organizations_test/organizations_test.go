@@ -0,0 +1,142 @@
+package organizations_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/organizations/create_organization"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockOrganizationRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrganizationRepository) CreateOrganization(ctx context.Context, name string) (int64, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) EnsureOrganization(ctx context.Context, name string) (int64, bool, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(int64), args.Bool(1), args.Error(2)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func TestCreateOrganizationHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		tenantId       int64
+		setupMock      func(*MockOrganizationRepository, *MockAuditRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:     "system admin creates organization",
+			body:     `{"name":"Acme"}`,
+			tenantId: 1,
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				mockOrgRepo.On("CreateOrganization", mock.Anything, "Acme").Return(int64(12), nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionOrganizationCreated && entry.TargetType == audit_db.TargetOrganization &&
+						entry.TargetID == 12 && entry.ActorID == 1
+				})).Return(nil).Once()
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"status":"OK","id":12}`,
+		},
+		{
+			// Токены без claim tenant_id относятся к организации по умолчанию
+			name:     "token without tenant is the default organization",
+			body:     `{"name":"Acme"}`,
+			tenantId: 0,
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				mockOrgRepo.On("CreateOrganization", mock.Anything, "Acme").Return(int64(12), nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.AnythingOfType("audit_db.Entry")).Return(nil).Once()
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"status":"OK","id":12}`,
+		},
+		{
+			name:     "admin of another organization is forbidden",
+			body:     `{"name":"Acme"}`,
+			tenantId: 7,
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				// Нет вызова мока, так как организацию создаёт только администратор организации по умолчанию
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Создавать организации могут только администраторы организации по умолчанию"}`,
+		},
+		{
+			name:     "name is taken",
+			body:     `{"name":"Acme"}`,
+			tenantId: 1,
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				mockOrgRepo.On("CreateOrganization", mock.Anything, "Acme").Return(int64(0), organizations_db.ErrOrganizationAlreadyExists).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Организация с таким названием уже существует"}`,
+		},
+		{
+			name:     "name is required",
+			body:     `{}`,
+			tenantId: 1,
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				// Нет вызова мока, так как тело не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Name is required"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockOrgRepo := new(MockOrganizationRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockOrgRepo, mockAuditRepo)
+			handler := create_organization.CreateOrganizationHandler(slog.Default(), mockOrgRepo, mockAuditRepo, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodPost, "/organizations", bytes.NewReader([]byte(test.body)))
+			req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{
+				UserID:      1,
+				Role:        "admin",
+				TenantID:    test.tenantId,
+				Permissions: []string{"organization:manage"},
+			}))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockOrgRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreateOrganizationHandlerUnauthorized(t *testing.T) {
+	handler := create_organization.CreateOrganizationHandler(slog.Default(), new(MockOrganizationRepository), new(MockAuditRepository), 5*time.Second)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/organizations", bytes.NewReader([]byte(`{"name":"Acme"}`))))
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,33 @@
+package create_scim_user
+
+import (
+	"context"
+	scimDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/scim_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CreateSCIMUserHandler создаёт пользователя (POST /scim/v2/Users). Возвращает 201 и созданного пользователя
+func CreateSCIMUserHandler(logger *slog.Logger, userRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/scim/create_scim_user/create_scim_user_handler.go/CreateSCIMUserHandler"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request scimDto.User
+		if !scim.DecodeBody(w, r, log, &request) {
+			return
+		}
+		user, err := scim_service.CreateUser(log, userRepository, ctx, request)
+		if err != nil {
+			scim.RenderError(w, log, err)
+			return
+		}
+		scim.RenderUser(w, r, http.StatusCreated, user)
+	}
+}
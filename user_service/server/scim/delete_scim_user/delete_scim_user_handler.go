@@ -0,0 +1,36 @@
+package delete_scim_user
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/scim_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DeleteSCIMUserHandler отзывает доступ пользователя (DELETE /scim/v2/Users/{id})
+//
+// Пользователь не удаляется, а деактивируется: история бронирований сохраняется, а администратор может его активировать.
+// Возвращает 204
+func DeleteSCIMUserHandler(logger *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, policy users_db.BookingPolicy, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/scim/delete_scim_user/delete_scim_user_handler.go/DeleteSCIMUserHandler"))
+
+		id, ok := scim.ParseID(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := scim_service.DeactivateUser(log, userRepository, refreshTokenRepository, ctx, id, policy); err != nil {
+			scim.RenderError(w, log, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
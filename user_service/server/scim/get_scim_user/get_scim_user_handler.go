@@ -0,0 +1,33 @@
+package get_scim_user
+
+import (
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/scim_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GetSCIMUserHandler возвращает пользователя (GET /scim/v2/Users/{id})
+func GetSCIMUserHandler(logger *slog.Logger, userRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/scim/get_scim_user/get_scim_user_handler.go/GetSCIMUserHandler"))
+
+		id, ok := scim.ParseID(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		user, err := scim_service.GetUser(log, userRepository, ctx, id)
+		if err != nil {
+			scim.RenderError(w, log, err)
+			return
+		}
+		scim.RenderUser(w, r, http.StatusOK, user)
+	}
+}
@@ -0,0 +1,69 @@
+package list_scim_users
+
+import (
+	"context"
+	scimDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/scim"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/scim_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultCount размер страницы, если count не передан
+const defaultCount = 100
+
+// ListSCIMUsersHandler ищет пользователей (GET /scim/v2/Users)
+//
+// Параметры: filter (только userName eq "email"), startIndex (с 1) и count (не больше scim_service.MaxCount)
+func ListSCIMUsersHandler(logger *slog.Logger, userRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/scim/list_scim_users/list_scim_users_handler.go/ListSCIMUsersHandler"))
+
+		query := r.URL.Query()
+		startIndex, ok := intParam(query.Get("startIndex"), 1)
+		if !ok {
+			resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidValue, "startIndex must be an integer")
+			return
+		}
+		count, ok := intParam(query.Get("count"), defaultCount)
+		if !ok {
+			resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidValue, "count must be an integer")
+			return
+		}
+		// RFC 7644: значения меньше 1 для startIndex и отрицательные для count приводятся к допустимым
+		startIndex = max(startIndex, 1)
+		count = min(max(count, 0), scim_service.MaxCount)
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		result, err := scim_service.ListUsers(log, userRepository, ctx, query.Get("filter"), startIndex, count)
+		if err != nil {
+			scim.RenderError(w, log, err)
+			return
+		}
+		response := scimDto.ListResponse{
+			Schemas:      []string{scimDto.SchemaListResponse},
+			TotalResults: result.Total,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(result.Users),
+			Resources:    make([]scimDto.User, 0, len(result.Users)),
+		}
+		for _, user := range result.Users {
+			response.Resources = append(response.Resources, scim_service.ToSCIM(user, scim.UserLocation(r, user.ID)))
+		}
+		resp.RenderSCIM(w, http.StatusOK, response)
+	}
+}
+
+func intParam(value string, fallback int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	parsed, err := strconv.Atoi(value)
+	return parsed, err == nil
+}
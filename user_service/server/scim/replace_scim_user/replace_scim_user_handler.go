@@ -0,0 +1,39 @@
+package replace_scim_user
+
+import (
+	"context"
+	scimDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/scim_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ReplaceSCIMUserHandler заменяет атрибуты пользователя (PUT /scim/v2/Users/{id})
+func ReplaceSCIMUserHandler(logger *slog.Logger, userRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, policy users_db.BookingPolicy, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/scim/replace_scim_user/replace_scim_user_handler.go/ReplaceSCIMUserHandler"))
+
+		id, ok := scim.ParseID(w, r)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request scimDto.User
+		if !scim.DecodeBody(w, r, log, &request) {
+			return
+		}
+		user, err := scim_service.ReplaceUser(log, userRepository, refreshTokenRepository, ctx, id, request, policy)
+		if err != nil {
+			scim.RenderError(w, log, err)
+			return
+		}
+		scim.RenderUser(w, r, http.StatusOK, user)
+	}
+}
@@ -0,0 +1,91 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	scimDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/scim"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/scim_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// UsersPath путь ресурса пользователей SCIM
+const UsersPath = "/scim/v2/Users"
+
+// RenderUser отвечает пользователем в представлении SCIM
+func RenderUser(w http.ResponseWriter, r *http.Request, status int, user users_db.UserInfo) {
+	location := UserLocation(r, user.ID)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", location)
+	}
+	resp.RenderSCIM(w, status, scim_service.ToSCIM(user, location))
+}
+
+// UserLocation абсолютный адрес ресурса пользователя для meta.location
+func UserLocation(r *http.Request, id int64) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + UsersPath + "/" + strconv.FormatInt(id, 10)
+}
+
+// ParseID читает id пользователя из пути. Для SCIM id непрозрачен, поэтому нечисловой id - это 404
+func ParseID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		resp.RenderSCIMError(w, http.StatusNotFound, "", "User not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// DecodeBody декодирует и валидирует тело запроса, при ошибке отвечает ошибкой SCIM
+func DecodeBody(w http.ResponseWriter, r *http.Request, log *slog.Logger, v interface{}) bool {
+	err := body.DecodeAndValidateJson(r, v)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, body.ErrDecodeJSON) {
+		resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidSyntax, err.Error())
+		return false
+	}
+	if validationErr, ok := err.(validator.ValidationErrors); ok {
+		log.Debug("Error validating request body", "err", validationErr)
+		resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidValue, resp.ValidationError(validationErr).Error)
+		return false
+	}
+	log.Error("Unexpected error", "err", err)
+	resp.RenderSCIMError(w, http.StatusInternalServerError, "", "internal server error")
+	return false
+}
+
+// RenderError отвечает на ошибку сервиса ошибкой SCIM с подходящим scimType
+func RenderError(w http.ResponseWriter, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, users_db.ErrUserNotFound):
+		resp.RenderSCIMError(w, http.StatusNotFound, "", "User not found")
+	case errors.Is(err, users_db.ErrEmailAlreadyExists):
+		resp.RenderSCIMError(w, http.StatusConflict, scimDto.ErrorTypeUniqueness, err.Error())
+	case errors.Is(err, scim_service.ErrInvalidFilter):
+		resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidFilter, err.Error())
+	case errors.Is(err, scim_service.ErrInvalidPath):
+		resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidPath, err.Error())
+	case errors.Is(err, scim_service.ErrInvalidValue):
+		resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeInvalidValue, err.Error())
+	case errors.Is(err, scim_service.ErrImmutable):
+		resp.RenderSCIMError(w, http.StatusBadRequest, scimDto.ErrorTypeMutability, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		log.Warn("Request canceled or timed out", slog.Any("err", err))
+		resp.RenderSCIMError(w, http.StatusGatewayTimeout, "", "Request timed out or canceled")
+	default:
+		log.Error("SCIM request failed", "err", err)
+		resp.RenderSCIMError(w, http.StatusInternalServerError, "", "internal server error")
+	}
+}
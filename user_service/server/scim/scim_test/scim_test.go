@@ -0,0 +1,424 @@
+package scim_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/create_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/delete_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/get_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/list_scim_users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/patch_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/scim/replace_scim_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+// newRouter собирает маршруты SCIM без проверки токена, она покрыта тестами middlewares
+func newRouter(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) http.Handler {
+	logger := slog.Default()
+	timeout := 5 * time.Second
+	policy := users_db.BookingPolicyCancel
+
+	router := chi.NewRouter()
+	router.Post("/scim/v2/Users", create_scim_user.CreateSCIMUserHandler(logger, userRepo, timeout))
+	router.Get("/scim/v2/Users", list_scim_users.ListSCIMUsersHandler(logger, userRepo, timeout))
+	router.Get("/scim/v2/Users/{id}", get_scim_user.GetSCIMUserHandler(logger, userRepo, timeout))
+	router.Put("/scim/v2/Users/{id}", replace_scim_user.ReplaceSCIMUserHandler(logger, userRepo, refreshRepo, policy, timeout))
+	router.Patch("/scim/v2/Users/{id}", patch_scim_user.PatchSCIMUserHandler(logger, userRepo, refreshRepo, policy, timeout))
+	router.Delete("/scim/v2/Users/{id}", delete_scim_user.DeleteSCIMUserHandler(logger, userRepo, refreshRepo, policy, timeout))
+	return router
+}
+
+var activeUser = users_db.UserInfo{
+	ID:        42,
+	FirstName: "Ivan",
+	LastName:  "Petrov",
+	Email:     "ivan@example.com",
+	Phone:     "+79990000000",
+	Role:      "user",
+	Status:    users_db.UserStatusActive,
+}
+
+func withStatus(user users_db.UserInfo, status string) users_db.UserInfo {
+	user.Status = status
+	return user
+}
+
+func TestSCIMUsers(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "create user",
+			method: http.MethodPost,
+			target: "/scim/v2/Users",
+			body:   `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"ivan@example.com","name":{"givenName":"Ivan","familyName":"Petrov"},"phoneNumbers":[{"value":"+79990000000","type":"work"}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(u *create_user.UserCreate) bool {
+					return u.Email == "ivan@example.com" && u.FirstName == "Ivan" && u.LastName == "Petrov" &&
+						u.Phone == "+79990000000" && strings.HasPrefix(u.Password, "$argon2id$")
+				})).Return(int64(42), nil).Once()
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody: `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"42","userName":"ivan@example.com",
+				"name":{"givenName":"Ivan","familyName":"Petrov"},"emails":[{"value":"ivan@example.com","type":"work","primary":true}],
+				"phoneNumbers":[{"value":"+79990000000","type":"work","primary":true}],"active":true,
+				"meta":{"resourceType":"User","location":"http://example.com/scim/v2/Users/42"}}`,
+		},
+		{
+			name:   "create inactive user",
+			method: http.MethodPost,
+			target: "/scim/v2/Users",
+			body:   `{"userName":"ivan@example.com","active":false}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("CreateUser", mock.Anything, mock.Anything).Return(int64(42), nil).Once()
+				userRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyKeep, int64(0)).Return(nil).Once()
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(withStatus(activeUser, users_db.UserStatusDeactivated), nil).Once()
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `"active":false`,
+		},
+		{
+			name:   "create duplicate user",
+			method: http.MethodPost,
+			target: "/scim/v2/Users",
+			body:   `{"userName":"ivan@example.com"}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("CreateUser", mock.Anything, mock.Anything).Return(int64(0), users_db.ErrEmailAlreadyExists).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"409","scimType":"uniqueness","detail":"Пользователь с email уже существует. "}`,
+		},
+		{
+			name:           "create without userName",
+			method:         http.MethodPost,
+			target:         "/scim/v2/Users",
+			body:           `{"name":{"givenName":"Ivan"}}`,
+			setupMock:      func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"400","scimType":"invalidValue","detail":"field UserName is required"}`,
+		},
+		{
+			name:   "get user",
+			method: http.MethodGet,
+			target: "/scim/v2/Users/42",
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"userName":"ivan@example.com"`,
+		},
+		{
+			name:   "deleted user is not found",
+			method: http.MethodGet,
+			target: "/scim/v2/Users/42",
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(withStatus(activeUser, users_db.UserStatusDeleted), nil).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"schemas":["urn:ietf:params:scim:api:messages:2.0:Error"],"status":"404","detail":"User not found"}`,
+		},
+		{
+			name:           "non numeric id is not found",
+			method:         http.MethodGet,
+			target:         "/scim/v2/Users/abc",
+			setupMock:      func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `"status":"404"`,
+		},
+		{
+			name:   "list with userName filter",
+			method: http.MethodGet,
+			target: "/scim/v2/Users?filter=" + url.QueryEscape(`userName eq "ivan@example.com"`),
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUserByEmail", mock.Anything, "ivan@example.com").Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"totalResults":1,"startIndex":1,"itemsPerPage":1`,
+		},
+		{
+			name:   "list with filter without match",
+			method: http.MethodGet,
+			target: "/scim/v2/Users?filter=" + url.QueryEscape(`USERNAME EQ "nobody@example.com"`),
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"schemas":["urn:ietf:params:scim:api:messages:2.0:ListResponse"],"totalResults":0,"startIndex":1,"itemsPerPage":0,"Resources":[]}`,
+		},
+		{
+			name:   "list with pagination",
+			method: http.MethodGet,
+			target: "/scim/v2/Users?startIndex=11&count=10",
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUserList", mock.Anything).Return(users_db.UserListResult{Users: []users_db.UserInfo{activeUser}, Total: 11}, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"totalResults":11,"startIndex":11,"itemsPerPage":1`,
+		},
+		{
+			name:           "unsupported filter",
+			method:         http.MethodGet,
+			target:         "/scim/v2/Users?filter=" + url.QueryEscape(`name.givenName sw "I"`),
+			setupMock:      func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"scimType":"invalidFilter"`,
+		},
+		{
+			name:   "replace user",
+			method: http.MethodPut,
+			target: "/scim/v2/Users/42",
+			body:   `{"userName":"ivan.petrov@example.com","name":{"givenName":"Ivan","familyName":"Petrov"}}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+				// Телефон не передан, поэтому очищается
+				userRepo.On("UpdateUser", mock.Anything, int64(42), "Ivan", "Petrov", "ivan.petrov@example.com", "").Return(nil).Once()
+				updated := activeUser
+				updated.Email, updated.Phone = "ivan.petrov@example.com", ""
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(updated, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"userName":"ivan.petrov@example.com"`,
+		},
+		{
+			name:   "patch deactivates user",
+			method: http.MethodPatch,
+			target: "/scim/v2/Users/42",
+			body:   `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+				userRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyCancel, int64(0)).Return(nil).Once()
+				refreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(withStatus(activeUser, users_db.UserStatusDeactivated), nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"active":false`,
+		},
+		{
+			name:   "patch without path reactivates user and changes name",
+			method: http.MethodPatch,
+			target: "/scim/v2/Users/42",
+			body:   `{"Operations":[{"op":"replace","value":{"active":true,"name.givenName":"Ivan","name.familyName":"Sidorov","urn:ietf:params:scim:schemas:extension:enterprise:2.0:User":{"department":"IT"}}}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(withStatus(activeUser, users_db.UserStatusDeactivated), nil).Once()
+				userRepo.On("UpdateUser", mock.Anything, int64(42), "Ivan", "Sidorov", "ivan@example.com", "+79990000000").Return(nil).Once()
+				userRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusActive, users_db.BookingPolicyKeep, int64(0)).Return(nil).Once()
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"active":true`,
+		},
+		{
+			name:   "patch phone by filtered path",
+			method: http.MethodPatch,
+			target: "/scim/v2/Users/42",
+			body:   `{"Operations":[{"op":"add","path":"phoneNumbers[type eq \"work\"].value","value":"+70000000000"}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+				userRepo.On("UpdateUser", mock.Anything, int64(42), "Ivan", "Petrov", "ivan@example.com", "+70000000000").Return(nil).Once()
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"id":"42"`,
+		},
+		{
+			name:   "patch unknown path",
+			method: http.MethodPatch,
+			target: "/scim/v2/Users/42",
+			body:   `{"Operations":[{"op":"replace","path":"title","value":"CEO"}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"scimType":"invalidPath"`,
+		},
+		{
+			name:   "patch cannot remove userName",
+			method: http.MethodPatch,
+			target: "/scim/v2/Users/42",
+			body:   `{"Operations":[{"op":"remove","path":"userName"}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"scimType":"mutability"`,
+		},
+		{
+			name:   "patch to taken userName",
+			method: http.MethodPatch,
+			target: "/scim/v2/Users/42",
+			body:   `{"Operations":[{"op":"replace","path":"userName","value":"taken@example.com"}]}`,
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+				userRepo.On("UpdateUser", mock.Anything, int64(42), "Ivan", "Petrov", "taken@example.com", "+79990000000").Return(users_db.ErrEmailAlreadyExists).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `"scimType":"uniqueness"`,
+		},
+		{
+			name:   "delete deactivates user",
+			method: http.MethodDelete,
+			target: "/scim/v2/Users/42",
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(activeUser, nil).Once()
+				userRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyCancel, int64(0)).Return(nil).Once()
+				refreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "delete already deactivated user",
+			method: http.MethodDelete,
+			target: "/scim/v2/Users/42",
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(42)).Return(withStatus(activeUser, users_db.UserStatusDeactivated), nil).Once()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "delete unknown user",
+			method: http.MethodDelete,
+			target: "/scim/v2/Users/7",
+			setupMock: func(userRepo *MockUserRepository, refreshRepo *MockRefreshTokenRepository) {
+				userRepo.On("GetUser", mock.Anything, int64(7)).Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `"status":"404"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userRepo := new(MockUserRepository)
+			refreshRepo := new(MockRefreshTokenRepository)
+			test.setupMock(userRepo, refreshRepo)
+
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/scim+json")
+			w := httptest.NewRecorder()
+			newRouter(userRepo, refreshRepo).ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status: %s", w.Body.String())
+			if test.expectedStatus != http.StatusNoContent {
+				require.Equal(t, "application/scim+json", w.Header().Get("Content-Type"))
+				require.True(t, json.Valid(w.Body.Bytes()))
+			}
+			if strings.HasPrefix(test.expectedBody, "{") {
+				require.JSONEq(t, test.expectedBody, w.Body.String())
+			} else {
+				require.Contains(t, w.Body.String(), test.expectedBody)
+			}
+			if test.expectedStatus == http.StatusCreated {
+				require.Equal(t, "http://example.com/scim/v2/Users/42", w.Header().Get("Location"))
+			}
+
+			userRepo.AssertExpectations(t)
+			refreshRepo.AssertExpectations(t)
+		})
+	}
+}
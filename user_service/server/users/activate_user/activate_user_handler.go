@@ -0,0 +1,46 @@
+package activate_user
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/user_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ActivateUserHandler снова активирует деактивированного пользователя (POST /users/{id}/activate)
+func ActivateUserHandler(logger *slog.Logger, userDbRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/users/activate_user/activate_user_handler.go/ActivateUserHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("ActivateUserHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err = user_service.ActivateUser(log, userDbRepository, ctx, principal, id); err != nil {
+			users.RenderStatusChangeError(w, r, log, err)
+			return
+		}
+		log.Info("Activated user", "userID", id)
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
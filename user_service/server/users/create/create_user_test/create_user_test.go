@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
 	users "github.com/ShlykovPavel/booker_microservice/user_service/server/users/create"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
 	"github.com/go-chi/chi/v5/middleware"
@@ -32,28 +34,83 @@ func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_d
 	return args.Get(0).(users_db.UserInfo), args.Error(1)
 }
 
-func (m *MockUserRepository) CheckAdminInDB(ctx context.Context) (users_db.UserInfo, error) {
-	args := m.Called(ctx)
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
 	return args.Get(0).(users_db.UserInfo), args.Error(1)
 }
-func (m *MockUserRepository) AddFirstAdmin(ctx context.Context, passwordHash string) error {
-	args := m.Called(ctx, passwordHash)
-	return args.Error(1)
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
 }
 func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
 	args := m.Called(ctx)
 	return args.Get(0).(users_db.UserListResult), args.Error(1)
 }
 
-func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone, role string) error {
-	args := m.Called(ctx, id, firstName, lastName, email, phone, role)
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
 	return args.Error(0)
 }
-func (m *MockUserRepository) DeleteUser(ctx context.Context, id int64) error {
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockEmailVerificationRepository struct {
+	mock.Mock
+}
+
+func (m *MockEmailVerificationRepository) CreateVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockEmailVerificationRepository) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEmailVerificationRepository) ReplaceVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time, minInterval time.Duration) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt, minInterval)
+	return args.Error(0)
+}
+
+// recordingMailer Запоминает отправленные письма
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, message mailer.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// failingMailer Не может отправить ни одного письма
+type failingMailer struct{}
+
+func (m failingMailer) Send(ctx context.Context, message mailer.Message) error {
+	return errors.New("smtp unavailable")
+}
+
 func TestCreateUser(t *testing.T) {
 	tests := []struct {
 		testName       string
@@ -68,7 +125,7 @@ func TestCreateUser(t *testing.T) {
 				FirstName: "Ryan",
 				LastName:  "Gosling",
 				Email:     "ryanGosling@gmail.com",
-				Password:  "password",
+				Password:  "correct-horse-battery",
 				Phone:     "+78951235678",
 			},
 			setupMock: func(mockRepo *MockUserRepository) {
@@ -85,7 +142,7 @@ func TestCreateUser(t *testing.T) {
 				FirstName: "", // Пустое поле вызовет ошибку валидации
 				LastName:  "Gosling",
 				Email:     "ryanGosling@gmail.com",
-				Password:  "password",
+				Password:  "correct-horse-battery",
 				Phone:     "+78951235678",
 			},
 			setupMock: func(mockRepo *MockUserRepository) {
@@ -94,13 +151,43 @@ func TestCreateUser(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `{"status":"ERROR","error":"field FirstName is required"}`,
 		},
+		{
+			testName: "common password is banned",
+			input: create_user.UserCreate{
+				FirstName: "Ryan",
+				LastName:  "Gosling",
+				Email:     "ryanGosling@gmail.com",
+				Password:  "Password123",
+				Phone:     "+78951235678",
+			},
+			setupMock: func(mockRepo *MockUserRepository) {
+				//	Не настраиваем мок так как будет ошибка
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Password does not meet the password policy"}`,
+		},
+		{
+			testName: "password too short",
+			input: create_user.UserCreate{
+				FirstName: "Ryan",
+				LastName:  "Gosling",
+				Email:     "ryanGosling@gmail.com",
+				Password:  "x7#kq",
+				Phone:     "+78951235678",
+			},
+			setupMock: func(mockRepo *MockUserRepository) {
+				//	Не настраиваем мок так как будет ошибка
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Password does not meet the password policy"}`,
+		},
 		{
 			testName: "email already exists",
 			input: create_user.UserCreate{
 				FirstName: "Ryan",
 				LastName:  "Gosling",
 				Email:     "ryanGosling@gmail.com",
-				Password:  "password",
+				Password:  "correct-horse-battery",
 				Phone:     "+78951235678",
 			},
 			setupMock: func(mockRepo *MockUserRepository) {
@@ -116,7 +203,7 @@ func TestCreateUser(t *testing.T) {
 				FirstName: "Ryan",
 				LastName:  "Gosling",
 				Email:     "ryanGosling@gmail.com",
-				Password:  "password",
+				Password:  "correct-horse-battery",
 				Phone:     "+78951235678",
 			},
 			setupMock: func(mockRepo *MockUserRepository) {
@@ -138,7 +225,11 @@ func TestCreateUser(t *testing.T) {
 			logger := slog.Default()
 			timeout := 5 * time.Second
 			mockRepo := new(MockUserRepository)
-			handler := users.CreateUser(logger, mockRepo, timeout)
+			mockVerificationRepo := new(MockEmailVerificationRepository)
+			mockVerificationRepo.On("CreateVerificationToken", mock.Anything, mock.AnythingOfType("int64"), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+				Return(nil).Maybe()
+			mail := &recordingMailer{}
+			handler := users.CreateUser(logger, mockRepo, mockVerificationRepo, mail, time.Hour, "https://booker.test/verify-email?token=", timeout)
 
 			// Настраиваем мок
 			test.setupMock(mockRepo)
@@ -161,9 +252,48 @@ func TestCreateUser(t *testing.T) {
 			require.NoError(t, err, "response should be valid JSON")
 			require.Contains(t, w.Body.String(), test.expectedBody, "unexpected response body")
 
+			// После успешной регистрации пользователю отправляется ссылка для подтверждения email
+			if test.expectedStatus == http.StatusCreated {
+				require.Len(t, mail.messages, 1)
+				require.Equal(t, test.input.Email, mail.messages[0].To)
+				require.Contains(t, mail.messages[0].Body, "https://booker.test/verify-email?token=")
+				mockVerificationRepo.AssertNumberOfCalls(t, "CreateVerificationToken", 1)
+			} else {
+				require.Empty(t, mail.messages)
+			}
+
 			// Проверяем, что все ожидаемые вызовы мока выполнены
 			mockRepo.AssertExpectations(t)
 		})
 	}
 
 }
+
+// Если письмо с подтверждением не удалось отправить, регистрация не отменяется:
+// токен сохранён, а письмо можно запросить повторно через POST /users/me/verify-email/resend
+func TestCreateUserVerificationMailFailed(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	mockRepo.On("CreateUser", mock.Anything, mock.AnythingOfType("*create_user.UserCreate")).Return(int64(123), nil).Once()
+	mockVerificationRepo := new(MockEmailVerificationRepository)
+	mockVerificationRepo.On("CreateVerificationToken", mock.Anything, int64(123), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Return(nil).Once()
+	handler := users.CreateUser(slog.Default(), mockRepo, mockVerificationRepo, failingMailer{}, time.Hour, "https://booker.test/verify-email?token=", 5*time.Second)
+
+	body, _ := json.Marshal(create_user.UserCreate{
+		FirstName: "Ryan",
+		LastName:  "Gosling",
+		Email:     "ryanGosling@gmail.com",
+		Password:  "correct-horse-battery",
+		Phone:     "+78951235678",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(context.Background(), middleware.RequestIDKey, "test-id"))
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.JSONEq(t, `{"status":"OK","id":123}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+	mockVerificationRepo.AssertExpectations(t)
+}
@@ -5,7 +5,11 @@ import (
 	"errors"
 	usersDto "github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/email_verification_service"
 	users "github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
@@ -15,7 +19,11 @@ import (
 	"time"
 )
 
-func CreateUser(log *slog.Logger, userRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+// CreateUser регистрирует пользователя и отправляет ему ссылку для подтверждения email
+//
+// Пользователь создаётся с неподтверждённым email. Ошибка отправки письма не отменяет регистрацию
+func CreateUser(log *slog.Logger, userRepository users_db.UserRepository, verificationRepository email_verification_db.EmailVerificationRepository, mail mailer.Mailer, verificationTTL time.Duration, verifyURL string, timeout time.Duration) http.HandlerFunc {
+	verificationSettings := email_verification_service.VerificationSettings{TokenTTL: verificationTTL, VerifyURL: verifyURL}
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "server/users.CreateUser"
 		log = log.With(
@@ -35,8 +43,7 @@ func CreateUser(log *slog.Logger, userRepository users_db.UserRepository, timeou
 		}
 
 		//Валидация
-		//TODO Посмотреть где ещё создаются валидаторы, и если их много, то нужно вынести инициализацию валидатора глобально для повышения оптимизации
-		if err = validator.New().Struct(&user); err != nil {
+		if err = validation.Struct(&user); err != nil {
 			validationErrors := err.(validator.ValidationErrors)
 			log.Error("Error validating request body", "err", validationErrors)
 			resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErrors))
@@ -71,9 +78,14 @@ func CreateUser(log *slog.Logger, userRepository users_db.UserRepository, timeou
 		}
 
 		log.Info("Created user", "user id", userId)
+
+		err = email_verification_service.SendVerification(log, verificationRepository, mail, ctx, userId, user.Email, verificationSettings)
+		if err != nil {
+			log.Error("Error while sending email verification", "err", err)
+		}
 		resp.RenderResponse(w, r, http.StatusCreated, usersDto.CreateUserResponse{
-			resp.OK(),
-			userId,
+			Response: resp.OK(),
+			UserID:   userId,
 		})
 	}
 }
@@ -0,0 +1,72 @@
+package deactivate_user
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/user_status"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/user_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeactivateUserHandler деактивирует пользователя (POST /users/{id}/deactivate)
+//
+// В теле передаётся политика для будущих бронирований: {"booking_policy": "cancel|reassign|keep", "reassign_to": ID}
+func DeactivateUserHandler(logger *slog.Logger, userDbRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/users/deactivate_user/deactivate_user_handler.go/DeactivateUserHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("DeactivateUserHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var policyRequest user_status.BookingPolicyRequest
+		err = body.DecodeAndValidateJson(r, &policyRequest)
+		if err != nil {
+			if errors.Is(err, body.ErrDecodeJSON) {
+				log.Error("DeactivateUserHandler: error decoding body", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+			if validationErr, ok := err.(validator.ValidationErrors); ok {
+				log.Error("Error validating request body", "err", validationErr)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErr))
+				return
+			}
+			log.Error("Unexpected error", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+
+		err = user_service.DeactivateUser(log, userDbRepository, refreshTokenRepository, ctx, principal, id, users_db.BookingPolicy(policyRequest.BookingPolicy), policyRequest.ReassignTo)
+		if err != nil {
+			users.RenderStatusChangeError(w, r, log, err)
+			return
+		}
+		log.Info("Deactivated user", "userID", id)
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
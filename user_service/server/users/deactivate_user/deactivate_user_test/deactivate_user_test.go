@@ -0,0 +1,340 @@
+package deactivate_user_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/activate_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/deactivate_user"
+	users_delete "github.com/ShlykovPavel/booker_microservice/user_service/server/users/delete"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/purge_user"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+// newRequest создаёт запрос с параметром id маршрута и администратором, как после AuthMiddleware
+func newRequest(method, target, userId string, body string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader([]byte(body)))
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", userId)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+	return req.WithContext(auth.NewContext(ctx, auth.Principal{UserID: 1, Role: "admin", Permissions: []string{"user:manage"}}))
+}
+
+func userWithStatus(status string) users_db.UserInfo {
+	return users_db.UserInfo{ID: 42, Email: "ryanGosling@gmail.com", Role: "user", Status: status}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		userId         string
+		body           string
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "cancel future bookings and revoke sessions",
+			userId: "42",
+			body:   `{"booking_policy":"cancel"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusActive), nil).Once()
+				mockRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyCancel, int64(0)).Return(nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:   "reassign future bookings",
+			userId: "42",
+			body:   `{"booking_policy":"reassign","reassign_to":7}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusActive), nil).Once()
+				mockRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyReassign, int64(7)).Return(nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:   "reassign target is inactive",
+			userId: "42",
+			body:   `{"booking_policy":"reassign","reassign_to":7}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusActive), nil).Once()
+				mockRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyReassign, int64(7)).Return(users_db.ErrReassignTargetInvalid).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Пользователь для переназначения бронирований не найден или не активен"}`,
+		},
+		{
+			name:   "reassign target outside of booking entity groups",
+			userId: "42",
+			body:   `{"booking_policy":"reassign","reassign_to":7}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusActive), nil).Once()
+				mockRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeactivated, users_db.BookingPolicyReassign, int64(7)).Return(users_db.ErrReassignTargetRestricted).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Пользователю для переназначения недоступны объекты некоторых бронирований из-за ограничений по группам"}`,
+		},
+		{
+			name:   "reassign without target",
+			userId: "42",
+			body:   `{"booking_policy":"reassign"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как не указан пользователь для переназначения
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Для политики reassign нужно указать другого пользователя в reassign_to"}`,
+		},
+		{
+			name:   "unknown policy",
+			userId: "42",
+			body:   `{"booking_policy":"drop"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field BookingPolicy is invalid"}`,
+		},
+		{
+			name:   "already deactivated",
+			userId: "42",
+			body:   `{"booking_policy":"keep"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusDeactivated), nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Недопустимая смена статуса пользователя"}`,
+		},
+		{
+			name:   "own account",
+			userId: "1",
+			body:   `{"booking_policy":"keep"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как свою учётную запись деактивировать нельзя
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя изменить статус собственной учётной записи"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			test.setupMock(mockRepo, mockRefreshRepo)
+			handler := deactivate_user.DeactivateUserHandler(slog.Default(), mockRepo, mockRefreshRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodPost, "/users/"+test.userId+"/deactivate", test.userId, test.body))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestActivateUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusDeactivated), nil).Once()
+	mockRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusActive, users_db.BookingPolicyKeep, int64(0)).Return(nil).Once()
+	handler := activate_user.ActivateUserHandler(slog.Default(), mockRepo, 5*time.Second)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(http.MethodPost, "/users/42/activate", "42", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+
+	// Удалённого пользователя активировать нельзя
+	mockRepo = new(MockUserRepository)
+	mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusDeleted), nil).Once()
+	handler = activate_user.ActivateUserHandler(slog.Default(), mockRepo, 5*time.Second)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(http.MethodPost, "/users/42/activate", "42", ""))
+
+	require.Equal(t, http.StatusConflict, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+	}{
+		{
+			name:   "soft delete keeps bookings",
+			target: "/users/42?booking_policy=keep",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusDeactivated), nil).Once()
+				mockRepo.On("SetStatus", mock.Anything, int64(42), users_db.UserStatusDeleted, users_db.BookingPolicyKeep, int64(0)).Return(nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "policy is required",
+			target: "/users/42",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как не выбрана политика для бронирований
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "already deleted",
+			target: "/users/42?booking_policy=cancel",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(userWithStatus(users_db.UserStatusDeleted), nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			test.setupMock(mockRepo, mockRefreshRepo)
+			handler := users_delete.DeleteUserHandler(slog.Default(), mockRepo, mockRefreshRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodDelete, test.target, "42", ""))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			mockRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPurgeUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		repoErr        error
+		expectedStatus int
+	}{
+		{name: "purge deleted user", expectedStatus: http.StatusNoContent},
+		{name: "user is not deleted", repoErr: users_db.ErrUserNotDeleted, expectedStatus: http.StatusConflict},
+		{name: "user has active bookings", repoErr: users_db.ErrUserHasBookings, expectedStatus: http.StatusConflict},
+		{name: "user not found", repoErr: users_db.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockRepo.On("PurgeUser", mock.Anything, int64(42)).Return(test.repoErr).Once()
+			handler := purge_user.PurgeUserHandler(slog.Default(), mockRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(http.MethodDelete, "/users/42/purge", "42", ""))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
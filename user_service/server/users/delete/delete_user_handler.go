@@ -2,20 +2,36 @@ package users_delete
 
 import (
 	"context"
-	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/user_status"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
 	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/user_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-func DeleteUserHandler(logger *slog.Logger, userDbRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+// DeleteUserHandler мягко удаляет пользователя (DELETE /users/{id}?booking_policy=cancel|reassign|keep&reassign_to=ID)
+//
+// Запись остаётся в БД со статусом deleted. Окончательное удаление - DELETE /users/{id}/purge
+func DeleteUserHandler(logger *slog.Logger, userDbRepository users_db.UserRepository, refreshTokenRepository refresh_tokens_db.RefreshTokenRepository, timeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := logger.With(slog.String("op", "internal/server/users/delete/delete_user_handler.go/DeleteUserHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("DeleteUserHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
 		userID := chi.URLParam(r, "id")
 		if userID == "" {
 			log.Error("User ID is empty")
@@ -29,18 +45,28 @@ func DeleteUserHandler(logger *slog.Logger, userDbRepository users_db.UserReposi
 			return
 		}
 
+		policyRequest := user_status.BookingPolicyRequest{BookingPolicy: r.URL.Query().Get("booking_policy")}
+		if reassignTo := r.URL.Query().Get("reassign_to"); reassignTo != "" {
+			policyRequest.ReassignTo, err = strconv.ParseInt(reassignTo, 10, 64)
+			if err != nil {
+				log.Error("reassign_to is invalid", "error", err)
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid reassign_to"))
+				return
+			}
+		}
+		if err = validation.Struct(&policyRequest); err != nil {
+			validationErrors := err.(validator.ValidationErrors)
+			log.Error("Error validating query params", "err", validationErrors)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.ValidationError(validationErrors))
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
-		err = user_service.DeleteUser(logger, userDbRepository, ctx, id)
+		err = user_service.DeleteUser(logger, userDbRepository, refreshTokenRepository, ctx, principal, id, users_db.BookingPolicy(policyRequest.BookingPolicy), policyRequest.ReassignTo)
 		if err != nil {
-			if errors.Is(err, users_db.ErrUserNotFound) {
-				log.Error("User not found", "error", err)
-				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
-				return
-			}
-			log.Error("Error deleting user", "error", err)
-			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Error deleting user"))
+			users.RenderStatusChangeError(w, r, log, err)
 			return
 		}
 		log.Info("Deleted user", "userID", userID)
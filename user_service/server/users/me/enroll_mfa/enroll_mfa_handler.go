@@ -0,0 +1,52 @@
+package enroll_mfa
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/mfa_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// EnrollMFAHandler начинает подключение 2FA текущим пользователем (POST /users/me/2fa/enroll)
+//
+// Возвращает секрет и otpauth URI. 2FA начинает действовать только после подтверждения кодом (POST /users/me/2fa/confirm)
+func EnrollMFAHandler(logger *slog.Logger, userRepository users_db.UserRepository, mfaRepository mfa_db.MFARepository, mfaSettings totp.Settings, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/users/me/enroll_mfa/enroll_mfa_handler.go/EnrollMFAHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("EnrollMFAHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		response, err := mfa_service.Enroll(log, userRepository, mfaRepository, ctx, principal.UserID, mfaSettings)
+		if err != nil {
+			switch {
+			case errors.Is(err, mfa_service.ErrMFAAlreadyEnabled):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrUserNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+			case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+			default:
+				log.Error("EnrollMFAHandler: error while enrolling 2fa", "error", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,305 @@
+package me_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/change_password"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/get_me"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/update_me"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+// withPrincipal добавляет в запрос пользователя, как это делает AuthMiddleware
+func withPrincipal(req *http.Request, userId int64) *http.Request {
+	return req.WithContext(auth.NewContext(req.Context(), auth.Principal{UserID: userId, Role: "user"}))
+}
+
+func testUser() users_db.UserInfo {
+	return users_db.UserInfo{
+		ID:            42,
+		FirstName:     "Ryan",
+		LastName:      "Gosling",
+		Email:         "ryanGosling@gmail.com",
+		Phone:         "78951235678",
+		Role:          "user",
+		EmailVerified: true,
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	tests := []struct {
+		name           string
+		withPrincipal  bool
+		setupMock      func(*MockUserRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:          "success",
+			withPrincipal: true,
+			setupMock: func(mockRepo *MockUserRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(testUser(), nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":42,"email":"ryanGosling@gmail.com","phone":"78951235678","first_name":"Ryan","last_name":"Gosling","role":"user","email_verified":true}`,
+		},
+		{
+			name:          "user deleted",
+			withPrincipal: true,
+			setupMock: func(mockRepo *MockUserRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"User not found"}`,
+		},
+		{
+			name:           "no principal",
+			setupMock:      func(mockRepo *MockUserRepository) {},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"ERROR","error":"Unauthorized"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			test.setupMock(mockRepo)
+			handler := get_me.GetMeHandler(slog.Default(), mockRepo, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			if test.withPrincipal {
+				req = withPrincipal(req, 42)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*MockUserRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "only passed fields are changed",
+			body: `{"first_name":"Thomas"}`,
+			setupMock: func(mockRepo *MockUserRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(testUser(), nil).Once()
+				mockRepo.On("UpdateProfile", mock.Anything, int64(42), "Thomas", "Gosling", "78951235678").Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":42,"email":"ryanGosling@gmail.com","phone":"78951235678","first_name":"Thomas","last_name":"Gosling","role":"user","email_verified":true}`,
+		},
+		{
+			name: "role and email are ignored",
+			body: `{"role":"admin","email":"evil@gmail.com","phone":"70000000000"}`,
+			setupMock: func(mockRepo *MockUserRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(testUser(), nil).Once()
+				mockRepo.On("UpdateProfile", mock.Anything, int64(42), "Ryan", "Gosling", "70000000000").Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":42,"email":"ryanGosling@gmail.com","phone":"70000000000","first_name":"Ryan","last_name":"Gosling","role":"user","email_verified":true}`,
+		},
+		{
+			name: "invalid phone",
+			body: `{"phone":"not-a-phone"}`,
+			setupMock: func(mockRepo *MockUserRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Phone is invalid"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			test.setupMock(mockRepo)
+			handler := update_me.UpdateMeHandler(slog.Default(), mockRepo, 5*time.Second)
+
+			req := withPrincipal(httptest.NewRequest(http.MethodPatch, "/users/me", bytes.NewReader([]byte(test.body))), 42)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	user := testUser()
+	passwordHash, err := users.HashUserPassword("old-secret-phrase", slog.Default())
+	require.NoError(t, err)
+	user.PasswordHash = passwordHash
+
+	tests := []struct {
+		name           string
+		input          map[string]string
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "success revokes all sessions",
+			input: map[string]string{"current_password": "old-secret-phrase", "new_password": "new-secret-phrase"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockRepo.On("UpdatePassword", mock.Anything, int64(42), mock.MatchedBy(func(passwordHash string) bool {
+					return users.ComparePassword(passwordHash, "new-secret-phrase", slog.Default())
+				})).Return(nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:  "wrong current password",
+			input: map[string]string{"current_password": "wrong-secret-phrase", "new_password": "new-secret-phrase"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Текущий пароль указан неверно"}`,
+		},
+		{
+			name:  "new password violates policy",
+			input: map[string]string{"current_password": "old-secret-phrase", "new_password": "qwerty123"},
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field NewPassword does not meet the password policy"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			test.setupMock(mockRepo, mockRefreshRepo)
+			handler := change_password.ChangePasswordHandler(slog.Default(), mockRepo, mockRefreshRepo, 5*time.Second)
+
+			body, _ := json.Marshal(test.input)
+			req := withPrincipal(httptest.NewRequest(http.MethodPost, "/users/me/password", bytes.NewReader(body)), 42)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package me_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/mfa"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/secure_tokens"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/totp"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/confirm_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/disable_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/enroll_mfa"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/mfa_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+func (m *MockMFARepository) GetTOTP(ctx context.Context, userId int64) (mfa_db.TOTPInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(mfa_db.TOTPInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) SaveTOTPSecret(ctx context.Context, userId int64, secret string) error {
+	args := m.Called(ctx, userId, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) ConfirmTOTP(ctx context.Context, userId int64, step int64, backupCodeHashes []string) error {
+	args := m.Called(ctx, userId, step, backupCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userId int64, step int64) error {
+	args := m.Called(ctx, userId, step)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseBackupCode(ctx context.Context, userId int64, codeHash string) error {
+	args := m.Called(ctx, userId, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) DeleteTOTP(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) CreateChallenge(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) GetChallenge(ctx context.Context, tokenHash string) (mfa_db.ChallengeInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(mfa_db.ChallengeInfo), args.Error(1)
+}
+
+func (m *MockMFARepository) RegisterChallengeAttempt(ctx context.Context, id int64) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockMFARepository) ConsumeChallenge(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+var testMFASettings = totp.Settings{Issuer: "Booker", RequiredRoles: []string{"admin"}}
+
+func TestEnrollAndConfirmMFA(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	mockMFARepo := new(MockMFARepository)
+	mockRepo.On("GetUser", mock.Anything, int64(42)).Return(testUser(), nil).Once()
+	var savedSecret string
+	mockMFARepo.On("SaveTOTPSecret", mock.Anything, int64(42), mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) { savedSecret = args.String(2) }).
+		Return(nil).Once()
+
+	enrollHandler := enroll_mfa.EnrollMFAHandler(slog.Default(), mockRepo, mockMFARepo, testMFASettings, 5*time.Second)
+	w := httptest.NewRecorder()
+	enrollHandler.ServeHTTP(w, withPrincipal(httptest.NewRequest(http.MethodPost, "/users/me/2fa/enroll", nil), 42))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollResponse mfa.EnrollResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollResponse))
+	require.Equal(t, savedSecret, enrollResponse.Secret)
+	uri, err := url.Parse(enrollResponse.OTPAuthURI)
+	require.NoError(t, err)
+	require.Equal(t, "/Booker:ryanGosling@gmail.com", uri.Path)
+
+	// Подтверждаем подключение кодом, который показало бы приложение-аутентификатор
+	code, err := totp.Code(savedSecret, time.Now())
+	require.NoError(t, err)
+	mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{UserID: 42, Secret: savedSecret}, nil).Once()
+	var savedHashes []string
+	mockMFARepo.On("ConfirmTOTP", mock.Anything, int64(42), mock.AnythingOfType("int64"), mock.AnythingOfType("[]string")).
+		Run(func(args mock.Arguments) { savedHashes = args.Get(3).([]string) }).
+		Return(nil).Once()
+
+	confirmHandler := confirm_mfa.ConfirmMFAHandler(slog.Default(), mockMFARepo, 5*time.Second)
+	body, _ := json.Marshal(mfa.ConfirmRequest{Code: code})
+	w = httptest.NewRecorder()
+	confirmHandler.ServeHTTP(w, withPrincipal(httptest.NewRequest(http.MethodPost, "/users/me/2fa/confirm", bytes.NewReader(body)), 42))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var confirmResponse mfa.ConfirmResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &confirmResponse))
+	require.Len(t, confirmResponse.BackupCodes, totp.BackupCodesCount)
+	require.Len(t, savedHashes, totp.BackupCodesCount)
+	// В БД попадают только хеши резервных кодов
+	for i, backupCode := range confirmResponse.BackupCodes {
+		require.Equal(t, secure_tokens.Hash(backupCode), savedHashes[i])
+	}
+
+	mockRepo.AssertExpectations(t)
+	mockMFARepo.AssertExpectations(t)
+}
+
+func TestConfirmMFA(t *testing.T) {
+	confirmedAt := time.Now()
+	tests := []struct {
+		name           string
+		code           string
+		setupMock      func(*MockMFARepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "wrong code",
+			code: "000000",
+			setupMock: func(mockMFARepo *MockMFARepository) {
+				mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{UserID: 42, Secret: "JBSWY3DPEHPK3PXP"}, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Неверный код подтверждения"}`,
+		},
+		{
+			name: "enrollment not started",
+			code: "123456",
+			setupMock: func(mockMFARepo *MockMFARepository) {
+				mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{}, mfa_db.ErrTOTPNotFound).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Двухфакторная аутентификация не подключена"}`,
+		},
+		{
+			name: "already confirmed",
+			code: "123456",
+			setupMock: func(mockMFARepo *MockMFARepository) {
+				mockMFARepo.On("GetTOTP", mock.Anything, int64(42)).Return(mfa_db.TOTPInfo{UserID: 42, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &confirmedAt}, nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Двухфакторная аутентификация уже подключена"}`,
+		},
+		{
+			name: "code is not six digits",
+			code: "12ab",
+			setupMock: func(mockMFARepo *MockMFARepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Code is invalid"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockMFARepo := new(MockMFARepository)
+			test.setupMock(mockMFARepo)
+			handler := confirm_mfa.ConfirmMFAHandler(slog.Default(), mockMFARepo, 5*time.Second)
+
+			body, _ := json.Marshal(mfa.ConfirmRequest{Code: test.code})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, withPrincipal(httptest.NewRequest(http.MethodPost, "/users/me/2fa/confirm", bytes.NewReader(body)), 42))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockMFARepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDisableMFA(t *testing.T) {
+	passwordHash, err := users.HashUserPassword("old-secret-phrase", slog.Default())
+	require.NoError(t, err)
+	user := testUser()
+	user.PasswordHash = passwordHash
+	admin := user
+	admin.Role = "admin"
+
+	tests := []struct {
+		name           string
+		password       string
+		setupMock      func(*MockUserRepository, *MockMFARepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:     "success",
+			password: "old-secret-phrase",
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+				mockMFARepo.On("DeleteTOTP", mock.Anything, int64(42)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:     "wrong password",
+			password: "wrong-secret-phrase",
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(user, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Пароль указан неверно"}`,
+		},
+		{
+			name:     "required by policy for admin",
+			password: "old-secret-phrase",
+			setupMock: func(mockRepo *MockUserRepository, mockMFARepo *MockMFARepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(admin, nil).Once()
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Для вашей роли двухфакторная аутентификация обязательна"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockMFARepo := new(MockMFARepository)
+			test.setupMock(mockRepo, mockMFARepo)
+			handler := disable_mfa.DisableMFAHandler(slog.Default(), mockRepo, mockMFARepo, testMFASettings, 5*time.Second)
+
+			body, _ := json.Marshal(mfa.DisableRequest{Password: test.password})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, withPrincipal(httptest.NewRequest(http.MethodDelete, "/users/me/2fa", bytes.NewReader(body)), 42))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockMFARepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package me_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/sessions_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/list_sessions"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/terminate_session"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockSessionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepository) IsSessionActive(ctx context.Context, sessionId int64) (bool, error) {
+	args := m.Called(ctx, sessionId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, userId int64, familyId string, client sessions_db.ClientInfo) (int64, error) {
+	args := m.Called(ctx, userId, familyId, client)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepository) ListSessions(ctx context.Context, userId int64) ([]sessions_db.SessionInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).([]sessions_db.SessionInfo), args.Error(1)
+}
+
+func (m *MockSessionRepository) TerminateSession(ctx context.Context, userId, sessionId int64) (string, error) {
+	args := m.Called(ctx, userId, sessionId)
+	return args.String(0), args.Error(1)
+}
+
+func TestListSessions(t *testing.T) {
+	seenAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockSessionRepo := new(MockSessionRepository)
+	mockSessionRepo.On("ListSessions", mock.Anything, int64(42)).Return([]sessions_db.SessionInfo{
+		{ID: 5, UserAgent: "curl/8.0", IP: "10.0.0.1", CreatedAt: seenAt, LastSeenAt: seenAt},
+		{ID: 3, UserAgent: "Firefox", IP: "10.0.0.2", CreatedAt: seenAt, LastSeenAt: seenAt},
+	}, nil).Once()
+	handler := list_sessions.ListSessionsHandler(slog.Default(), mockSessionRepo, 5*time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/sessions", nil)
+	req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{UserID: 42, Role: "user", SessionID: 3}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	// Текущей помечается сессия из claim sid токена запроса
+	require.JSONEq(t, `{"status":"OK","data":[
+		{"id":5,"user_agent":"curl/8.0","ip":"10.0.0.1","created_at":"2025-03-01T12:00:00Z","last_seen_at":"2025-03-01T12:00:00Z","current":false},
+		{"id":3,"user_agent":"Firefox","ip":"10.0.0.2","created_at":"2025-03-01T12:00:00Z","last_seen_at":"2025-03-01T12:00:00Z","current":true}
+	]}`, w.Body.String())
+	mockSessionRepo.AssertExpectations(t)
+}
+
+func TestTerminateSession(t *testing.T) {
+	tests := []struct {
+		name           string
+		sessionId      string
+		setupMock      func(*MockSessionRepository, *MockRefreshTokenRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:      "success revokes refresh tokens of session",
+			sessionId: "5",
+			setupMock: func(mockSessionRepo *MockSessionRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockSessionRepo.On("TerminateSession", mock.Anything, int64(42), int64(5)).Return("family", nil).Once()
+				mockRefreshRepo.On("RevokeFamily", mock.Anything, "family").Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:      "session of another user",
+			sessionId: "6",
+			setupMock: func(mockSessionRepo *MockSessionRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockSessionRepo.On("TerminateSession", mock.Anything, int64(42), int64(6)).Return("", sessions_db.ErrSessionNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"Session not found"}`,
+		},
+		{
+			name:      "refresh tokens revocation error",
+			sessionId: "5",
+			setupMock: func(mockSessionRepo *MockSessionRepository, mockRefreshRepo *MockRefreshTokenRepository) {
+				mockSessionRepo.On("TerminateSession", mock.Anything, int64(42), int64(5)).Return("family", nil).Once()
+				mockRefreshRepo.On("RevokeFamily", mock.Anything, "family").Return(errors.New("db is down")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"internal server error"}`,
+		},
+		{
+			name:           "invalid id",
+			sessionId:      "abc",
+			setupMock:      func(mockSessionRepo *MockSessionRepository, mockRefreshRepo *MockRefreshTokenRepository) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Invalid session ID"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockSessionRepo := new(MockSessionRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			test.setupMock(mockSessionRepo, mockRefreshRepo)
+			handler := terminate_session.TerminateSessionHandler(slog.Default(), mockSessionRepo, mockRefreshRepo, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/me/sessions/"+test.sessionId, nil)
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("id", test.sessionId)
+			req = withPrincipal(req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)), 42)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockSessionRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+		})
+	}
+}
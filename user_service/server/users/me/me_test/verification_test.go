@@ -0,0 +1,140 @@
+package me_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/me/resend_verification"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockEmailVerificationRepository struct {
+	mock.Mock
+}
+
+func (m *MockEmailVerificationRepository) CreateVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockEmailVerificationRepository) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEmailVerificationRepository) ReplaceVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time, minInterval time.Duration) error {
+	args := m.Called(ctx, userId, tokenHash, expiresAt, minInterval)
+	return args.Error(0)
+}
+
+// testMailer Запоминает отправленные письма, при заданной err возвращает её вместо отправки
+type testMailer struct {
+	messages []mailer.Message
+	err      error
+}
+
+func (m *testMailer) Send(ctx context.Context, message mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func TestResendVerification(t *testing.T) {
+	unverified := testUser()
+	unverified.EmailVerified = false
+
+	tests := []struct {
+		name           string
+		mailErr        error
+		setupMock      func(*MockUserRepository, *MockEmailVerificationRepository)
+		expectedStatus int
+		expectedBody   string
+		expectedMails  int
+	}{
+		{
+			// Письмо при регистрации не дошло или ссылка истекла: прежний токен заменяется новым
+			name: "issues new token after failed or expired one",
+			setupMock: func(mockRepo *MockUserRepository, mockVerificationRepo *MockEmailVerificationRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(unverified, nil).Once()
+				mockVerificationRepo.On("ReplaceVerificationToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.MatchedBy(func(expiresAt time.Time) bool {
+					return expiresAt.After(time.Now())
+				}), time.Minute).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+			expectedMails:  1,
+		},
+		{
+			name:    "mail sending failed",
+			mailErr: errors.New("smtp unavailable"),
+			setupMock: func(mockRepo *MockUserRepository, mockVerificationRepo *MockEmailVerificationRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(unverified, nil).Once()
+				mockVerificationRepo.On("ReplaceVerificationToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), time.Minute).
+					Return(nil).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"internal server error"}`,
+		},
+		{
+			name: "resend requested too soon",
+			setupMock: func(mockRepo *MockUserRepository, mockVerificationRepo *MockEmailVerificationRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(unverified, nil).Once()
+				mockVerificationRepo.On("ReplaceVerificationToken", mock.Anything, int64(42), mock.AnythingOfType("string"), mock.AnythingOfType("time.Time"), time.Minute).
+					Return(email_verification_db.ErrVerificationResendTooSoon).Once()
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   `{"status":"ERROR","error":"Письмо с подтверждением уже отправлено недавно, попробуйте позже"}`,
+		},
+		{
+			name: "email already verified",
+			setupMock: func(mockRepo *MockUserRepository, mockVerificationRepo *MockEmailVerificationRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(testUser(), nil).Once()
+			},
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"status":"ERROR","error":"Email уже подтверждён"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockVerificationRepo := new(MockEmailVerificationRepository)
+			test.setupMock(mockRepo, mockVerificationRepo)
+			mail := &testMailer{err: test.mailErr}
+			handler := resend_verification.ResendVerificationHandler(slog.Default(), mockRepo, mockVerificationRepo, mail, time.Hour, "https://booker.test/verify-email?token=", time.Minute, 5*time.Second)
+
+			req := withPrincipal(httptest.NewRequest(http.MethodPost, "/users/me/verify-email/resend", nil), 42)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			require.Len(t, mail.messages, test.expectedMails)
+			if test.expectedMails > 0 {
+				require.Equal(t, unverified.Email, mail.messages[0].To)
+				require.Contains(t, mail.messages[0].Body, "https://booker.test/verify-email?token=")
+			}
+			mockRepo.AssertExpectations(t)
+			mockVerificationRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestResendVerificationUnauthorized(t *testing.T) {
+	handler := resend_verification.ResendVerificationHandler(slog.Default(), new(MockUserRepository), new(MockEmailVerificationRepository), &testMailer{}, time.Hour, "https://booker.test/verify-email?token=", time.Minute, 5*time.Second)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/me/verify-email/resend", nil))
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,60 @@
+package resend_verification
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/email_verification_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/email_verification_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ResendVerificationHandler повторно отправляет письмо с подтверждением email пользователю из токена доступа (POST /users/me/verify-email/resend)
+//
+// Выдаёт новый токен подтверждения, прежние ссылки перестают действовать. Не чаще, чем раз в resendInterval
+func ResendVerificationHandler(logger *slog.Logger, userRepository users_db.UserRepository, verificationRepository email_verification_db.EmailVerificationRepository, mail mailer.Mailer, verificationTTL time.Duration, verifyURL string, resendInterval time.Duration, timeout time.Duration) http.HandlerFunc {
+	verificationSettings := email_verification_service.VerificationSettings{TokenTTL: verificationTTL, VerifyURL: verifyURL, ResendInterval: resendInterval}
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/users/me/resend_verification/resend_verification_handler.go/ResendVerificationHandler"))
+
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			log.Error("ResendVerificationHandler: principal not found in context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		err := email_verification_service.ResendVerification(log, userRepository, verificationRepository, mail, ctx, principal.UserID, verificationSettings)
+		if err != nil {
+			if errors.Is(err, email_verification_service.ErrEmailAlreadyVerified) {
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, email_verification_service.ErrResendTooSoon) {
+				resp.RenderResponse(w, r, http.StatusTooManyRequests, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+				return
+			}
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warn("Request canceled or timed out", slog.Any("err", err))
+				resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+				return
+			}
+			log.Error("ResendVerificationHandler: error while resending verification email", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, resp.OK())
+	}
+}
@@ -0,0 +1,40 @@
+package purge_user
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/user_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PurgeUserHandler окончательно удаляет пользователя из БД (DELETE /users/{id}/purge)
+//
+// Пользователь должен быть предварительно удалён через DELETE /users/{id}, иначе возвращается 409
+func PurgeUserHandler(logger *slog.Logger, userDbRepository users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(slog.String("op", "user_service/server/users/purge_user/purge_user_handler.go/PurgeUserHandler"))
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err = user_service.PurgeUser(log, userDbRepository, ctx, id); err != nil {
+			users.RenderStatusChangeError(w, r, log, err)
+			return
+		}
+		log.Info("Purged user", "userID", id)
+		resp.RenderResponse(w, r, http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,356 @@
+package roles_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/passwords"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/roles"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+type MockOrganizationRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrganizationRepository) CreateOrganization(ctx context.Context, name string) (int64, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) EnsureOrganization(ctx context.Context, name string) (int64, bool, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(int64), args.Bool(1), args.Error(2)
+}
+
+func newAdmin(password string) create_user.UserCreate {
+	return create_user.UserCreate{
+		FirstName: "Admin",
+		LastName:  "Admin",
+		Email:     "root@booker.test",
+		Password:  password,
+		Phone:     "70000000000",
+	}
+}
+
+func TestEnsureAdmin(t *testing.T) {
+	tests := []struct {
+		name            string
+		password        string
+		setupMock       func(*MockUserRepository, *MockAuditRepository)
+		expectedId      int64
+		expectedChanged bool
+		expectedErr     error
+	}{
+		{
+			name:     "creates admin when user does not exist",
+			password: "correct-horse-battery",
+			setupMock: func(mockRepo *MockUserRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "root@booker.test").Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+				mockRepo.On("CreateAdmin", mock.Anything, mock.MatchedBy(func(u *create_user.UserCreate) bool {
+					// В БД уходит хеш, а не сам пароль
+					ok, _, err := passwords.Default().Verify(u.Password, "correct-horse-battery")
+					return err == nil && ok && u.Email == "root@booker.test"
+				})).Return(int64(7), nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionAdminCreated && entry.TargetID == 7 && entry.ActorID == 0
+				})).Return(nil).Once()
+			},
+			expectedId:      7,
+			expectedChanged: true,
+		},
+		{
+			name:     "existing admin is left unchanged",
+			password: "correct-horse-battery",
+			setupMock: func(mockRepo *MockUserRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "root@booker.test").
+					Return(users_db.UserInfo{ID: 3, Role: "admin", Status: users_db.UserStatusActive}, nil).Once()
+			},
+			expectedId:      3,
+			expectedChanged: false,
+		},
+		{
+			name:     "existing user is promoted",
+			password: "correct-horse-battery",
+			setupMock: func(mockRepo *MockUserRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "root@booker.test").
+					Return(users_db.UserInfo{ID: 5, Role: "user", Status: users_db.UserStatusActive}, nil).Once()
+				mockRepo.On("UpdateRole", mock.Anything, int64(5), "admin").Return(nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionAdminCreated && entry.TargetID == 5
+				})).Return(nil).Once()
+			},
+			expectedId:      5,
+			expectedChanged: true,
+		},
+		{
+			name:     "deactivated user is not promoted",
+			password: "correct-horse-battery",
+			setupMock: func(mockRepo *MockUserRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUserByEmail", mock.Anything, "root@booker.test").
+					Return(users_db.UserInfo{ID: 5, Role: "user", Status: users_db.UserStatusDeactivated}, nil).Once()
+			},
+			expectedErr: roles.ErrAdminInactive,
+		},
+		{
+			name:     "weak password is rejected",
+			password: "password",
+			setupMock: func(mockRepo *MockUserRepository, mockAuditRepo *MockAuditRepository) {
+				// Нет вызова мока, так как пароль не проходит политику паролей
+			},
+			expectedErr: roles.ErrInvalidAdmin,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockRepo, mockAuditRepo)
+
+			id, changed, err := roles.EnsureAdmin(slog.Default(), mockRepo, mockAuditRepo, context.Background(), newAdmin(test.password))
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.expectedId, id)
+				require.Equal(t, test.expectedChanged, changed)
+			}
+			mockRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEnsureOrganization(t *testing.T) {
+	tests := []struct {
+		name         string
+		organization string
+		setupMock    func(*MockOrganizationRepository, *MockAuditRepository)
+		expectedId   int64
+		expectedErr  error
+	}{
+		{
+			name:         "creates missing organization",
+			organization: "Acme",
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				mockOrgRepo.On("EnsureOrganization", mock.Anything, "Acme").Return(int64(12), true, nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionOrganizationCreated && entry.TargetType == audit_db.TargetOrganization &&
+						entry.TargetID == 12 && entry.ActorID == 0
+				})).Return(nil).Once()
+			},
+			expectedId: 12,
+		},
+		{
+			name:         "existing organization is reused",
+			organization: "Acme",
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				mockOrgRepo.On("EnsureOrganization", mock.Anything, "Acme").Return(int64(12), false, nil).Once()
+			},
+			expectedId: 12,
+		},
+		{
+			name:         "too long name is rejected",
+			organization: strings.Repeat("а", 101),
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				// Нет вызова мока, так как название не проходит проверку
+			},
+			expectedErr: roles.ErrInvalidOrganization,
+		},
+		{
+			name:         "repository error",
+			organization: "Acme",
+			setupMock: func(mockOrgRepo *MockOrganizationRepository, mockAuditRepo *MockAuditRepository) {
+				mockOrgRepo.On("EnsureOrganization", mock.Anything, "Acme").Return(int64(0), false, errors.New("connection refused")).Once()
+			},
+			expectedErr: errors.New("connection refused"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockOrgRepo := new(MockOrganizationRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockOrgRepo, mockAuditRepo)
+
+			id, err := roles.EnsureOrganization(slog.Default(), mockOrgRepo, mockAuditRepo, context.Background(), test.organization)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.expectedErr.Error())
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.expectedId, id)
+			}
+			mockOrgRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// newRequest создаёт запрос с параметром id маршрута и администратором, как после AuthMiddleware
+func newRequest(userId string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/users/"+userId+"/admin", nil)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", userId)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+	return req.WithContext(auth.NewContext(ctx, auth.Principal{UserID: 1, Role: "admin", Permissions: []string{"user:manage"}}))
+}
+
+func TestSetAdminRoleHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userId         string
+		setupMock      func(*MockUserRepository, *MockPermissionRepository, *MockAuditRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "success is audited",
+			userId: "42",
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"user:manage"}, nil).Once()
+				mockRepo.On("UpdateRole", mock.Anything, int64(42), "admin").Return(nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionUserRoleChanged && entry.ActorID == 1 && entry.TargetID == 42 && entry.Details["role"] == "admin"
+				})).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:   "own role cannot be changed",
+			userId: "1",
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				// Нет вызова мока, так как свою роль менять нельзя
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя изменить собственную роль"}`,
+		},
+		{
+			name:   "user not found",
+			userId: "404",
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"user:manage"}, nil).Once()
+				mockRepo.On("UpdateRole", mock.Anything, int64(404), "admin").Return(users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"User not found"}`,
+		},
+		{
+			name:   "repository error",
+			userId: "42",
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository, mockAuditRepo *MockAuditRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string(nil), errors.New("db is down")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"status":"ERROR","error":"Failed to set admin role"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockRepo, mockPermissionRepo, mockAuditRepo)
+			handler := roles.SetAdminRoleHandler(slog.Default(), mockRepo, mockPermissionRepo, mockAuditRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(test.userId))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockPermissionRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
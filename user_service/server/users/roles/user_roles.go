@@ -4,69 +4,130 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
 	"github.com/ShlykovPavel/booker_microservice/user_service/server/users"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/organizations_db"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
-	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/go-playground/validator"
 	"log/slog"
-	"net/http"
-	"strconv"
+	"unicode/utf8"
 )
 
-func CheckAdminInDB(poll *pgxpool.Pool, log *slog.Logger) error {
-	userRepository := users_db.NewUsersDB(poll, log)
+// RoleAdmin роль администратора
+const RoleAdmin = "admin"
 
-	user, err := userRepository.CheckAdminInDB(context.Background())
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			log.Error("no admin role found", "error", err)
-			//Создаём захэшированный пароль
-			passwordHash, err := users.HashUserPassword("password", log)
-			if err != nil {
-				log.Error("Error while hashing password", "err", err)
-				return fmt.Errorf("failed to hash password: %w", err)
-			}
-			err = userRepository.AddFirstAdmin(context.Background(), passwordHash)
-			if err != nil {
-				log.Error("error adding admin role", "error", err)
-				return err
+var ErrInvalidAdmin = errors.New("Некорректные данные администратора")
+var ErrAdminInactive = errors.New("Пользователь с этим email деактивирован или удалён")
+var ErrInvalidOrganization = errors.New("Название организации должно быть от 1 до 100 символов")
+
+// EnsureAdmin Создаёт администратора, если его ещё нет. Используется командой create-admin
+//
+// Команда идемпотентна:
+// если пользователь с таким email уже администратор - ничего не меняется (пароль тоже не перезаписывается),
+// если это обычный активный пользователь - ему выдаётся роль администратора,
+// если пользователя нет - он создаётся с ролью администратора и подтверждённым email.
+// Деактивированного или удалённого пользователя команда не трогает, возвращает ErrAdminInactive.
+//
+// Возвращает id администратора и признак того, что что-то изменилось
+func EnsureAdmin(log *slog.Logger, userRepository users_db.UserRepository, auditRepository audit_db.AuditRepository, ctx context.Context, admin create_user.UserCreate) (int64, bool, error) {
+	log = log.With(slog.String("op", "user_service/server/users/roles/user_roles.go/EnsureAdmin"),
+		slog.String("email", admin.Email))
+
+	if err := validation.Struct(admin); err != nil {
+		var validationErr validator.ValidationErrors
+		if errors.As(err, &validationErr) {
+			fields := make([]string, 0, len(validationErr))
+			for _, fieldErr := range validationErr {
+				fields = append(fields, fieldErr.Field())
 			}
+			return 0, false, fmt.Errorf("%w: %v", ErrInvalidAdmin, fields)
 		}
-		log.Error("error checking admin role", "error", err)
-		return err
+		return 0, false, err
 	}
-	log.Info("admin role check ok. no need to create admin role. Found admin:", "user", user)
-	return nil
-}
 
-func SetAdminRole(poll *pgxpool.Pool, log *slog.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		userID := chi.URLParam(r, "id")
-		if userID == "" {
-			log.Error("User ID is empty")
-			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("User ID is required"))
-			return
+	user, err := userRepository.GetUserByEmail(ctx, admin.Email)
+	if err != nil && !errors.Is(err, users_db.ErrUserNotFound) {
+		log.Error("Failed to get user by email", "err", err)
+		return 0, false, err
+	}
+	if err == nil {
+		if user.Status == users_db.UserStatusDeactivated || user.Status == users_db.UserStatusDeleted {
+			return 0, false, ErrAdminInactive
 		}
-		id, err := strconv.ParseInt(userID, 10, 64)
-		if err != nil {
-			log.Error("User ID is invalid", "error", err)
-			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
-			return
+		if user.Role == RoleAdmin {
+			log.Info("Admin already exists, nothing to do", "id", user.ID)
+			return user.ID, false, nil
 		}
-		userRepository := users_db.NewUsersDB(poll, log)
-		err = userRepository.SetAdminRole(context.Background(), id)
-		if err != nil {
-			if errors.Is(err, users_db.ErrUserNotFound) {
-				log.Debug("user not found", "error", err)
-				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("User not found"))
-				return
-			}
-
-			log.Error("error setting admin role", "error", err)
-			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to set admin role"))
-			return
+		if err = userRepository.UpdateRole(ctx, user.ID, RoleAdmin); err != nil {
+			log.Error("Failed to promote user to admin", "err", err)
+			return 0, false, err
 		}
+		recordAdminCreated(log, auditRepository, ctx, user.ID, map[string]any{"promoted": true, "previous_role": user.Role})
+		log.Info("User promoted to admin", "id", user.ID)
+		return user.ID, true, nil
+	}
+
+	passwordHash, err := users.HashUserPassword(admin.Password, log)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to hash password: %w", err)
+	}
+	admin.Password = passwordHash
+	id, err := userRepository.CreateAdmin(ctx, &admin)
+	if err != nil {
+		log.Error("Failed to create admin", "err", err)
+		return 0, false, err
+	}
+	recordAdminCreated(log, auditRepository, ctx, id, map[string]any{"promoted": false})
+	log.Info("Admin created", "id", id)
+	return id, true, nil
+}
+
+// EnsureOrganization Возвращает id организации с названием name, создавая её, если её ещё нет.
+// Используется командой create-admin --org, что б создать первого администратора новой организации
+//
+// Создание организации записывается в журнал аудита без ActorID, как и создание администратора
+func EnsureOrganization(log *slog.Logger, organizationRepository organizations_db.OrganizationRepository, auditRepository audit_db.AuditRepository, ctx context.Context, name string) (int64, error) {
+	log = log.With(slog.String("op", "user_service/server/users/roles/user_roles.go/EnsureOrganization"),
+		slog.String("organization", name))
+
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return 0, ErrInvalidOrganization
+	}
+
+	id, created, err := organizationRepository.EnsureOrganization(ctx, name)
+	if err != nil {
+		log.Error("Failed to ensure organization", "err", err)
+		return 0, err
+	}
+	if !created {
+		log.Info("Organization already exists", "id", id)
+		return id, nil
+	}
+	err = auditRepository.Record(ctx, audit_db.Entry{
+		Action:     audit_db.ActionOrganizationCreated,
+		TargetType: audit_db.TargetOrganization,
+		TargetID:   id,
+		Details:    map[string]any{"name": name},
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionOrganizationCreated)
+	}
+	log.Info("Organization created", "id", id)
+	return id, nil
+}
+
+// recordAdminCreated пишет в журнал аудита появление нового администратора.
+// Команда запускается не от имени пользователя, поэтому ActorID не заполняется
+func recordAdminCreated(log *slog.Logger, auditRepository audit_db.AuditRepository, ctx context.Context, id int64, details map[string]any) {
+	err := auditRepository.Record(ctx, audit_db.Entry{
+		Action:     audit_db.ActionAdminCreated,
+		TargetType: audit_db.TargetUser,
+		TargetID:   id,
+		Details:    details,
+	})
+	if err != nil {
+		log.Error("Failed to record audit entry", "err", err, "action", audit_db.ActionAdminCreated)
 	}
 }
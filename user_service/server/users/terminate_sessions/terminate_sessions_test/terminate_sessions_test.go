@@ -0,0 +1,192 @@
+package terminate_sessions_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/terminate_sessions"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/refresh_tokens_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userId, familyId, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (refresh_tokens_db.RefreshTokenInfo, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(refresh_tokens_db.RefreshTokenInfo), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, oldTokenId, newTokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	args := m.Called(ctx, familyId)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func TestTerminateUserSessionsHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		userId         string
+		setupMock      func(*MockUserRepository, *MockRefreshTokenRepository, *MockAuditRepository)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "success is audited",
+			userId: "42",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42}, nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionUserSignedOut && entry.ActorID == 1 && entry.TargetID == 42
+				})).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:   "audit error does not fail request",
+			userId: "42",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(42)).Return(users_db.UserInfo{ID: 42}, nil).Once()
+				mockRefreshRepo.On("RevokeAllForUser", mock.Anything, int64(42)).Return(nil).Once()
+				mockAuditRepo.On("Record", mock.Anything, mock.Anything).Return(errors.New("db is down")).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+		},
+		{
+			name:   "user not found",
+			userId: "404",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository, mockAuditRepo *MockAuditRepository) {
+				mockRepo.On("GetUser", mock.Anything, int64(404)).Return(users_db.UserInfo{}, users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"User not found"}`,
+		},
+		{
+			name:   "invalid id",
+			userId: "abc",
+			setupMock: func(mockRepo *MockUserRepository, mockRefreshRepo *MockRefreshTokenRepository, mockAuditRepo *MockAuditRepository) {
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Invalid user ID"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockRefreshRepo := new(MockRefreshTokenRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockRepo, mockRefreshRepo, mockAuditRepo)
+			handler := terminate_sessions.TerminateUserSessionsHandler(slog.Default(), mockRepo, mockRefreshRepo, mockAuditRepo, 5*time.Second)
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+test.userId+"/sessions", nil)
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("id", test.userId)
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+			req = req.WithContext(auth.NewContext(ctx, auth.Principal{UserID: 1, Role: "admin", Permissions: []string{"user:manage"}}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockRefreshRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
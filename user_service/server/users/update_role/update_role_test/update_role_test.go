@@ -0,0 +1,209 @@
+package update_role_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/user_service/server/users/update_role"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUser(ctx context.Context, userId int64) (users_db.UserInfo, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (users_db.UserInfo, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(users_db.UserInfo), args.Error(1)
+}
+
+func (m *MockUserRepository) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	args := m.Called(ctx, userinfo)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (users_db.UserListResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(users_db.UserListResult), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, email, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	args := m.Called(ctx, id, firstName, lastName, phone)
+	return args.Error(0)
+}
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetStatus(ctx context.Context, id int64, status string, policy users_db.BookingPolicy, reassignTo int64) error {
+	args := m.Called(ctx, id, status, policy, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+type MockPermissionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPermissionRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, entry audit_db.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+// newRequest создаёт запрос с параметром id маршрута и администратором, как после AuthMiddleware
+func newRequest(userId string, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, "/users/"+userId+"/role", bytes.NewReader([]byte(body)))
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", userId)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+	return req.WithContext(auth.NewContext(ctx, auth.Principal{UserID: 1, Role: "admin", Permissions: []string{"user:manage"}}))
+}
+
+func TestUpdateRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		userId         string
+		body           string
+		setupMock      func(*MockUserRepository, *MockPermissionRepository)
+		expectedStatus int
+		expectedBody   string
+		expectAudit    bool
+		auditErr       error
+	}{
+		{
+			name:   "success",
+			userId: "42",
+			body:   `{"role":"admin"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "admin").Return([]string{"user:manage"}, nil).Once()
+				mockRepo.On("UpdateRole", mock.Anything, int64(42), "admin").Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+			expectAudit:    true,
+		},
+		{
+			name:   "audit failure does not fail role change",
+			userId: "42",
+			body:   `{"role":"user"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return([]string{"booking:read"}, nil).Once()
+				mockRepo.On("UpdateRole", mock.Anything, int64(42), "user").Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"OK"}`,
+			expectAudit:    true,
+			auditErr:       errors.New("audit_log is unavailable"),
+		},
+		{
+			name:   "unknown role",
+			userId: "42",
+			body:   `{"role":"superuser"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "superuser").Return([]string{}, nil).Once()
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"Роль не существует"}`,
+		},
+		{
+			name:   "own role cannot be changed",
+			userId: "1",
+			body:   `{"role":"user"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository) {
+				// Нет вызова мока, так как свою роль менять нельзя
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"status":"ERROR","error":"Нельзя изменить собственную роль"}`,
+		},
+		{
+			name:   "user not found",
+			userId: "404",
+			body:   `{"role":"user"}`,
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository) {
+				mockPermissionRepo.On("GetRolePermissions", mock.Anything, "user").Return([]string{"booking:read"}, nil).Once()
+				mockRepo.On("UpdateRole", mock.Anything, int64(404), "user").Return(users_db.ErrUserNotFound).Once()
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"status":"ERROR","error":"User not found"}`,
+		},
+		{
+			name:   "missing role",
+			userId: "42",
+			body:   `{}`,
+			setupMock: func(mockRepo *MockUserRepository, mockPermissionRepo *MockPermissionRepository) {
+				// Нет вызова мока, так как хендлер не проходит валидацию
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"status":"ERROR","error":"field Role is required"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			mockPermissionRepo := new(MockPermissionRepository)
+			mockAuditRepo := new(MockAuditRepository)
+			test.setupMock(mockRepo, mockPermissionRepo)
+			if test.expectAudit {
+				mockAuditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry audit_db.Entry) bool {
+					return entry.Action == audit_db.ActionUserRoleChanged && entry.ActorID == 1 && entry.TargetID == 42
+				})).Return(test.auditErr).Once()
+			}
+			handler := update_role.UpdateRoleHandler(slog.Default(), mockRepo, mockPermissionRepo, mockAuditRepo, 5*time.Second)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newRequest(test.userId, test.body))
+
+			require.Equal(t, test.expectedStatus, w.Code, "unexpected HTTP status")
+			require.JSONEq(t, test.expectedBody, w.Body.String(), "unexpected response body")
+			mockRepo.AssertExpectations(t)
+			mockPermissionRepo.AssertExpectations(t)
+			mockAuditRepo.AssertExpectations(t)
+		})
+	}
+}
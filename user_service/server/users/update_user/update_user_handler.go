@@ -6,6 +6,7 @@ import (
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/update_user"
 	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/validation"
 	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/user_service"
 	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
 	"github.com/go-chi/chi/v5"
@@ -46,7 +47,7 @@ func UpdateUserHandler(log *slog.Logger, userRepository users_db.UserRepository,
 			return
 		}
 
-		err = validator.New().Struct(&UpdateUserDto)
+		err = validation.Struct(&UpdateUserDto)
 		if err != nil {
 			validationErrors := err.(validator.ValidationErrors)
 			log.Error("Failed while validating body", "err", err, "body", r.Body)
@@ -60,6 +61,10 @@ func UpdateUserHandler(log *slog.Logger, userRepository users_db.UserRepository,
 				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
 				return
 			}
+			if errors.Is(err, users_db.ErrEmailAlreadyExists) {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
 			log.Error("Failed to update user", "err", err)
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed updating user"))
 			return
@@ -0,0 +1,31 @@
+package users
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/booker_microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/booker_microservice/user_service/internal/lib/services/user_service"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"log/slog"
+	"net/http"
+)
+
+// RenderStatusChangeError отвечает на ошибку смены статуса пользователя (деактивация, активация, удаление, purge)
+func RenderStatusChangeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, users_db.ErrUserNotFound):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+	case errors.Is(err, user_service.ErrOwnStatusChange):
+		resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+	case errors.Is(err, user_service.ErrInvalidStatusTransition), errors.Is(err, users_db.ErrUserNotDeleted), errors.Is(err, users_db.ErrUserHasBookings), errors.Is(err, users_db.ErrReassignTargetRestricted):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	case errors.Is(err, user_service.ErrReassignTargetRequired), errors.Is(err, users_db.ErrReassignTargetInvalid):
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		log.Warn("Request canceled or timed out", slog.Any("err", err))
+		resp.RenderResponse(w, r, http.StatusGatewayTimeout, resp.Error("Request timed out or canceled"))
+	default:
+		log.Error("Error changing user status", "error", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("internal server error"))
+	}
+}
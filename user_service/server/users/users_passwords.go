@@ -1,35 +1,46 @@
 package users
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/passwords"
 	"log/slog"
 )
 
 // HashUserPassword хеширует пароль
 // при хешировании автоматически генерируется соль
-// ограничение длинны пароля 72 байта (можно выставить 64 символа)
+// алгоритм и его параметры берутся из passwords.Default() (argon2id или bcrypt, задаются в конфигурации)
 func HashUserPassword(password string, log *slog.Logger) (string, error) {
 	log = log.With(
 		slog.String("operation", "server/users.HashUserPassword"))
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Default().Hash(password)
 	if err != nil {
 		log.Error("Hashing password is failed. Error: ", "err", err)
 		return "", err
 	}
-	return string(hashedPassword), nil
+	return hashedPassword, nil
 }
 
 // ComparePassword Проверяет пароль на соответствие
 //
-// Из переданного хеша пароля он сам достаёт соль, и хеширует пароль с этой солью
-// Если пароли совпадают, то ничего не возвращается
+// Из переданного хеша пароля он сам достаёт алгоритм, параметры и соль, и хеширует пароль с ними
 func ComparePassword(hashedPassword string, password string, log *slog.Logger) bool {
+	ok, _ := VerifyPassword(hashedPassword, password, log)
+	return ok
+}
+
+// VerifyPassword Проверяет пароль на соответствие и сообщает, нужно ли перехешировать пароль
+//
+// needsRehash = true, если хеш создан другим алгоритмом или с устаревшими параметрами
+func VerifyPassword(hashedPassword string, password string, log *slog.Logger) (ok bool, needsRehash bool) {
 	log = log.With(
-		slog.String("operation", "server/users.ComparePassword"))
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		slog.String("operation", "server/users.VerifyPassword"))
+	ok, needsRehash, err := passwords.Default().Verify(hashedPassword, password)
 	if err != nil {
-		log.Error("Password is incorrect. Error: ", "err", err)
-		return false
+		log.Error("Failed to verify password. Error: ", "err", err)
+		return false, false
+	}
+	if !ok {
+		log.Debug("Password is incorrect")
+		return false, false
 	}
-	return true
+	return true, needsRehash
 }
@@ -0,0 +1,136 @@
+package email_verification_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrVerificationTokenInvalid = errors.New("Токен подтверждения email недействителен или истёк ")
+var ErrVerificationResendTooSoon = errors.New("Новый токен подтверждения email уже был выдан недавно ")
+
+type EmailVerificationRepository interface {
+	CreateVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash string) (int64, error)
+	ReplaceVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time, minInterval time.Duration) error
+}
+
+type EmailVerificationRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewEmailVerificationRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *EmailVerificationRepositoryImpl {
+	return &EmailVerificationRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// CreateVerificationToken Сохраняет хеш токена подтверждения email
+func (ev *EmailVerificationRepositoryImpl) CreateVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+
+	_, err := ev.db.Exec(ctx, query, userId, tokenHash, expiresAt.UTC())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ev.log); ctxErr != nil {
+			return ctxErr
+		}
+		ev.log.Error("Failed to create email verification token", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// ReplaceVerificationToken Сохраняет новый токен подтверждения email вместо неиспользованных токенов пользователя
+//
+// Выполняется в транзакции, параллельные запросы одного пользователя выполняются по очереди.
+// Если последний токен выдан раньше, чем minInterval назад, новый не создаётся и возвращается ErrVerificationResendTooSoon
+func (ev *EmailVerificationRepositoryImpl) ReplaceVerificationToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time, minInterval time.Duration) error {
+	tx, err := ev.db.Begin(ctx)
+	if err != nil {
+		ev.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var recent bool
+	recentQuery := `SELECT EXISTS (
+    SELECT 1 FROM email_verification_tokens
+    WHERE user_id = u.id AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $2)
+)
+FROM users u WHERE u.id = $1 FOR UPDATE OF u`
+	err = tx.QueryRow(ctx, recentQuery, userId, minInterval.Seconds()).Scan(&recent)
+	if err != nil {
+		return ev.replaceError(ctx, err)
+	}
+	if recent {
+		return ErrVerificationResendTooSoon
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM email_verification_tokens WHERE user_id = $1 AND used_at IS NULL`, userId); err != nil {
+		return ev.replaceError(ctx, err)
+	}
+	insertQuery := `INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err = tx.Exec(ctx, insertQuery, userId, tokenHash, expiresAt.UTC()); err != nil {
+		return ev.replaceError(ctx, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		ev.log.Error("Failed to commit email verification token", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (ev *EmailVerificationRepositoryImpl) replaceError(ctx context.Context, err error) error {
+	if ctxErr := database.DbCtxError(ctx, err, ev.log); ctxErr != nil {
+		return ctxErr
+	}
+	ev.log.Error("Failed to replace email verification token", "error", err)
+	return database.PsqlErrorHandler(err)
+}
+
+// VerifyEmail Помечает токен использованным и подтверждает email пользователя
+//
+// Выполняется в транзакции. Если токен не найден, уже использован или истёк, возвращается ErrVerificationTokenInvalid
+func (ev *EmailVerificationRepositoryImpl) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	tx, err := ev.db.Begin(ctx)
+	if err != nil {
+		ev.log.Error("Failed to begin transaction", "error", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userId int64
+	consumeQuery := `UPDATE email_verification_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING user_id`
+	err = tx.QueryRow(ctx, consumeQuery, tokenHash).Scan(&userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrVerificationTokenInvalid
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ev.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		ev.log.Error("Failed to consume email verification token", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE users SET email_verified = TRUE WHERE id = $1`, userId); err != nil {
+		ev.log.Error("Failed to mark email as verified", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		ev.log.Error("Failed to commit email verification", "error", err)
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userId, nil
+}
@@ -0,0 +1,120 @@
+package identities_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/user_service/storage/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+var ErrIdentityNotFound = errors.New("Внешняя учётная запись не привязана")
+var ErrIdentityAlreadyLinked = errors.New("Внешняя учётная запись уже привязана к другому пользователю")
+
+type IdentityRepository interface {
+	GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int64, error)
+	LinkIdentity(ctx context.Context, userId int64, issuer, subject string) error
+	ProvisionUser(ctx context.Context, userinfo *create_user.UserCreate, role string, emailVerified bool, issuer, subject string) (int64, error)
+}
+
+type IdentityRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewIdentityRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *IdentityRepositoryImpl {
+	return &IdentityRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// GetUserIDByIdentity Возвращает id пользователя, к которому привязана внешняя учётная запись issuer + subject
+func (ir *IdentityRepositoryImpl) GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int64, error) {
+	query := `SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2`
+
+	var userId int64
+	err := ir.db.QueryRow(ctx, query, issuer, subject).Scan(&userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrIdentityNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ir.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		ir.log.Error("Failed to get user identity", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return userId, nil
+}
+
+// LinkIdentity Привязывает внешнюю учётную запись к существующему пользователю
+//
+// У пользователя может быть только одна учётная запись каждого провайдера,
+// если она или сама учётная запись уже привязаны, возвращается ErrIdentityAlreadyLinked
+func (ir *IdentityRepositoryImpl) LinkIdentity(ctx context.Context, userId int64, issuer, subject string) error {
+	query := `INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)`
+
+	_, err := ir.db.Exec(ctx, query, userId, issuer, subject)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, ir.log); ctxErr != nil {
+			return ctxErr
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return ErrIdentityAlreadyLinked
+		}
+		ir.log.Error("Failed to link user identity", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// ProvisionUser Создаёт пользователя с ролью role и сразу привязывает к нему внешнюю учётную запись
+//
+// Пользователь и привязка создаются в одной транзакции. Если email занят, возвращается users_db.ErrEmailAlreadyExists
+func (ir *IdentityRepositoryImpl) ProvisionUser(ctx context.Context, userinfo *create_user.UserCreate, role string, emailVerified bool, issuer, subject string) (int64, error) {
+	tx, err := ir.db.Begin(ctx)
+	if err != nil {
+		ir.log.Error("Failed to begin transaction", "error", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userId int64
+	err = tx.QueryRow(ctx, `
+INSERT INTO users (first_name, last_name, email, password, role, phone, email_verified)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id`, userinfo.FirstName, userinfo.LastName, userinfo.Email, userinfo.Password, role, userinfo.Phone, emailVerified).Scan(&userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return 0, users_db.ErrEmailAlreadyExists
+		}
+		return 0, ir.txError(ctx, err, "Failed to insert provisioned user")
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)`, userId, issuer, subject)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return 0, ErrIdentityAlreadyLinked
+		}
+		return 0, ir.txError(ctx, err, "Failed to insert user identity")
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		ir.log.Error("Failed to commit user provisioning", "error", err)
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userId, nil
+}
+
+func (ir *IdentityRepositoryImpl) txError(ctx context.Context, err error, msg string) error {
+	if ctxErr := database.DbCtxError(ctx, err, ir.log); ctxErr != nil {
+		return ctxErr
+	}
+	ir.log.Error(msg, "error", err)
+	return database.PsqlErrorHandler(err)
+}
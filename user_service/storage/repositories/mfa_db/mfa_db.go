@@ -0,0 +1,289 @@
+package mfa_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrTOTPNotFound = errors.New("Двухфакторная аутентификация не подключена")
+var ErrTOTPAlreadyConfirmed = errors.New("Двухфакторная аутентификация уже подключена")
+var ErrTOTPStepUsed = errors.New("Код уже был использован")
+var ErrBackupCodeInvalid = errors.New("Резервный код недействителен")
+var ErrChallengeInvalid = errors.New("Токен второго шага входа недействителен или истёк")
+
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userId int64) (TOTPInfo, error)
+	SaveTOTPSecret(ctx context.Context, userId int64, secret string) error
+	ConfirmTOTP(ctx context.Context, userId int64, step int64, backupCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userId int64, step int64) error
+	UseBackupCode(ctx context.Context, userId int64, codeHash string) error
+	DeleteTOTP(ctx context.Context, userId int64) error
+	CreateChallenge(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error
+	GetChallenge(ctx context.Context, tokenHash string) (ChallengeInfo, error)
+	RegisterChallengeAttempt(ctx context.Context, id int64) (int, error)
+	ConsumeChallenge(ctx context.Context, id int64) error
+}
+
+// TOTPInfo секрет TOTP пользователя. ConfirmedAt = nil, пока подключение не подтверждено кодом
+type TOTPInfo struct {
+	UserID       int64
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep *int64
+}
+
+// Confirmed подтверждено ли подключение 2FA
+func (t TOTPInfo) Confirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+// ChallengeInfo незавершённый вход, ожидающий второй фактор
+type ChallengeInfo struct {
+	ID        int64
+	UserID    int64
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type MFARepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewMFARepository(dbPoll *pgxpool.Pool, log *slog.Logger) *MFARepositoryImpl {
+	return &MFARepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+func (mr *MFARepositoryImpl) GetTOTP(ctx context.Context, userId int64) (TOTPInfo, error) {
+	query := `SELECT user_id, secret, confirmed_at, last_used_step FROM user_totp WHERE user_id = $1`
+
+	var info TOTPInfo
+	err := mr.db.QueryRow(ctx, query, userId).Scan(&info.UserID, &info.Secret, &info.ConfirmedAt, &info.LastUsedStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TOTPInfo{}, ErrTOTPNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return TOTPInfo{}, ctxErr
+		}
+		mr.log.Error("Failed to get totp secret", "error", err)
+		return TOTPInfo{}, database.PsqlErrorHandler(err)
+	}
+	return info, nil
+}
+
+// SaveTOTPSecret Сохраняет новый неподтверждённый секрет, заменяя предыдущий неподтверждённый
+//
+// Подтверждённый секрет не перезаписывается, в этом случае возвращается ErrTOTPAlreadyConfirmed
+func (mr *MFARepositoryImpl) SaveTOTPSecret(ctx context.Context, userId int64, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = CURRENT_TIMESTAMP
+WHERE user_totp.confirmed_at IS NULL`
+
+	result, err := mr.db.Exec(ctx, query, userId, secret)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return ctxErr
+		}
+		mr.log.Error("Failed to save totp secret", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPAlreadyConfirmed
+	}
+	return nil
+}
+
+// ConfirmTOTP Подтверждает подключение 2FA и заменяет резервные коды пользователя
+//
+// step - шаг кода, которым подтверждено подключение, что б этот код нельзя было сразу использовать для входа
+func (mr *MFARepositoryImpl) ConfirmTOTP(ctx context.Context, userId int64, step int64, backupCodeHashes []string) error {
+	tx, err := mr.db.Begin(ctx)
+	if err != nil {
+		mr.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `UPDATE user_totp SET confirmed_at = CURRENT_TIMESTAMP, last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL`, userId, step)
+	if err != nil {
+		return mr.txError(ctx, err, "Failed to confirm totp")
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPAlreadyConfirmed
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM mfa_backup_codes WHERE user_id = $1`, userId); err != nil {
+		return mr.txError(ctx, err, "Failed to delete old backup codes")
+	}
+	for _, codeHash := range backupCodeHashes {
+		if _, err = tx.Exec(ctx, `INSERT INTO mfa_backup_codes (user_id, code_hash) VALUES ($1, $2)`, userId, codeHash); err != nil {
+			return mr.txError(ctx, err, "Failed to insert backup code")
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		mr.log.Error("Failed to commit totp confirmation", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep Запоминает шаг использованного кода
+//
+// Код принимается только если его шаг больше последнего использованного, иначе возвращается ErrTOTPStepUsed.
+// Проверка и обновление выполняются одним запросом, поэтому один код нельзя использовать дважды даже параллельно
+func (mr *MFARepositoryImpl) UseTOTPStep(ctx context.Context, userId int64, step int64) error {
+	query := `UPDATE user_totp SET last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NOT NULL AND (last_used_step IS NULL OR last_used_step < $2)`
+
+	result, err := mr.db.Exec(ctx, query, userId, step)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return ctxErr
+		}
+		mr.log.Error("Failed to update totp step", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPStepUsed
+	}
+	return nil
+}
+
+// UseBackupCode Помечает резервный код использованным. Если код не найден или уже использован, возвращается ErrBackupCodeInvalid
+func (mr *MFARepositoryImpl) UseBackupCode(ctx context.Context, userId int64, codeHash string) error {
+	query := `UPDATE mfa_backup_codes SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := mr.db.Exec(ctx, query, userId, codeHash)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return ctxErr
+		}
+		mr.log.Error("Failed to use backup code", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrBackupCodeInvalid
+	}
+	return nil
+}
+
+// DeleteTOTP Отключает 2FA: удаляет секрет и резервные коды пользователя
+func (mr *MFARepositoryImpl) DeleteTOTP(ctx context.Context, userId int64) error {
+	tx, err := mr.db.Begin(ctx)
+	if err != nil {
+		mr.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userId)
+	if err != nil {
+		return mr.txError(ctx, err, "Failed to delete totp secret")
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPNotFound
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM mfa_backup_codes WHERE user_id = $1`, userId); err != nil {
+		return mr.txError(ctx, err, "Failed to delete backup codes")
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		mr.log.Error("Failed to commit totp deletion", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateChallenge Сохраняет хеш токена второго шага входа. Сам токен отдаётся клиенту и в БД не хранится
+func (mr *MFARepositoryImpl) CreateChallenge(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+
+	_, err := mr.db.Exec(ctx, query, userId, tokenHash, expiresAt.UTC())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return ctxErr
+		}
+		mr.log.Error("Failed to create mfa challenge", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// GetChallenge Возвращает действующий (не использованный и не истёкший) вход, иначе ErrChallengeInvalid
+func (mr *MFARepositoryImpl) GetChallenge(ctx context.Context, tokenHash string) (ChallengeInfo, error) {
+	query := `SELECT id, user_id, attempts, expires_at, used_at FROM mfa_challenges
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	var info ChallengeInfo
+	err := mr.db.QueryRow(ctx, query, tokenHash).Scan(&info.ID, &info.UserID, &info.Attempts, &info.ExpiresAt, &info.UsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ChallengeInfo{}, ErrChallengeInvalid
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return ChallengeInfo{}, ctxErr
+		}
+		mr.log.Error("Failed to get mfa challenge", "error", err)
+		return ChallengeInfo{}, database.PsqlErrorHandler(err)
+	}
+	return info, nil
+}
+
+// RegisterChallengeAttempt Увеличивает счётчик попыток ввода кода и возвращает его новое значение
+func (mr *MFARepositoryImpl) RegisterChallengeAttempt(ctx context.Context, id int64) (int, error) {
+	query := `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts`
+
+	var attempts int
+	err := mr.db.QueryRow(ctx, query, id).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrChallengeInvalid
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		mr.log.Error("Failed to register mfa challenge attempt", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return attempts, nil
+}
+
+// ConsumeChallenge Помечает вход завершённым. Повторно использовать токен второго шага нельзя
+func (mr *MFARepositoryImpl) ConsumeChallenge(ctx context.Context, id int64) error {
+	query := `UPDATE mfa_challenges SET used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	result, err := mr.db.Exec(ctx, query, id)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+			return ctxErr
+		}
+		mr.log.Error("Failed to consume mfa challenge", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrChallengeInvalid
+	}
+	return nil
+}
+
+func (mr *MFARepositoryImpl) txError(ctx context.Context, err error, msg string) error {
+	if ctxErr := database.DbCtxError(ctx, err, mr.log); ctxErr != nil {
+		return ctxErr
+	}
+	mr.log.Error(msg, "error", err)
+	return database.PsqlErrorHandler(err)
+}
@@ -0,0 +1,83 @@
+package organizations_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+var ErrOrganizationAlreadyExists = errors.New("Организация с таким названием уже существует")
+
+type OrganizationRepository interface {
+	CreateOrganization(ctx context.Context, name string) (int64, error)
+	EnsureOrganization(ctx context.Context, name string) (int64, bool, error)
+}
+
+// OrganizationRepositoryImpl Организации не принадлежат организации запроса, поэтому запросы не ограничиваются tenant.FromContext.
+// Кто может создавать организации, проверяется до обращения к репозиторию
+type OrganizationRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewOrganizationRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *OrganizationRepositoryImpl {
+	return &OrganizationRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// CreateOrganization Создаёт организацию. Если организация с таким названием уже есть, возвращает ErrOrganizationAlreadyExists
+func (or *OrganizationRepositoryImpl) CreateOrganization(ctx context.Context, name string) (int64, error) {
+	query := `INSERT INTO organizations (name) VALUES ($1) RETURNING id`
+
+	var id int64
+	err := or.db.QueryRow(ctx, query, name).Scan(&id)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, or.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return 0, ErrOrganizationAlreadyExists
+		}
+		or.log.Error("Failed to create organization", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, nil
+}
+
+// EnsureOrganization Возвращает id организации с таким названием, создавая её, если её ещё нет.
+// Используется командой create-admin
+//
+// Второе значение - признак того, что организация была создана
+func (or *OrganizationRepositoryImpl) EnsureOrganization(ctx context.Context, name string) (int64, bool, error) {
+	// При параллельном создании INSERT ничего не возвращает, и организация читается вторым запросом
+	query := `INSERT INTO organizations (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id`
+
+	var id int64
+	err := or.db.QueryRow(ctx, query, name).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, or.ensureError(ctx, err)
+	}
+
+	err = or.db.QueryRow(ctx, `SELECT id FROM organizations WHERE name = $1`, name).Scan(&id)
+	if err != nil {
+		return 0, false, or.ensureError(ctx, err)
+	}
+	return id, false, nil
+}
+
+func (or *OrganizationRepositoryImpl) ensureError(ctx context.Context, err error) error {
+	if ctxErr := database.DbCtxError(ctx, err, or.log); ctxErr != nil {
+		return ctxErr
+	}
+	or.log.Error("Failed to ensure organization", "error", err)
+	return database.PsqlErrorHandler(err)
+}
@@ -0,0 +1,69 @@
+package password_reset_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrResetTokenInvalid = errors.New("Токен сброса пароля недействителен или истёк ")
+
+type PasswordResetRepository interface {
+	CreateResetToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error
+	ConsumeResetToken(ctx context.Context, tokenHash string) (int64, error)
+}
+
+type PasswordResetRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewPasswordResetRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *PasswordResetRepositoryImpl {
+	return &PasswordResetRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// CreateResetToken Сохраняет хеш токена сброса пароля. Сам токен отправляется пользователю и в БД не хранится
+func (pr *PasswordResetRepositoryImpl) CreateResetToken(ctx context.Context, userId int64, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+
+	_, err := pr.db.Exec(ctx, query, userId, tokenHash, expiresAt.UTC())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, pr.log); ctxErr != nil {
+			return ctxErr
+		}
+		pr.log.Error("Failed to create password reset token", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// ConsumeResetToken Помечает токен использованным и возвращает id пользователя
+//
+// Проверка и пометка выполняются одним запросом, поэтому токен нельзя использовать дважды даже параллельными запросами.
+// Если токен не найден, уже использован или истёк, возвращается ErrResetTokenInvalid
+func (pr *PasswordResetRepositoryImpl) ConsumeResetToken(ctx context.Context, tokenHash string) (int64, error) {
+	query := `UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING user_id`
+
+	var userId int64
+	err := pr.db.QueryRow(ctx, query, tokenHash).Scan(&userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, pr.log); ctxErr != nil {
+			return 0, ctxErr
+		}
+		pr.log.Error("Failed to consume password reset token", "error", err)
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return userId, nil
+}
@@ -0,0 +1,163 @@
+package refresh_tokens_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrRefreshTokenNotFound = errors.New("Refresh токен не найден ")
+var ErrRefreshTokenAlreadyUsed = errors.New("Refresh токен уже был использован ")
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshTokenInfo, error)
+	RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error
+	RevokeFamily(ctx context.Context, familyId string) error
+	RevokeAllForUser(ctx context.Context, userId int64) error
+}
+
+// RefreshTokenInfo Информация о refresh токене. Сам токен в БД не хранится, только его хеш
+type RefreshTokenInfo struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewRefreshTokenRepository(dbPoll *pgxpool.Pool, log *slog.Logger) *RefreshTokenRepositoryImpl {
+	return &RefreshTokenRepositoryImpl{
+		db:  dbPoll,
+		log: log,
+	}
+}
+
+// CreateRefreshToken Сохраняет хеш нового refresh токена
+// familyId - идентификатор семейства токенов, которое начинается при логине и наследуется при каждой ротации
+func (rt *RefreshTokenRepositoryImpl) CreateRefreshToken(ctx context.Context, userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+
+	_, err := rt.db.Exec(ctx, query, userId, familyId, tokenHash, expiresAt.UTC())
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, rt.log); ctxErr != nil {
+			return ctxErr
+		}
+		rt.log.Error("Failed to create refresh token", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func (rt *RefreshTokenRepositoryImpl) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshTokenInfo, error) {
+	query := `SELECT id, user_id, family_id, expires_at, used_at, revoked_at FROM refresh_tokens WHERE token_hash = $1`
+
+	var token RefreshTokenInfo
+	err := rt.db.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RefreshTokenInfo{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, rt.log); ctxErr != nil {
+			return RefreshTokenInfo{}, ctxErr
+		}
+		return RefreshTokenInfo{}, database.PsqlErrorHandler(err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken Помечает старый токен использованным и сохраняет новый токен того же семейства
+//
+// Выполняется в транзакции. Если старый токен уже был использован или отозван
+// (например, параллельный запрос успел его ротировать), возвращается ErrRefreshTokenAlreadyUsed
+func (rt *RefreshTokenRepositoryImpl) RotateRefreshToken(ctx context.Context, oldTokenId int64, newTokenHash string, expiresAt time.Time) error {
+	tx, err := rt.db.Begin(ctx)
+	if err != nil {
+		rt.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userId int64
+	var familyId string
+	markUsedQuery := `UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+RETURNING user_id, family_id`
+	err = tx.QueryRow(ctx, markUsedQuery, oldTokenId).Scan(&userId, &familyId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRefreshTokenAlreadyUsed
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, rt.log); ctxErr != nil {
+			return ctxErr
+		}
+		rt.log.Error("Failed to mark refresh token as used", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+
+	insertQuery := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(ctx, insertQuery, userId, familyId, newTokenHash, expiresAt.UTC()); err != nil {
+		rt.log.Error("Failed to insert rotated refresh token", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		rt.log.Error("Failed to commit refresh token rotation", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RevokeFamily Отзывает все токены семейства (используется при обнаружении повторного использования токена)
+//
+// Сессия семейства тоже завершается, поэтому выданные в ней токены доступа перестают приниматься AuthMiddleware
+func (rt *RefreshTokenRepositoryImpl) RevokeFamily(ctx context.Context, familyId string) error {
+	query := `WITH terminated AS (
+    UPDATE sessions SET terminated_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND terminated_at IS NULL
+)
+UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+
+	result, err := rt.db.Exec(ctx, query, familyId)
+	if err != nil {
+		rt.log.Error("Failed to revoke refresh token family", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	rt.log.Debug("Refresh token family revoked", "family_id", familyId, "revoked", result.RowsAffected())
+	return nil
+}
+
+// RevokeAllForUser Отзывает все refresh токены пользователя, завершая все его сессии (например, после сброса пароля)
+func (rt *RefreshTokenRepositoryImpl) RevokeAllForUser(ctx context.Context, userId int64) error {
+	query := `WITH terminated AS (
+    UPDATE sessions SET terminated_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND terminated_at IS NULL
+)
+UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+
+	result, err := rt.db.Exec(ctx, query, userId)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, rt.log); ctxErr != nil {
+			return ctxErr
+		}
+		rt.log.Error("Failed to revoke user refresh tokens", "error", err)
+		return database.PsqlErrorHandler(err)
+	}
+	rt.log.Debug("User refresh tokens revoked", "user_id", userId, "revoked", result.RowsAffected())
+	return nil
+}
@@ -0,0 +1,151 @@
+package users_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/auth"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/booker_microservice/internal/storage/database/repositories/groups_db"
+	"github.com/jackc/pgx/v5"
+	"log/slog"
+)
+
+// Статусы пользователя
+//
+// Деактивированный пользователь не может войти, но может быть активирован снова.
+// Удалённый пользователь скрыт из списков, окончательно удаляется только через PurgeUser
+const (
+	UserStatusActive      = "active"
+	UserStatusDeactivated = "deactivated"
+	UserStatusDeleted     = "deleted"
+)
+
+// BookingPolicy что делать с будущими бронированиями пользователя при деактивации или удалении
+type BookingPolicy string
+
+const (
+	BookingPolicyCancel   BookingPolicy = "cancel"
+	BookingPolicyReassign BookingPolicy = "reassign"
+	BookingPolicyKeep     BookingPolicy = "keep"
+)
+
+var ErrUserNotDeleted = errors.New("Окончательно удалить можно только удалённого пользователя")
+var ErrUserHasBookings = errors.New("Нельзя окончательно удалить пользователя с действующими бронированиями, сначала их нужно отменить")
+var ErrReassignTargetInvalid = errors.New("Пользователь для переназначения бронирований не найден или не активен")
+var ErrReassignTargetRestricted = errors.New("Пользователю для переназначения недоступны объекты некоторых бронирований из-за ограничений по группам")
+
+// SetStatus Меняет статус пользователя и применяет политику к его будущим бронированиям
+//
+// Выполняется в транзакции: статус и бронирования меняются вместе.
+// Для статуса deleted выставляется deleted_at, для остальных статусов он сбрасывается.
+// reassignTo используется только с BookingPolicyReassign и должен быть активным пользователем той же организации,
+// которому доступны объекты всех переназначаемых бронирований (ErrReassignTargetRestricted). Каждое переназначенное
+// бронирование записывается в журнал аудита
+func (us *UserRepositoryImpl) SetStatus(ctx context.Context, id int64, status string, policy BookingPolicy, reassignTo int64) error {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		us.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	statusQuery := `UPDATE users
+SET status = $1, deleted_at = CASE WHEN $1 = 'deleted' THEN CURRENT_TIMESTAMP END
+WHERE id = $2`
+	statusArgs := []interface{}{status, id}
+	statusQuery += tenant.And(ctx, "tenant_id", &statusArgs)
+	result, err := tx.Exec(ctx, statusQuery, statusArgs...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return ctxErr
+		}
+		us.log.Error("Failed to update user status", slog.String("error", err.Error()))
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	// Изменения бронирований записываются от имени пользователя запроса
+	var changedBy int64
+	if principal, ok := auth.FromContext(ctx); ok {
+		changedBy = principal.UserID
+	}
+	var bookingsAffected int64
+	switch policy {
+	case BookingPolicyCancel:
+		// Отменяются только бронирования, которые ещё можно отменить, отмена записывается в историю статусов
+		// от имени пользователя запроса. У системных вызовов (SCIM) автор отмены не указывается
+		cancelQuery := `WITH cancelled AS (
+    UPDATE bookings b SET status = 'cancelled'
+    FROM bookings old
+    WHERE old.id = b.id AND b.user_id = $1 AND b.start_time > CURRENT_TIMESTAMP AND b.status IN ('pending', 'confirmed')
+    RETURNING b.id, old.status AS from_status
+)
+INSERT INTO booking_status_history (booking_id, from_status, to_status, changed_by)
+SELECT id, from_status, 'cancelled', NULLIF($2::BIGINT, 0) FROM cancelled`
+		result, err = tx.Exec(ctx, cancelQuery, id, changedBy)
+		bookingsAffected = result.RowsAffected()
+	case BookingPolicyReassign:
+		var targetStatus string
+		targetArgs := []interface{}{reassignTo}
+		targetQuery := `SELECT status FROM users WHERE id = $1` + tenant.And(ctx, "tenant_id", &targetArgs)
+		err = tx.QueryRow(ctx, targetQuery, targetArgs...).Scan(&targetStatus)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && targetStatus != UserStatusActive) {
+			return ErrReassignTargetInvalid
+		}
+		if err != nil {
+			us.log.Error("Failed to get reassign target", slog.String("error", err.Error()))
+			return database.PsqlErrorHandler(err)
+		}
+		// Переназначаются те же бронирования, что отменяет BookingPolicyCancel. Если объект или тип хотя бы одного
+		// из них ограничен группами, в которых нет нового владельца, не переназначается ничего
+		restrictedQuery := `SELECT EXISTS (
+    SELECT 1 FROM bookings b JOIN booking_entities e ON e.id = b.booking_entity_id
+    WHERE b.user_id = $1 AND b.start_time > CURRENT_TIMESTAMP AND b.status IN ('pending', 'confirmed')
+    AND NOT ` + groups_db.BookingEntityAllowedCondition("e.id", "e.booking_type_id", 2) + `
+)`
+		var restricted bool
+		err = tx.QueryRow(ctx, restrictedQuery, id, reassignTo).Scan(&restricted)
+		if err != nil {
+			if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+				return ctxErr
+			}
+			us.log.Error("Failed to check reassign target groups", slog.String("error", err.Error()))
+			return database.PsqlErrorHandler(err)
+		}
+		if restricted {
+			return ErrReassignTargetRestricted
+		}
+		reassignQuery := `WITH reassigned AS (
+    UPDATE bookings SET user_id = $2
+    WHERE user_id = $1 AND start_time > CURRENT_TIMESTAMP AND status IN ('pending', 'confirmed')
+    RETURNING id
+)
+INSERT INTO audit_log (actor_id, action, target_type, target_id, details)
+SELECT NULLIF($3::BIGINT, 0), $4, $5, id, jsonb_build_object('from_user_id', $1::BIGINT, 'to_user_id', $2::BIGINT)
+FROM reassigned`
+		result, err = tx.Exec(ctx, reassignQuery, id, reassignTo, changedBy, audit_db.ActionBookingReassigned, audit_db.TargetBooking)
+		bookingsAffected = result.RowsAffected()
+	case BookingPolicyKeep:
+	default:
+		return fmt.Errorf("unknown booking policy %q", policy)
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return ctxErr
+		}
+		us.log.Error("Failed to apply booking policy", slog.String("error", err.Error()), "policy", policy)
+		return database.PsqlErrorHandler(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		us.log.Error("Failed to commit user status change", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	us.log.Debug("User status changed", "id", id, "status", status, "policy", policy, "bookings_affected", bookingsAffected)
+	return nil
+}
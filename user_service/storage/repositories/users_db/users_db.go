@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/models/users/create_user"
 	"github.com/ShlykovPavel/booker_microservice/internal/lib/api/query_params"
+	"github.com/ShlykovPavel/booker_microservice/internal/lib/tenant"
 	"github.com/ShlykovPavel/booker_microservice/internal/storage/database"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
 	"strings"
+	"time"
 )
 
 var ErrEmailAlreadyExists = errors.New("Пользователь с email уже существует. ")
@@ -20,13 +22,19 @@ var ErrUserNotFound = errors.New("Пользователь не найден ")
 type UserRepository interface {
 	CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error)
 	GetUser(ctx context.Context, userId int64) (UserInfo, error)
+	GetUserByEmail(ctx context.Context, email string) (UserInfo, error)
 	GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (UserListResult, error)
-	CheckAdminInDB(ctx context.Context) (UserInfo, error)
-	AddFirstAdmin(ctx context.Context, passwordHash string) error
-	UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone, role string) error
-	DeleteUser(ctx context.Context, id int64) error
+	CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error)
+	UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error
+	UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error
+	UpdateRole(ctx context.Context, id int64, role string) error
+	SetStatus(ctx context.Context, id int64, status string, policy BookingPolicy, reassignTo int64) error
+	PurgeUser(ctx context.Context, id int64) error
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
 }
 
+// UserRepositoryImpl Запросы ограничиваются организацией пользователя запроса (см. tenant.FromContext).
+// Без пользователя в контексте (вход, обновление токена, SCIM) запросы выполняются по всем организациям
 type UserRepositoryImpl struct {
 	db  *pgxpool.Pool
 	log *slog.Logger
@@ -34,13 +42,17 @@ type UserRepositoryImpl struct {
 
 // UserInfo Структура с информацие о пользователе
 type UserInfo struct {
-	ID           int64
-	FirstName    string
-	LastName     string
-	Email        string
-	PasswordHash string
-	Role         string
-	Phone        string
+	ID            int64
+	FirstName     string
+	LastName      string
+	Email         string
+	PasswordHash  string
+	Role          string
+	Phone         string
+	EmailVerified bool
+	Status        string
+	DeletedAt     *time.Time
+	TenantID      int64
 }
 type UserListResult struct {
 	Users []UserInfo
@@ -59,14 +71,15 @@ func NewUsersDB(dbPoll *pgxpool.Pool, log *slog.Logger) *UserRepositoryImpl {
 // ctx - внешний контекст, что б вызывающая сторона могла контролировать запрос (например выставить таймаут)
 // userinfo - структуру UserInfo с необходимыми полями для добавления
 //
+// Пользователь создаётся в организации пользователя запроса, без авторизации - в организации по умолчанию.
 // После запроса возвращается Id созданного пользователя
 func (us *UserRepositoryImpl) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
 	query := `
-INSERT INTO users (first_name, last_name, email, password, Role, phone)
-VALUES ($1, $2, $3, $4, 'user', $5)
+INSERT INTO users (first_name, last_name, email, password, Role, phone, tenant_id)
+VALUES ($1, $2, $3, $4, 'user', $5, $6)
 RETURNING id`
 	var id int64
-	err := us.db.QueryRow(ctx, query, userinfo.FirstName, userinfo.LastName, userinfo.Email, userinfo.Password, userinfo.Phone).Scan(&id)
+	err := us.db.QueryRow(ctx, query, userinfo.FirstName, userinfo.LastName, userinfo.Email, userinfo.Password, userinfo.Phone, tenant.ForInsert(ctx)).Scan(&id)
 	if err != nil {
 		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
 			return 0, ctxErr
@@ -82,16 +95,57 @@ RETURNING id`
 }
 
 func (us *UserRepositoryImpl) GetUser(ctx context.Context, userId int64) (UserInfo, error) {
-	query := `SELECT first_name, last_name, email, password, role, phone FROM users WHERE id = $1`
+	query := `SELECT id, first_name, last_name, email, password, role, phone, email_verified, status, deleted_at, tenant_id FROM users WHERE id = $1`
+	args := []interface{}{userId}
+	query += tenant.And(ctx, "tenant_id", &args)
 
 	var user UserInfo
-	err := us.db.QueryRow(ctx, query, userId).Scan(
+	err := us.db.QueryRow(ctx, query, args...).Scan(
+		&user.ID,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Role,
-		&user.Phone)
+		&user.Phone,
+		&user.EmailVerified,
+		&user.Status,
+		&user.DeletedAt,
+		&user.TenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UserInfo{}, ErrUserNotFound
+	}
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return UserInfo{}, ctxErr
+		}
+		dbErr := database.PsqlErrorHandler(err)
+		return UserInfo{}, dbErr
+	}
+	return user, nil
+}
+
+// GetUserByEmail Поиск пользователя по email
+// Используется при аутентификации, поэтому возвращает также хеш пароля и роль.
+// Email уникален во всех организациях, поэтому при входе организация пользователя определяется по найденной записи
+func (us *UserRepositoryImpl) GetUserByEmail(ctx context.Context, email string) (UserInfo, error) {
+	query := `SELECT id, first_name, last_name, email, password, role, phone, email_verified, status, deleted_at, tenant_id FROM users WHERE email = $1`
+	args := []interface{}{email}
+	query += tenant.And(ctx, "tenant_id", &args)
+
+	var user UserInfo
+	err := us.db.QueryRow(ctx, query, args...).Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.Phone,
+		&user.EmailVerified,
+		&user.Status,
+		&user.DeletedAt,
+		&user.TenantID)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return UserInfo{}, ErrUserNotFound
 	}
@@ -107,9 +161,10 @@ func (us *UserRepositoryImpl) GetUser(ctx context.Context, userId int64) (UserIn
 
 func (us *UserRepositoryImpl) GetUserList(ctx context.Context, search string, limit, offset int, sortParams []query_params.SortParam) (UserListResult, error) {
 	// Базовый SQL-запрос для пользователей
-	query := "SELECT id, first_name, last_name, email, role, phone FROM users"
-	countQuery := "SELECT COUNT(*) FROM users"
-	searchQuery := " WHERE first_name ILIKE $1 OR last_name ILIKE $1 OR email ILIKE $1"
+	// Удалённые пользователи в список не попадают
+	query := "SELECT id, first_name, last_name, email, role, phone, status FROM users WHERE status <> 'deleted'"
+	countQuery := "SELECT COUNT(*) FROM users WHERE status <> 'deleted'"
+	searchQuery := " AND (first_name ILIKE $1 OR last_name ILIKE $1 OR email ILIKE $1)"
 	args := []interface{}{}
 	countArgs := []interface{}{}
 
@@ -120,6 +175,12 @@ func (us *UserRepositoryImpl) GetUserList(ctx context.Context, search string, li
 		args = append(args, "%"+search+"%")
 		countArgs = append(countArgs, "%"+search+"%")
 	}
+	// Только пользователи организации пользователя запроса
+	if condition := tenant.And(ctx, "tenant_id", &args); condition != "" {
+		query += condition
+		countQuery += condition
+		countArgs = append(countArgs, args[len(args)-1])
+	}
 
 	// Сортировка
 	var orderBy []string
@@ -159,7 +220,7 @@ func (us *UserRepositoryImpl) GetUserList(ctx context.Context, search string, li
 	var users []UserInfo
 	for rows.Next() {
 		var user UserInfo
-		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Role, &user.Phone); err != nil {
+		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Role, &user.Phone, &user.Status); err != nil {
 			us.log.Error("Error scanning user row", slog.Any("error", err))
 			return UserListResult{}, fmt.Errorf("error scanning user row: %w", err)
 		}
@@ -176,84 +237,177 @@ func (us *UserRepositoryImpl) GetUserList(ctx context.Context, search string, li
 	}, nil
 }
 
-func (us *UserRepositoryImpl) CheckAdminInDB(ctx context.Context) (UserInfo, error) {
-	query := `SELECT id, first_name, last_name, email, password FROM users WHERE Role LIKE '%admin%'`
-
-	var user UserInfo
-	err := us.db.QueryRow(ctx, query).Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.PasswordHash,
-	)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return UserInfo{}, pgx.ErrNoRows
-	}
+// CreateAdmin Создание администратора
+//
+// Используется командой create-admin. Email администратора считается подтверждённым
+func (us *UserRepositoryImpl) CreateAdmin(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	query := `
+INSERT INTO users (first_name, last_name, email, password, Role, phone, email_verified, tenant_id)
+VALUES ($1, $2, $3, $4, 'admin', $5, TRUE, $6)
+RETURNING id`
+	var id int64
+	err := us.db.QueryRow(ctx, query, userinfo.FirstName, userinfo.LastName, userinfo.Email, userinfo.Password, userinfo.Phone, tenant.ForInsert(ctx)).Scan(&id)
 	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return 0, ctxErr
+		}
 		dbErr := database.PsqlErrorHandler(err)
-		return UserInfo{}, dbErr
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return 0, ErrEmailAlreadyExists
+		}
+		return 0, dbErr
 	}
-	return user, nil
+
+	return id, nil
 }
 
-func (us *UserRepositoryImpl) AddFirstAdmin(ctx context.Context, passwordHash string) error {
-	query := `INSERT INTO users (id, first_name, last_name, email, password, Role, phone) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+// UpdateUser Обновляет данные пользователя. Роль меняется отдельно через UpdateRole
+func (us *UserRepositoryImpl) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone string) error {
+	query := `UPDATE users SET first_name = $1, last_name = $2, email = $3, phone = $4 WHERE id = $5`
+	args := []interface{}{firstName, lastName, email, phone, id}
+	query += tenant.And(ctx, "tenant_id", &args)
 
-	_, err := us.db.Exec(ctx, query, 0, "Admin first name", "Admin last name", "admin@admin.com", passwordHash, "admin", +78901234567)
+	result, err := us.db.Exec(ctx, query, args...)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return ErrEmailAlreadyExists
+		}
 		dbErr := database.PsqlErrorHandler(err)
+		us.log.Error("Failed to update user in db", slog.String("error", err.Error()))
 		return dbErr
 	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	us.log.Debug("User updated successfully", "id", id)
 	return nil
 }
 
-func (us *UserRepositoryImpl) SetAdminRole(ctx context.Context, id int64) error {
-	query := `UPDATE users SET Role = 'admin' WHERE id = $1`
-	result, err := us.db.Exec(ctx, query, id)
+// UpdateProfile Обновляет поля профиля, которые пользователь может менять сам
+func (us *UserRepositoryImpl) UpdateProfile(ctx context.Context, id int64, firstName, lastName, phone string) error {
+	query := `UPDATE users SET first_name = $1, last_name = $2, phone = $3 WHERE id = $4`
+	args := []interface{}{firstName, lastName, phone, id}
+	query += tenant.And(ctx, "tenant_id", &args)
+
+	result, err := us.db.Exec(ctx, query, args...)
 	if err != nil {
-		dbErr := database.PsqlErrorHandler(err)
-		return dbErr
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return ctxErr
+		}
+		us.log.Error("Failed to update user profile in db", slog.String("error", err.Error()))
+		return database.PsqlErrorHandler(err)
 	}
 	if result.RowsAffected() == 0 {
 		return ErrUserNotFound
 	}
+	us.log.Debug("User profile updated successfully", "id", id)
 	return nil
 }
 
-func (us *UserRepositoryImpl) UpdateUser(ctx context.Context, id int64, firstName, lastName, email, phone, role string) error {
-	query := `UPDATE users SET first_name = $1, last_name = $2, email = $3, phone = $4, role = $5 WHERE id = $6`
+// UpdateRole Меняет роль пользователя
+func (us *UserRepositoryImpl) UpdateRole(ctx context.Context, id int64, role string) error {
+	query := `UPDATE users SET role = $1 WHERE id = $2`
+	args := []interface{}{role, id}
+	query += tenant.And(ctx, "tenant_id", &args)
 
-	result, err := us.db.Exec(ctx, query, firstName, lastName, email, phone, role, id)
+	result, err := us.db.Exec(ctx, query, args...)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrUserNotFound
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return ctxErr
 		}
-		dbErr := database.PsqlErrorHandler(err)
-		us.log.Error("Failed to update user in db", slog.String("error", err.Error()))
-		return dbErr
+		us.log.Error("Failed to update user role in db", slog.String("error", err.Error()))
+		return database.PsqlErrorHandler(err)
 	}
 	if result.RowsAffected() == 0 {
 		return ErrUserNotFound
 	}
-	us.log.Debug("User updated successfully", "id", id)
+	us.log.Debug("User role updated successfully", "id", id, "role", role)
 	return nil
 }
 
-func (us *UserRepositoryImpl) DeleteUser(ctx context.Context, id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
-	result, err := us.db.Exec(ctx, query, id)
+// PurgeUser Окончательно удаляет пользователя из БД
+//
+// Удалить можно только пользователя в статусе deleted, для остальных возвращается ErrUserNotDeleted.
+// Пока у пользователя есть действующие бронирования (pending, confirmed, checked_in), возвращается ErrUserHasBookings:
+// их нужно отменить, например политикой cancel при удалении. Остальные бронирования пользователя удаляются
+// вместе с ним в одной транзакции, а созданные им бронирования других пользователей записываются на их владельцев
+func (us *UserRepositoryImpl) PurgeUser(ctx context.Context, id int64) error {
+	tx, err := us.db.Begin(ctx)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrUserNotFound
+		us.log.Error("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Строка пользователя блокируется, что б параллельно ему не создали новое бронирование
+	var status string
+	args := []interface{}{id}
+	query := `SELECT status FROM users WHERE id = $1` + tenant.And(ctx, "tenant_id", &args) + ` FOR UPDATE`
+	err = tx.QueryRow(ctx, query, args...).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return us.purgeError(ctx, err)
+	}
+	if status != UserStatusDeleted {
+		return ErrUserNotDeleted
+	}
+
+	var hasBookings bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM bookings WHERE user_id = $1 AND status IN ('pending', 'confirmed', 'checked_in'))`, id).Scan(&hasBookings)
+	if err != nil {
+		return us.purgeError(ctx, err)
+	}
+	if hasBookings {
+		return ErrUserHasBookings
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE bookings SET created_by = user_id WHERE created_by = $1 AND user_id <> $1`, id); err != nil {
+		return us.purgeError(ctx, err)
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM bookings WHERE user_id = $1`, id); err != nil {
+		return us.purgeError(ctx, err)
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return us.purgeError(ctx, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		us.log.Error("Failed to commit user purge", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	us.log.Debug("User purged successfully", "id", id)
+	return nil
+}
+
+func (us *UserRepositoryImpl) purgeError(ctx context.Context, err error) error {
+	if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+		return ctxErr
+	}
+	us.log.Error("Failed to purge user in db", slog.String("error", err.Error()))
+	return database.PsqlErrorHandler(err)
+}
+
+// UpdatePassword Сохраняет новый хеш пароля пользователя
+func (us *UserRepositoryImpl) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	args := []interface{}{passwordHash, id}
+	query += tenant.And(ctx, "tenant_id", &args)
+	result, err := us.db.Exec(ctx, query, args...)
+	if err != nil {
+		if ctxErr := database.DbCtxError(ctx, err, us.log); ctxErr != nil {
+			return ctxErr
 		}
-		dbErr := database.PsqlErrorHandler(err)
-		us.log.Error("Failed to delete user in db", slog.String("error", err.Error()))
-		return dbErr
+		us.log.Error("Failed to update user password in db", slog.String("error", err.Error()))
+		return database.PsqlErrorHandler(err)
 	}
 	if result.RowsAffected() == 0 {
 		return ErrUserNotFound
 	}
-	us.log.Debug("User deleted successfully", "id", id)
+	us.log.Debug("User password updated successfully", "id", id)
 	return nil
 }